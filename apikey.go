@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/datastore"
+)
+
+const apiKeyPrefix = "tx"
+const apiKeyTokenLifetime = 15 * time.Minute
+const maxAPIKeyLifetime = 365 * 24 * time.Hour
+
+// Scopes users may give their API keys. Keys carry a subset of them, scopes removed later are not issued anymore.
+var apiKeyScopes = []string{}
+
+// APIKey is a long-lived credential a user can exchange for short-lived tokens.
+// ID is the exact ID of the owning user, which tells it apart from users stored before IDs were
+// canonicalized whose IDs only differ by case or width.
+// The key itself is only returned on creation. It has the form tx_<Prefix>_<secret>
+// and is stored as a hash which is looked up through the Prefix.
+type APIKey struct {
+	ID      string
+	Name    string `datastore:",noindex"`
+	Prefix  string
+	Hash    string         `datastore:",noindex"`
+	Scope   string         `datastore:",noindex"`
+	Iat     time.Time      `datastore:",noindex"`
+	Exp     time.Time      `datastore:",noindex"`
+	Revoked bool           `datastore:",noindex"`
+	key     *datastore.Key `datastore:"__key__"`
+}
+
+func (k *APIKey) setKey(key *datastore.Key) {
+	k.key = key
+}
+
+func (k *APIKey) isActive() bool {
+	return !k.Revoked && k.Exp.After(now())
+}
+
+// splitAPIKey returns the lookup prefix of a key in the form tx_<Prefix>_<secret>.
+func splitAPIKey(key string) (string, error) {
+	parts := strings.SplitN(key, "_", 3)
+
+	if len(parts) != 3 || parts[0] != apiKeyPrefix || parts[1] == "" || parts[2] == "" {
+		return "", errors.New("Malformed API key")
+	}
+
+	return parts[1], nil
+}
+
+// createAPIKey stores a new named key for the user which expires after lifetime.
+// Returns the key which can not be recovered later.
+func createAPIKey(ctx context.Context, id, name, scope string, lifetime time.Duration) (string, *APIKey, error) {
+	if name == "" {
+		return "", nil, errors.New("Empty name")
+	}
+
+	if lifetime <= 0 || lifetime > maxAPIKeyLifetime {
+		return "", nil, fmt.Errorf("Lifetime must be positive and at most %v", maxAPIKeyLifetime)
+	}
+
+	if err := checkUserScope(scope); err != nil {
+		return "", nil, err
+	}
+
+	for _, s := range strings.Fields(scope) {
+		if !hasScope(strings.Join(apiKeyScopes, " "), s) {
+			return "", nil, fmt.Errorf("Scope '%v' is not allowed for API keys", s)
+		}
+	}
+
+	ud, err := readComplete(ctx, id)
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	prefix := make([]byte, 6)
+
+	if _, err := randRead(prefix); err != nil {
+		return "", nil, err
+	}
+
+	secret, err := randomToken()
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	apiKey := &APIKey{
+		ID:     ud.ID,
+		Name:   name,
+		Prefix: hex.EncodeToString(prefix),
+		Scope:  strings.Join(strings.Fields(scope), " "),
+		Iat:    now(),
+	}
+
+	apiKey.Exp = apiKey.Iat.Add(lifetime)
+	key := strings.Join([]string{apiKeyPrefix, apiKey.Prefix, secret}, "_")
+	apiKey.Hash = hashToken(key)
+
+	if err := writeAPIKeyToDB(ctx, apiKey); err != nil {
+		return "", nil, err
+	}
+
+	return key, apiKey, nil
+}
+
+// listAPIKeys returns the keys of the user with exactly the id which are neither revoked nor expired.
+func listAPIKeys(ctx context.Context, id string) ([]*APIKey, error) {
+	if id == "" {
+		return nil, errors.New("empty id")
+	}
+
+	dst := []*APIKey{}
+
+	if err := getEntities(ctx, newQuery("APIKEY").Filter("ID =", id), &dst); err != nil {
+		return nil, err
+	}
+
+	active := []*APIKey{}
+
+	for _, k := range dst {
+		if k.isActive() {
+			active = append(active, k)
+		}
+	}
+
+	return active, nil
+}
+
+// revokeAPIKey revokes the key with the given prefix of the user with exactly the id.
+func revokeAPIKey(ctx context.Context, id, prefix string) error {
+	apiKey, err := readAPIKey(ctx, prefix)
+
+	if err != nil || id == "" || apiKey.ID != id {
+		return errors.New("Unknown API key")
+	}
+
+	apiKey.Revoked = true
+
+	return writeAPIKeyToDB(ctx, apiKey)
+}
+
+// exchangeAPIKey signs short-lived Claims with the key's scopes which are still apiKeyScopes.
+// The token never outlives the key.
+func exchangeAPIKey(ctx context.Context, key string) (string, error) {
+	prefix, err := splitAPIKey(key)
+
+	if err != nil {
+		return "", err
+	}
+
+	apiKey, err := readAPIKey(ctx, prefix)
+
+	if err != nil || subtle.ConstantTimeCompare([]byte(apiKey.Hash), []byte(hashToken(key))) != 1 {
+		return "", errors.New("Invalid API key")
+	}
+
+	if !apiKey.isActive() {
+		return "", errors.New("API key is revoked or expired")
+	}
+
+	ud, err := readExactUser(ctx, apiKey.ID)
+
+	if err != nil {
+		return "", err
+	}
+
+	claims := NewClaims(ud.ID)
+	claims.Exp = claims.Iat.Add(apiKeyTokenLifetime)
+	claims.Aud = accessTokenAudience
+	claims.Scope = intersectScope(apiKey.Scope, apiKeyScopes)
+
+	if apiKey.Exp.Before(claims.Exp) {
+		claims.Exp = apiKey.Exp
+	}
+
+	return signClaims(ctx, claims)
+}
+
+func writeAPIKeyToDB(ctx context.Context, k *APIKey) error {
+	if k == nil {
+		return nil
+	}
+
+	dk, err := putEntity(ctx, "APIKEY", k.key, k)
+
+	if err != nil {
+		return err
+	}
+
+	k.key = dk
+
+	return nil
+}
+
+func readAPIKey(ctx context.Context, prefix string) (*APIKey, error) {
+	if prefix == "" {
+		return nil, errors.New("empty prefix")
+	}
+
+	query := newQuery("APIKEY").Filter("Prefix =", prefix)
+	dst := []*APIKey{}
+
+	if err := getEntities(ctx, query, &dst); err != nil {
+		return nil, err
+	}
+
+	if err := singleResult(len(dst), query); err != nil {
+		return nil, err
+	}
+
+	return dst[0], nil
+}
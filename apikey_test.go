@@ -0,0 +1,167 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCreateAPIKey(T *testing.T) {
+	store := injectOAuthStore()
+	apiKeyScopes = []string{"SomeScope", "OtherScope"}
+	defer func() { apiKeyScopes = []string{} }()
+
+	key, apiKey, err := createAPIKey(testctx, "SomeID", "SomeCLI", "SomeScope", time.Hour)
+	prefix, splitErr := splitAPIKey(key)
+
+	expectations := map[string]bool{
+		"Create without error": err == nil && splitErr == nil,
+		"Return tx_ key":       strings.HasPrefix(key, "tx_"+apiKey.Prefix+"_"),
+		"Lookup by prefix":     prefix == apiKey.Prefix && len(prefix) == 12,
+		"Store only hash":      apiKey.Hash == hashToken(key) && !strings.Contains(apiKey.Hash, key),
+		"Store key":            store.entities[len(store.entities)-1] == apiKey,
+		"Set owner and name":   apiKey.ID == "SomeID" && apiKey.Name == "SomeCLI" && apiKey.Scope == "SomeScope",
+		"Set expiry":           apiKey.Exp == testtime.Add(time.Hour),
+	}
+
+	failures := map[string]func() error{
+		"Empty name":  func() error { _, _, err := createAPIKey(testctx, "SomeID", "", "", time.Hour); return err },
+		"No lifetime": func() error { _, _, err := createAPIKey(testctx, "SomeID", "SomeCLI", "", 0); return err },
+		"Too long": func() error {
+			_, _, err := createAPIKey(testctx, "SomeID", "SomeCLI", "", 2*maxAPIKeyLifetime)
+			return err
+		},
+		"Unlisted scope": func() error {
+			_, _, err := createAPIKey(testctx, "SomeID", "SomeCLI", "SomeScope ThirdScope", time.Hour)
+			return err
+		},
+		"Reserved scope": func() error {
+			_, _, err := createAPIKey(testctx, "SomeID", "SomeCLI", "SomeScope users:import", time.Hour)
+			return err
+		},
+		"Unknown user": func() error {
+			_, _, err := createAPIKey(testctx, "SomeUnknownID", "SomeCLI", "", time.Hour)
+			return err
+		},
+	}
+
+	for name, create := range failures {
+		expectations["Reject "+name] = create() != nil
+	}
+
+	CheckExpectations(expectations, T)
+}
+
+func TestSplitAPIKey(T *testing.T) {
+	if prefix, err := splitAPIKey("tx_0123_Some_Secret"); prefix != "0123" || err != nil {
+		T.Errorf("splitAPIKey failed! Expected '0123' got '%v', '%v'", prefix, err)
+	}
+
+	for _, key := range []string{"", "tx_0123", "tx__Secret", "xx_0123_Secret", "tx_0123_"} {
+		if _, err := splitAPIKey(key); err == nil || err.Error() != "Malformed API key" {
+			T.Errorf("splitAPIKey failed for '%v'! Expected 'Malformed API key' got '%v'", key, err)
+		}
+	}
+}
+
+func TestListAPIKeys(T *testing.T) {
+	injectOAuthStore()
+	_, first, _ := createAPIKey(testctx, "SomeID", "First", "", time.Hour)
+	_, revoked, _ := createAPIKey(testctx, "SomeID", "Revoked", "", time.Hour)
+	_, expired, _ := createAPIKey(testctx, "SomeID", "Expired", "", time.Hour)
+	revokeAPIKey(testctx, "SomeID", revoked.Prefix)
+	expired.Exp = testtime
+
+	keys, err := listAPIKeys(testctx, "SomeID")
+
+	if err != nil || len(keys) != 1 || keys[0] != first {
+		T.Errorf("listAPIKeys failed! Expected '[%+v]' got '%+v', '%v'", first, keys, err)
+	}
+
+	if _, err := listAPIKeys(testctx, ""); err == nil || err.Error() != "empty id" {
+		T.Errorf("listAPIKeys failed! Expected 'empty id' got '%v'", err)
+	}
+}
+
+func TestRevokeAPIKey(T *testing.T) {
+	store := injectOAuthStore()
+	key, apiKey, _ := createAPIKey(testctx, "SomeID", "SomeCLI", "", time.Hour)
+
+	expectations := map[string]bool{
+		"Reject foreign key": revokeAPIKey(testctx, "SomeOtherID", apiKey.Prefix) != nil && !apiKey.Revoked,
+		"Reject unknown key": revokeAPIKey(testctx, "SomeID", "SomeUnknownPrefix") != nil,
+		"Revoke own key":     revokeAPIKey(testctx, "SomeID", apiKey.Prefix) == nil && apiKey.Revoked,
+	}
+
+	_, err := exchangeAPIKey(testctx, key)
+	stored, readErr := readAPIKey(testctx, apiKey.Prefix)
+	expectations["Reject revoked key"] = err != nil && err.Error() == "API key is revoked or expired"
+	expectations["Update the stored key"] = store.count("APIKEY") == 1 && readErr == nil && stored.Revoked
+
+	CheckExpectations(expectations, T)
+}
+
+func TestExchangeAPIKey(T *testing.T) {
+	injectOAuthStore()
+	apiKeyScopes = []string{"SomeScope", "OtherScope"}
+	defer func() { apiKeyScopes = []string{} }()
+	key, _, _ := createAPIKey(testctx, "SomeID", "SomeCLI", "SomeScope", time.Hour)
+	removedKey, _, _ := createAPIKey(testctx, "SomeID", "RemovedCLI", "SomeScope OtherScope", time.Hour)
+	shortKey, _, _ := createAPIKey(testctx, "SomeID", "SomeShortCLI", "", time.Minute)
+
+	signed, err := exchangeAPIKey(testctx, key)
+	_, claims, parseErr := parse(signed)
+
+	expectations := map[string]bool{
+		"Exchange without error": err == nil && parseErr == nil,
+		"Sign user token":        claims != nil && claims.ID == "SomeID" && !claims.IsClient(),
+		"Set key scope":          claims != nil && claims.Scope == "SomeScope",
+		"Issue short-lived":      claims != nil && claims.Exp == testtime.Add(apiKeyTokenLifetime),
+	}
+
+	apiKeyScopes = []string{"SomeScope"}
+	signed, _ = exchangeAPIKey(testctx, removedKey)
+	_, claims, _ = parse(signed)
+	expectations["Drop removed scopes"] = claims != nil && claims.Scope == "SomeScope"
+
+	signed, _ = exchangeAPIKey(testctx, shortKey)
+	_, claims, _ = parse(signed)
+	expectations["Never outlive key"] = claims != nil && claims.Exp == testtime.Add(time.Minute)
+
+	prefix, _ := splitAPIKey(key)
+	_, err = exchangeAPIKey(testctx, "tx_"+prefix+"_SomeWrongSecret")
+	expectations["Reject wrong secret"] = err != nil && err.Error() == "Invalid API key"
+
+	_, err = exchangeAPIKey(testctx, "SomeMalformedKey")
+	expectations["Reject malformed key"] = err != nil
+
+	now = func() time.Time { return testtime.Add(2 * time.Hour) }
+	_, err = exchangeAPIKey(testctx, key)
+	expectations["Reject expired key"] = err != nil && err.Error() == "API key is revoked or expired"
+	now = func() time.Time { return testtime }
+
+	CheckExpectations(expectations, T)
+}
+
+func TestAPIKeyOwner(T *testing.T) {
+	store := injectOAuthStore()
+	store.add(legacyUser("someid"))
+	someKey, _, someErr := createAPIKey(testctx, "SomeID", "SomeCLI", "", time.Hour)
+	legacyKey, legacyAPIKey, legacyErr := createAPIKey(testctx, "someid", "LegacyCLI", "", time.Hour)
+
+	signed, _ := exchangeAPIKey(testctx, someKey)
+	_, someClaims, _ := parse(signed)
+	signed, _ = exchangeAPIKey(testctx, legacyKey)
+	_, legacyClaims, _ := parse(signed)
+	keys, _ := listAPIKeys(testctx, "SomeID")
+
+	expectations := map[string]bool{
+		"Create keys":            someErr == nil && legacyErr == nil,
+		"Store exact owner":      legacyAPIKey.ID == "someid",
+		"Sign for exact owner":   someClaims != nil && someClaims.ID == "SomeID" && legacyClaims != nil && legacyClaims.ID == "someid",
+		"List keys of the owner": len(keys) == 1 && keys[0].Name == "SomeCLI",
+		"Reject other owner":     revokeAPIKey(testctx, "SomeID", legacyAPIKey.Prefix) != nil,
+	}
+
+	CheckExpectations(expectations, T)
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+const auditSuccess = "success"
+const auditFailure = "failure"
+
+// AuditEvent records the outcome of an authentication related request.
+// It must never carry passwords, secrets or raw tokens. Tokens are identified by their JTI.
+type AuditEvent struct {
+	Time      time.Time `json:"time"`
+	Event     string    `json:"event"`
+	UserID    string    `json:"user_id,omitempty"`
+	ClientIP  string    `json:"client_ip,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	Result    string    `json:"result"`
+	Reason    string    `json:"reason,omitempty"`
+	JTI       string    `json:"jti,omitempty"`
+}
+
+// AuditSink persists AuditEvents.
+type AuditSink interface {
+	Write(ctx context.Context, e *AuditEvent) error
+}
+
+// auditSink receives all AuditEvents. Defaults to JSON lines on stdout.
+var auditSink AuditSink = NewStdoutAuditSink()
+
+// JSONLinesAuditSink writes every AuditEvent as one line of JSON.
+type JSONLinesAuditSink struct {
+	out io.Writer
+	mu  sync.Mutex
+}
+
+// NewStdoutAuditSink creates a JSONLinesAuditSink writing to stdout.
+func NewStdoutAuditSink() *JSONLinesAuditSink {
+	return &JSONLinesAuditSink{out: os.Stdout}
+}
+
+// NewFileAuditSink creates a JSONLinesAuditSink appending to the file at path.
+func NewFileAuditSink(path string) (*JSONLinesAuditSink, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &JSONLinesAuditSink{out: file}, nil
+}
+
+// Write appends the AuditEvent as JSON line.
+func (s *JSONLinesAuditSink) Write(ctx context.Context, e *AuditEvent) error {
+	line, err := json.Marshal(e)
+
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err = s.out.Write(append(line, '\n'))
+
+	return err
+}
+
+// DatastoreAuditSink stores AuditEvents as entities of kind AUDIT.
+type DatastoreAuditSink struct{}
+
+// Write stores the AuditEvent under a new key.
+func (DatastoreAuditSink) Write(ctx context.Context, e *AuditEvent) error {
+	_, err := putEntity(ctx, "AUDIT", nil, e)
+	return err
+}
+
+// audit writes the AuditEvent to the auditSink. Failing writes are logged but do not fail the request.
+func audit(ctx context.Context, e *AuditEvent) {
+	if e.Time.IsZero() {
+		e.Time = now()
+	}
+
+	if err := auditSink.Write(ctx, e); err != nil {
+		log.Printf("Unable to write audit event '%v': %v", e.Event, err)
+	}
+}
+
+// tokenJTI returns the jti of a token without verifying it.
+func tokenJTI(signedString string) string {
+	claims := &Claims{}
+
+	if _, _, err := new(jwt.Parser).ParseUnverified(signedString, claims); err != nil {
+		return ""
+	}
+
+	return claims.Jti
+}
+
+// auditUnaryInterceptor records an AuditEvent for every RPC.
+// The user and token are taken from request and response messages with an ID or SignedString.
+func auditUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	resp, err := handler(ctx, req)
+
+	e := &AuditEvent{Event: info.FullMethod, Result: auditSuccess}
+
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		e.ClientIP = hostOf(p.Addr.String())
+	}
+
+	if md, ok := metadata.FromIncomingContext(ctx); ok && len(md.Get("user-agent")) > 0 {
+		e.UserAgent = md.Get("user-agent")[0]
+	}
+
+	if r, ok := req.(interface{ GetID() string }); ok {
+		e.UserID = r.GetID()
+	}
+
+	for _, message := range []interface{}{req, resp} {
+		if t, ok := message.(interface{ GetSignedString() string }); ok && t.GetSignedString() != "" {
+			claims := &Claims{}
+
+			if _, _, err := new(jwt.Parser).ParseUnverified(t.GetSignedString(), claims); err == nil {
+				e.JTI = claims.Jti
+
+				if e.UserID == "" {
+					e.UserID = claims.ID
+				}
+			}
+		}
+	}
+
+	if err != nil {
+		e.Result = auditFailure
+		e.Reason = status.Code(err).String()
+	}
+
+	audit(ctx, e)
+
+	return resp, err
+}
+
+// auditResponseWriter captures the status of an HTTP response for its AuditEvent.
+type auditResponseWriter struct {
+	http.ResponseWriter
+	event  *AuditEvent
+	status int
+}
+
+func (w *auditResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// auditEventOf returns the AuditEvent of a response written through auditHandler.
+// Handlers use it to add the user, token and failure reason.
+func auditEventOf(w http.ResponseWriter) *AuditEvent {
+	if aw, ok := w.(*auditResponseWriter); ok {
+		return aw.event
+	}
+
+	return &AuditEvent{}
+}
+
+// auditHandler records an AuditEvent for every HTTP request. Status codes from 400 on are failures.
+func auditHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		aw := &auditResponseWriter{
+			ResponseWriter: w,
+			event: &AuditEvent{
+				Event:     r.Method + " " + r.URL.Path,
+				ClientIP:  hostOf(r.RemoteAddr),
+				UserAgent: r.UserAgent(),
+				Result:    auditSuccess,
+			},
+		}
+
+		next.ServeHTTP(aw, r)
+
+		if aw.status >= http.StatusBadRequest {
+			aw.event.Result = auditFailure
+
+			if aw.event.Reason == "" {
+				aw.event.Reason = http.StatusText(aw.status)
+			}
+		}
+
+		audit(r.Context(), aw.event)
+	})
+}
+
+func hostOf(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+
+	if err != nil {
+		return addr
+	}
+
+	return host
+}
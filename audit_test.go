@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// recordingAuditSink keeps written AuditEvents for inspection.
+type recordingAuditSink struct {
+	events []*AuditEvent
+}
+
+func (r *recordingAuditSink) Write(ctx context.Context, e *AuditEvent) error {
+	r.events = append(r.events, e)
+	return nil
+}
+
+func injectRecordingAuditSink() *recordingAuditSink {
+	recorder := &recordingAuditSink{}
+	auditSink = recorder
+	return recorder
+}
+
+// fakeUser and fakeToken mimic the getters of the generated request and response messages.
+type fakeUser struct{ ID, Password string }
+
+func (u *fakeUser) GetID() string { return u.ID }
+
+type fakeToken struct{ SignedString string }
+
+func (t *fakeToken) GetSignedString() string { return t.SignedString }
+
+func TestJSONLinesAuditSink(T *testing.T) {
+	out := &bytes.Buffer{}
+	auditSink = &JSONLinesAuditSink{out: out}
+	defer func() { auditSink = &JSONLinesAuditSink{out: ioutil.Discard} }()
+
+	audit(testctx, &AuditEvent{Event: "First", Result: auditSuccess})
+	audit(testctx, &AuditEvent{Event: "Second", Result: auditFailure, Reason: "SomeReason"})
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	second := AuditEvent{}
+	err := json.Unmarshal([]byte(lines[len(lines)-1]), &second)
+
+	expectations := map[string]bool{
+		"Write one line per event": len(lines) == 2,
+		"Write JSON":               err == nil && second.Event == "Second" && second.Reason == "SomeReason",
+		"Set time":                 second.Time.Equal(testtime),
+	}
+
+	CheckExpectations(expectations, T)
+}
+
+func TestFileAuditSink(T *testing.T) {
+	dir, _ := ioutil.TempDir("", "audit")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.jsonl")
+
+	sink, err := NewFileAuditSink(path)
+
+	if err != nil {
+		T.Fatalf("NewFileAuditSink failed with '%v'", err)
+	}
+
+	sink.Write(testctx, &AuditEvent{Event: "SomeEvent"})
+	content, _ := ioutil.ReadFile(path)
+
+	if !bytes.Contains(content, []byte(`"event":"SomeEvent"`)) {
+		T.Errorf("FileAuditSink failed! Got '%s'", content)
+	}
+}
+
+func TestDatastoreAuditSink(T *testing.T) {
+	store := injectMemoryStore()
+	e := &AuditEvent{Event: "SomeEvent"}
+
+	if err := (DatastoreAuditSink{}).Write(testctx, e); err != nil || len(store.entities) != 1 || store.entities[0] != e {
+		T.Errorf("DatastoreAuditSink failed! Got '%v', '%v'", store.entities, err)
+	}
+}
+
+func TestAuditUnaryInterceptor(T *testing.T) {
+	recorder := injectRecordingAuditSink()
+	defer func() { auditSink = &JSONLinesAuditSink{out: ioutil.Discard} }()
+
+	token, _ := signClaims(testctx, NewClaims("SomeID"))
+	_, claims, _ := parse(token)
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 4711}})
+	ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("user-agent", "SomeAgent"))
+	info := &grpc.UnaryServerInfo{FullMethod: "/AuthService/Login"}
+
+	auditUnaryInterceptor(ctx, &fakeUser{ID: "SomeID", Password: "SomePW"}, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return &fakeToken{SignedString: token}, nil
+	})
+
+	auditUnaryInterceptor(ctx, &fakeUser{ID: "SomeID", Password: "SomePW"}, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, status.Error(codes.Unauthenticated, "Invalid ID or password")
+	})
+
+	auditUnaryInterceptor(context.Background(), &fakeToken{SignedString: token}, &grpc.UnaryServerInfo{FullMethod: "/AuthService/Revoke"}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, errors.New("SomeError")
+	})
+
+	success, failure, revoke := recorder.events[0], recorder.events[1], recorder.events[2]
+	serialized, _ := json.Marshal(recorder.events)
+
+	expectations := map[string]bool{
+		"Record every call":     len(recorder.events) == 3,
+		"Record method":         success.Event == "/AuthService/Login",
+		"Record client":         success.ClientIP == "192.0.2.1" && success.UserAgent == "SomeAgent",
+		"Record issued token":   success.UserID == "SomeID" && success.JTI == claims.Jti && claims.Jti != "",
+		"Record success":        success.Result == auditSuccess && success.Reason == "",
+		"Record failure reason": failure.Result == auditFailure && failure.Reason == "Unauthenticated",
+		"Record passed token":   revoke.UserID == "SomeID" && revoke.JTI == claims.Jti && revoke.Reason == "Unknown",
+		"Never write password":  !bytes.Contains(serialized, []byte("SomePW")),
+		"Never write raw token": !bytes.Contains(serialized, []byte(token)),
+	}
+
+	CheckExpectations(expectations, T)
+}
+
+func TestAuditHandler(T *testing.T) {
+	recorder := injectRecordingAuditSink()
+	defer func() { auditSink = &JSONLinesAuditSink{out: ioutil.Discard} }()
+	injectOAuthStore()
+
+	authorize(authorizeParams("SomeClient"), "SomeID", "SomeOtherPW")
+	failedLogin := recorder.events[len(recorder.events)-1]
+
+	response, _ := decodeTokenResponse(postForm("/token", url.Values{"grant_type": {"client_credentials"}}, func(r *http.Request) {
+		r.SetBasicAuth("SomeService", "SomeServiceSecret")
+		r.Header.Set("User-Agent", "SomeAgent")
+	}))
+	issued := recorder.events[len(recorder.events)-1]
+
+	postForm("/token", url.Values{"grant_type": {"password"}}, func(r *http.Request) { r.SetBasicAuth("SomeService", "SomeServiceSecret") })
+	unsupported := recorder.events[len(recorder.events)-1]
+
+	serialized, _ := json.Marshal(recorder.events)
+
+	expectations := map[string]bool{
+		"Record failed login":   failedLogin.Event == "POST /authorize" && failedLogin.Result == auditFailure && failedLogin.Reason == "invalid_credentials",
+		"Record attempted user": failedLogin.UserID == "SomeID",
+		"Record client IP":      failedLogin.ClientIP == "192.0.2.1",
+		"Record issued token":   issued.Result == auditSuccess && issued.UserID == "SomeService" && issued.JTI == tokenJTI(response.AccessToken) && issued.JTI != "",
+		"Record user agent":     issued.UserAgent == "SomeAgent",
+		"Record OAuth error":    unsupported.Result == auditFailure && unsupported.Reason == "unsupported_grant_type",
+		"Never write password":  !bytes.Contains(serialized, []byte("SomeOtherPW")) && !bytes.Contains(serialized, []byte("SomeServiceSecret")),
+		"Never write raw token": !bytes.Contains(serialized, []byte(response.AccessToken)),
+	}
+
+	CheckExpectations(expectations, T)
+}
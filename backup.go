@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Backups are JSON lines of backupUser. They are written and read through putEntity and getEntities only,
+// so they can be moved between every store connected to put, getAll and deleteKey.
+
+// Number of users read from the store at once while exporting.
+var exportPageSize = 500
+
+// Policies for users of a backup whose ID is already taken in the store.
+const restoreSkip = "skip"
+const restoreOverwrite = "overwrite"
+const restoreFail = "fail"
+
+// backupUser is the UserData in a backup. Sessions and pending single use tokens are not part of it,
+// so restored users have to log in again and request new verification and reset mails.
+type backupUser struct {
+	ID            string               `json:"id"`
+	CanonicalID   string               `json:"canonical_id"`
+	Hash          string               `json:"hash"`
+	HashAlgorithm string               `json:"hash_algorithm,omitempty"`
+	TOTPSecret    []byte               `json:"totp_secret,omitempty"`
+	TOTPConfirmed bool                 `json:"totp_confirmed,omitempty"`
+	RecoveryCodes []string             `json:"recovery_codes,omitempty"`
+	Credentials   []WebAuthnCredential `json:"credentials,omitempty"`
+	Email         string               `json:"email,omitempty"`
+	EmailVerified bool                 `json:"email_verified,omitempty"`
+	Disabled      bool                 `json:"disabled,omitempty"`
+}
+
+func backupOf(ud *UserData) *backupUser {
+	return &backupUser{
+		ID:            ud.ID,
+		CanonicalID:   ud.CanonicalID,
+		Hash:          ud.Hash,
+		HashAlgorithm: ud.HashAlgorithm,
+		TOTPSecret:    ud.TOTPSecret,
+		TOTPConfirmed: ud.TOTPConfirmed,
+		RecoveryCodes: ud.RecoveryCodes,
+		Credentials:   ud.Credentials,
+		Email:         ud.Email,
+		EmailVerified: ud.EmailVerified,
+		Disabled:      ud.Disabled,
+	}
+}
+
+func (b *backupUser) userData() *UserData {
+	return &UserData{
+		ID:            b.ID,
+		CanonicalID:   b.CanonicalID,
+		Hash:          b.Hash,
+		HashAlgorithm: b.HashAlgorithm,
+		TOTPSecret:    b.TOTPSecret,
+		TOTPConfirmed: b.TOTPConfirmed,
+		RecoveryCodes: b.RecoveryCodes,
+		Credentials:   b.Credentials,
+		Email:         b.Email,
+		EmailVerified: b.EmailVerified,
+		Disabled:      b.Disabled,
+	}
+}
+
+// exportUsers writes all users to w and returns their number. Users are read in pages of exportPageSize
+// through cursors like in runMigration, so the store is never read at once and users stored before
+// IDs were canonicalized are exported as well.
+func exportUsers(ctx context.Context, w io.Writer) (int, error) {
+	encoder := json.NewEncoder(w)
+	exported := 0
+	cursor := ""
+
+	for {
+		page := []*UserData{}
+		next, err := getEntityPage(ctx, newQuery(userKind).Limit(exportPageSize), cursor, &page)
+
+		if err != nil {
+			return exported, err
+		}
+
+		for _, ud := range page {
+			if err := encoder.Encode(backupOf(ud)); err != nil {
+				return exported, err
+			}
+
+			exported++
+		}
+
+		if len(page) < exportPageSize {
+			return exported, nil
+		}
+
+		cursor = next
+	}
+}
+
+// restoreReport counts the users of a backup by what happened to them.
+type restoreReport struct {
+	Restored    int
+	Overwritten int
+	Skipped     int
+	DryRun      bool
+}
+
+// restoreUsers stores the users of the backup in r. Users whose ID is taken are handled by the policy:
+// restoreSkip keeps the stored user, restoreOverwrite replaces it and restoreFail stops before the user.
+// Users restored before a failure stay in the store. With dryRun nothing is stored.
+func restoreUsers(ctx context.Context, r io.Reader, policy string, dryRun bool) (*restoreReport, error) {
+	switch policy {
+	case restoreSkip, restoreOverwrite, restoreFail:
+	default:
+		return nil, fmt.Errorf("Unknown conflict policy '%v', expected %v, %v or %v", policy, restoreSkip, restoreOverwrite, restoreFail)
+	}
+
+	report := &restoreReport{DryRun: dryRun}
+	lines := newLineReader(r)
+
+	for number := 1; ; number++ {
+		line, err := lines()
+
+		if err == io.EOF {
+			return report, nil
+		}
+
+		if err != nil {
+			return report, err
+		}
+
+		ud, err := readBackupLine(line)
+
+		if err != nil {
+			return report, fmt.Errorf("Line %v: %v", number, err)
+		}
+
+		stored := []*UserData{}
+
+		if err := getEntities(ctx, newQuery(userKind).Filter("CanonicalID =", ud.CanonicalID), &stored); err != nil {
+			return report, err
+		}
+
+		if len(stored) > 1 {
+			return report, fmt.Errorf("Line %v: ID '%v' is stored %v times", number, ud.ID, len(stored))
+		}
+
+		overwrite := len(stored) == 1
+
+		if overwrite {
+			switch policy {
+			case restoreSkip:
+				report.Skipped++
+				continue
+			case restoreFail:
+				return report, fmt.Errorf("Line %v: ID '%v' is already taken", number, ud.ID)
+			}
+
+			ud.key = stored[0].key
+		}
+
+		if !dryRun {
+			if err := writeToDB(ctx, ud); err != nil {
+				return report, fmt.Errorf("Line %v: %v", number, err)
+			}
+		}
+
+		if overwrite {
+			report.Overwritten++
+		} else {
+			report.Restored++
+		}
+	}
+}
+
+// readBackupLine decodes a backupUser and checks that its IDs match.
+func readBackupLine(line string) (*UserData, error) {
+	decoder := json.NewDecoder(strings.NewReader(line))
+	decoder.DisallowUnknownFields()
+	b := &backupUser{}
+
+	if err := decoder.Decode(b); err != nil {
+		return nil, fmt.Errorf("Malformed backup: %v", err)
+	}
+
+	canonical, err := canonicalID(b.ID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Users stored before IDs were canonicalized
+	if b.CanonicalID == "" {
+		b.CanonicalID = canonical
+	}
+
+	if b.CanonicalID != canonical {
+		return nil, fmt.Errorf("CanonicalID '%v' does not match ID '%v'", b.CanonicalID, b.ID)
+	}
+
+	if b.Hash == "" {
+		return nil, fmt.Errorf("User '%v' has no hash", b.ID)
+	}
+
+	if b.HashAlgorithm != "" {
+		if err := checkForeignHash(b.HashAlgorithm, b.Hash); err != nil {
+			return nil, err
+		}
+	}
+
+	return b.userData(), nil
+}
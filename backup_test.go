@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExportUsers(T *testing.T) {
+	store := injectOAuthStore()
+	exportPageSize = 2
+	defer func() { exportPageSize = 500 }()
+
+	writeToDB(testctx, NewUserData(testctx, "OtherID", "SomePW"))
+
+	// Stored before IDs were canonicalized, writeToDB would backfill the CanonicalID
+	legacy := NewUserData(testctx, "LegacyID", "SomePW")
+	legacy.CanonicalID = ""
+	store.add(legacy)
+
+	writeToDB(testctx, NewUserData(testctx, "ThirdID", "SomePW"))
+
+	some, _ := readUser(testctx, "SomeID")
+	some.Token = "SomeToken"
+	some.ResetHash = "SomeResetHash"
+	some.TOTPSecret = []byte("SomeSecret")
+
+	out := &bytes.Buffer{}
+	exported, err := exportUsers(testctx, out)
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+
+	first := backupUser{}
+	json.Unmarshal([]byte(lines[0]), &first)
+
+	expectations := map[string]bool{
+		"Export all users":   err == nil && exported == 4 && len(lines) == 4,
+		"Export legacy user": strings.Contains(out.String(), `"id":"LegacyID","canonical_id":""`),
+		"Include hashes":     first.Hash != "",
+		"Include secrets":    strings.Contains(out.String(), `"totp_secret"`),
+		"Exclude tokens":     !strings.Contains(out.String(), "SomeToken") && !strings.Contains(out.String(), "SomeResetHash"),
+		"Exclude other kind": !strings.Contains(out.String(), "SomeClient"),
+	}
+
+	CheckExpectations(expectations, T)
+}
+
+func TestRestoreUsers(T *testing.T) {
+	store := injectOAuthStore()
+
+	some, _ := readUser(testctx, "SomeID")
+	otherHash, _ := hashPassword(testctx, []byte("OtherPW"))
+	restoredHash, _ := hashPassword(testctx, []byte("RestoredPW"))
+
+	backup := `{"id":"OtherID","canonical_id":"otherid","hash":"` + string(otherHash) + `","email":"other@example.com","email_verified":true}` + "\n" +
+		`{"id":"SomeID","canonical_id":"someid","hash":"` + string(restoredHash) + `"}` + "\n"
+
+	_, failErr := restoreUsers(testctx, strings.NewReader(backup), restoreFail, false)
+	_, loginErr := login(testctx, "OtherID", "OtherPW")
+	other, _ := readUser(testctx, "OtherID")
+
+	skipped, skipErr := restoreUsers(testctx, strings.NewReader(backup), restoreSkip, false)
+	_, keptErr := login(testctx, "SomeID", "SomePW")
+
+	dryRun, dryRunErr := restoreUsers(testctx, strings.NewReader(backup), restoreOverwrite, true)
+	_, notOverwrittenErr := login(testctx, "SomeID", "SomePW")
+
+	overwritten, overwriteErr := restoreUsers(testctx, strings.NewReader(backup), restoreOverwrite, false)
+	_, overwrittenErr := login(testctx, "SomeID", "RestoredPW")
+	restored, _ := readUser(testctx, "SomeID")
+
+	_, policyErr := restoreUsers(testctx, strings.NewReader(backup), "merge", false)
+	_, mismatchErr := restoreUsers(testctx, strings.NewReader(`{"id":"NewID","canonical_id":"otherid","hash":"SomeHash"}`), restoreSkip, false)
+	_, tokenErr := restoreUsers(testctx, strings.NewReader(`{"id":"NewID","hash":"SomeHash","token":"SomeToken"}`), restoreSkip, false)
+
+	expectations := map[string]bool{
+		"Fail on conflict":   failErr != nil && strings.Contains(failErr.Error(), "Line 2"),
+		"Restore users":      loginErr == nil && other.Email == "other@example.com" && other.EmailVerified,
+		"Skip conflicts":     skipErr == nil && skipped.Skipped == 2 && skipped.Restored == 0 && keptErr == nil,
+		"Dry run":            dryRunErr == nil && dryRun.Overwritten == 2 && notOverwrittenErr == nil,
+		"Overwrite":          overwriteErr == nil && overwritten.Overwritten == 2 && overwrittenErr == nil,
+		"Keep entity":        restored != nil && restored.key.Equal(some.key) && store.count("USER") == 2,
+		"Reject policy":      policyErr != nil,
+		"Check CanonicalID":  mismatchErr != nil,
+		"Reject token field": tokenErr != nil,
+	}
+
+	CheckExpectations(expectations, T)
+}
+
+func TestBackupCommands(T *testing.T) {
+	defer injectCLI()()
+	injectOAuthStore()
+
+	dir, _ := ioutil.TempDir("", "backup")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "users.jsonl")
+
+	exported, exportErr := runCLIWith("", "user", "export", "-out", path)
+	_, existsErr := runCLIWith("", "user", "export", "-out", path)
+	info, _ := os.Stat(path)
+	backup, _ := ioutil.ReadFile(path)
+
+	injectOAuthStore()
+	some, _ := readUser(testctx, "SomeID")
+	deleteEntity(testctx, some.key)
+
+	_, conflictErr := runCLIWith(string(backup)+string(backup), "user", "restore", "-")
+	_, loginErr := login(testctx, "SomeID", "SomePW")
+	restored, restoreErr := runCLIWith("", "user", "restore", "-conflict", "skip", path)
+
+	expectations := map[string]bool{
+		"Export to file":       exportErr == nil && strings.Contains(exported, "Exported 1 users"),
+		"Keep existing file":   existsErr != nil,
+		"Restrict permissions": info != nil && info.Mode().Perm() == 0600,
+		"Restore from stdin":   conflictErr != nil && loginErr == nil,
+		"Report restore":       restoreErr == nil && strings.Contains(restored, "skipped 1"),
+	}
+
+	CheckExpectations(expectations, T)
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Browser sessions keep the signed token in an HttpOnly cookie, so it is never exposed to scripts.
+// The __Host- prefix binds the cookies to this host, HTTPS and the root path.
+const sessionCookie = "__Host-session"
+const csrfCookie = "__Host-csrf"
+const csrfHeader = "X-CSRF-Token"
+
+// browserSessions enables the /session endpoints, which require the csrfKey.
+var browserSessions bool
+
+// Browser sessions renew their token once it is older than sessionRenewAfter.
+var sessionRenewAfter = 12 * time.Hour
+var sessionSameSite = http.SameSiteLaxMode
+
+// csrfKey is the HMAC key of the CSRF tokens, so they can not be derived from a leaked session token alone.
+var csrfKey []byte
+
+type browserSessionKey struct{}
+
+// csrfToken derives the CSRF token of a session. Scripts read it from the csrfCookie and
+// send it back in the csrfHeader, which cross-site requests can not do.
+func csrfToken(session string) string {
+	mac := hmac.New(sha256.New, csrfKey)
+	mac.Write([]byte(session))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// trustedOrigin reports whether a request without session comes from the issuerURL or one of the
+// corsOrigins. Browsers send Origin with every POST, older ones at least Sec-Fetch-Site.
+// Requests with neither do not come from a browser and can not be forged by another site.
+func trustedOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+
+	if origin == "" {
+		site := r.Header.Get("Sec-Fetch-Site")
+		return site == "" || site == "same-origin" || site == "none"
+	}
+
+	if issuer, err := url.Parse(issuerURL); err == nil && origin == issuer.Scheme+"://"+issuer.Host {
+		return true
+	}
+
+	for _, allowed := range corsOrigins {
+		if allowed == origin {
+			return true
+		}
+	}
+
+	return false
+}
+
+func validCSRF(r *http.Request, session string) bool {
+	expected := csrfToken(session)
+	return subtle.ConstantTimeCompare([]byte(r.Header.Get(csrfHeader)), []byte(expected)) == 1
+}
+
+func safeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// setSessionCookies stores the token and its CSRF token in cookies expiring with the token.
+func setSessionCookies(w http.ResponseWriter, token string) {
+	_, claims, err := parse(token)
+
+	if err != nil {
+		return
+	}
+
+	maxAge := int(claims.Exp.Sub(now()).Seconds())
+
+	if maxAge <= 0 {
+		maxAge = -1
+	}
+
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Value: token, Path: "/", MaxAge: maxAge, Secure: true, HttpOnly: true, SameSite: sessionSameSite})
+	http.SetCookie(w, &http.Cookie{Name: csrfCookie, Value: csrfToken(token), Path: "/", MaxAge: maxAge, Secure: true, SameSite: http.SameSiteStrictMode})
+}
+
+func clearSessionCookies(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Path: "/", MaxAge: -1, Secure: true, HttpOnly: true, SameSite: sessionSameSite})
+	http.SetCookie(w, &http.Cookie{Name: csrfCookie, Path: "/", MaxAge: -1, Secure: true, SameSite: http.SameSiteStrictMode})
+}
+
+// browserSession authenticates requests by the session cookie and renews the token sliding-window style.
+// Requests with unsafe methods additionally need the session's CSRF token in the csrfHeader.
+func browserSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		cookie, err := r.Cookie(sessionCookie)
+
+		if err != nil || cookie.Value == "" {
+			writeGatewayError(w, status.Error(codes.Unauthenticated, "Missing session"))
+			return
+		}
+
+		token := cookie.Value
+		auditEventOf(w).JTI = tokenJTI(token)
+
+		if !safeMethod(r.Method) && !validCSRF(r, token) {
+			writeGatewayError(w, status.Error(codes.PermissionDenied, "Invalid CSRF token"))
+			return
+		}
+
+		claims, err := validateSession(ctx, token)
+
+		if err != nil {
+			clearSessionCookies(w)
+			writeGatewayError(w, err)
+			return
+		}
+
+		auditEventOf(w).UserID = claims.ID
+
+		if now().After(claims.Iat.Add(sessionRenewAfter)) {
+			if renewed, err := renew(ctx, token); err == nil {
+				token = renewed
+				setSessionCookies(w, token)
+			}
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(ctx, browserSessionKey{}, token)))
+	})
+}
+
+// sessionToken returns the current token of a request authenticated by browserSession.
+func sessionToken(ctx context.Context) string {
+	token, _ := ctx.Value(browserSessionKey{}).(string)
+	return token
+}
+
+// handleSessionLogin checks ID, Password and, if enabled, the second factor Code of a form
+// and starts a browser session. Forms posted by other sites are rejected, so they can not log
+// the browser into the attacker's account.
+func handleSessionLogin(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !trustedOrigin(r) {
+		writeGatewayError(w, status.Error(codes.PermissionDenied, "Untrusted origin"))
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		writeGatewayError(w, status.Error(codes.InvalidArgument, "Malformed form"))
+		return
+	}
+
+	auditEventOf(w).UserID = r.PostForm.Get("ID")
+	token, err := login(ctx, r.PostForm.Get("ID"), r.PostForm.Get("Password"))
+
+	if err == nil {
+		if _, _, challengeErr := parseTyped(token, mfaRequired); challengeErr == nil {
+			if token, err = verifyMFA(ctx, token, r.PostForm.Get("Code")); err != nil {
+				err = statusOf(err, codes.Unauthenticated, "Invalid authentication code")
+			}
+		}
+	}
+
+	if err != nil {
+		writeGatewayError(w, err)
+		return
+	}
+
+	auditEventOf(w).JTI = tokenJTI(token)
+	setSessionCookies(w, token)
+	writeJSON(w, http.StatusOK, map[string]string{"ID": r.PostForm.Get("ID")})
+}
+
+// handleSession returns the user of the browser session.
+func handleSession(w http.ResponseWriter, r *http.Request) {
+	_, claims, err := parse(sessionToken(r.Context()))
+
+	if err != nil {
+		writeGatewayError(w, status.Error(codes.Unauthenticated, "Invalid session"))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"ID": claims.ID})
+}
+
+// handleSessionLogout revokes the token of the browser session and clears its cookies.
+func handleSessionLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := revoke(r.Context(), sessionToken(r.Context())); err != nil {
+		writeGatewayError(w, err)
+		return
+	}
+
+	clearSessionCookies(w)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// cookiesOf returns the cookies set by the response by name.
+func cookiesOf(recorder *httptest.ResponseRecorder) map[string]*http.Cookie {
+	cookies := map[string]*http.Cookie{}
+
+	for _, cookie := range recorder.Result().Cookies() {
+		cookies[cookie.Name] = cookie
+	}
+
+	return cookies
+}
+
+// withSession adds the session cookie and optionally the CSRF header to a request.
+func withSession(session string, csrf string) func(*http.Request) {
+	return func(r *http.Request) {
+		r.AddCookie(&http.Cookie{Name: sessionCookie, Value: session})
+
+		if csrf != "" {
+			r.Header.Set(csrfHeader, csrf)
+		}
+	}
+}
+
+func getWithSession(path, session string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodGet, path, nil)
+	withSession(session, "")(request)
+
+	recorder := httptest.NewRecorder()
+	oauthHandler().ServeHTTP(recorder, request)
+
+	return recorder
+}
+
+func TestSessionLogin(T *testing.T) {
+	injectOAuthStore()
+
+	response := postForm("/session/login", url.Values{"ID": {"SomeID"}, "Password": {"SomePW"}})
+	cookies := cookiesOf(response)
+	session, csrf := cookies[sessionCookie], cookies[csrfCookie]
+	ud, _ := readComplete(testctx, "SomeID")
+
+	expectations := map[string]bool{
+		"Return 200":                response.Code == http.StatusOK,
+		"Set session cookie":        session != nil && session.Value == ud.Token,
+		"Hide session from scripts": session != nil && session.HttpOnly && session.Secure && session.SameSite == http.SameSiteLaxMode && session.Path == "/",
+		"Expire with token":         session != nil && session.MaxAge == int((24*time.Hour).Seconds()),
+		"Set CSRF cookie":           csrf != nil && !csrf.HttpOnly && csrf.Secure && csrf.Value == csrfToken(ud.Token),
+		"Reject wrong password":     postForm("/session/login", url.Values{"ID": {"SomeID"}, "Password": {"OtherPW"}}).Code == http.StatusUnauthorized,
+	}
+
+	current := getWithSession("/session", session.Value)
+	expectations["Authenticate by cookie"] = current.Code == http.StatusOK && current.Body.String() == "{\"ID\":\"SomeID\"}\n"
+	expectations["Reject missing cookie"] = get("/session", "").Code == http.StatusUnauthorized
+
+	browserSessions = false
+	disabled := postForm("/session/login", url.Values{"ID": {"SomeID"}, "Password": {"SomePW"}})
+	browserSessions = true
+	expectations["Serve only when enabled"] = disabled.Code == http.StatusNotFound && len(cookiesOf(disabled)) == 0
+
+	CheckExpectations(expectations, T)
+}
+
+func TestSessionLoginWithSecondFactor(T *testing.T) {
+	ud, secret, _ := enrolledUserData(T)
+	hash, _ := hashPassword(testctx, []byte("SomePW"))
+	ud.Hash = string(hash)
+
+	withoutCode := postForm("/session/login", url.Values{"ID": {"SomeID"}, "Password": {"SomePW"}})
+	withCode := postForm("/session/login", url.Values{"ID": {"SomeID"}, "Password": {"SomePW"}, "Code": {nextTOTP(secret)}})
+
+	expectations := map[string]bool{
+		"Require code":            withoutCode.Code == http.StatusUnauthorized && cookiesOf(withoutCode)[sessionCookie] == nil,
+		"Start session with code": withCode.Code == http.StatusOK && cookiesOf(withCode)[sessionCookie].Value == ud.Token,
+	}
+
+	CheckExpectations(expectations, T)
+}
+
+func TestSessionCSRF(T *testing.T) {
+	injectOAuthStore()
+	session := cookiesOf(postForm("/session/login", url.Values{"ID": {"SomeID"}, "Password": {"SomePW"}}))[sessionCookie].Value
+
+	missing := postForm("/session/logout", url.Values{}, withSession(session, ""))
+	forged := postForm("/session/logout", url.Values{}, withSession(session, csrfToken("OtherSession")))
+	loggedOut := postForm("/session/logout", url.Values{}, withSession(session, csrfToken(session)))
+	ud, _ := readComplete(testctx, "SomeID")
+
+	expectations := map[string]bool{
+		"Reject missing CSRF token": missing.Code == http.StatusForbidden,
+		"Reject forged CSRF token":  forged.Code == http.StatusForbidden,
+		"Log out":                   loggedOut.Code == http.StatusNoContent && ud.Token == "",
+		"Clear cookies":             cookiesOf(loggedOut)[sessionCookie] != nil && cookiesOf(loggedOut)[sessionCookie].MaxAge < 0,
+		"Reject revoked session":    getWithSession("/session", session).Code == http.StatusUnauthorized,
+	}
+
+	CheckExpectations(expectations, T)
+}
+
+func TestSessionLoginCSRF(T *testing.T) {
+	injectOAuthStore()
+	form := url.Values{"ID": {"SomeID"}, "Password": {"SomePW"}}
+	header := func(name, value string) func(*http.Request) {
+		return func(r *http.Request) { r.Header.Set(name, value) }
+	}
+
+	defer func(origins []string) { corsOrigins = origins }(corsOrigins)
+	corsOrigins = []string{"https://app.example.com", "*"}
+
+	crossSite := postForm("/session/login", form, header("Origin", "https://evil.example.com"))
+	fetchMetadata := postForm("/session/login", form, header("Sec-Fetch-Site", "cross-site"))
+
+	expectations := map[string]bool{
+		"Reject other origin":             crossSite.Code == http.StatusForbidden && cookiesOf(crossSite)[sessionCookie] == nil,
+		"Reject cross-site fetch":         fetchMetadata.Code == http.StatusForbidden,
+		"Accept issuer origin":            postForm("/session/login", form, header("Origin", "https://localhost")).Code == http.StatusOK,
+		"Accept CORS origin":              postForm("/session/login", form, header("Origin", "https://app.example.com")).Code == http.StatusOK,
+		"Accept same-origin fetch":        postForm("/session/login", form, header("Sec-Fetch-Site", "same-origin")).Code == http.StatusOK,
+		"Accept requests of non-browsers": postForm("/session/login", form).Code == http.StatusOK,
+	}
+
+	key := csrfKey
+	token := csrfToken("SomeSession")
+	csrfKey = []byte("0123456789abcdef0123456789abcdef")
+	expectations["Derive CSRF token with key"] = token != csrfToken("SomeSession") && token != hashToken("csrf:SomeSession")
+	csrfKey = key
+
+	CheckExpectations(expectations, T)
+}
+
+func TestSessionRenewal(T *testing.T) {
+	store := injectOAuthStore()
+	session := cookiesOf(postForm("/session/login", url.Values{"ID": {"SomeID"}, "Password": {"SomePW"}}))[sessionCookie].Value
+
+	fresh := getWithSession("/session", session)
+
+	now = func() time.Time { return testtime.Add(sessionRenewAfter + time.Minute) }
+	defer func() { now = func() time.Time { return testtime } }()
+
+	renewed := getWithSession("/session", session)
+	cookies := cookiesOf(renewed)
+	ud, _ := readComplete(testctx, "SomeID")
+
+	expectations := map[string]bool{
+		"Keep fresh token":        fresh.Code == http.StatusOK && cookiesOf(fresh)[sessionCookie] == nil,
+		"Renew old token":         renewed.Code == http.StatusOK && cookies[sessionCookie] != nil && cookies[sessionCookie].Value != session,
+		"Store renewed token":     cookies[sessionCookie] != nil && ud.Token == cookies[sessionCookie].Value,
+		"Rotate CSRF token":       cookies[csrfCookie] != nil && cookies[csrfCookie].Value == csrfToken(ud.Token),
+		"Reject replaced session": getWithSession("/session", session).Code == http.StatusUnauthorized,
+		"Update the stored user":  store.count("USER") == 1,
+	}
+
+	CheckExpectations(expectations, T)
+}
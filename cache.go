@@ -0,0 +1,303 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Cache stores values for a limited time. Implementations are safe for concurrent use.
+type Cache interface {
+	// Get returns the value of key and whether it was found.
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, key string) error
+}
+
+// userCache is read through by readCachedUser and invalidated by writeToDB. Nil disables caching.
+var userCache Cache
+
+// Time a cached user is used before it is read again. Instances whose cache was not invalidated,
+// e.g. other instances with an LRUCache, see revocations and disabled users after userCacheTTL at the latest.
+var userCacheTTL = 30 * time.Second
+
+var cacheRequests = metrics.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "authservice",
+	Name:      "cache_requests_total",
+	Help:      "User cache lookups by result.",
+}, []string{"result"})
+
+// cachedUser is the part of the UserData needed to check tokens. Only the hashToken of the token is cached,
+// so a shared cache does not hold valid tokens.
+type cachedUser struct {
+	ID        string
+	TokenHash string
+	Disabled  bool
+}
+
+func cachedUserOf(ud *UserData) *cachedUser {
+	cached := &cachedUser{ID: ud.ID, Disabled: ud.Disabled}
+
+	if ud.Token != "" {
+		cached.TokenHash = hashToken(ud.Token)
+	}
+
+	return cached
+}
+
+// hasToken reports whether the token is the user's stored token.
+func (c *cachedUser) hasToken(token string) bool {
+	return token != "" && c.TokenHash == hashToken(token)
+}
+
+func userCacheKey(canonical string) string {
+	return "user:" + canonical
+}
+
+// readCachedUser returns the user with exactly the id from the userCache and reads it from the store on a miss.
+// Users are cached under their canonicalized ID, so a cached user with another ID counts as miss.
+// Failures of the cache are logged and fall back to the store.
+func readCachedUser(ctx context.Context, id string) (*cachedUser, error) {
+	canonical, err := canonicalID(id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	key := userCacheKey(canonical)
+
+	if userCache != nil {
+		value, found, err := userCache.Get(ctx, key)
+		cached := &cachedUser{}
+
+		switch {
+		case err != nil:
+			cacheRequests.WithLabelValues("error").Inc()
+			log.Printf("Unable to read %v from cache: %v", key, err)
+		case found && json.Unmarshal(value, cached) == nil && cached.ID == id:
+			cacheRequests.WithLabelValues("hit").Inc()
+			return cached, nil
+		default:
+			cacheRequests.WithLabelValues("miss").Inc()
+		}
+	}
+
+	return refreshCachedUser(ctx, id)
+}
+
+// refreshCachedUser reads the user with exactly the id from the store and replaces it in the userCache.
+// Users whose ID only canonicalizes alike are not found, as tokens carry the exact ID of their user.
+func refreshCachedUser(ctx context.Context, id string) (*cachedUser, error) {
+	canonical, err := canonicalID(id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	ud, err := readUser(ctx, id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if ud.ID != id {
+		return nil, fmt.Errorf("%w for ID '%v'", errNotFound, id)
+	}
+
+	cached := cachedUserOf(ud)
+
+	if userCache != nil {
+		key := userCacheKey(canonical)
+		value, _ := json.Marshal(cached)
+
+		if err := userCache.Set(ctx, key, value, userCacheTTL); err != nil {
+			log.Printf("Unable to write %v to cache: %v", key, err)
+		}
+	}
+
+	return cached, nil
+}
+
+// invalidateUser removes a changed or deleted user from the userCache. Users are cached under their
+// canonicalized ID, also if they were stored before IDs were canonicalized and have no CanonicalID yet.
+// A user read before the change may still be cached by a concurrent read for up to userCacheTTL.
+func invalidateUser(ctx context.Context, id string) {
+	canonical, err := canonicalID(id)
+
+	if userCache == nil || err != nil {
+		return
+	}
+
+	if err := userCache.Delete(ctx, userCacheKey(canonical)); err != nil {
+		log.Printf("Unable to invalidate %v in cache: %v", userCacheKey(canonical), err)
+	}
+}
+
+// LRUCache keeps up to size values in process and evicts the least recently used value first.
+type LRUCache struct {
+	size    int
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+type lruEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+// NewLRUCache creates an LRUCache for size values.
+func NewLRUCache(size int) *LRUCache {
+	return &LRUCache{size: size, entries: map[string]*list.Element{}, order: list.New()}
+}
+
+// Get returns the value of key unless it expired.
+func (c *LRUCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+
+	if !ok {
+		return nil, false, nil
+	}
+
+	entry := element.Value.(*lruEntry)
+
+	if !now().Before(entry.expires) {
+		c.remove(element)
+		return nil, false, nil
+	}
+
+	c.order.MoveToFront(element)
+
+	return entry.value, true, nil
+}
+
+// Set stores the value of key for ttl and evicts the least recently used value if the cache is full.
+func (c *LRUCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+
+	c.entries[key] = c.order.PushFront(&lruEntry{key: key, value: value, expires: now().Add(ttl)})
+
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+
+	return nil
+}
+
+// Delete removes the value of key.
+func (c *LRUCache) Delete(ctx context.Context, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+
+	return nil
+}
+
+func (c *LRUCache) remove(element *list.Element) {
+	c.order.Remove(element)
+	delete(c.entries, element.Value.(*lruEntry).key)
+}
+
+// Timeout of connecting to Redis and of commands without an earlier deadline of their context.
+var redisTimeout = time.Second
+
+// Number of idle connections kept to Redis.
+const redisIdleConnections = 8
+
+// RedisCache stores values in Redis, so all instances share them and see invalidations at once.
+// Keys are prefixed with "authservice:".
+type RedisCache struct {
+	pool *redis.Pool
+}
+
+// NewRedisCache creates a RedisCache for the server at addr. The password may be empty.
+func NewRedisCache(addr, password string, db int) *RedisCache {
+	return &RedisCache{pool: &redis.Pool{
+		MaxIdle: redisIdleConnections,
+		DialContext: func(ctx context.Context) (redis.Conn, error) {
+			return redis.DialContext(ctx, "tcp", addr,
+				redis.DialPassword(password),
+				redis.DialDatabase(db),
+				redis.DialConnectTimeout(redisTimeout),
+				redis.DialReadTimeout(redisTimeout),
+				redis.DialWriteTimeout(redisTimeout),
+			)
+		},
+	}}
+}
+
+// Get returns the value of key.
+func (c *RedisCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	value, err := redis.Bytes(c.do(ctx, "GET", "authservice:"+key))
+
+	if err == redis.ErrNil {
+		return nil, false, nil
+	}
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	return value, true, nil
+}
+
+// Set stores the value of key for ttl, rounded down to milliseconds but at least one.
+func (c *RedisCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	milliseconds := ttl.Milliseconds()
+
+	if milliseconds < 1 {
+		milliseconds = 1
+	}
+
+	_, err := c.do(ctx, "SET", "authservice:"+key, value, "PX", milliseconds)
+	return err
+}
+
+// Delete removes the value of key.
+func (c *RedisCache) Delete(ctx context.Context, key string) error {
+	_, err := c.do(ctx, "DEL", "authservice:"+key)
+	return err
+}
+
+// Close closes the connections.
+func (c *RedisCache) Close() error {
+	return c.pool.Close()
+}
+
+// do runs the command on a connection of the pool until the deadline of ctx, or for redisTimeout without one.
+func (c *RedisCache) do(ctx context.Context, command string, args ...interface{}) (interface{}, error) {
+	conn, err := c.pool.GetContext(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Close()
+
+	timeout := redisTimeout
+
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = time.Until(deadline)
+	}
+
+	return redis.DoWithTimeout(conn, timeout, command, args...)
+}
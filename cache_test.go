@@ -0,0 +1,290 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/datastore"
+)
+
+func TestLRUCache(T *testing.T) {
+	defer func() { now = func() time.Time { return testtime } }()
+
+	cache := NewLRUCache(2)
+	cache.Set(testctx, "SomeKey", []byte("SomeValue"), time.Minute)
+	cache.Set(testctx, "OtherKey", []byte("OtherValue"), time.Minute)
+	cache.Get(testctx, "SomeKey")
+	cache.Set(testctx, "ThirdKey", []byte("ThirdValue"), time.Second)
+
+	value, found, err := cache.Get(testctx, "SomeKey")
+	_, evicted, _ := cache.Get(testctx, "OtherKey")
+
+	cache.Delete(testctx, "SomeKey")
+	_, deleted, _ := cache.Get(testctx, "SomeKey")
+
+	now = func() time.Time { return testtime.Add(time.Second) }
+	_, expired, _ := cache.Get(testctx, "ThirdKey")
+
+	expectations := map[string]bool{
+		"Get value":          err == nil && found && string(value) == "SomeValue",
+		"Evict least recent": !evicted,
+		"Delete value":       !deleted,
+		"Expire value":       !expired && cache.order.Len() == 0,
+	}
+
+	CheckExpectations(expectations, T)
+}
+
+// countReads counts the reads of the memoryStore.
+func countReads() *int {
+	reads := 0
+	memoryGetAll := getAll
+
+	getAll = func(ctx context.Context, q *datastore.Query, dst interface{}) ([]*datastore.Key, error) {
+		reads++
+		return memoryGetAll(ctx, q, dst)
+	}
+
+	return &reads
+}
+
+func TestReadCachedUser(T *testing.T) {
+	injectOAuthStore()
+	userCache = NewLRUCache(10)
+	defer func() { userCache = nil }()
+	reads := countReads()
+
+	first, firstErr := readCachedUser(testctx, "SomeID")
+	second, _ := readCachedUser(testctx, "SomeID")
+	readsWhileCached := *reads
+	_, likeErr := readCachedUser(testctx, "someid")
+	readsForLike := *reads - readsWhileCached
+
+	ud, _ := readUser(testctx, "SomeID")
+	ud.Token = "SomeToken"
+	writeToDB(testctx, ud)
+	invalidated, _ := readCachedUser(testctx, "SomeID")
+	value, _, _ := userCache.Get(testctx, userCacheKey("someid"))
+
+	readsBeforeLookup := *reads
+	byID, byIDErr := readTokenByID(testctx, "SomeID")
+	_, unknownErr := readTokenByID(testctx, "UnknownID")
+
+	expectations := map[string]bool{
+		"Read through":                 firstErr == nil && first.ID == "SomeID",
+		"Serve from cache":             second.ID == "SomeID" && readsWhileCached == 1,
+		"Compare exact ID":             errors.Is(likeErr, errNotFound) && readsForLike > 0,
+		"Invalidate on write":          invalidated.hasToken("SomeToken") && !invalidated.hasToken("OtherToken"),
+		"Cache only token hash":        strings.Contains(string(value), hashToken("SomeToken")) && !strings.Contains(string(value), `"SomeToken"`),
+		"Read tokens by ID from store": byIDErr == nil && byID.ID == "SomeID" && byID.Token == "SomeToken" && *reads > readsBeforeLookup,
+		"Report unknown IDs":           unknownErr != nil,
+	}
+
+	CheckExpectations(expectations, T)
+}
+
+func TestValidateSessionCache(T *testing.T) {
+	injectOAuthStore()
+	userCache = NewLRUCache(10)
+	defer func() {
+		userCache = nil
+		now = func() time.Time { return testtime }
+	}()
+
+	token, _ := login(testctx, "SomeID", "SomePW")
+	claims, validErr := validateSession(testctx, token)
+
+	// The session is revoked on another instance, which can not invalidate this instance's cache
+	ud, _ := readUser(testctx, "SomeID")
+	ud.Token = ""
+	_, staleErr := validateSession(testctx, token)
+
+	// The user logs in again on another instance
+	ud.Token, _ = signClaims(testctx, NewClaims("SomeID"))
+	_, issuedElsewhereErr := validateSession(testctx, ud.Token)
+	ud.Token = ""
+
+	now = func() time.Time { return testtime.Add(userCacheTTL) }
+	_, revokedErr := validateSession(testctx, token)
+
+	expectations := map[string]bool{
+		"Validate session":               validErr == nil && claims.ID == "SomeID",
+		"Accept until TTL":               staleErr == nil,
+		"Accept tokens issued elsewhere": issuedElsewhereErr == nil,
+		"Reject after TTL":               revokedErr != nil,
+		"Reject invalid token":           func() bool { _, err := validateSession(testctx, "SomeToken"); return err != nil }(),
+		"Reject disabled users": func() bool {
+			ud.Disabled = true
+			writeToDB(testctx, ud)
+			_, err := validateSession(testctx, token)
+			return err != nil
+		}(),
+	}
+
+	CheckExpectations(expectations, T)
+}
+
+// fakeRedis serves GET, SET with PX, DEL, AUTH and SELECT of a single database from memory.
+type fakeRedis struct {
+	listener net.Listener
+	password string
+	mu       sync.Mutex
+	values   map[string]string
+	commands []string
+}
+
+func startFakeRedis(T *testing.T, password string) *fakeRedis {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		T.Fatal(err)
+	}
+
+	f := &fakeRedis{listener: listener, password: password, values: map[string]string{}}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+
+			if err != nil {
+				return
+			}
+
+			go f.serve(conn)
+		}
+	}()
+
+	return f
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	authenticated := f.password == ""
+
+	for {
+		args, err := readCommand(reader)
+
+		if err != nil {
+			return
+		}
+
+		f.mu.Lock()
+		f.commands = append(f.commands, strings.Join(args, " "))
+		reply := "+OK\r\n"
+
+		switch {
+		case args[0] == "AUTH":
+			authenticated = args[1] == f.password
+
+			if !authenticated {
+				reply = "-WRONGPASS invalid password\r\n"
+			}
+		case !authenticated:
+			reply = "-NOAUTH Authentication required\r\n"
+		case args[0] == "GET":
+			if value, ok := f.values[args[1]]; ok {
+				reply = fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+			} else {
+				reply = "$-1\r\n"
+			}
+		case args[0] == "SET":
+			f.values[args[1]] = args[2]
+		case args[0] == "DEL":
+			_, ok := f.values[args[1]]
+			delete(f.values, args[1])
+			reply = fmt.Sprintf(":%d\r\n", map[bool]int{true: 1, false: 0}[ok])
+		}
+
+		f.mu.Unlock()
+		conn.Write([]byte(reply))
+	}
+}
+
+func readCommand(reader *bufio.Reader) ([]string, error) {
+	line, err := reader.ReadString('\n')
+
+	if err != nil {
+		return nil, err
+	}
+
+	count, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+	args := []string{}
+
+	for i := 0; i < count; i++ {
+		header, err := reader.ReadString('\n')
+
+		if err != nil {
+			return nil, err
+		}
+
+		length, _ := strconv.Atoi(strings.TrimSpace(header[1:]))
+		arg := make([]byte, length+2)
+
+		if _, err := io.ReadFull(reader, arg); err != nil {
+			return nil, err
+		}
+
+		args = append(args, string(arg[:length]))
+	}
+
+	return args, nil
+}
+
+func TestRedisCache(T *testing.T) {
+	server := startFakeRedis(T, "SomePassword")
+	defer server.listener.Close()
+
+	cache := NewRedisCache(server.listener.Addr().String(), "SomePassword", 2)
+	defer cache.Close()
+
+	setErr := cache.Set(testctx, "SomeKey", []byte("Some\r\nValue"), 1500*time.Millisecond)
+	value, found, getErr := cache.Get(testctx, "SomeKey")
+	deleteErr := cache.Delete(testctx, "SomeKey")
+	_, deleted, _ := cache.Get(testctx, "SomeKey")
+
+	_, _, wrongErr := NewRedisCache(server.listener.Addr().String(), "OtherPassword", 0).Get(testctx, "SomeKey")
+
+	server.mu.Lock()
+	commands := strings.Join(server.commands, "\n")
+	server.mu.Unlock()
+
+	expectations := map[string]bool{
+		"Set value":        setErr == nil && strings.Contains(commands, "SET authservice:SomeKey Some\r\nValue PX 1500"),
+		"Get value":        getErr == nil && found && string(value) == "Some\r\nValue",
+		"Delete value":     deleteErr == nil && !deleted,
+		"Authenticate":     strings.HasPrefix(commands, "AUTH SomePassword\nSELECT 2\n"),
+		"Reuse connection": strings.Count(commands, "AUTH") == 2,
+		"Report errors":    wrongErr != nil && strings.Contains(wrongErr.Error(), "WRONGPASS"),
+	}
+
+	CheckExpectations(expectations, T)
+}
+
+func TestUnreachableCache(T *testing.T) {
+	injectOAuthStore()
+	listener, _ := net.Listen("tcp", "127.0.0.1:0")
+	listener.Close()
+	userCache = NewRedisCache(listener.Addr().String(), "", 0)
+	defer func() { userCache = nil }()
+
+	cached, err := readCachedUser(testctx, "SomeID")
+	token, loginErr := login(testctx, "SomeID", "SomePW")
+	_, sessionErr := validateSession(testctx, token)
+
+	expectations := map[string]bool{
+		"Fall back to store": err == nil && cached.ID == "SomeID",
+		"Keep serving":       loginErr == nil && sessionErr == nil,
+	}
+
+	CheckExpectations(expectations, T)
+}
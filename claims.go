@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/hex"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
@@ -11,12 +12,40 @@ var now = func() time.Time {
 	return time.Now()
 }
 
+// Issuer of the tokens, their lifetime and the tolerated clock difference between services.
+var tokenIssuer = "tooxoot"
+var tokenLifetime = 24 * time.Hour
+var clockSkew = 5 * time.Minute
+
 // Claims contain a go representation of the jwt claims in use.
 type Claims struct {
 	Exp time.Time `json:"exp"`
 	Iat time.Time `json:"iat"`
 	ID string `json:"id"`
 	Iss string	`json:"iss"`
+	Aud string `json:"aud,omitempty"`
+	Typ string `json:"typ,omitempty"`
+	Challenge string `json:"challenge,omitempty"`
+	Scope string `json:"scope,omitempty"`
+	ClientID string `json:"client_id,omitempty"`
+	SubType string `json:"sub_type,omitempty"`
+	Jti string `json:"jti,omitempty"`
+}
+
+// IsClient reports whether the subject of the Claims is a client instead of a user.
+func (c *Claims) IsClient() bool {
+	return c.SubType == subjectClient
+}
+
+// newJTI returns a random token identifier. It is only used to correlate tokens, e.g. in audit events.
+func newJTI() string {
+	raw := make([]byte, 16)
+
+	if _, err := randRead(raw); err != nil {
+		return ""
+	}
+
+	return hex.EncodeToString(raw)
 }
 
 // NewClaims correctly produces new Claims object with given id. 
@@ -29,25 +58,47 @@ func NewClaims(id string) *Claims {
 	currentTime := now()
 	
 	return &Claims{
-		Exp: currentTime.Add(24 * time.Hour),
+		Exp: currentTime.Add(tokenLifetime),
 		Iat: currentTime,
 		ID: id,
-		Iss: "tooxoot",
+		Iss: tokenIssuer,
+		Jti: newJTI(),
+	}
+}
+
+// NewMFAChallengeClaims produces a short-lived mfa_required challenge for the given id.
+// The challenge can only be exchanged for regular Claims by passing the second factor.
+// Returns nil for empty id.
+func NewMFAChallengeClaims(id string) *Claims {
+	return newChallengeClaims(id, mfaRequired)
+}
+
+// newChallengeClaims produces short-lived Claims of the given typ.
+// Returns nil for empty id.
+func newChallengeClaims(id, typ string) *Claims {
+	claims := NewClaims(id)
+	if claims == nil {
+		return nil
 	}
+
+	claims.Exp = claims.Iat.Add(5 * time.Minute)
+	claims.Typ = typ
+
+	return claims
 }
 
 // Valid returns a jwt.ValidationError if the Claims object is invalid
 func (c Claims) Valid() error {
 	currentTime := now()
-	if c.Iss != "tooxoot" {
-		return jwt.NewValidationError("Issuer must be tooxoot", 1)
+	if c.Iss != tokenIssuer {
+		return jwt.NewValidationError("Issuer must be " + tokenIssuer, 1)
 	}
 
-	if c.Exp.Before(currentTime.Add(-5 * time.Minute)) {
+	if c.Exp.Before(currentTime.Add(-clockSkew)) {
 		return jwt.NewValidationError("Token is expired", 2)
 	}
 
-	if c.Iat.After(currentTime.Add(5 * time.Minute)) {
+	if c.Iat.After(currentTime.Add(clockSkew)) {
 		return jwt.NewValidationError("Token is issued in the future", 3)
 	}
 
@@ -85,3 +85,17 @@ func TestClaimValidation(T *testing.T) {
 		T.Errorf("Claims validation failed for valid claims!")
 	} 
 }
+
+func TestNewMFAChallengeClaims(T *testing.T) {
+	challenge := NewMFAChallengeClaims("SomeID")
+
+	expectations := map[string]bool{
+		"Expire after 5 minutes": challenge.Exp == testtime.Add(5 * time.Minute),
+		"Set id": challenge.ID == "SomeID",
+		"Set mfa_required type": challenge.Typ == mfaRequired,
+		"Be valid": challenge.Valid() == nil,
+		"Return nil for empty id": NewMFAChallengeClaims("") == nil,
+	}
+
+	CheckExpectations(expectations, T)
+}
@@ -0,0 +1,733 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/dgrijalva/jwt-go"
+	"google.golang.org/grpc/credentials"
+)
+
+// Dependencies for injection
+var stdin io.Reader = os.Stdin
+var openStore = func(ctx context.Context, c *Config) (io.Closer, error) {
+	return connectStore(ctx, c.DatastoreProject)
+}
+
+const cliUsage = `Usage: authservice <command> [flags] [arguments]
+
+Commands:
+  serve                         Serve the AuthService on grpc_addr and the HTTP endpoints on http_addr
+  config print                  Show the effective configuration
+  user create <id>              Create a user with the password read from stdin
+  user get <id>                 Show a user
+  user list                     List all users
+  user disable <id>             Disable a user and end its session
+  user enable <id>              Enable a disabled user
+  user delete <id>              Delete a user
+  user set-password <id>        Set the password read from stdin and end the session
+  user import <file|->          Import users with hashes of another system, see -format and -dry-run
+  user export [-out file]       Write all users as JSON lines, without sessions
+  user restore <file|->         Restore exported users, see -conflict and -dry-run
+  migrate status                Show the migrations of the stored users
+  migrate run                   Apply pending migrations, see -dry-run and -batch-size
+  key generate [-out file]      Generate a signing key
+  key rotate -out file          Replace the signing key in file and keep the old one in file.previous
+  token sign <id>               Sign a token, see -typ, -scope and -lifetime
+  token verify <token>          Verify a token and show its claims
+  token decode <token>          Show the header and claims of a token without verifying it
+
+All commands but key and token decode read the configuration and accept its flags, e.g. -config file.`
+
+// runCLI runs the admin command in args and writes its output to out.
+func runCLI(ctx context.Context, args []string, out io.Writer) error {
+	if len(args) > 0 && args[0] == "serve" {
+		return serveCommand(ctx, args[1:], out)
+	}
+
+	if len(args) < 2 {
+		return errors.New(cliUsage)
+	}
+
+	switch args[0] {
+	case "config":
+		return configCommand(args[1:], out)
+	case "user":
+		return userCommand(ctx, args[1:], out)
+	case "migrate":
+		return migrateCommand(ctx, args[1:], out)
+	case "key":
+		return keyCommand(args[1:], out)
+	case "token":
+		return tokenCommand(ctx, args[1:], out)
+	}
+
+	return errors.New(cliUsage)
+}
+
+func newFlagSet(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+
+	return flags
+}
+
+// loadCommandConfig loads and applies the Config with the flags of a command.
+func loadCommandConfig(flags *flag.FlagSet, args []string) (*Config, error) {
+	c, err := loadConfigFlags(flags, args)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return c, c.apply()
+}
+
+// serveCommand runs the gRPC and HTTP servers with TLS from tls_cert_file and tls_key_file, if set, until shutdown.
+func serveCommand(ctx context.Context, args []string, out io.Writer) error {
+	c, err := loadCommandConfig(newFlagSet("serve"), args)
+
+	if err != nil {
+		return err
+	}
+
+	store, err := openStore(ctx, c)
+
+	if err != nil {
+		return err
+	}
+
+	defer store.Close()
+
+	var creds credentials.TransportCredentials
+	var httpTLS *tls.Config
+
+	if c.TLSCertFile != "" {
+		if creds, err = serverCredentials(c.TLSCertFile, c.TLSKeyFile, c.TLSClientCAFile); err != nil {
+			return err
+		}
+
+		reloader, err := newCertReloader(c.TLSCertFile, c.TLSKeyFile, c.TLSClientCAFile)
+
+		if err != nil {
+			return err
+		}
+
+		httpTLS = reloader.TLSConfig()
+	}
+
+	grpcListener, err := net.Listen("tcp", c.GRPCAddr)
+
+	if err != nil {
+		return err
+	}
+
+	httpListener, err := net.Listen("tcp", c.HTTPAddr)
+
+	if err != nil {
+		grpcListener.Close()
+		return err
+	}
+
+	if httpTLS != nil {
+		httpListener = tls.NewListener(httpListener, httpTLS)
+	}
+
+	fmt.Fprintf(out, "Serving gRPC on %v and HTTP on %v\n", grpcListener.Addr(), httpListener.Addr())
+
+	return serve(newGRPCServer(creds), grpcListener, &http.Server{Handler: oauthHandler()}, httpListener)
+}
+
+// userView is the part of the UserData shown to operators. Hashes, tokens and secrets are left out.
+type userView struct {
+	ID            string
+	CanonicalID   string
+	Email         string `json:",omitempty"`
+	EmailVerified bool
+	TOTPEnabled   bool
+	WebAuthnKeys  int
+	Disabled      bool
+	LoggedIn      bool
+}
+
+func viewOf(ud *UserData) userView {
+	return userView{
+		ID:            ud.ID,
+		CanonicalID:   ud.CanonicalID,
+		Email:         ud.Email,
+		EmailVerified: ud.EmailVerified,
+		TOTPEnabled:   ud.TOTPConfirmed,
+		WebAuthnKeys:  len(ud.Credentials),
+		Disabled:      ud.Disabled,
+		LoggedIn:      ud.Token != "",
+	}
+}
+
+// readPassword reads the first line of stdin, so passwords do not end up in the shell history.
+func readPassword() (string, error) {
+	line, err := bufio.NewReader(stdin).ReadString('\n')
+
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+
+	password := strings.TrimRight(line, "\r\n")
+
+	if password == "" {
+		return "", errors.New("Empty password, pass it on stdin")
+	}
+
+	return password, nil
+}
+
+func userCommand(ctx context.Context, args []string, out io.Writer) error {
+	command := args[0]
+	flags := newFlagSet("user " + command)
+	format := flags.String("format", "", "Format of the imported users, csv or jsonl, by default from the file extension")
+	dryRun := flags.Bool("dry-run", false, "Validate the imported or restored users without storing them")
+	conflict := flags.String("conflict", restoreFail, "Policy for restored users whose ID is taken: skip, overwrite or fail")
+	path := flags.String("out", "", "File to export the users to")
+
+	c, err := loadCommandConfig(flags, args[1:])
+
+	if err != nil {
+		return err
+	}
+
+	store, err := openStore(ctx, c)
+
+	if err != nil {
+		return err
+	}
+
+	defer store.Close()
+
+	switch command {
+	case "list":
+		return listUsers(ctx, out)
+	case "export":
+		return exportCommand(ctx, *path, out)
+	}
+
+	if flags.NArg() != 1 {
+		return fmt.Errorf("Usage: user %v <id>", command)
+	}
+
+	id := flags.Arg(0)
+
+	switch command {
+	case "create":
+		return createUser(ctx, id, out)
+	case "get":
+		ud, err := readUser(ctx, id)
+
+		if err != nil {
+			return err
+		}
+
+		return writeIndentedJSON(out, viewOf(ud))
+	case "disable", "enable":
+		return setDisabled(ctx, id, command == "disable", out)
+	case "delete":
+		ud, err := readUser(ctx, id)
+
+		if err != nil {
+			return err
+		}
+
+		if err := deleteUser(ctx, ud); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(out, "Deleted user %v\n", ud.ID)
+		return nil
+	case "set-password":
+		return setPassword(ctx, id, out)
+	case "import":
+		return importCommand(ctx, id, *format, *dryRun, out)
+	case "restore":
+		return restoreCommand(ctx, id, *conflict, *dryRun, out)
+	}
+
+	return errors.New(cliUsage)
+}
+
+func createUser(ctx context.Context, id string, out io.Writer) error {
+	if _, err := canonicalID(id); err != nil {
+		return err
+	}
+
+	if exists, err := userExists(ctx, id); err != nil {
+		return err
+	} else if exists {
+		return fmt.Errorf("ID '%v' is already taken", id)
+	}
+
+	password, err := readPassword()
+
+	if err != nil {
+		return err
+	}
+
+	ud := NewUserData(ctx, id, password)
+
+	if ud == nil {
+		return errors.New("Unable to create user")
+	}
+
+	if err := insertUser(ctx, ud); err == errAlreadyExists {
+		return fmt.Errorf("ID '%v' is already taken", id)
+	} else if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "Created user %v\n", ud.ID)
+	return nil
+}
+
+func listUsers(ctx context.Context, out io.Writer) error {
+	users := []*UserData{}
+
+	if err := getEntities(ctx, newQuery(userKind), &users); err != nil {
+		return err
+	}
+
+	sort.Slice(users, func(i, j int) bool { return users[i].CanonicalID < users[j].CanonicalID })
+
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tEMAIL\tSTATUS")
+
+	for _, ud := range users {
+		state := "enabled"
+
+		if ud.Disabled {
+			state = "disabled"
+		}
+
+		fmt.Fprintf(w, "%v\t%v\t%v\n", ud.ID, ud.Email, state)
+	}
+
+	return w.Flush()
+}
+
+// setDisabled disables or enables a user. Disabling also ends the user's session.
+func setDisabled(ctx context.Context, id string, disabled bool, out io.Writer) error {
+	ud, err := readUser(ctx, id)
+
+	if err != nil {
+		return err
+	}
+
+	ud.Disabled = disabled
+
+	if disabled {
+		ud.Token = ""
+	}
+
+	if err := writeToDB(ctx, ud); err != nil {
+		return err
+	}
+
+	if disabled {
+		fmt.Fprintf(out, "Disabled user %v\n", ud.ID)
+	} else {
+		fmt.Fprintf(out, "Enabled user %v\n", ud.ID)
+	}
+
+	return nil
+}
+
+// setPassword replaces the password and ends the user's session and pending password resets.
+func setPassword(ctx context.Context, id string, out io.Writer) error {
+	ud, err := readUser(ctx, id)
+
+	if err != nil {
+		return err
+	}
+
+	password, err := readPassword()
+
+	if err != nil {
+		return err
+	}
+
+	if err := ud.setPassword(ctx, password); err != nil {
+		return err
+	}
+
+	ud.Token = ""
+	ud.ResetHash = ""
+
+	if err := writeToDB(ctx, ud); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "Set password of user %v\n", ud.ID)
+	return nil
+}
+
+// importCommand imports the users in path, or stdin for -, and fails if any row was not imported.
+func importCommand(ctx context.Context, path, format string, dryRun bool, out io.Writer) error {
+	if format == "" {
+		format = strings.TrimPrefix(filepath.Ext(path), ".")
+	}
+
+	input, err := openInput(path)
+
+	if err != nil {
+		return err
+	}
+
+	defer input.Close()
+
+	report, err := importUsers(ctx, input, format, dryRun)
+
+	if report == nil {
+		return err
+	}
+
+	for _, e := range report.Errors {
+		if e.ID != "" {
+			fmt.Fprintf(out, "Row %v (%v): %v\n", e.Row, e.ID, e.Message)
+		} else {
+			fmt.Fprintf(out, "Row %v: %v\n", e.Row, e.Message)
+		}
+	}
+
+	if dryRun {
+		fmt.Fprintf(out, "Validated %v users, %v rows failed, nothing was imported\n", report.Imported, len(report.Errors))
+	} else {
+		fmt.Fprintf(out, "Imported %v users, %v rows failed\n", report.Imported, len(report.Errors))
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if len(report.Errors) > 0 {
+		return fmt.Errorf("%v rows were not imported", len(report.Errors))
+	}
+
+	return nil
+}
+
+// openInput opens the file in path, or stdin for -.
+func openInput(path string) (io.ReadCloser, error) {
+	if path == "-" {
+		return ioutil.NopCloser(stdin), nil
+	}
+
+	return os.Open(path)
+}
+
+// exportCommand writes all users to path, or out if path is empty.
+// Backups contain password hashes and TOTP secrets, so files are only readable by their owner and never replaced.
+func exportCommand(ctx context.Context, path string, out io.Writer) error {
+	if path == "" {
+		_, err := exportUsers(ctx, out)
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+
+	if err != nil {
+		return err
+	}
+
+	exported, err := exportUsers(ctx, file)
+
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "Exported %v users to %v\n", exported, path)
+	return nil
+}
+
+func restoreCommand(ctx context.Context, path, policy string, dryRun bool, out io.Writer) error {
+	input, err := openInput(path)
+
+	if err != nil {
+		return err
+	}
+
+	defer input.Close()
+
+	report, err := restoreUsers(ctx, input, policy, dryRun)
+
+	if report == nil {
+		return err
+	}
+
+	if dryRun {
+		fmt.Fprintf(out, "Would restore %v users, overwrite %v and skip %v, nothing was restored\n", report.Restored, report.Overwritten, report.Skipped)
+	} else {
+		fmt.Fprintf(out, "Restored %v users, overwrote %v and skipped %v\n", report.Restored, report.Overwritten, report.Skipped)
+	}
+
+	return err
+}
+
+func migrateCommand(ctx context.Context, args []string, out io.Writer) error {
+	command := args[0]
+	flags := newFlagSet("migrate " + command)
+	dryRun := flags.Bool("dry-run", false, "Report what the migrations would change without storing it")
+	batchSize := flags.Int("batch-size", migrationBatchSize, "Number of users migrated at once")
+
+	c, err := loadCommandConfig(flags, args[1:])
+
+	if err != nil {
+		return err
+	}
+
+	if *batchSize < 1 {
+		return errors.New("The batch size must be positive")
+	}
+
+	migrationBatchSize = *batchSize
+
+	store, err := openStore(ctx, c)
+
+	if err != nil {
+		return err
+	}
+
+	defer store.Close()
+
+	switch command {
+	case "status":
+		return migrationStatus(ctx, out)
+	case "run":
+		return runMigrations(ctx, *dryRun, out)
+	}
+
+	return errors.New(cliUsage)
+}
+
+func migrationStatus(ctx context.Context, out io.Writer) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tSTATUS\tPROCESSED\tCHANGED\tDESCRIPTION")
+
+	for _, m := range userMigrations {
+		state, err := readMigrationState(ctx, m.name)
+
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\n", m.name, state.status(), state.Processed, state.Changed, m.description)
+	}
+
+	return w.Flush()
+}
+
+func keyCommand(args []string, out io.Writer) error {
+	command := args[0]
+	flags := newFlagSet("key " + command)
+	keyType := flags.String("type", "rsa", "Type of the key")
+	bits := flags.Int("bits", 2048, "Size of the key in bits")
+	path := flags.String("out", "", "File to write the key to")
+
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	// Tokens are signed with RS256 only, so readRSAKEY is the only reader of signing keys.
+	if *keyType != "rsa" {
+		return fmt.Errorf("Unsupported key type '%v', readRSAKEY only accepts rsa keys", *keyType)
+	}
+
+	if *bits < 2048 {
+		return errors.New("Keys must have at least 2048 bits")
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, *bits)
+
+	if err != nil {
+		return err
+	}
+
+	switch command {
+	case "generate":
+		if *path == "" {
+			_, err := io.WriteString(out, encodeRSAKEY(key))
+			return err
+		}
+
+		if err := writeKeyFile(*path, encodeRSAKEY(key), false); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(out, "Generated key %v in %v\n", jwkOf(&key.PublicKey).Kid, *path)
+		return nil
+	case "rotate":
+		return rotateKey(*path, key, out)
+	}
+
+	return errors.New(cliUsage)
+}
+
+// rotateKey replaces the key in path by the new key and moves the replaced key to path.previous.
+func rotateKey(path string, key *rsa.PrivateKey, out io.Writer) error {
+	if path == "" {
+		return errors.New("Usage: key rotate -out file")
+	}
+
+	current, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return err
+	}
+
+	old, err := readRSAKEY(string(current))
+
+	if err != nil {
+		return err
+	}
+
+	if err := writeKeyFile(path+".previous", string(current), true); err != nil {
+		return err
+	}
+
+	if err := writeKeyFile(path, encodeRSAKEY(key), true); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "Rotated key %v to %v in %v\n", jwkOf(&old.PublicKey).Kid, jwkOf(&key.PublicKey).Kid, path)
+	fmt.Fprintf(out, "Configure %v.previous as previous_rsa_key for token_lifetime, so issued tokens stay valid\n", path)
+	return nil
+}
+
+// writeKeyFile writes a key only readable by its owner. Existing files are only replaced if replace is set.
+// Replacing goes through a temporary file, so the key in path is never partially written.
+func writeKeyFile(path, key string, replace bool) error {
+	if !replace {
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+
+		if err != nil {
+			return err
+		}
+
+		if _, err := io.WriteString(file, key); err != nil {
+			file.Close()
+			return err
+		}
+
+		return file.Close()
+	}
+
+	temporary := path + ".tmp"
+
+	if err := ioutil.WriteFile(temporary, []byte(key), 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(temporary, path)
+}
+
+func tokenCommand(ctx context.Context, args []string, out io.Writer) error {
+	command := args[0]
+	flags := newFlagSet("token " + command)
+
+	if command == "decode" {
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+
+		return decodeUnverified(flags.Arg(0), out)
+	}
+
+	typ := flags.String("typ", "", "Type of the token, e.g. mfa_required")
+	scope := flags.String("scope", "", "Scope of the signed token")
+	lifetime := flags.Duration("lifetime", 0, "Lifetime of the signed token instead of token_lifetime")
+
+	if _, err := loadCommandConfig(flags, args[1:]); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 1 {
+		return fmt.Errorf("Usage: token %v [flags] <argument>", command)
+	}
+
+	switch command {
+	case "sign":
+		claims := NewClaims(flags.Arg(0))
+
+		if claims == nil {
+			return errors.New("Empty ID")
+		}
+
+		claims.Typ = *typ
+		claims.Scope = *scope
+
+		if *lifetime > 0 {
+			claims.Exp = claims.Iat.Add(*lifetime)
+		}
+
+		token, err := signClaims(ctx, claims)
+
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintln(out, token)
+		return nil
+	case "verify":
+		_, claims, err := parseTyped(flags.Arg(0), *typ)
+
+		if err != nil {
+			return fmt.Errorf("Invalid token: %w", err)
+		}
+
+		return writeIndentedJSON(out, claims)
+	}
+
+	return errors.New(cliUsage)
+}
+
+// decodeUnverified shows the header and Claims of a token without checking its signature or validity.
+func decodeUnverified(signedString string, out io.Writer) error {
+	claims := &Claims{}
+	token, _, err := new(jwt.Parser).ParseUnverified(signedString, claims)
+
+	if err != nil {
+		return fmt.Errorf("Malformed token: %w", err)
+	}
+
+	return writeIndentedJSON(out, map[string]interface{}{
+		"header":  token.Header,
+		"claims":  claims,
+		"expired": claims.Exp.Before(now()),
+	})
+}
+
+func writeIndentedJSON(out io.Writer, v interface{}) error {
+	encoded, err := json.MarshalIndent(v, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(out, "%s\n", encoded)
+	return err
+}
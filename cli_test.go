@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type closedStore struct{}
+
+func (closedStore) Close() error { return nil }
+
+// injectCLI runs commands against the OAuth test store and configuration. The returned function restores the injections.
+func injectCLI() func() {
+	injectOAuthStore()
+	restoreEnv := injectEnv(testKeys())
+	openStore = func(ctx context.Context, c *Config) (io.Closer, error) { return closedStore{}, nil }
+
+	return func() {
+		restoreEnv()
+		stdin = os.Stdin
+	}
+}
+
+// runCLIWith runs the command with the input on stdin and returns its output.
+func runCLIWith(input string, args ...string) (string, error) {
+	stdin = strings.NewReader(input)
+	out := &bytes.Buffer{}
+	err := runCLI(testctx, args, out)
+
+	return out.String(), err
+}
+
+func TestUserCommands(T *testing.T) {
+	defer injectCLI()()
+
+	created, createErr := runCLIWith("OtherPW\n", "user", "create", "OtherID")
+	_, takenErr := runCLIWith("OtherPW\n", "user", "create", "otherid")
+	_, emptyErr := runCLIWith("", "user", "create", "NewID")
+	other, _ := readComplete(testctx, "OtherID")
+
+	got, getErr := runCLIWith("", "user", "get", "SomeID")
+	view := userView{}
+	json.Unmarshal([]byte(got), &view)
+
+	list, _ := runCLIWith("", "user", "list")
+
+	expectations := map[string]bool{
+		"Create user":           createErr == nil && created == "Created user OtherID\n" && other.compare(testctx, "OtherPW"),
+		"Reject taken ID":       takenErr != nil,
+		"Require password":      emptyErr != nil,
+		"Get user":              getErr == nil && view.ID == "SomeID" && view.CanonicalID == "someid",
+		"Hide hash":             !strings.Contains(got, "Hash"),
+		"List users":            strings.Contains(list, "OtherID") && strings.Contains(list, "SomeID"),
+		"Require ID":            func() bool { _, err := runCLIWith("", "user", "get"); return err != nil }(),
+		"Reject unknown action": func() bool { _, err := runCLIWith("", "user", "rename", "SomeID"); return err != nil }(),
+	}
+
+	CheckExpectations(expectations, T)
+}
+
+func TestDisableUser(T *testing.T) {
+	defer injectCLI()()
+	store := injectOAuthStore()
+
+	token, _ := login(testctx, "SomeID", "SomePW")
+
+	_, disableErr := runCLIWith("", "user", "disable", "SomeID")
+	_, loginErr := login(testctx, "SomeID", "SomePW")
+	_, sessionErr := currentSession(testctx, token)
+	list, _ := runCLIWith("", "user", "list")
+
+	_, enableErr := runCLIWith("", "user", "enable", "SomeID")
+	_, enabledErr := login(testctx, "SomeID", "SomePW")
+
+	expectations := map[string]bool{
+		"Disable user":        disableErr == nil,
+		"Reject login":        loginErr != nil,
+		"End session":         sessionErr != nil,
+		"List as disabled":    strings.Contains(list, "disabled"),
+		"Enable user":         enableErr == nil && enabledErr == nil,
+		"Update stored user":  store.count("USER") == 1,
+		"Report unknown user": func() bool { _, err := runCLIWith("", "user", "disable", "UnknownID"); return err != nil }(),
+	}
+
+	CheckExpectations(expectations, T)
+}
+
+func TestSetPasswordAndDeleteUser(T *testing.T) {
+	defer injectCLI()()
+	store := injectOAuthStore()
+
+	token, _ := login(testctx, "SomeID", "SomePW")
+	_, setErr := runCLIWith("NewPW\n", "user", "set-password", "SomeID")
+	_, oldErr := login(testctx, "SomeID", "SomePW")
+	_, newErr := login(testctx, "SomeID", "NewPW")
+	_, sessionErr := currentSession(testctx, token)
+
+	users := store.count("USER")
+	_, deleteErr := runCLIWith("", "user", "delete", "SomeID")
+	_, readErr := readUser(testctx, "SomeID")
+
+	expectations := map[string]bool{
+		"Set password":       setErr == nil && newErr == nil,
+		"Reject old":         oldErr != nil,
+		"End session":        sessionErr != nil,
+		"Update stored user": users == 1,
+		"Delete user":        deleteErr == nil && readErr != nil && store.count("USER") == 0,
+		"Report missing ID":  func() bool { _, err := runCLIWith("", "user", "delete", "SomeID"); return err != nil }(),
+	}
+
+	CheckExpectations(expectations, T)
+}
+
+func TestKeyCommands(T *testing.T) {
+	dir, _ := ioutil.TempDir("", "key")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "key.pem")
+
+	generated, err := runCLIWith("", "key", "generate")
+	_, readErr := readRSAKEY(generated)
+	_, ecErr := runCLIWith("", "key", "generate", "-type", "ec")
+	_, smallErr := runCLIWith("", "key", "generate", "-bits", "1024")
+
+	_, fileErr := runCLIWith("", "key", "generate", "-out", path)
+	_, overwriteErr := runCLIWith("", "key", "generate", "-out", path)
+	before, _ := ioutil.ReadFile(path)
+
+	rotated, rotateErr := runCLIWith("", "key", "rotate", "-out", path)
+	after, _ := ioutil.ReadFile(path)
+	previous, _ := ioutil.ReadFile(path + ".previous")
+	info, _ := os.Stat(path)
+	_, afterErr := readRSAKEY(string(after))
+
+	expectations := map[string]bool{
+		"Generate key":            err == nil && readErr == nil,
+		"Reject EC keys":          ecErr != nil && strings.Contains(ecErr.Error(), "readRSAKEY"),
+		"Reject small keys":       smallErr != nil,
+		"Write key file":          fileErr == nil && len(before) > 0,
+		"Keep existing file":      overwriteErr != nil,
+		"Rotate key":              rotateErr == nil && afterErr == nil && string(after) != string(before),
+		"Keep previous key":       string(previous) == string(before),
+		"Restrict permissions":    info != nil && info.Mode().Perm() == 0600,
+		"Explain previous key":    strings.Contains(rotated, "previous_rsa_key"),
+		"Require file for rotate": func() bool { _, err := runCLIWith("", "key", "rotate"); return err != nil }(),
+	}
+
+	CheckExpectations(expectations, T)
+}
+
+func TestTokenCommands(T *testing.T) {
+	defer injectCLI()()
+
+	signed, signErr := runCLIWith("", "token", "sign", "-scope", "SomeScope", "-lifetime", "1h", "SomeID")
+	token := strings.TrimSpace(signed)
+	_, claims, parseErr := parse(token)
+
+	verified, verifyErr := runCLIWith("", "token", "verify", token)
+	_, invalidErr := runCLIWith("", "token", "verify", token+"x")
+
+	challenge, _ := signClaims(testctx, NewMFAChallengeClaims("SomeID"))
+	_, typedErr := runCLIWith("", "token", "verify", "-typ", mfaRequired, challenge)
+
+	decoded, decodeErr := runCLIWith("", "token", "decode", token+"x")
+	_, malformedErr := runCLIWith("", "token", "decode", "SomeMalformedToken")
+
+	expectations := map[string]bool{
+		"Sign token":          signErr == nil && parseErr == nil && claims.ID == "SomeID" && claims.Scope == "SomeScope",
+		"Apply lifetime":      claims.Exp.Equal(testtime.Add(time.Hour)),
+		"Verify token":        verifyErr == nil && strings.Contains(verified, `"id": "SomeID"`),
+		"Reject invalid":      invalidErr != nil,
+		"Verify typed token":  typedErr == nil,
+		"Decode unverified":   decodeErr == nil && strings.Contains(decoded, `"alg": "RS256"`) && strings.Contains(decoded, `"scope": "SomeScope"`),
+		"Reject malformed":    malformedErr != nil,
+		"Require subcommands": func() bool { _, err := runCLIWith("", "token"); return err != nil }(),
+	}
+
+	CheckExpectations(expectations, T)
+}
@@ -0,0 +1,534 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/smtp"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v3"
+)
+
+// Dependency for injection
+var lookupEnv = os.LookupEnv
+
+const configEnv = "AUTHSERVICE_CONFIG"
+const redacted = "<redacted>"
+
+// Duration is a time.Duration written as e.g. "1h30m" in files, variables and flags.
+type Duration time.Duration
+
+// UnmarshalText parses the Duration with time.ParseDuration.
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(parsed)
+
+	return nil
+}
+
+// MarshalText formats the Duration like time.Duration.String.
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// Config contains all settings of the service.
+// Every setting is read from the file key of its yaml tag, the variable of its env tag and
+// the flag named like the file key with dashes. Settings tagged as secret have no flag,
+// as arguments are visible to other users of the host, and are redacted on print.
+type Config struct {
+	Issuer        string   `yaml:"issuer" toml:"issuer" env:"AUTHSERVICE_ISSUER"`
+	IssuerURL     string   `yaml:"issuer_url" toml:"issuer_url" env:"AUTHSERVICE_ISSUER_URL"`
+	TokenLifetime Duration `yaml:"token_lifetime" toml:"token_lifetime" env:"AUTHSERVICE_TOKEN_LIFETIME"`
+	ClockSkew     Duration `yaml:"clock_skew" toml:"clock_skew" env:"AUTHSERVICE_CLOCK_SKEW"`
+	BcryptCost    int      `yaml:"bcrypt_cost" toml:"bcrypt_cost" env:"AUTHSERVICE_BCRYPT_COST"`
+	UserKind      string   `yaml:"user_kind" toml:"user_kind" env:"AUTHSERVICE_USER_KIND"`
+
+	DatastoreProject  string   `yaml:"datastore_project" toml:"datastore_project" env:"AUTHSERVICE_DATASTORE_PROJECT"`
+	StoreReadTimeout  Duration `yaml:"store_read_timeout" toml:"store_read_timeout" env:"AUTHSERVICE_STORE_READ_TIMEOUT"`
+	StoreWriteTimeout Duration `yaml:"store_write_timeout" toml:"store_write_timeout" env:"AUTHSERVICE_STORE_WRITE_TIMEOUT"`
+
+	BrowserSessions   bool     `yaml:"browser_sessions" toml:"browser_sessions" env:"AUTHSERVICE_BROWSER_SESSIONS"`
+	SessionRenewAfter Duration `yaml:"session_renew_after" toml:"session_renew_after" env:"AUTHSERVICE_SESSION_RENEW_AFTER"`
+	CORSOrigins       []string `yaml:"cors_origins" toml:"cors_origins" env:"AUTHSERVICE_CORS_ORIGINS"`
+	CORSMaxAge        Duration `yaml:"cors_max_age" toml:"cors_max_age" env:"AUTHSERVICE_CORS_MAX_AGE"`
+	WebAuthnRPID      string   `yaml:"webauthn_rp_id" toml:"webauthn_rp_id" env:"AUTHSERVICE_WEBAUTHN_RP_ID"`
+	WebAuthnOrigin    string   `yaml:"webauthn_origin" toml:"webauthn_origin" env:"AUTHSERVICE_WEBAUTHN_ORIGIN"`
+
+	GRPCAddr          string   `yaml:"grpc_addr" toml:"grpc_addr" env:"AUTHSERVICE_GRPC_ADDR"`
+	HTTPAddr          string   `yaml:"http_addr" toml:"http_addr" env:"AUTHSERVICE_HTTP_ADDR"`
+	TLSCertFile       string   `yaml:"tls_cert_file" toml:"tls_cert_file" env:"AUTHSERVICE_TLS_CERT_FILE"`
+	TLSKeyFile        string   `yaml:"tls_key_file" toml:"tls_key_file" env:"AUTHSERVICE_TLS_KEY_FILE"`
+	TLSClientCAFile   string   `yaml:"tls_client_ca_file" toml:"tls_client_ca_file" env:"AUTHSERVICE_TLS_CLIENT_CA_FILE"`
+	TLSReloadInterval Duration `yaml:"tls_reload_interval" toml:"tls_reload_interval" env:"AUTHSERVICE_TLS_RELOAD_INTERVAL"`
+	ShutdownTimeout   Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout" env:"AUTHSERVICE_SHUTDOWN_TIMEOUT"`
+
+	AdminClients     []string `yaml:"admin_clients" toml:"admin_clients" env:"AUTHSERVICE_ADMIN_CLIENTS"`
+	APIKeyScopes     []string `yaml:"api_key_scopes" toml:"api_key_scopes" env:"AUTHSERVICE_API_KEY_SCOPES"`
+	MaxSecretOverlap Duration `yaml:"max_secret_overlap" toml:"max_secret_overlap" env:"AUTHSERVICE_MAX_SECRET_OVERLAP"`
+
+	AccessTokenAudience string `yaml:"access_token_audience" toml:"access_token_audience" env:"AUTHSERVICE_ACCESS_TOKEN_AUDIENCE"`
+	MetricsToken        string `yaml:"metrics_token" toml:"metrics_token" env:"AUTHSERVICE_METRICS_TOKEN" secret:"true"`
+
+	CacheBackend  string   `yaml:"cache_backend" toml:"cache_backend" env:"AUTHSERVICE_CACHE_BACKEND"`
+	CacheSize     int      `yaml:"cache_size" toml:"cache_size" env:"AUTHSERVICE_CACHE_SIZE"`
+	CacheTTL      Duration `yaml:"cache_ttl" toml:"cache_ttl" env:"AUTHSERVICE_CACHE_TTL"`
+	RedisAddr     string   `yaml:"redis_addr" toml:"redis_addr" env:"AUTHSERVICE_REDIS_ADDR"`
+	RedisPassword string   `yaml:"redis_password" toml:"redis_password" env:"AUTHSERVICE_REDIS_PASSWORD" secret:"true"`
+	RedisDB       int      `yaml:"redis_db" toml:"redis_db" env:"AUTHSERVICE_REDIS_DB"`
+
+	SMTPAddr     string `yaml:"smtp_addr" toml:"smtp_addr" env:"AUTHSERVICE_SMTP_ADDR"`
+	SMTPFrom     string `yaml:"smtp_from" toml:"smtp_from" env:"AUTHSERVICE_SMTP_FROM"`
+	SMTPUsername string `yaml:"smtp_username" toml:"smtp_username" env:"AUTHSERVICE_SMTP_USERNAME"`
+	SMTPPassword string `yaml:"smtp_password" toml:"smtp_password" env:"AUTHSERVICE_SMTP_PASSWORD" secret:"true"`
+	MailLog      string `yaml:"mail_log" toml:"mail_log" env:"AUTHSERVICE_MAIL_LOG"`
+
+	RSAKey         string `yaml:"rsa_key" toml:"rsa_key" env:"RSAKEY" secret:"true"`
+	PreviousRSAKey string `yaml:"previous_rsa_key" toml:"previous_rsa_key" env:"PREVIOUS_RSAKEY" secret:"true"`
+	MFAKey         string `yaml:"mfa_key" toml:"mfa_key" env:"MFAKEY" secret:"true"`
+	CSRFKey        string `yaml:"csrf_key" toml:"csrf_key" env:"AUTHSERVICE_CSRF_KEY" secret:"true"`
+}
+
+// defaultConfig returns the built-in settings.
+func defaultConfig() *Config {
+	return &Config{
+		Issuer:            "tooxoot",
+		IssuerURL:         "https://localhost",
+		TokenLifetime:     Duration(24 * time.Hour),
+		ClockSkew:         Duration(5 * time.Minute),
+		BcryptCost:        bcrypt.DefaultCost,
+		UserKind:          "USER",
+		StoreReadTimeout:  Duration(5 * time.Second),
+		StoreWriteTimeout: Duration(5 * time.Second),
+		SessionRenewAfter: Duration(12 * time.Hour),
+		CORSOrigins:       []string{},
+		CORSMaxAge:        Duration(10 * time.Minute),
+		WebAuthnRPID:      "localhost",
+		WebAuthnOrigin:    "https://localhost",
+		GRPCAddr:          ":50051",
+		HTTPAddr:          ":8080",
+		TLSReloadInterval: Duration(10 * time.Second),
+		ShutdownTimeout:   Duration(30 * time.Second),
+		AdminClients:      []string{},
+		APIKeyScopes:      []string{},
+		MaxSecretOverlap:  Duration(7 * 24 * time.Hour),
+		CacheBackend:      "memory",
+		CacheSize:         10000,
+		CacheTTL:          Duration(30 * time.Second),
+	}
+}
+
+// configField is a settable setting of a Config.
+type configField struct {
+	name   string
+	env    string
+	secret bool
+	value  reflect.Value
+}
+
+func (c *Config) fields() []configField {
+	v := reflect.ValueOf(c).Elem()
+	fields := []configField{}
+
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+
+		fields = append(fields, configField{
+			name:   f.Tag.Get("yaml"),
+			env:    f.Tag.Get("env"),
+			secret: f.Tag.Get("secret") == "true",
+			value:  v.Field(i),
+		})
+	}
+
+	return fields
+}
+
+func flagName(name string) string {
+	return strings.ReplaceAll(name, "_", "-")
+}
+
+// Set parses s into the setting. Lists are separated by commas.
+func (f configField) Set(s string) error {
+	switch value := f.value.Addr().Interface().(type) {
+	case *string:
+		*value = s
+	case *bool:
+		parsed, err := strconv.ParseBool(s)
+
+		if err != nil {
+			return errors.New("Expected true or false")
+		}
+
+		*value = parsed
+	case *int:
+		parsed, err := strconv.Atoi(s)
+
+		if err != nil {
+			return errors.New("Expected an integer")
+		}
+
+		*value = parsed
+	case *Duration:
+		if err := value.UnmarshalText([]byte(s)); err != nil {
+			return errors.New("Expected a duration like 1h30m")
+		}
+	case *[]string:
+		*value = []string{}
+
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				*value = append(*value, item)
+			}
+		}
+	default:
+		return fmt.Errorf("Unsupported setting type %v", f.value.Type())
+	}
+
+	return nil
+}
+
+// loadConfig resolves the Config from the defaults, a file, environment variables and the flags in args,
+// each overriding the former. The file is named by the -config flag or the AUTHSERVICE_CONFIG variable.
+// The resulting Config is validated.
+func loadConfig(args []string) (*Config, error) {
+	flags := flag.NewFlagSet("authservice", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+
+	return loadConfigFlags(flags, args)
+}
+
+// loadConfigFlags works like loadConfig but parses args with flags, so commands can add their own flags.
+// Arguments after the flags are left in flags.Args().
+func loadConfigFlags(flags *flag.FlagSet, args []string) (*Config, error) {
+	c := defaultConfig()
+
+	path, _ := lookupEnv(configEnv)
+	flags.StringVar(&path, "config", path, "Path of a YAML or TOML configuration file")
+
+	for _, f := range c.fields() {
+		if !f.secret {
+			flags.String(flagName(f.name), "", "Overrides "+f.name)
+		}
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return nil, fmt.Errorf("Invalid flags: %w", err)
+	}
+
+	// Flags are only applied after the file and the environment, so they are collected first.
+	set := map[string]string{}
+
+	flags.Visit(func(fl *flag.Flag) {
+		set[fl.Name] = fl.Value.String()
+	})
+
+	if path != "" {
+		if err := c.readFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, f := range c.fields() {
+		if value, ok := lookupEnv(f.env); ok {
+			if err := f.Set(value); err != nil {
+				return nil, fmt.Errorf("Invalid %v: %w", f.env, err)
+			}
+		}
+	}
+
+	for _, f := range c.fields() {
+		if value, ok := set[flagName(f.name)]; ok {
+			if err := f.Set(value); err != nil {
+				return nil, fmt.Errorf("Invalid flag -%v: %w", flagName(f.name), err)
+			}
+		}
+	}
+
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// readFile decodes a YAML or TOML file, chosen by its extension, into the Config.
+// Unknown keys are rejected, so misspelled settings do not go unnoticed.
+func (c *Config) readFile(path string) error {
+	extension := strings.ToLower(filepath.Ext(path))
+
+	if extension != ".yaml" && extension != ".yml" && extension != ".toml" {
+		return fmt.Errorf("Config file %v must end in .yaml, .yml or .toml", path)
+	}
+
+	content, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return fmt.Errorf("Unable to read config file: %w", err)
+	}
+
+	switch extension {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(content))
+		decoder.KnownFields(true)
+
+		if err := decoder.Decode(c); err != nil && err != io.EOF {
+			return fmt.Errorf("Invalid config file %v: %w", path, err)
+		}
+	case ".toml":
+		meta, err := toml.Decode(string(content), c)
+
+		if err != nil {
+			return fmt.Errorf("Invalid config file %v: %w", path, err)
+		}
+
+		if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("Invalid config file %v: unknown key %v", path, undecoded[0])
+		}
+	}
+
+	return nil
+}
+
+// validate reports all invalid settings at once.
+func (c *Config) validate() error {
+	problems := []string{}
+	check := func(valid bool, format string, args ...interface{}) {
+		if !valid {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+
+	check(c.Issuer != "", "issuer must not be empty")
+	check(absoluteURL(c.IssuerURL), "issuer_url must be an absolute URL but is '%v'", c.IssuerURL)
+	check(c.TokenLifetime > 0, "token_lifetime must be positive")
+	check(c.ClockSkew >= 0, "clock_skew must not be negative")
+	check(c.BcryptCost >= bcrypt.MinCost && c.BcryptCost <= bcrypt.MaxCost, "bcrypt_cost must be between %v and %v but is %v", bcrypt.MinCost, bcrypt.MaxCost, c.BcryptCost)
+	check(c.UserKind != "", "user_kind must not be empty")
+	check(c.StoreReadTimeout >= 0, "store_read_timeout must not be negative")
+	check(c.StoreWriteTimeout >= 0, "store_write_timeout must not be negative")
+	check(c.SessionRenewAfter > 0 && c.SessionRenewAfter < c.TokenLifetime, "session_renew_after must be positive and shorter than token_lifetime")
+	check(c.CORSMaxAge >= 0, "cors_max_age must not be negative")
+	check(c.WebAuthnRPID != "", "webauthn_rp_id must not be empty")
+	check(absoluteURL(c.WebAuthnOrigin), "webauthn_origin must be an absolute URL but is '%v'", c.WebAuthnOrigin)
+
+	for _, origin := range c.CORSOrigins {
+		check(absoluteURL(origin), "cors_origins must contain absolute URLs but contains '%v'", origin)
+	}
+
+	_, _, grpcErr := net.SplitHostPort(c.GRPCAddr)
+	check(grpcErr == nil, "grpc_addr must be [host]:port but is '%v'", c.GRPCAddr)
+	_, _, httpErr := net.SplitHostPort(c.HTTPAddr)
+	check(httpErr == nil, "http_addr must be [host]:port but is '%v'", c.HTTPAddr)
+
+	check((c.TLSCertFile == "") == (c.TLSKeyFile == ""), "tls_cert_file and tls_key_file must be set together")
+	check(c.TLSClientCAFile == "" || c.TLSCertFile != "", "tls_client_ca_file requires tls_cert_file and tls_key_file")
+	check(c.TLSReloadInterval > 0, "tls_reload_interval must be positive")
+	check(c.ShutdownTimeout > 0, "shutdown_timeout must be positive")
+
+	check(c.MaxSecretOverlap >= 0, "max_secret_overlap must not be negative")
+	check(checkUserScope(strings.Join(c.APIKeyScopes, " ")) == nil, "api_key_scopes must not contain scopes starting with %v", reservedScopePrefix)
+
+	check(c.CacheBackend == "none" || c.CacheBackend == "memory" || c.CacheBackend == "redis", "cache_backend must be none, memory or redis but is '%v'", c.CacheBackend)
+	check(c.CacheSize > 0, "cache_size must be positive")
+	check(c.CacheTTL > 0, "cache_ttl must be positive")
+	check(c.RedisDB >= 0, "redis_db must not be negative")
+
+	if c.CacheBackend == "redis" {
+		_, _, err := net.SplitHostPort(c.RedisAddr)
+		check(err == nil, "redis_addr must be host:port but is '%v'", c.RedisAddr)
+	}
+
+	if c.SMTPAddr != "" {
+		_, _, err := net.SplitHostPort(c.SMTPAddr)
+		check(err == nil, "smtp_addr must be host:port but is '%v'", c.SMTPAddr)
+		check(c.SMTPFrom != "", "smtp_from is required with smtp_addr")
+	}
+
+	check(c.SMTPAddr == "" || c.MailLog == "", "smtp_addr and mail_log must not be set together")
+
+	if _, err := readRSAKEY(c.RSAKey); err != nil {
+		problems = append(problems, "rsa_key is invalid: "+err.Error())
+	}
+
+	if _, err := readRSAKEY(c.PreviousRSAKey); c.PreviousRSAKey != "" && err != nil {
+		problems = append(problems, "previous_rsa_key is invalid: "+err.Error())
+	}
+
+	if _, err := readMFAKEY(c.MFAKey); c.MFAKey != "" && err != nil {
+		problems = append(problems, "mfa_key is invalid: "+err.Error())
+	}
+
+	// Only browser sessions derive CSRF tokens
+	if _, err := readKey("CSRF key", c.CSRFKey); (c.BrowserSessions || c.CSRFKey != "") && err != nil {
+		problems = append(problems, "csrf_key is invalid: "+err.Error())
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("Invalid configuration:\n  %v", strings.Join(problems, "\n  "))
+	}
+
+	return nil
+}
+
+func absoluteURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && u.Scheme != "" && u.Host != ""
+}
+
+// apply makes the Config effective by setting the package's settings.
+func (c *Config) apply() error {
+	key, err := readRSAKEY(c.RSAKey)
+
+	if err != nil {
+		return err
+	}
+
+	privateKey = key
+	previousKey = nil
+	mfaKey = nil
+	csrfKey = nil
+
+	if c.PreviousRSAKey != "" {
+		previous, err := readRSAKEY(c.PreviousRSAKey)
+
+		if err != nil {
+			return err
+		}
+
+		previousKey = &previous.PublicKey
+	}
+
+	// Without a key TOTP can not be enrolled, the other logins work as before
+	if c.MFAKey != "" {
+		secret, err := readMFAKEY(c.MFAKey)
+
+		if err != nil {
+			return err
+		}
+
+		mfaKey = secret
+	}
+
+	// Without browser_sessions the /session endpoints are not served and need no key
+	if c.BrowserSessions {
+		secret, err := readKey("CSRF key", c.CSRFKey)
+
+		if err != nil {
+			return err
+		}
+
+		csrfKey = secret
+	}
+
+	tokenIssuer = c.Issuer
+	issuerURL = c.IssuerURL
+	tokenLifetime = time.Duration(c.TokenLifetime)
+	clockSkew = time.Duration(c.ClockSkew)
+	bcryptCost = c.BcryptCost
+	userKind = c.UserKind
+	storeReadTimeout = time.Duration(c.StoreReadTimeout)
+	storeWriteTimeout = time.Duration(c.StoreWriteTimeout)
+	browserSessions = c.BrowserSessions
+	sessionRenewAfter = time.Duration(c.SessionRenewAfter)
+	corsOrigins = c.CORSOrigins
+	corsMaxAge = time.Duration(c.CORSMaxAge)
+	webauthnRPID = c.WebAuthnRPID
+	webauthnOrigin = c.WebAuthnOrigin
+	tlsReloadInterval = time.Duration(c.TLSReloadInterval)
+	shutdownTimeout = time.Duration(c.ShutdownTimeout)
+	adminClients = c.AdminClients
+	apiKeyScopes = c.APIKeyScopes
+	maxSecretOverlap = time.Duration(c.MaxSecretOverlap)
+	accessTokenAudience = c.AccessTokenAudience
+	metricsToken = c.MetricsToken
+	userCacheTTL = time.Duration(c.CacheTTL)
+
+	switch c.CacheBackend {
+	case "memory":
+		userCache = NewLRUCache(c.CacheSize)
+	case "redis":
+		userCache = NewRedisCache(c.RedisAddr, c.RedisPassword, c.RedisDB)
+	default:
+		userCache = nil
+	}
+
+	// Mails are only logged on request, as they contain live tokens
+	switch {
+	case c.SMTPAddr != "":
+		s := &SMTPMailer{Addr: c.SMTPAddr, From: c.SMTPFrom}
+
+		if c.SMTPUsername != "" {
+			host, _, _ := net.SplitHostPort(c.SMTPAddr)
+			s.Auth = smtp.PlainAuth("", c.SMTPUsername, c.SMTPPassword, host)
+		}
+
+		mailer = s
+	case c.MailLog == "-":
+		mailer = &LogMailer{Out: os.Stderr}
+	case c.MailLog != "":
+		fileMailer, err := NewFileMailer(c.MailLog)
+
+		if err != nil {
+			return fmt.Errorf("Unable to open mail_log: %w", err)
+		}
+
+		mailer = fileMailer
+	default:
+		mailer = noMailer{}
+	}
+
+	return nil
+}
+
+// print writes the Config as YAML. Secrets which are set are replaced by <redacted>.
+func (c *Config) print(w io.Writer) error {
+	shown := *c
+
+	for _, f := range shown.fields() {
+		if f.secret && f.value.String() != "" {
+			f.value.SetString(redacted)
+		}
+	}
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+
+	if err := encoder.Encode(&shown); err != nil {
+		return err
+	}
+
+	return encoder.Close()
+}
+
+// configCommand runs `config print [flags]`, which shows the effective Config.
+func configCommand(args []string, out io.Writer) error {
+	if len(args) == 0 || args[0] != "print" {
+		return errors.New("Usage: config print [-config file] [flags]")
+	}
+
+	c, err := loadConfig(args[1:])
+
+	if err != nil {
+		return err
+	}
+
+	return c.print(out)
+}
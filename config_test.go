@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// injectEnv replaces the environment with env until the returned function is called.
+func injectEnv(env map[string]string) func() {
+	lookupEnv = func(key string) (string, bool) {
+		value, ok := env[key]
+		return value, ok
+	}
+
+	return func() { lookupEnv = os.LookupEnv }
+}
+
+// testKeys returns the test keys in the encoding expected by the Config. Browser sessions are enabled, as the tests use them,
+// and passwords are hashed with bcrypt.MinCost to keep the tests fast.
+func testKeys() map[string]string {
+	rsaKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)})
+
+	return map[string]string{
+		"RSAKEY":                       string(rsaKey),
+		"MFAKEY":                       base64.StdEncoding.EncodeToString(mfaKey),
+		"AUTHSERVICE_CSRF_KEY":         base64.StdEncoding.EncodeToString(csrfKey),
+		"AUTHSERVICE_BROWSER_SESSIONS": "true",
+		"AUTHSERVICE_BCRYPT_COST":      "4",
+	}
+}
+
+func writeConfigFile(T *testing.T, name, content string) (string, func()) {
+	dir, _ := ioutil.TempDir("", "config")
+	path := filepath.Join(dir, name)
+
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		T.Fatal(err)
+	}
+
+	return path, func() { os.RemoveAll(dir) }
+}
+
+func TestLoadConfig(T *testing.T) {
+	path, cleanup := writeConfigFile(T, "config.yaml", "issuer: FileIssuer\nuser_kind: FileKind\ntoken_lifetime: 48h\nbcrypt_cost: 5\ncors_origins: [\"https://app.example\"]\n")
+	defer cleanup()
+
+	env := testKeys()
+	env["AUTHSERVICE_CONFIG"] = path
+	env["AUTHSERVICE_USER_KIND"] = "EnvKind"
+	env["AUTHSERVICE_BCRYPT_COST"] = "6"
+	defer injectEnv(env)()
+
+	c, err := loadConfig([]string{"-bcrypt-cost", "7"})
+
+	expectations := map[string]bool{
+		"Load":                  err == nil,
+		"Keep defaults":         err == nil && c.ClockSkew == Duration(5*time.Minute) && c.IssuerURL == "https://localhost",
+		"Read file":             err == nil && c.Issuer == "FileIssuer" && c.TokenLifetime == Duration(48*time.Hour) && len(c.CORSOrigins) == 1,
+		"Prefer env over file":  err == nil && c.UserKind == "EnvKind",
+		"Prefer flags over env": err == nil && c.BcryptCost == 7,
+		"Default cost":          defaultConfig().BcryptCost == bcrypt.DefaultCost,
+		"Read secrets from env": err == nil && c.RSAKey == env["RSAKEY"],
+	}
+
+	CheckExpectations(expectations, T)
+}
+
+func TestLoadConfigTOML(T *testing.T) {
+	path, cleanup := writeConfigFile(T, "config.toml", "issuer = \"FileIssuer\"\nclock_skew = \"1m\"\ncors_origins = [\"https://app.example\"]\n")
+	defer cleanup()
+	unknown, cleanupUnknown := writeConfigFile(T, "config.toml", "isuer = \"FileIssuer\"\n")
+	defer cleanupUnknown()
+	defer injectEnv(testKeys())()
+
+	c, err := loadConfig([]string{"-config", path})
+	_, unknownErr := loadConfig([]string{"-config", unknown})
+	_, extensionErr := loadConfig([]string{"-config", "config.json"})
+
+	expectations := map[string]bool{
+		"Read file":           err == nil && c.Issuer == "FileIssuer" && c.ClockSkew == Duration(time.Minute) && c.CORSOrigins[0] == "https://app.example",
+		"Reject unknown keys": unknownErr != nil && strings.Contains(unknownErr.Error(), "isuer"),
+		"Reject extension":    extensionErr != nil && strings.Contains(extensionErr.Error(), ".toml"),
+	}
+
+	CheckExpectations(expectations, T)
+}
+
+func TestConfigValidation(T *testing.T) {
+	env := testKeys()
+	env["AUTHSERVICE_TOKEN_LIFETIME"] = "0s"
+	env["AUTHSERVICE_TLS_CLIENT_CA_FILE"] = "ca.pem"
+	env["AUTHSERVICE_CACHE_BACKEND"] = "redis"
+	env["AUTHSERVICE_GRPC_ADDR"] = "50051"
+	delete(env, "MFAKEY")
+	defer injectEnv(env)()
+
+	_, err := loadConfig([]string{"-bcrypt-cost", "99", "-issuer-url", "localhost"})
+	_, durationErr := loadConfig([]string{"-clock-skew", "5"})
+	_, flagErr := loadConfig([]string{"-unknown"})
+	_, secretFlagErr := loadConfig([]string{"-mfa-key", env["RSAKEY"]})
+
+	message := ""
+	if err != nil {
+		message = err.Error()
+	}
+
+	expectations := map[string]bool{
+		"Report lifetime":       strings.Contains(message, "token_lifetime must be positive"),
+		"Report cost":           strings.Contains(message, "bcrypt_cost must be between 4 and 31 but is 99"),
+		"Report URL":            strings.Contains(message, "issuer_url must be an absolute URL but is 'localhost'"),
+		"Report TLS":            strings.Contains(message, "tls_client_ca_file requires tls_cert_file"),
+		"Report Redis":          strings.Contains(message, "redis_addr must be host:port"),
+		"Report listen address": strings.Contains(message, "grpc_addr must be [host]:port but is '50051'") && !strings.Contains(message, "http_addr"),
+		"Allow missing MFA key": !strings.Contains(message, "mfa_key"),
+		"Report malformed flag": durationErr != nil && strings.Contains(durationErr.Error(), "-clock-skew: Expected a duration"),
+		"Report unknown flag":   flagErr != nil && strings.Contains(flagErr.Error(), "unknown"),
+		"Reject secret flag":    secretFlagErr != nil && strings.Contains(secretFlagErr.Error(), "mfa-key"),
+	}
+
+	CheckExpectations(expectations, T)
+}
+
+func TestConfigPrint(T *testing.T) {
+	env := testKeys()
+	env["AUTHSERVICE_SMTP_ADDR"] = "smtp.example:587"
+	env["AUTHSERVICE_SMTP_FROM"] = "auth@example"
+	env["AUTHSERVICE_SMTP_PASSWORD"] = "SomeSMTPPassword"
+	defer injectEnv(env)()
+
+	out := &bytes.Buffer{}
+	err := configCommand([]string{"print", "-issuer", "FlagIssuer"}, out)
+	printed := out.String()
+
+	expectations := map[string]bool{
+		"Print":                 err == nil,
+		"Show effective values": strings.Contains(printed, "issuer: FlagIssuer\n") && strings.Contains(printed, "token_lifetime: 24h0m0s\n"),
+		"Redact secrets":        strings.Contains(printed, "smtp_password: <redacted>\n") && strings.Contains(printed, "mfa_key: <redacted>\n"),
+		"Hide secret values":    !strings.Contains(printed, "SomeSMTPPassword") && !strings.Contains(printed, "PRIVATE KEY"),
+		"Require subcommand":    configCommand([]string{}, out) != nil,
+	}
+
+	CheckExpectations(expectations, T)
+}
+
+func TestConfigApply(T *testing.T) {
+	env := testKeys()
+	env["AUTHSERVICE_ISSUER"] = "OtherIssuer"
+	env["AUTHSERVICE_TOKEN_LIFETIME"] = "1h"
+	env["AUTHSERVICE_SESSION_RENEW_AFTER"] = "30m"
+	defer injectEnv(env)()
+
+	defer func(issuer string, lifetime time.Duration, m Mailer) {
+		tokenIssuer, tokenLifetime, mailer, userCache = issuer, lifetime, m, nil
+	}(tokenIssuer, tokenLifetime, mailer)
+
+	n := privateKey.N
+	c, err := loadConfig([]string{})
+
+	if err != nil {
+		T.Fatal(err)
+	}
+
+	err = c.apply()
+	claims := NewClaims("SomeID")
+
+	expectations := map[string]bool{
+		"Apply":                err == nil,
+		"Issue with issuer":    claims.Iss == "OtherIssuer" && claims.Valid() == nil,
+		"Issue with lifetime":  claims.Exp == testtime.Add(time.Hour),
+		"Load keys":            privateKey.N.Cmp(n) == 0 && len(mfaKey) == 32,
+		"Refuse mails":         mailer == noMailer{},
+		"Cache users":          userCache != nil && userCacheTTL == 30*time.Second,
+		"Reject other issuers": Claims{Iss: "tooxoot", ID: "SomeID", Exp: testtime.Add(time.Hour)}.Valid() != nil,
+	}
+
+	c.MailLog = "-"
+	err = c.apply()
+	logMailer, ok := mailer.(*LogMailer)
+	expectations["Log mails on request"] = err == nil && ok && logMailer.Out == os.Stderr
+
+	key := mfaKey
+	c.MFAKey = ""
+	err = c.apply()
+	expectations["Apply without MFA key"] = err == nil && mfaKey == nil
+	mfaKey = key
+
+	csrf := csrfKey
+	c.BrowserSessions, c.CSRFKey = false, ""
+	validateErr := c.validate()
+	err = c.apply()
+	expectations["Apply without browser sessions"] = validateErr == nil && err == nil && csrfKey == nil && !browserSessions
+	c.BrowserSessions = true
+	validateErr = c.validate()
+	expectations["Require CSRF key for browser sessions"] = validateErr != nil && strings.Contains(validateErr.Error(), "csrf_key is invalid: Empty CSRF key")
+	browserSessions, csrfKey, mfaKey = true, csrf, key
+
+	CheckExpectations(expectations, T)
+}
@@ -4,29 +4,71 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log"
+	"reflect"
+	"time"
 
 	"cloud.google.com/go/datastore"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
-// UserData contains the user's persisted data
+// UserData contains the user's persisted data.
+// ID is shown to the user as entered on registration while CanonicalID is used for lookups.
 type UserData struct {
 	ID string
+	CanonicalID string
 	Hash string
+	HashAlgorithm string
 	Token string
+	TOTPSecret []byte `datastore:",noindex"`
+	TOTPConfirmed bool
+	TOTPCounter int64 `datastore:",noindex"`
+	MFAFailures int `datastore:",noindex"`
+	MFALockedUntil time.Time `datastore:",noindex"`
+	RecoveryCodes []string `datastore:",noindex"`
+	Credentials []WebAuthnCredential
+	Email string
+	EmailVerified bool
+	VerificationHash string `datastore:",noindex"`
+	ResetHash string `datastore:",noindex"`
+	Disabled bool
 	key *datastore.Key `datastore:"__key__"`
 }
 
-var generateFromPassword = bcrypt.GenerateFromPassword
-var compareHashAndPassword = bcrypt.CompareHashAndPassword
+var generateFromPassword = instrumentGenerate(bcrypt.GenerateFromPassword)
+var compareHashAndPassword = instrumentCompare(bcrypt.CompareHashAndPassword)
 var incompleteKey = datastore.IncompleteKey
 var put func(ctx context.Context, key *datastore.Key, src interface{}) (*datastore.Key, error)
 var getAll func(ctx context.Context, q *datastore.Query, dst interface{}) (keys []*datastore.Key, err error)
+var deleteKey func(ctx context.Context, key *datastore.Key) error
+var getPage func(ctx context.Context, q *datastore.Query, cursor string, dst interface{}) (keys []*datastore.Key, next string, err error)
+var insert func(ctx context.Context, key *datastore.Key, src interface{}) error
+var update func(ctx context.Context, key *datastore.Key, dst interface{}, change func() error) error
 var newQuery = datastore.NewQuery
 
+// Cost of new password hashes and Datastore kind of the UserData.
+var bcryptCost = bcrypt.DefaultCost
+var userKind = "USER"
+
+// Timeouts of single Datastore operations. They only shorten the caller's deadline; zero disables them.
+var storeReadTimeout = 5 * time.Second
+var storeWriteTimeout = 5 * time.Second
+
 // NewUserData created a new UserData object
-func NewUserData(id, pw string) *UserData {
-	hash, err := generateFromPassword([]byte(pw), bcrypt.MinCost)
+// Returns nil for IDs which can not be canonicalized or on hashing errors.
+func NewUserData(ctx context.Context, id, pw string) *UserData {
+	canonical, err := canonicalID(id)
+
+	if err != nil {
+		return nil
+	}
+
+	hash, err := hashPassword(ctx, []byte(pw))
 	
 	if err != nil {
 		return nil
@@ -34,78 +76,616 @@ func NewUserData(id, pw string) *UserData {
 
 	return &UserData{
 		ID: id,
+		CanonicalID: canonical,
 		Hash: string(hash),
 	}
 }
 
-func (ud *UserData) compare(pw string) bool {
+func (ud *UserData) compare(ctx context.Context, pw string) bool {
 	if ud == nil {
 		return false
 	}
 
-	return nil == compareHashAndPassword([]byte(ud.Hash), []byte(pw))
+	// Hash imported from another system
+	if ud.HashAlgorithm != "" {
+		return ud.compareForeign(ctx, pw)
+	}
+
+	return nil == comparePassword(ctx, []byte(ud.Hash), []byte(pw))
+}
+
+// hashPassword hashes with bcryptCost through generateFromPassword.
+func hashPassword(ctx context.Context, pw []byte) ([]byte, error) {
+	_, span := startSpan(ctx, "bcrypt.generate")
+	hash, err := generateFromPassword(pw, bcryptCost)
+	endSpan(span, err)
+
+	return hash, err
 }
 
-func writeToDB(ud *UserData) error {
+// comparePassword compares through compareHashAndPassword.
+// A mismatch is the expected outcome of a comparison and is not recorded as span error.
+func comparePassword(ctx context.Context, hash, pw []byte) error {
+	_, span := startSpan(ctx, "bcrypt.compare")
+	defer span.End()
+
+	return compareHashAndPassword(hash, pw)
+}
+
+func writeToDB(ctx context.Context, ud *UserData) error {
 	if ud == nil {
 		return nil
 	}
-	usedKey :=ud.key
 
-	if usedKey == nil {
-		usedKey = incompleteKey("USER", nil)
+	// UserData stored before IDs were canonicalized
+	if ud.CanonicalID == "" && ud.ID != "" {
+		if err := backfillCanonicalID(ctx, ud); err != nil {
+			return err
+		}
 	}
 
-	k, err := put(context.TODO(), usedKey, ud)
+	k, err := putEntity(ctx, userKind, ud.key, ud)
 
 	if err != nil  { 
 		return err
 	}
 
 	ud.key = k
+	invalidateUser(ctx, ud.ID)
 
 	return nil
 }
 
-func readUserData(query *datastore.Query) (*UserData, error) {
+// backfillCanonicalID sets the CanonicalID of a user stored before IDs were canonicalized unless another user
+// already holds it. Colliding users keep their empty CanonicalID, so both stay readable by their exact ID.
+func backfillCanonicalID(ctx context.Context, ud *UserData) error {
+	canonical, err := canonicalID(ud.ID)
+
+	if err != nil {
+		return err
+	}
+
+	taken, err := canonicalIDTaken(ctx, canonical)
+
+	if err != nil {
+		return err
+	}
+
+	if taken {
+		log.Printf("Not setting CanonicalID of '%v', '%v' is already taken by another user", ud.ID, canonical)
+		return nil
+	}
+
+	ud.CanonicalID = canonical
+
+	return nil
+}
+
+// canonicalIDTaken reports whether a stored user holds the CanonicalID.
+func canonicalIDTaken(ctx context.Context, canonical string) (bool, error) {
+	dst := []*UserData{}
+
+	if err := getEntities(ctx, newQuery(userKind).Filter("CanonicalID =", canonical).Project("ID", "Token"), &dst); err != nil {
+		return false, err
+	}
+
+	return len(dst) > 0, nil
+}
+
+func (ud *UserData) setKey(key *datastore.Key) {
+	ud.key = key
+}
+
+// deleteUser deletes the user from the store and the userCache.
+func deleteUser(ctx context.Context, ud *UserData) error {
+	if err := deleteEntity(ctx, ud.key); err != nil {
+		return err
+	}
+
+	invalidateUser(ctx, ud.ID)
+
+	return nil
+}
+
+func readUserData(ctx context.Context, query *datastore.Query) (*UserData, error) {
 	if query == nil {
 		return nil, errors.New("nil query")
 	}
 
 	dst  := []*UserData{}
-	_, err := getAll(context.TODO(), query, &dst)
+	err := getEntities(ctx, query, &dst)
 	
 	if err != nil {
 		return nil, err
 	}
 
-	if (len(dst) == 0) {
-		return nil, fmt.Errorf("No Results for Query '%v'", query)
+	if err := singleResult(len(dst), query); err != nil {
+		return nil, err
 	}
 
-	if (len(dst) != 1) {
-		return nil, fmt.Errorf("Got %v results for Query '%v'", len(dst), query)
+	return dst[0], nil
+}
+
+// putEntity stores src under the given key or a new incomplete key of the given kind.
+func putEntity(ctx context.Context, kind string, key *datastore.Key, src interface{}) (*datastore.Key, error) {
+	if key == nil {
+		key = incompleteKey(kind, nil)
 	}
 
-	return dst[0], nil
+	ctx, cancel := withStoreTimeout(ctx, storeWriteTimeout)
+	defer cancel()
+
+	ctx, span := startSpan(ctx, "datastore.put", trace.WithAttributes(attribute.String("datastore.kind", kind)))
+	defer observeSince(storeDuration.WithLabelValues("put"), time.Now())
+
+	k, err := put(ctx, key, src)
+	err = storeError(ctx, err)
+	endSpan(span, err)
+
+	return k, err
 }
 
-func readTokenByID(id string) (*UserData, error) {
+// errAlreadyExists is returned by insertEntity for keys under which an entity is already stored.
+var errAlreadyExists = errors.New("Entity already exists")
+
+// insertEntity stores src under the complete key unless an entity is already stored under it.
+// Of concurrent inserts of the same key only one succeeds.
+func insertEntity(ctx context.Context, key *datastore.Key, src interface{}) error {
+	ctx, cancel := withStoreTimeout(ctx, storeWriteTimeout)
+	defer cancel()
+
+	ctx, span := startSpan(ctx, "datastore.insert", trace.WithAttributes(attribute.String("datastore.kind", key.Kind)))
+	defer observeSince(storeDuration.WithLabelValues("insert"), time.Now())
+
+	err := insert(ctx, key, src)
+
+	if status.Code(err) == codes.AlreadyExists {
+		err = errAlreadyExists
+	}
+
+	err = storeError(ctx, err)
+	endSpan(span, err)
+
+	return err
+}
+
+// updateEntity reads the entity stored under key into dst, applies change and stores dst in one transaction.
+// Concurrent updates of the entity make Datastore retry the transaction, so change may run several times
+// but never on a stale entity. An error returned by change aborts the update.
+func updateEntity(ctx context.Context, key *datastore.Key, dst interface{}, change func() error) error {
+	if key == nil {
+		return errors.New("Entity has no key")
+	}
+
+	ctx, cancel := withStoreTimeout(ctx, storeWriteTimeout)
+	defer cancel()
+
+	ctx, span := startSpan(ctx, "datastore.update", trace.WithAttributes(attribute.String("datastore.kind", key.Kind)))
+	defer observeSince(storeDuration.WithLabelValues("update"), time.Now())
+
+	err := storeError(ctx, update(ctx, key, dst, change))
+	endSpan(span, err)
+
+	return err
+}
+
+// updateUser applies change to the stored UserData of ud in a transaction and replaces ud with the result.
+func updateUser(ctx context.Context, ud *UserData, change func(stored *UserData) error) error {
+	stored := &UserData{}
+
+	if err := updateEntity(ctx, ud.key, stored, func() error { return change(stored) }); err != nil {
+		return err
+	}
+
+	stored.key = ud.key
+	*ud = *stored
+	invalidateUser(ctx, ud.ID)
+
+	return nil
+}
+
+// Datastore kind of the usedTokens.
+const usedTokenKind = "USEDTOKEN"
+
+// usedToken marks a single use token as used. It is named after the hashToken of the token.
+// Exp is the time after which the token is invalid anyway, so the usedToken can be deleted.
+type usedToken struct {
+	Exp time.Time
+}
+
+// consumeToken marks the token as used. It fails with errAlreadyExists if the token was used before,
+// also if it was used concurrently on another instance.
+func consumeToken(ctx context.Context, token string, exp time.Time) error {
+	return insertEntity(ctx, datastore.NameKey(usedTokenKind, hashToken(token), nil), &usedToken{Exp: exp})
+}
+
+// deleteEntity deletes the entity stored under key.
+func deleteEntity(ctx context.Context, key *datastore.Key) error {
+	if key == nil {
+		return errors.New("Entity has no key")
+	}
+
+	ctx, cancel := withStoreTimeout(ctx, storeWriteTimeout)
+	defer cancel()
+
+	ctx, span := startSpan(ctx, "datastore.delete", trace.WithAttributes(attribute.String("datastore.kind", key.Kind)))
+	defer observeSince(storeDuration.WithLabelValues("delete"), time.Now())
+
+	err := storeError(ctx, deleteKey(ctx, key))
+	endSpan(span, err)
+
+	return err
+}
+
+// keyedEntity is an entity which keeps the key it is stored under, so writing it again replaces it
+// instead of storing a copy under a new key.
+type keyedEntity interface {
+	setKey(key *datastore.Key)
+}
+
+// setKeys sets the keys returned by getAll or getPage on the keyedEntities they loaded into dst.
+// Datastore only fills exported fields, so the unexported key fields stay empty otherwise.
+func setKeys(dst interface{}, keys []*datastore.Key) {
+	slice := reflect.ValueOf(dst).Elem()
+	offset := slice.Len() - len(keys)
+
+	for i, key := range keys {
+		if offset+i < 0 {
+			continue
+		}
+
+		if entity, ok := slice.Index(offset + i).Interface().(keyedEntity); ok {
+			entity.setKey(key)
+		}
+	}
+}
+
+// getEntities runs the query through getAll and sets the keys of the loaded entities.
+func getEntities(ctx context.Context, query *datastore.Query, dst interface{}) error {
+	ctx, cancel := withStoreTimeout(ctx, storeReadTimeout)
+	defer cancel()
+
+	ctx, span := startSpan(ctx, "datastore.getAll")
+	defer observeSince(storeDuration.WithLabelValues("getAll"), time.Now())
+
+	keys, err := getAll(ctx, query, dst)
+	err = storeError(ctx, err)
+	endSpan(span, err)
+
+	if err == nil {
+		setKeys(dst, keys)
+	}
+
+	return err
+}
+
+// getEntityPage runs the query from the cursor through getPage and returns the cursor following the results.
+// An empty cursor starts at the first result. Like getEntities it sets the keys of the loaded entities.
+func getEntityPage(ctx context.Context, query *datastore.Query, cursor string, dst interface{}) (string, error) {
+	ctx, cancel := withStoreTimeout(ctx, storeReadTimeout)
+	defer cancel()
+
+	ctx, span := startSpan(ctx, "datastore.getPage")
+	defer observeSince(storeDuration.WithLabelValues("getPage"), time.Now())
+
+	keys, next, err := getPage(ctx, query, cursor, dst)
+	err = storeError(ctx, err)
+	endSpan(span, err)
+
+	if err == nil {
+		setKeys(dst, keys)
+	}
+
+	return next, err
+}
+
+func withStoreTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, timeout)
+}
+
+// storeError maps failures caused by an exceeded deadline or a cancellation of ctx to their gRPC status.
+// Other errors are returned unchanged.
+func storeError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) || ctx.Err() == context.DeadlineExceeded {
+		return status.Error(codes.DeadlineExceeded, "Datastore operation exceeded its deadline")
+	}
+
+	if errors.Is(err, context.Canceled) || ctx.Err() == context.Canceled {
+		return status.Error(codes.Canceled, "Datastore operation was canceled")
+	}
+
+	return err
+}
+
+// errNotFound is wrapped by the errors of reads which found nothing, so callers can tell them from failures.
+var errNotFound = errors.New("No Results")
+
+// errIDCollision is wrapped by the errors of lookups whose ID matches several users,
+// e.g. users stored before IDs were canonicalized whose IDs differ only by case or width.
+var errIDCollision = errors.New("ID collision")
+
+// singleResult returns an error unless a query returned exactly one result.
+func singleResult(count int, query *datastore.Query) error {
+	if count == 0 {
+		return fmt.Errorf("%w for Query '%v'", errNotFound, query)
+	}
+
+	if count != 1 {
+		return fmt.Errorf("Got %v results for Query '%v'", count, query)
+	}
+
+	return nil
+}
+
+func readTokenByID(ctx context.Context, id string) (*UserData, error) {
+	if id == "" {
+		return nil, errors.New("empty id")
+	}
+
+	return lookupUser(ctx, id, "ID", "Token")
+}
+
+// userExists reports whether a user with the ID or one canonicalizing alike is stored. It reads the store,
+// not the userCache. Failed reads are returned as error and never reported as a free ID.
+func userExists(ctx context.Context, id string) (bool, error) {
+	_, err := lookupUser(ctx, id, "ID", "Token")
+
+	switch {
+	case err == nil, errors.Is(err, errIDCollision):
+		return true, nil
+	case !errors.Is(err, errNotFound):
+		return false, err
+	}
+
+	return legacyUserExists(ctx, id)
+}
+
+// legacyUserExists reports whether a user stored before IDs were canonicalized has an ID canonicalizing like id.
+// lookupUser finds those users only by their exact ID. After the canonical IDs migration every one of them holds
+// its CanonicalID or collides with the user holding it, so the IDs of all users are only scanned before.
+func legacyUserExists(ctx context.Context, id string) (bool, error) {
+	state, err := readMigrationState(ctx, canonicalIDsMigration)
+
+	if err != nil || state.Done {
+		return false, err
+	}
+
+	canonical, err := canonicalID(id)
+
+	if err != nil {
+		return false, err
+	}
+
+	users := []*UserData{}
+
+	if err := getEntities(ctx, newQuery(userKind).Project("ID"), &users); err != nil {
+		return false, err
+	}
+
+	for _, ud := range users {
+		if other, err := canonicalID(ud.ID); err == nil && other == canonical {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// insertUser stores a new user under a key named after its CanonicalID. Of concurrent inserts of users whose
+// IDs canonicalize alike only one succeeds, the others fail with errAlreadyExists. Users stored under other
+// keys, e.g. before users were inserted, are not detected, so callers check userExists first.
+func insertUser(ctx context.Context, ud *UserData) error {
+	key := datastore.NameKey(userKind, ud.CanonicalID, nil)
+
+	if err := insertEntity(ctx, key, ud); err != nil {
+		return err
+	}
+
+	ud.key = key
+	invalidateUser(ctx, ud.ID)
+
+	return nil
+}
+
+// errUserDisabled is returned for users disabled by an operator. They can not authenticate in any way.
+var errUserDisabled = errors.New("User is disabled")
+
+// readComplete reads the UserData of an enabled user.
+func readComplete(ctx context.Context, id string) (*UserData, error) {
+	ud, err := readUser(ctx, id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if ud.Disabled {
+		return nil, errUserDisabled
+	}
+
+	return ud, nil
+}
+
+// readExactUser reads the UserData of the enabled user stored with exactly the id. Unlike readComplete it
+// never returns a user whose ID only canonicalizes alike, so it is used for IDs which were stored as they are.
+func readExactUser(ctx context.Context, id string) (*UserData, error) {
 	if id == "" {
 		return nil, errors.New("empty id")
 	}
 
-	q := newQuery("USER").Filter("ID =", id).Project("ID", "Token")
+	query := newQuery(userKind).Filter("ID =", id)
+	ud, err := readUserData(ctx, query)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if ud.Disabled {
+		return nil, errUserDisabled
+	}
 
-	return readUserData(q)
+	return ud, nil
 }
 
-func readComplete(id string) (*UserData, error) {
+// readUser reads the UserData of an enabled or disabled user.
+func readUser(ctx context.Context, id string) (*UserData, error) {
 	if id == "" {
 		return nil, errors.New("empty id")
 	}
 
-	q := newQuery("USER").Filter("ID =", id)
+	return lookupUser(ctx, id)
+}
+
+// lookupUser reads the user whose CanonicalID matches the id, projected to the properties if any are given.
+// Users stored before IDs were canonicalized have no CanonicalID until they are migrated or written again,
+// so they are found by their exact ID. A user stored with exactly the id is preferred over one whose ID only
+// canonicalizes alike. IDs matching several users are logged and fail with errIDCollision.
+func lookupUser(ctx context.Context, id string, properties ...string) (*UserData, error) {
+	canonical, err := canonicalID(id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	matches, err := queryUsers(ctx, "CanonicalID =", canonical, properties)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(matches) == 1 && matches[0].ID == id {
+		return matches[0], nil
+	}
+
+	if len(matches) <= 1 {
+		legacy, err := queryUsers(ctx, "ID =", id, properties)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if len(legacy) == 1 {
+			return legacy[0], nil
+		}
+
+		if len(legacy) == 0 && len(matches) == 1 {
+			return matches[0], nil
+		}
+
+		matches = append(matches, legacy...)
+	}
+
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("%w for ID '%v'", errNotFound, id)
+	}
+
+	log.Printf("ID '%v' matches %v stored users, their IDs differ only by case or width", id, len(matches))
+
+	return nil, fmt.Errorf("%w: '%v' matches %v users", errIDCollision, id, len(matches))
+}
+
+func queryUsers(ctx context.Context, filter, value string, properties []string) ([]*UserData, error) {
+	q := newQuery(userKind).Filter(filter, value)
+
+	if len(properties) > 0 {
+		q = q.Project(properties...)
+	}
+
+	dst := []*UserData{}
+
+	if err := getEntities(ctx, q, &dst); err != nil {
+		return nil, err
+	}
+
+	return dst, nil
+}
+
+// connectStore connects put, getAll, getPage, insert, update and deleteKey to the Datastore of the project.
+// An empty projectID is detected from the environment, e.g. DATASTORE_PROJECT_ID for the emulator.
+func connectStore(ctx context.Context, projectID string) (*datastore.Client, error) {
+	client, err := datastore.NewClient(ctx, projectID)
+
+	if err != nil {
+		return nil, fmt.Errorf("Unable to connect to Datastore: %w", err)
+	}
+
+	put = client.Put
+	getAll = client.GetAll
+	deleteKey = client.Delete
+	getPage = pageOf(client)
+	insert = func(ctx context.Context, key *datastore.Key, src interface{}) error {
+		_, err := client.Mutate(ctx, datastore.NewInsert(key, src))
+		return err
+	}
+	update = func(ctx context.Context, key *datastore.Key, dst interface{}, change func() error) error {
+		_, err := client.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+			// a retried transaction must not see the fields loaded by the previous attempt
+			reflect.ValueOf(dst).Elem().Set(reflect.Zero(reflect.TypeOf(dst).Elem()))
+
+			if err := tx.Get(key, dst); err != nil {
+				return err
+			}
+
+			if err := change(); err != nil {
+				return err
+			}
+
+			_, err := tx.Put(key, dst)
+			return err
+		})
+
+		return err
+	}
+
+	return client, nil
+}
+
+// pageOf implements getPage with Datastore cursors. dst is a pointer to a slice of struct pointers like for getAll.
+func pageOf(client *datastore.Client) func(ctx context.Context, q *datastore.Query, cursor string, dst interface{}) ([]*datastore.Key, string, error) {
+	return func(ctx context.Context, q *datastore.Query, cursor string, dst interface{}) ([]*datastore.Key, string, error) {
+		if cursor != "" {
+			start, err := datastore.DecodeCursor(cursor)
+
+			if err != nil {
+				return nil, "", fmt.Errorf("Invalid cursor: %w", err)
+			}
+
+			q = q.Start(start)
+		}
+
+		slice := reflect.ValueOf(dst).Elem()
+		keys := []*datastore.Key{}
+		it := client.Run(ctx, q)
 
-	return readUserData(q)
+		for {
+			entity := reflect.New(slice.Type().Elem().Elem())
+			key, err := it.Next(entity.Interface())
+
+			if err == iterator.Done {
+				break
+			}
+
+			if err != nil {
+				return nil, "", err
+			}
+
+			slice.Set(reflect.Append(slice, entity))
+			keys = append(keys, key)
+		}
+
+		next, err := it.Cursor()
+
+		if err != nil {
+			return nil, "", err
+		}
+
+		return keys, next.String(), nil
+	}
 }
@@ -4,10 +4,15 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"reflect"
+	"strconv"
 	"testing"
+	"time"
 
 	"cloud.google.com/go/datastore"
 	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 func TestNewUserData(T *testing.T) {
@@ -19,13 +24,14 @@ func TestNewUserData(T *testing.T) {
 		expectations["Pass MinCost"] = c == bcrypt.MinCost
 		return []byte("generatedHash"), nil 
 	}
-	userData := NewUserData("SomeID", "SomePW")
-	expectations["Return correct Userdata"] = fmt.Sprintf("%+v", userData) == "&{ID:SomeID Hash:generatedHash Token: key:<nil>}"
+	userData := NewUserData(testctx, "SomeID", "SomePW")
+	expectations["Return correct Userdata"] = fmt.Sprintf("%+v", userData) == "&{ID:SomeID CanonicalID:someid Hash:generatedHash HashAlgorithm: Token: TOTPSecret:[] TOTPConfirmed:false TOTPCounter:0 MFAFailures:0 MFALockedUntil:0001-01-01 00:00:00 +0000 UTC RecoveryCodes:[] Credentials:[] Email: EmailVerified:false VerificationHash: ResetHash: Disabled:false key:<nil>}"
 
 	generateFromPassword = func (b []byte, c int) ([]byte, error) { 
 		return nil, errors.New("") 
 	}	
-	expectations["Return nil on hashing error"] = NewUserData("SomeID", "SomePW") == nil
+	expectations["Return nil on hashing error"] = NewUserData(testctx, "SomeID", "SomePW") == nil
+	expectations["Return nil on invalid ID"] = NewUserData(testctx, "Some ID", "SomePW") == nil
 
 	CheckExpectations(expectations, T)
 }
@@ -35,9 +41,9 @@ func TestCompare(T *testing.T) {
 	usedPW := "SomePW"
 
 	var userData *UserData
-	expectations["Return false on nil UserData"] = userData.compare(usedPW)
+	expectations["Return false on nil UserData"] = userData.compare(testctx, usedPW)
 
-	userData = &UserData{"ID1", "Hash1", "Token1", nil}
+	userData = &UserData{ID: "ID1", Hash: "Hash1", Token: "Token1"}
 
 
 	compareHashAndPassword = func(b1 []byte, b2 []byte) error { 
@@ -46,12 +52,12 @@ func TestCompare(T *testing.T) {
 		expectations["Pass Password"] = string(b1) == usedPW
 		return nil 
 	}
-	expectations["Return true on nil error"] = userData.compare(usedPW)
+	expectations["Return true on nil error"] = userData.compare(testctx, usedPW)
 	
 	compareHashAndPassword = func(_ []byte, _ []byte) error { 
 		return errors.New("") 
 	}
-	expectations["Return false on error"] = userData.compare(usedPW)
+	expectations["Return false on error"] = userData.compare(testctx, usedPW)
 }
 
 
@@ -61,7 +67,7 @@ func TestWriteToDB(T *testing.T) {
 		expectations := map[string]bool{}
 		var userData *UserData
 		
-		expectations["Nil error on nil UserData"] = writeToDB(userData) == nil
+		expectations["Nil error on nil UserData"] = writeToDB(testctx, userData) == nil
 	
 		CheckExpectations(expectations, t)
 	})
@@ -83,7 +89,7 @@ func TestWriteToDB(T *testing.T) {
 			return usedKey2, nil
 		}
 		
-		expectations["Nil error on valid UserData"] = writeToDB(userData) == nil 
+		expectations["Nil error on valid UserData"] = writeToDB(testctx, userData) == nil 
 		expectations["Set UserData key to key from put"] = userData.key == usedKey2 
 		
 		CheckExpectations(expectations, T)
@@ -107,7 +113,7 @@ func TestWriteToDB(T *testing.T) {
 			return usedKey2, nil
 		}
 		
-		expectations["Nil error on valid UserData"] = writeToDB(userData) == nil 
+		expectations["Nil error on valid UserData"] = writeToDB(testctx, userData) == nil 
 		expectations["Set UserData key to key from put"] = userData.key == usedKey2 
 		
 		CheckExpectations(expectations, T)
@@ -128,7 +134,7 @@ func TestWriteToDB(T *testing.T) {
 			return &datastore.Key{}, thrownError
 		}
 		
-		expectations["Return error from put"] = writeToDB(userData) == thrownError 
+		expectations["Return error from put"] = writeToDB(testctx, userData) == thrownError 
 		expectations["Nil key on UserData"] = userData.key == nil 
 		
 		CheckExpectations(expectations, T)
@@ -139,7 +145,7 @@ func TestReadUserData(T *testing.T) {
 	T.Run("Nil Query", func(t *testing.T){
 		expectations := map[string]bool{}
 		
-		result, err := readUserData(nil)
+		result, err := readUserData(testctx, nil)
 
 		expectations["Nil result on nil Query"] =  result == nil
 		expectations["Error on nil Query"] =  err.Error() == "nil query" 
@@ -149,7 +155,7 @@ func TestReadUserData(T *testing.T) {
 
 	T.Run("Valid UserData", func(t *testing.T){
 		expectations := map[string]bool{}
-		userDataFromRead := &UserData{"ID1", "Hash1", "Token1", nil}
+		userDataFromRead := &UserData{ID: "ID1", Hash: "Hash1", Token: "Token1"}
 		query := &datastore.Query{}
 	
 		getAll = func(ctx context.Context, q *datastore.Query, dst interface{}) ([]*datastore.Key, error) {
@@ -161,7 +167,7 @@ func TestReadUserData(T *testing.T) {
 			return nil, nil	
 		}
 
-		result, err := readUserData(query)
+		result, err := readUserData(testctx, query)
 	
 		expectations["Return UserData from getAll"] = result == userDataFromRead
 		expectations["Nil Error on valid UserData"] = err == nil 
@@ -183,7 +189,7 @@ func TestReadUserData(T *testing.T) {
 			return nil, thrownError	
 		}
 	
-		result, err := readUserData(&datastore.Query{})
+		result, err := readUserData(testctx, &datastore.Query{})
 
 		expectations["Do not return UserData"] = result == nil
 		expectations["Return error from getAll"] = err == thrownError 
@@ -204,7 +210,7 @@ func TestReadUserData(T *testing.T) {
 			return nil, nil	
 		}
 	
-		result, err := readUserData(&datastore.Query{})
+		result, err := readUserData(testctx, &datastore.Query{})
 
 		expectations["Do not return UserData"] = result == nil
 		expectations["Return error on empty result list"] = err.Error() == fmt.Sprintf("No Results for Query '%v'", &datastore.Query{})
@@ -214,7 +220,7 @@ func TestReadUserData(T *testing.T) {
 
 	T.Run("Too many results", func(t *testing.T){
 		expectations := map[string]bool{}
-		userDataFromRead := &UserData{"ID1", "Hash1", "Token1", nil}
+		userDataFromRead := &UserData{ID: "ID1", Hash: "Hash1", Token: "Token1"}
 		
 		newQuery = func(kind string) *datastore.Query {
 			expectations["Call newQuery"] = true
@@ -229,7 +235,7 @@ func TestReadUserData(T *testing.T) {
 			return nil, nil	
 		}
 	
-		result, err := readUserData(&datastore.Query{})
+		result, err := readUserData(testctx, &datastore.Query{})
 	
 		expectations["Do not return UserData"] = result == nil
 		expectations["Return error on empty result list"] = err.Error() == fmt.Sprintf("Got 2 results for Query '%v'", &datastore.Query{})
@@ -242,7 +248,7 @@ func TestReadTokenByID(T *testing.T) {
 	T.Run("Empty String", func(t *testing.T){
 		expectations := map[string]bool{}
 		
-		result, err := readTokenByID("")
+		result, err := readTokenByID(testctx, "")
 
 		expectations["Return nil result"] =  result == nil
 		expectations["Return error"] =  err.Error() == "empty id" 
@@ -252,19 +258,19 @@ func TestReadTokenByID(T *testing.T) {
 
 	T.Run("Valid id", func(t *testing.T){
 		expectations := map[string]bool{}
-		userDataFromRead := &UserData{"ID1", "Hash1", "Token1", nil}
+		userDataFromRead := &UserData{ID: "ID1", Hash: "Hash1", Token: "Token1"}
 		
 
 		getAll = func(ctx context.Context, q *datastore.Query, dst interface{}) ([]*datastore.Key, error) {
 			expectations["Call getAll"] = true
-			expectedQuery := newQuery("USER").Filter("ID =", "ID1").Project("ID", "Token")
+			expectedQuery := newQuery("USER").Filter("CanonicalID =", "id1").Project("ID", "Token")
 			expectations["Use projected id query"] = fmt.Sprint(q) == fmt.Sprint(expectedQuery)
 			slice, _ := dst.(*[]*UserData)
 			*slice = append(*slice, userDataFromRead)
 			return nil, nil	
 		}
 		
-		result, err := readTokenByID("ID1")
+		result, err := readTokenByID(testctx, "ID1")
 
 		expectations["Return read UserData"] = fmt.Sprint(result) == fmt.Sprint(userDataFromRead)
 		expectations["Return nil error"] =  err == nil
@@ -276,23 +282,267 @@ func TestReadTokenByID(T *testing.T) {
 func TestReadComplete(T *testing.T) {
 	T.Run("Valid id", func(t *testing.T){
 		expectations := map[string]bool{}
-		userDataFromRead := &UserData{"ID1", "Hash1", "Token1", nil}
+		userDataFromRead := &UserData{ID: "ID1", Hash: "Hash1", Token: "Token1"}
 		
 
 		getAll = func(ctx context.Context, q *datastore.Query, dst interface{}) ([]*datastore.Key, error) {
 			expectations["Call getAll"] = true
-			expectedQuery := newQuery("USER").Filter("ID =", "ID1")
+			expectedQuery := newQuery("USER").Filter("CanonicalID =", "id1")
 			expectations["Use projected id query"] = fmt.Sprint(q) == fmt.Sprint(expectedQuery)
 			slice, _ := dst.(*[]*UserData)
 			*slice = append(*slice, userDataFromRead)
 			return nil, nil	
 		}
 		
-		result, err := readComplete("ID1")
+		result, err := readComplete(testctx, "ID1")
 
 		expectations["Return read UserData"] = fmt.Sprint(result) == fmt.Sprint(userDataFromRead)
 		expectations["Return nil error"] =  err == nil
 	
 		CheckExpectations(expectations, t)
 	})
-}
\ No newline at end of file
+}
+
+func TestUpdateStoredUser(T *testing.T) {
+	generateFromPassword = bcrypt.GenerateFromPassword
+	store := injectMemoryStore(NewUserData(testctx, "SomeID", "SomePW"))
+	ud, err := readComplete(testctx, "SomeID")
+
+	expectations := map[string]bool{
+		"Read without error":  err == nil,
+		"Set key of the read": err == nil && ud.key != nil && ud.key.Equal(store.keys[0]),
+	}
+
+	ud.Token = "SomeToken"
+	err = writeToDB(testctx, ud)
+	updated, readErr := readTokenByID(testctx, "SomeID")
+
+	expectations["Write without error"] = err == nil
+	expectations["Replace the stored user"] = store.count("USER") == 1
+	expectations["Read the update"] = readErr == nil && updated.Token == "SomeToken"
+
+	CheckExpectations(expectations, T)
+}
+
+func TestStoreDeadlines(T *testing.T) {
+	blockingGetAll := func(ctx context.Context, q *datastore.Query, dst interface{}) ([]*datastore.Key, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	blockingPut := func(ctx context.Context, key *datastore.Key, src interface{}) (*datastore.Key, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	getAll, put = blockingGetAll, blockingPut
+	storeReadTimeout, storeWriteTimeout = time.Millisecond, time.Millisecond
+	defer func() { storeReadTimeout, storeWriteTimeout = 5*time.Second, 5*time.Second }()
+
+	_, readErr := readComplete(testctx, "ID1")
+	writeErr := writeToDB(testctx, &UserData{ID: "ID1"})
+
+	storeReadTimeout = 0
+	deadline, cancelDeadline := context.WithTimeout(testctx, time.Millisecond)
+	defer cancelDeadline()
+	_, deadlineErr := readTokenByID(deadline, "ID1")
+
+	canceled, cancel := context.WithCancel(testctx)
+	cancel()
+	_, canceledErr := readTokenByID(canceled, "ID1")
+
+	expectations := map[string]bool{
+		"Time out reads":        status.Code(readErr) == codes.DeadlineExceeded,
+		"Time out writes":       status.Code(writeErr) == codes.DeadlineExceeded,
+		"Apply caller deadline": status.Code(deadlineErr) == codes.DeadlineExceeded,
+		"Map cancellation":      status.Code(canceledErr) == codes.Canceled,
+		"Keep other errors":     storeError(testctx, errors.New("SomeError")).Error() == "SomeError",
+	}
+
+	CheckExpectations(expectations, T)
+}
+
+// memoryStore fakes put, getAll, getPage, insert, update and deleteKey on a set of entities and behaves like Datastore:
+// keys are kept apart from the entities and only handed out by getAll and getPage, the key fields of the entities
+// are never set by the store. put with an incomplete key stores a new entity, with a complete key it replaces
+// the entity stored under that key. insert fails for keys which are already stored. update changes the stored
+// entity in place, so pointers handed out by getAll see the change.
+// getPage returns the entities of the kind in pages of the query's limit, its cursors are offsets.
+// A query matches an entity if it equals an equality filter on one of the entity's string fields
+// or selects the entity's whole kind.
+type memoryStore struct {
+	entities []interface{}
+	keys     []*datastore.Key
+	nextID   int64
+}
+
+var entityKinds = map[reflect.Type]string{
+	reflect.TypeOf(&UserData{}): "USER",
+	reflect.TypeOf(&OAuthClient{}): "CLIENT",
+	reflect.TypeOf(&OAuthGrant{}): "GRANT",
+	reflect.TypeOf(&APIKey{}): "APIKEY",
+	reflect.TypeOf(&migrationState{}): "MIGRATION",
+}
+
+// add stores the entity under a new key of its kind, like put with an incomplete key.
+func (store *memoryStore) add(entity interface{}) *datastore.Key {
+	return store.addKind(entityKinds[reflect.TypeOf(entity)], entity)
+}
+
+func (store *memoryStore) addKind(kind string, entity interface{}) *datastore.Key {
+	store.nextID++
+	key := datastore.IDKey(kind, store.nextID, nil)
+	store.entities = append(store.entities, entity)
+	store.keys = append(store.keys, key)
+
+	return key
+}
+
+// count returns the number of entities stored under keys of the kind.
+func (store *memoryStore) count(kind string) int {
+	count := 0
+
+	for _, key := range store.keys {
+		if key.Kind == kind {
+			count++
+		}
+	}
+
+	return count
+}
+
+func (store *memoryStore) index(key *datastore.Key) int {
+	for i, stored := range store.keys {
+		if key != nil && stored.Equal(key) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func injectMemoryStore(entities ...interface{}) *memoryStore {
+	store := &memoryStore{}
+	userCache = nil
+	incompleteKey = datastore.IncompleteKey
+
+	for _, entity := range entities {
+		store.add(entity)
+	}
+
+	put = func(ctx context.Context, key *datastore.Key, src interface{}) (*datastore.Key, error) {
+		if key.Incomplete() {
+			return store.addKind(key.Kind, src), nil
+		}
+
+		if i := store.index(key); i >= 0 {
+			store.entities[i] = src
+			return key, nil
+		}
+
+		store.entities = append(store.entities, src)
+		store.keys = append(store.keys, key)
+		return key, nil
+	}
+
+	getAll = func(ctx context.Context, q *datastore.Query, dst interface{}) ([]*datastore.Key, error) {
+		slice := reflect.ValueOf(dst).Elem()
+		keys := []*datastore.Key{}
+
+		for i, entity := range store.entities {
+			if reflect.TypeOf(entity) == slice.Type().Elem() && matchesQuery(entity, q) {
+				slice.Set(reflect.Append(slice, reflect.ValueOf(entity)))
+				keys = append(keys, store.keys[i])
+			}
+		}
+
+		return keys, nil
+	}
+
+	getPage = func(ctx context.Context, q *datastore.Query, cursor string, dst interface{}) ([]*datastore.Key, string, error) {
+		slice := reflect.ValueOf(dst).Elem()
+		keys := []*datastore.Key{}
+		offset, _ := strconv.Atoi(cursor)
+		limit := int(reflect.ValueOf(q).Elem().FieldByName("limit").Int())
+		matched := 0
+
+		for i, entity := range store.entities {
+			if reflect.TypeOf(entity) != slice.Type().Elem() {
+				continue
+			}
+
+			if matched >= offset && slice.Len() < limit {
+				slice.Set(reflect.Append(slice, reflect.ValueOf(entity)))
+				keys = append(keys, store.keys[i])
+			}
+
+			matched++
+		}
+
+		return keys, strconv.Itoa(offset + slice.Len()), nil
+	}
+
+	insert = func(ctx context.Context, key *datastore.Key, src interface{}) error {
+		if store.index(key) >= 0 {
+			return status.Error(codes.AlreadyExists, "entity already exists")
+		}
+
+		store.entities = append(store.entities, src)
+		store.keys = append(store.keys, key)
+		return nil
+	}
+
+	update = func(ctx context.Context, key *datastore.Key, dst interface{}, change func() error) error {
+		i := store.index(key)
+
+		if i < 0 {
+			return datastore.ErrNoSuchEntity
+		}
+
+		stored := reflect.ValueOf(store.entities[i]).Elem()
+		reflect.ValueOf(dst).Elem().Set(stored)
+
+		if err := change(); err != nil {
+			return err
+		}
+
+		stored.Set(reflect.ValueOf(dst).Elem())
+		return nil
+	}
+
+	deleteKey = func(ctx context.Context, key *datastore.Key) error {
+		if i := store.index(key); i >= 0 {
+			store.entities = append(store.entities[:i], store.entities[i+1:]...)
+			store.keys = append(store.keys[:i], store.keys[i+1:]...)
+			return nil
+		}
+
+		return datastore.ErrNoSuchEntity
+	}
+
+	return store
+}
+
+func matchesQuery(entity interface{}, q *datastore.Query) bool {
+	value := reflect.ValueOf(entity).Elem()
+	kind := entityKinds[reflect.TypeOf(entity)]
+
+	if fmt.Sprint(q) == fmt.Sprint(datastore.NewQuery(kind)) || fmt.Sprint(q) == fmt.Sprint(datastore.NewQuery(kind).Project("ID")) {
+		return true
+	}
+
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+
+		if field.PkgPath != "" || field.Type.Kind() != reflect.String || value.Field(i).String() == "" {
+			continue
+		}
+
+		candidate := datastore.NewQuery(kind).Filter(field.Name+" =", value.Field(i).String())
+
+		if fmt.Sprint(q) == fmt.Sprint(candidate) || fmt.Sprint(q) == fmt.Sprint(candidate.Project("ID", "Token")) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const emailVerification = "email_verification"
+const passwordReset = "password_reset"
+const emailVerificationLifetime = 24 * time.Hour
+const passwordResetLifetime = 30 * time.Minute
+
+var errEmailTaken = errors.New("Email address is already taken")
+
+var resetPasswordForm = template.Must(template.New("reset").Parse(`<!DOCTYPE html>
+<html>
+<body>
+<form method="POST">
+<input type="hidden" name="token" value="{{.Token}}">
+{{if .Error}}<p>{{.Error}}</p>
+{{end}}<input name="Password" type="password" placeholder="New password" autofocus>
+<button type="submit">Reset password</button>
+</form>
+</body>
+</html>
+`))
+
+// normalizeEmail accepts a bare address and lower cases its domain. The local part is kept as entered, as it
+// may be case sensitive. Addresses are compared after normalizeEmail, so addresses whose local parts differ
+// only by case are different addresses, for uniqueness as well as for password resets.
+func normalizeEmail(email string) (string, error) {
+	address, err := mail.ParseAddress(email)
+
+	if err != nil || address.Name != "" || address.Address != email {
+		return "", fmt.Errorf("Invalid email address '%v'", email)
+	}
+
+	at := strings.LastIndex(email, "@")
+
+	return email[:at] + strings.ToLower(email[at:]), nil
+}
+
+// newSingleUseToken signs typed Claims carrying a random nonce whose hash is stored in nonceHash.
+// The caller has to persist the UserData the hash belongs to.
+func newSingleUseToken(ctx context.Context, id, typ string, lifetime time.Duration, nonceHash *string) (string, error) {
+	nonce, err := randomToken()
+
+	if err != nil {
+		return "", err
+	}
+
+	claims := newChallengeClaims(id, typ)
+
+	if claims == nil {
+		return "", errors.New("empty id")
+	}
+
+	claims.Exp = claims.Iat.Add(lifetime)
+	claims.Challenge = nonce
+	*nonceHash = hashToken(nonce)
+
+	return signClaims(ctx, claims)
+}
+
+// consumeSingleUseToken checks a token created by newSingleUseToken, marks it as used through consumeToken
+// and clears the stored nonce hash, which invalidates older tokens of the user.
+// Of concurrent uses of the same token only one succeeds. The caller has to persist the returned UserData.
+func consumeSingleUseToken(ctx context.Context, signedString, typ string, nonceHash func(*UserData) *string) (*UserData, error) {
+	_, claims, err := parseTyped(signedString, typ)
+
+	if err != nil {
+		return nil, err
+	}
+
+	ud, err := readComplete(ctx, claims.ID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	stored := nonceHash(ud)
+
+	if *stored == "" || subtle.ConstantTimeCompare([]byte(*stored), []byte(hashToken(claims.Challenge))) != 1 {
+		return nil, errors.New("Token was already used")
+	}
+
+	if err := consumeToken(ctx, signedString, claims.Exp); err == errAlreadyExists {
+		return nil, errors.New("Token was already used")
+	} else if err != nil {
+		return nil, err
+	}
+
+	*stored = ""
+
+	return ud, nil
+}
+
+// verifiedOwners returns the users who verified the address. Unverified addresses are not unique,
+// so setting someone else's address does not affect them.
+func verifiedOwners(ctx context.Context, email string) ([]*UserData, error) {
+	users := []*UserData{}
+
+	if err := getEntities(ctx, newQuery(userKind).Filter("Email =", email), &users); err != nil {
+		return nil, err
+	}
+
+	verified := []*UserData{}
+
+	for _, ud := range users {
+		if ud.EmailVerified {
+			verified = append(verified, ud)
+		}
+	}
+
+	return verified, nil
+}
+
+// checkEmailAvailable fails with errEmailTaken if another user verified the address.
+func checkEmailAvailable(ctx context.Context, ud *UserData, email string) error {
+	owners, err := verifiedOwners(ctx, email)
+
+	if err != nil {
+		return err
+	}
+
+	for _, owner := range owners {
+		if owner.ID != ud.ID {
+			return errEmailTaken
+		}
+	}
+
+	return nil
+}
+
+// setEmail changes the user's email address and sends a verification mail to it.
+// Addresses verified by another user are rejected.
+func setEmail(ctx context.Context, id, email string) error {
+	email, err := normalizeEmail(email)
+
+	if err != nil {
+		return err
+	}
+
+	ud, err := readComplete(ctx, id)
+
+	if err != nil {
+		return err
+	}
+
+	if ud.Email == email && ud.EmailVerified {
+		return nil
+	}
+
+	if err := checkEmailAvailable(ctx, ud, email); err != nil {
+		return err
+	}
+
+	ud.Email = email
+	ud.EmailVerified = false
+
+	return sendVerificationMail(ctx, ud)
+}
+
+func sendVerificationMail(ctx context.Context, ud *UserData) error {
+	token, err := newSingleUseToken(ctx, ud.ID, emailVerification, emailVerificationLifetime, &ud.VerificationHash)
+
+	if err != nil {
+		return err
+	}
+
+	if err := writeToDB(ctx, ud); err != nil {
+		return err
+	}
+
+	return mailer.Send(Mail{
+		To:      ud.Email,
+		Subject: "Verify your email address",
+		Body:    fmt.Sprintf("Open %v/verify-email?token=%v to verify your email address.\n", issuerURL, url.QueryEscape(token)),
+	})
+}
+
+// verifyEmail marks the user's email address as verified, unless another user verified it in the meantime.
+func verifyEmail(ctx context.Context, token string) error {
+	ud, err := consumeSingleUseToken(ctx, token, emailVerification, func(ud *UserData) *string { return &ud.VerificationHash })
+
+	if err != nil {
+		return err
+	}
+
+	if err := checkEmailAvailable(ctx, ud, ud.Email); err != nil {
+		return err
+	}
+
+	ud.EmailVerified = true
+
+	return writeToDB(ctx, ud)
+}
+
+// requestPasswordReset mails a reset link if a user with the verified address exists.
+// It does not reveal whether that is the case, so failures after checking the address are only logged.
+// Users with the same unverified address are ignored.
+func requestPasswordReset(ctx context.Context, email string) error {
+	email, err := normalizeEmail(email)
+
+	if err != nil {
+		return err
+	}
+
+	owners, err := verifiedOwners(ctx, email)
+
+	if err != nil || len(owners) == 0 {
+		return nil
+	}
+
+	// Only possible for addresses verified before they were unique
+	if len(owners) > 1 {
+		log.Printf("Email address is verified by %v users, not sending a reset mail", len(owners))
+		return nil
+	}
+
+	if err := sendResetMail(ctx, owners[0]); err != nil {
+		log.Printf("Unable to send password reset mail: %v", err)
+	}
+
+	return nil
+}
+
+func sendResetMail(ctx context.Context, ud *UserData) error {
+	token, err := newSingleUseToken(ctx, ud.ID, passwordReset, passwordResetLifetime, &ud.ResetHash)
+
+	if err != nil {
+		return err
+	}
+
+	if err := writeToDB(ctx, ud); err != nil {
+		return err
+	}
+
+	return mailer.Send(Mail{
+		To:      ud.Email,
+		Subject: "Reset your password",
+		Body:    fmt.Sprintf("Open %v/reset-password?token=%v to choose a new password.\nIgnore this mail if you did not ask for it.\n", issuerURL, url.QueryEscape(token)),
+	})
+}
+
+// resetPassword sets a new password and ends the user's current session.
+func resetPassword(ctx context.Context, token, password string) error {
+	if password == "" {
+		return errors.New("Empty password")
+	}
+
+	ud, err := consumeSingleUseToken(ctx, token, passwordReset, func(ud *UserData) *string { return &ud.ResetHash })
+
+	if err != nil {
+		return err
+	}
+
+	if err := ud.setPassword(ctx, password); err != nil {
+		return err
+	}
+
+	ud.Token = ""
+
+	return writeToDB(ctx, ud)
+}
+
+func handleVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if err := verifyEmail(ctx, r.URL.Query().Get("token")); err != nil {
+		http.Error(w, "Invalid or expired verification link", http.StatusBadRequest)
+		return
+	}
+
+	fmt.Fprintln(w, "Your email address is verified.")
+}
+
+// handleResetPassword renders the reset form for GET and resets the password on POST.
+func handleResetPassword(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+
+	token := r.Form.Get("token")
+
+	if r.Method == http.MethodGet {
+		resetPasswordForm.Execute(w, map[string]string{"Token": token})
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := resetPassword(ctx, token, r.PostForm.Get("Password")); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		resetPasswordForm.Execute(w, map[string]string{"Token": token, "Error": "Invalid or expired reset link"})
+		return
+	}
+
+	fmt.Fprintln(w, "Your password was reset.")
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// mailedToken extracts the token of the link in the last sent Mail.
+func mailedToken(recorder *recordingMailer) string {
+	if len(recorder.sent) == 0 {
+		return ""
+	}
+
+	body := recorder.sent[len(recorder.sent)-1].Body
+	start := strings.Index(body, "token=") + len("token=")
+	end := strings.Index(body[start:], " ")
+
+	if end < 0 {
+		return ""
+	}
+
+	token, _ := url.QueryUnescape(body[start : start+end])
+
+	return token
+}
+
+// verifiedUser stores "SomeID" with the verified address some@example.com.
+func verifiedUser(T *testing.T) *UserData {
+	injectOAuthStore()
+	recorder := injectRecordingMailer()
+	ud, _ := readComplete(testctx, "SomeID")
+
+	if err := setEmail(testctx, "SomeID", "some@Example.com"); err != nil {
+		T.Fatalf("setEmail failed with '%v'", err)
+	}
+
+	if err := verifyEmail(testctx, mailedToken(recorder)); err != nil {
+		T.Fatalf("verifyEmail failed with '%v'", err)
+	}
+
+	return ud
+}
+
+func TestNormalizeEmail(T *testing.T) {
+	if email, err := normalizeEmail("Some.One@Example.COM"); email != "Some.One@example.com" || err != nil {
+		T.Errorf("normalizeEmail failed! Expected 'Some.One@example.com' got '%v', '%v'", email, err)
+	}
+
+	for _, email := range []string{"", "no-at-sign", "Some <some@example.com>", " some@example.com", "some@example.com, other@example.com"} {
+		if _, err := normalizeEmail(email); err == nil {
+			T.Errorf("normalizeEmail failed! Expected error for '%v'", email)
+		}
+	}
+}
+
+func TestVerifyEmail(T *testing.T) {
+	injectOAuthStore()
+	recorder := injectRecordingMailer()
+	ud, _ := readComplete(testctx, "SomeID")
+
+	err := setEmail(testctx, "SomeID", "some@Example.com")
+	token := mailedToken(recorder)
+
+	expectations := map[string]bool{
+		"Set email":            err == nil && ud.Email == "some@example.com" && !ud.EmailVerified,
+		"Send mail to address": len(recorder.sent) == 1 && recorder.sent[0].To == "some@example.com",
+		"Link to verification": strings.Contains(recorder.sent[0].Body, issuerURL+"/verify-email?token="),
+		"Store only hash":      ud.VerificationHash != "" && !strings.Contains(token, ud.VerificationHash),
+		"Reject invalid email": setEmail(testctx, "SomeID", "invalid") != nil,
+	}
+
+	_, _, err = parse(token)
+	expectations["Reject as session token"] = err != nil
+
+	expectations["Verify with token"] = verifyEmail(testctx, token) == nil && ud.EmailVerified && ud.VerificationHash == ""
+	expectations["Reject reused token"] = verifyEmail(testctx, token) != nil
+
+	setEmail(testctx, "SomeID", "other@example.com")
+	expectations["Reset verification on change"] = ud.Email == "other@example.com" && !ud.EmailVerified
+
+	expired := mailedToken(recorder)
+	now = func() time.Time { return testtime.Add(emailVerificationLifetime + time.Hour) }
+	expectations["Reject expired token"] = verifyEmail(testctx, expired) != nil
+	now = func() time.Time { return testtime }
+
+	CheckExpectations(expectations, T)
+}
+
+type failingMailer struct{}
+
+func (failingMailer) Send(m Mail) error {
+	return errors.New("Unavailable")
+}
+
+func TestConcurrentTokenUse(T *testing.T) {
+	ud := verifiedUser(T)
+	recorder := injectRecordingMailer()
+	requestPasswordReset(testctx, "some@example.com")
+	token := mailedToken(recorder)
+	hash := ud.ResetHash
+
+	consume := func() error {
+		_, err := consumeSingleUseToken(testctx, token, passwordReset, func(ud *UserData) *string { return &ud.ResetHash })
+		return err
+	}
+
+	first := consume()
+	// Another instance read the user before the first use was stored
+	ud.ResetHash = hash
+	second := consume()
+
+	expectations := map[string]bool{
+		"Accept first use":  first == nil,
+		"Reject second use": second != nil && strings.Contains(second.Error(), "already used"),
+	}
+
+	CheckExpectations(expectations, T)
+}
+
+func TestPasswordReset(T *testing.T) {
+	ud := verifiedUser(T)
+	recorder := injectRecordingMailer()
+
+	err := requestPasswordReset(testctx, "some@example.com")
+	token := mailedToken(recorder)
+
+	expectations := map[string]bool{
+		"Request without error": err == nil && token != "",
+		"Link to reset":         len(recorder.sent) == 1 && strings.Contains(recorder.sent[0].Body, issuerURL+"/reset-password?token="),
+		"Reject empty password": resetPassword(testctx, token, "") != nil,
+	}
+
+	_, _, err = parseTyped(token, emailVerification)
+	expectations["Reject as verification token"] = err != nil
+
+	ud.Token = "SomeSessionToken"
+	expectations["Reset with token"] = resetPassword(testctx, token, "SomeNewPW") == nil && ud.compare(testctx, "SomeNewPW") && !ud.compare(testctx, "SomePW")
+	expectations["End session"] = ud.Token == ""
+	expectations["Reject reused token"] = resetPassword(testctx, token, "SomeOtherPW") != nil && ud.compare(testctx, "SomeNewPW")
+
+	mailer = failingMailer{}
+	expectations["Hide mail failures"] = requestPasswordReset(testctx, "some@example.com") == nil
+	mailer = recorder
+
+	ud.EmailVerified = false
+	recorder.sent = nil
+	expectations["Ignore unverified address"] = requestPasswordReset(testctx, "some@example.com") == nil && len(recorder.sent) == 0
+	expectations["Ignore unknown address"] = requestPasswordReset(testctx, "unknown@example.com") == nil && len(recorder.sent) == 0
+
+	CheckExpectations(expectations, T)
+}
+
+func TestEmailUniqueness(T *testing.T) {
+	ud := verifiedUser(T)
+	recorder := injectRecordingMailer()
+	register(testctx, "OtherID", "OtherPW")
+	other, _ := readComplete(testctx, "OtherID")
+
+	expectations := map[string]bool{
+		"Reject verified address of other user": setEmail(testctx, "OtherID", "some@example.com") == errEmailTaken && other.Email == "",
+		"Accept own address":                    setEmail(testctx, "SomeID", "some@example.com") == nil,
+	}
+
+	// An unverified address does not block its owner
+	other.Email = "some@example.com"
+	recorder.sent = nil
+	err := requestPasswordReset(testctx, "some@example.com")
+	expectations["Reset despite unverified duplicate"] = err == nil && len(recorder.sent) == 1 && ud.ResetHash != ""
+
+	ud.Email = "changed@example.com"
+	ud.EmailVerified = false
+	setEmail(testctx, "OtherID", "shared@example.com")
+	otherToken := mailedToken(recorder)
+	setEmail(testctx, "SomeID", "shared@example.com")
+	expectations["Verify first"] = verifyEmail(testctx, mailedToken(recorder)) == nil && ud.EmailVerified
+	expectations["Reject verifying second"] = verifyEmail(testctx, otherToken) == errEmailTaken && !other.EmailVerified
+
+	CheckExpectations(expectations, T)
+}
+
+func TestEmailHandlers(T *testing.T) {
+	verifiedUser(T)
+	recorder := injectRecordingMailer()
+	requestPasswordReset(testctx, "some@example.com")
+	token := mailedToken(recorder)
+
+	serve := func(request *http.Request) *httptest.ResponseRecorder {
+		response := httptest.NewRecorder()
+		oauthHandler().ServeHTTP(response, request)
+		return response
+	}
+
+	form := serve(httptest.NewRequest(http.MethodGet, "/reset-password?token="+url.QueryEscape(token), nil))
+	reset := postForm("/reset-password", url.Values{"token": {token}, "Password": {"SomeNewPW"}})
+	reused := postForm("/reset-password", url.Values{"token": {token}, "Password": {"SomeOtherPW"}})
+	verify := serve(httptest.NewRequest(http.MethodGet, "/verify-email?token=SomeInvalidToken", nil))
+
+	expectations := map[string]bool{
+		"Render reset form":     form.Code == http.StatusOK && strings.Contains(form.Body.String(), `name="Password"`),
+		"Reset password":        reset.Code == http.StatusOK,
+		"Reject reused token":   reused.Code == http.StatusBadRequest,
+		"Reject invalid verify": verify.Code == http.StatusBadRequest,
+	}
+
+	CheckExpectations(expectations, T)
+}
+
+func TestUserinfoEmail(T *testing.T) {
+	ud := verifiedUser(T)
+
+	claims := userinfoClaims(ud, "openid email")
+	withoutScope := userinfoClaims(ud, "openid")
+
+	if claims["email"] != "some@example.com" || claims["email_verified"] != true || withoutScope["email"] != nil {
+		T.Errorf("userinfoClaims failed! Got '%v' and '%v'", claims, withoutScope)
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"github.com/tooxoot/authservice/protobuf"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const gatewayPrefix = "/v1/"
+
+// Origins allowed to call the gateway from browsers. "*" allows every origin.
+var corsOrigins = []string{}
+var corsMaxAge = 10 * time.Minute
+
+// gatewayMethod exposes an AuthService method as POST route taking and returning the JSON mapping of its messages.
+type gatewayMethod struct {
+	name string
+	in   func() proto.Message
+	call func(ctx context.Context, in proto.Message) (proto.Message, error)
+}
+
+var gatewayMethods = []gatewayMethod{
+	{
+		name: "Login",
+		in:   func() proto.Message { return &protobuf.User{} },
+		call: func(ctx context.Context, in proto.Message) (proto.Message, error) {
+			user := in.(*protobuf.User)
+			token, err := login(ctx, user.GetID(), user.GetPassword())
+			return &protobuf.Token{SignedString: token}, err
+		},
+	},
+	{
+		name: "Register",
+		in:   func() proto.Message { return &protobuf.User{} },
+		call: func(ctx context.Context, in proto.Message) (proto.Message, error) {
+			user := in.(*protobuf.User)
+			token, err := register(ctx, user.GetID(), user.GetPassword())
+			return &protobuf.Token{SignedString: token}, err
+		},
+	},
+	{
+		name: "Revoke",
+		in:   func() proto.Message { return &protobuf.Token{} },
+		call: func(ctx context.Context, in proto.Message) (proto.Message, error) {
+			return &protobuf.Token{}, revoke(ctx, in.(*protobuf.Token).GetSignedString())
+		},
+	},
+	{
+		name: "Renew",
+		in:   func() proto.Message { return &protobuf.Token{} },
+		call: func(ctx context.Context, in proto.Message) (proto.Message, error) {
+			token, err := renew(ctx, in.(*protobuf.Token).GetSignedString())
+			return &protobuf.Token{SignedString: token}, err
+		},
+	},
+}
+
+func (m gatewayMethod) path() string {
+	return gatewayPrefix + strings.ToLower(m.name)
+}
+
+// registerGateway adds the REST/JSON routes mirroring the AuthService and their OpenAPI document to the mux.
+func registerGateway(mux *http.ServeMux) {
+	for _, method := range gatewayMethods {
+		mux.Handle(method.path(), corsHandler(method))
+	}
+
+	mux.Handle(gatewayPrefix+"openapi.json", corsHandler(http.HandlerFunc(handleOpenAPI)))
+}
+
+type gatewayError struct {
+	Code    int    `json:"code"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+// writeGatewayError responds with the HTTP status mapped from the gRPC status of err.
+func writeGatewayError(w http.ResponseWriter, err error) {
+	s := status.Convert(err)
+	auditEventOf(w).Reason = s.Code().String()
+	writeJSON(w, httpStatusFromCode(s.Code()), gatewayError{Code: int(s.Code()), Status: s.Code().String(), Message: s.Message()})
+}
+
+func (m gatewayMethod) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	in := m.in()
+
+	if err := (&jsonpb.Unmarshaler{}).Unmarshal(http.MaxBytesReader(w, r.Body, 1<<16), in); err != nil {
+		writeGatewayError(w, status.Error(codes.InvalidArgument, "Malformed request body"))
+		return
+	}
+
+	if user, ok := in.(*protobuf.User); ok {
+		auditEventOf(w).UserID = user.GetID()
+	} else if token, ok := in.(*protobuf.Token); ok {
+		auditEventOf(w).JTI = tokenJTI(token.GetSignedString())
+	}
+
+	out, err := m.call(r.Context(), in)
+
+	if err != nil {
+		writeGatewayError(w, err)
+		return
+	}
+
+	if token, ok := out.(*protobuf.Token); ok && token.GetSignedString() != "" {
+		auditEventOf(w).JTI = tokenJTI(token.GetSignedString())
+	}
+
+	body, err := (&jsonpb.Marshaler{OrigName: true}).MarshalToString(out)
+
+	if err != nil {
+		writeGatewayError(w, status.Error(codes.Internal, "Unable to encode response"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write([]byte(body))
+}
+
+// httpStatusFromCode maps gRPC status codes to HTTP status codes like grpc-gateway.
+func httpStatusFromCode(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func corsAllowed(origin string) bool {
+	for _, allowed := range corsOrigins {
+		if allowed == "*" || allowed == origin {
+			return true
+		}
+	}
+
+	return false
+}
+
+// corsHandler adds CORS headers for allowed origins and answers preflight requests.
+func corsHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		w.Header().Add("Vary", "Origin")
+
+		if origin == "" || !corsAllowed(origin) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+
+		if r.Method != http.MethodOptions || r.Header.Get("Access-Control-Request-Method") == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST")
+		w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+		w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(corsMaxAge.Seconds())))
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
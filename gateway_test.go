@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+)
+
+// postJSON sends the body to the path of the gateway.
+func postJSON(path, body string, configure ...func(*http.Request)) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+
+	for _, c := range configure {
+		c(request)
+	}
+
+	recorder := httptest.NewRecorder()
+	oauthHandler().ServeHTTP(recorder, request)
+
+	return recorder
+}
+
+func decodeToken(recorder *httptest.ResponseRecorder) string {
+	token := map[string]string{}
+	json.Unmarshal(recorder.Body.Bytes(), &token)
+
+	return token["SignedString"]
+}
+
+func TestGateway(T *testing.T) {
+	injectOAuthStore()
+
+	registered := postJSON("/v1/register", `{"ID":"OtherID","Password":"OtherPW"}`)
+	loggedIn := postJSON("/v1/login", `{"ID":"SomeID","Password":"SomePW"}`)
+	token := decodeToken(loggedIn)
+	renewed := postJSON("/v1/renew", `{"SignedString":"`+token+`"}`)
+	reused := postJSON("/v1/renew", `{"SignedString":"`+token+`"}`)
+	revoked := postJSON("/v1/revoke", `{"SignedString":"`+decodeToken(renewed)+`"}`)
+
+	gatewayErr := gatewayError{}
+	json.Unmarshal(reused.Body.Bytes(), &gatewayErr)
+
+	expectations := map[string]bool{
+		"Register":              registered.Code == http.StatusOK && decodeToken(registered) != "",
+		"Login":                 loggedIn.Code == http.StatusOK && token != "",
+		"Renew":                 renewed.Code == http.StatusOK && decodeToken(renewed) != token,
+		"Map Unauthenticated":   reused.Code == http.StatusUnauthorized && gatewayErr.Code == int(codes.Unauthenticated) && gatewayErr.Message != "",
+		"Revoke":                revoked.Code == http.StatusOK,
+		"Map AlreadyExists":     postJSON("/v1/register", `{"ID":"OtherID","Password":"OtherPW"}`).Code == http.StatusConflict,
+		"Reject malformed JSON": postJSON("/v1/login", `{"ID":`).Code == http.StatusBadRequest,
+		"Reject unknown fields": postJSON("/v1/login", `{"Name":"SomeID"}`).Code == http.StatusBadRequest,
+	}
+
+	get := httptest.NewRecorder()
+	oauthHandler().ServeHTTP(get, httptest.NewRequest(http.MethodGet, "/v1/login", nil))
+	expectations["Allow only POST"] = get.Code == http.StatusMethodNotAllowed
+
+	CheckExpectations(expectations, T)
+}
+
+func TestHTTPStatusFromCode(T *testing.T) {
+	expected := map[codes.Code]int{
+		codes.OK:               http.StatusOK,
+		codes.InvalidArgument:  http.StatusBadRequest,
+		codes.Unauthenticated:  http.StatusUnauthorized,
+		codes.PermissionDenied: http.StatusForbidden,
+		codes.NotFound:         http.StatusNotFound,
+		codes.AlreadyExists:    http.StatusConflict,
+		codes.DeadlineExceeded: http.StatusGatewayTimeout,
+		codes.Unavailable:      http.StatusServiceUnavailable,
+		codes.Internal:         http.StatusInternalServerError,
+		codes.Unknown:          http.StatusInternalServerError,
+	}
+
+	for code, status := range expected {
+		if got := httpStatusFromCode(code); got != status {
+			T.Errorf("httpStatusFromCode failed for %v! Expected %v got %v", code, status, got)
+		}
+	}
+}
+
+func TestCORS(T *testing.T) {
+	injectOAuthStore()
+	corsOrigins = []string{"https://app.example"}
+	defer func() { corsOrigins = []string{} }()
+
+	preflight := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodOptions, "/v1/login", nil)
+	request.Header.Set("Origin", "https://app.example")
+	request.Header.Set("Access-Control-Request-Method", "POST")
+	oauthHandler().ServeHTTP(preflight, request)
+
+	allowed := postJSON("/v1/login", `{"ID":"SomeID","Password":"SomePW"}`, func(r *http.Request) { r.Header.Set("Origin", "https://app.example") })
+	denied := postJSON("/v1/login", `{"ID":"SomeID","Password":"SomePW"}`, func(r *http.Request) { r.Header.Set("Origin", "https://evil.example") })
+
+	expectations := map[string]bool{
+		"Answer preflight":      preflight.Code == http.StatusNoContent && strings.Contains(preflight.Header().Get("Access-Control-Allow-Methods"), "POST"),
+		"Allow content type":    strings.Contains(preflight.Header().Get("Access-Control-Allow-Headers"), "Content-Type"),
+		"Allow listed origin":   allowed.Header().Get("Access-Control-Allow-Origin") == "https://app.example",
+		"Omit for other origin": denied.Header().Get("Access-Control-Allow-Origin") == "" && denied.Header().Get("Vary") == "Origin",
+	}
+
+	CheckExpectations(expectations, T)
+}
+
+func TestOpenAPI(T *testing.T) {
+	recorder := get("/v1/openapi.json", "")
+	document := struct {
+		OpenAPI    string                            `json:"openapi"`
+		Paths      map[string]map[string]interface{} `json:"paths"`
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]map[string]interface{} `json:"properties"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}{}
+	err := json.Unmarshal(recorder.Body.Bytes(), &document)
+
+	expectations := map[string]bool{
+		"Return document": recorder.Code == http.StatusOK && err == nil && document.OpenAPI != "",
+		"Describe User":   document.Components.Schemas["User"].Properties["Password"]["type"] == "string",
+		"Describe Token":  document.Components.Schemas["Token"].Properties["SignedString"] != nil,
+		"Describe Error":  document.Components.Schemas["Error"].Properties["code"] != nil,
+	}
+
+	for _, m := range gatewayMethods {
+		expectations["Describe "+m.path()] = document.Paths[m.path()]["post"] != nil
+	}
+
+	CheckExpectations(expectations, T)
+}
@@ -3,7 +3,23 @@ module github.com/tooxoot/authservice
 go 1.14
 
 require (
-	golang.org/x/crypto v0.0.0-20200406173513-056763e48d71
-	github.com/dgrijalva/jwt-go v3.2.0+incompatible
 	cloud.google.com/go/datastore v1.1.0
+	github.com/BurntSushi/toml v0.3.1
+	github.com/dgrijalva/jwt-go v3.2.0+incompatible
+	github.com/fxamacker/cbor/v2 v2.2.0
+	github.com/golang/protobuf v1.4.0
+	github.com/gomodule/redigo v1.8.4
+	github.com/prometheus/client_golang v1.5.1
+	github.com/tooxoot/authservice/protobuf v0.0.0-00010101000000-000000000000
+	go.opentelemetry.io/otel v1.0.1
+	go.opentelemetry.io/otel/sdk v1.0.1
+	go.opentelemetry.io/otel/trace v1.0.1
+	golang.org/x/crypto v0.0.0-20200406173513-056763e48d71
+	golang.org/x/text v0.3.2
+	google.golang.org/api v0.17.0
+	google.golang.org/grpc v1.28.1
+	google.golang.org/protobuf v1.21.0
+	gopkg.in/yaml.v3 v3.0.0-20200313102051-9f266ea9e77c
 )
+
+replace github.com/tooxoot/authservice/protobuf => ./protobuf
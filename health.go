@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/tooxoot/authservice/protobuf"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// Time in-flight RPCs and requests get to finish on shutdown before they are cancelled.
+var shutdownTimeout = 30 * time.Second
+
+// Interval in which the readiness is reported to the gRPC health service.
+var readinessInterval = 5 * time.Second
+
+var shutdownSignals = []os.Signal{syscall.SIGTERM, os.Interrupt}
+
+// healthServer implements grpc.health.v1 for the overall server ("") and the AuthService.
+var healthServer = health.NewServer()
+
+var shuttingDown int32
+
+// readiness returns why the service can not serve requests yet, or nil if it can.
+func readiness(ctx context.Context) error {
+	if atomic.LoadInt32(&shuttingDown) == 1 {
+		return errors.New("Shutting down")
+	}
+
+	if privateKey == nil {
+		return errors.New("Signing key not loaded")
+	}
+
+	if getAll == nil {
+		return errors.New("User store not connected")
+	}
+
+	if err := getEntities(ctx, newQuery(userKind).Limit(1), &[]*UserData{}); err != nil {
+		return errors.New("User store unreachable: " + err.Error())
+	}
+
+	return nil
+}
+
+// updateHealth reports the current readiness to the healthServer.
+func updateHealth(ctx context.Context) {
+	servingStatus := healthpb.HealthCheckResponse_SERVING
+
+	if err := readiness(ctx); err != nil {
+		servingStatus = healthpb.HealthCheckResponse_NOT_SERVING
+	}
+
+	healthServer.SetServingStatus("", servingStatus)
+	healthServer.SetServingStatus(authServiceName, servingStatus)
+}
+
+// watchHealth updates the healthServer every readinessInterval until ctx is done.
+func watchHealth(ctx context.Context) {
+	ticker := time.NewTicker(readinessInterval)
+	defer ticker.Stop()
+
+	for {
+		updateHealth(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// handleHealthz reports that the process is alive. It does not depend on any dependency.
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("ok\n"))
+}
+
+// handleReadyz reports whether the service can serve requests, and why not otherwise.
+func handleReadyz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+	if err := readiness(r.Context()); err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(err.Error() + "\n"))
+		return
+	}
+
+	w.Write([]byte("ok\n"))
+}
+
+// newGRPCServer creates a server with the tracing, metrics and audit interceptors, the AuthService and the health service.
+// creds may be nil for plaintext, which is only meant for local testing.
+func newGRPCServer(creds credentials.TransportCredentials, opts ...grpc.ServerOption) *grpc.Server {
+	if creds != nil {
+		opts = append(opts, grpc.Creds(creds))
+	}
+
+	opts = append(opts, grpc.ChainUnaryInterceptor(tracingUnaryInterceptor, metricsUnaryInterceptor, auditUnaryInterceptor))
+
+	server := grpc.NewServer(opts...)
+	protobuf.RegisterAuthServiceServer(server, authServer{})
+	healthpb.RegisterHealthServer(server, healthServer)
+
+	return server
+}
+
+// serve runs the gRPC and HTTP servers until one of the shutdownSignals arrives and then shuts them down gracefully.
+func serve(grpcServer *grpc.Server, grpcListener net.Listener, httpServer *http.Server, httpListener net.Listener) error {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, shutdownSignals...)
+	defer signal.Stop(signals)
+
+	stop := make(chan struct{})
+
+	go func() {
+		sig := <-signals
+		log.Printf("Received %v, shutting down", sig)
+		close(stop)
+	}()
+
+	return serveUntil(stop, grpcServer, grpcListener, httpServer, httpListener)
+}
+
+// serveUntil runs the servers until stop is closed or a server fails.
+// On stop the servers are reported as not ready and stop accepting connections. In-flight RPCs and
+// requests may finish within the shutdownTimeout, after which they are cancelled.
+func serveUntil(stop <-chan struct{}, grpcServer *grpc.Server, grpcListener net.Listener, httpServer *http.Server, httpListener net.Listener) error {
+	atomic.StoreInt32(&shuttingDown, 0)
+	healthServer.Resume()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go watchHealth(ctx)
+
+	failed := make(chan error, 2)
+
+	go func() { failed <- grpcServer.Serve(grpcListener) }()
+	go func() {
+		if err := httpServer.Serve(httpListener); err != http.ErrServerClosed {
+			failed <- err
+		}
+	}()
+
+	var serveErr error
+
+	select {
+	case <-stop:
+	case serveErr = <-failed:
+	}
+
+	atomic.StoreInt32(&shuttingDown, 1)
+	healthServer.Shutdown()
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancelShutdown()
+
+	drained := make(chan struct{})
+
+	go func() {
+		grpcServer.GracefulStop()
+		close(drained)
+	}()
+
+	httpErr := httpServer.Shutdown(shutdownCtx)
+
+	select {
+	case <-drained:
+	case <-shutdownCtx.Done():
+		grpcServer.Stop()
+		<-drained
+	}
+
+	if serveErr != nil {
+		return serveErr
+	}
+
+	if shutdownCtx.Err() != nil || httpErr != nil {
+		httpServer.Close()
+		return errors.New("Shutdown timed out, in-flight requests were cancelled")
+	}
+
+	return nil
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/datastore"
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func servingStatus(service string) healthpb.HealthCheckResponse_ServingStatus {
+	response, err := healthServer.Check(testctx, &healthpb.HealthCheckRequest{Service: service})
+
+	if err != nil {
+		return healthpb.HealthCheckResponse_UNKNOWN
+	}
+
+	return response.Status
+}
+
+func TestReadiness(T *testing.T) {
+	injectOAuthStore()
+	atomic.StoreInt32(&shuttingDown, 0)
+	healthServer.Resume()
+
+	ready := get("/readyz", "")
+	updateHealth(testctx)
+	serving := servingStatus(authServiceName)
+
+	key := privateKey
+	privateKey = nil
+	withoutKey := get("/readyz", "")
+	privateKey = key
+
+	getAll = func(ctx context.Context, q *datastore.Query, dst interface{}) ([]*datastore.Key, error) {
+		return nil, errors.New("Unavailable")
+	}
+	withoutStore := get("/readyz", "")
+	updateHealth(testctx)
+
+	expectations := map[string]bool{
+		"Report ready":             ready.Code == http.StatusOK,
+		"Report serving":           serving == healthpb.HealthCheckResponse_SERVING,
+		"Require signing key":      withoutKey.Code == http.StatusServiceUnavailable && strings.Contains(withoutKey.Body.String(), "Signing key not loaded"),
+		"Require store":            withoutStore.Code == http.StatusServiceUnavailable && strings.Contains(withoutStore.Body.String(), "User store unreachable"),
+		"Report not serving":       servingStatus("") == healthpb.HealthCheckResponse_NOT_SERVING,
+		"Stay alive while unready": get("/healthz", "").Code == http.StatusOK,
+	}
+
+	CheckExpectations(expectations, T)
+}
+
+// blockingServer serves every unknown method by waiting for release and replying with an empty HealthCheckResponse.
+func blockingServer(started chan<- struct{}, release <-chan struct{}) grpc.ServerOption {
+	return grpc.UnknownServiceHandler(func(srv interface{}, stream grpc.ServerStream) error {
+		if err := stream.RecvMsg(&healthpb.HealthCheckRequest{}); err != nil {
+			return err
+		}
+
+		started <- struct{}{}
+
+		select {
+		case <-release:
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		}
+
+		return stream.SendMsg(&healthpb.HealthCheckResponse{})
+	})
+}
+
+// startServers runs a gRPC server with the blockingServer until stop is closed. The result of serveUntil is sent to done.
+func startServers(T *testing.T, stop <-chan struct{}, started chan<- struct{}, release <-chan struct{}) (*grpc.ClientConn, chan error) {
+	grpcListener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		T.Fatal(err)
+	}
+
+	httpListener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		T.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	server := newGRPCServer(nil, blockingServer(started, release))
+
+	go func() {
+		done <- serveUntil(stop, server, grpcListener, &http.Server{Handler: oauthHandler()}, httpListener)
+	}()
+
+	cc, err := grpc.Dial(grpcListener.Addr().String(), grpc.WithInsecure())
+
+	if err != nil {
+		T.Fatal(err)
+	}
+
+	return cc, done
+}
+
+func TestGracefulShutdown(T *testing.T) {
+	injectOAuthStore()
+
+	stop, started, release := make(chan struct{}), make(chan struct{}, 1), make(chan struct{})
+	cc, done := startServers(T, stop, started, release)
+	defer cc.Close()
+
+	rpcErr := make(chan error, 1)
+	go func() {
+		rpcErr <- cc.Invoke(testctx, "/test.Service/Block", &healthpb.HealthCheckRequest{}, &healthpb.HealthCheckResponse{})
+	}()
+
+	<-started
+	close(stop)
+	time.Sleep(50 * time.Millisecond)
+
+	expectations := map[string]bool{
+		"Report not serving": servingStatus("") == healthpb.HealthCheckResponse_NOT_SERVING,
+		"Report not ready":   readiness(testctx) != nil && strings.Contains(readiness(testctx).Error(), "Shutting down"),
+	}
+
+	close(release)
+
+	expectations["Drain in-flight RPC"] = <-rpcErr == nil
+	expectations["Exit cleanly"] = <-done == nil
+
+	CheckExpectations(expectations, T)
+}
+
+func TestShutdownTimeout(T *testing.T) {
+	injectOAuthStore()
+	shutdownTimeout = 50 * time.Millisecond
+	defer func() { shutdownTimeout = 30 * time.Second }()
+
+	stop, started, release := make(chan struct{}), make(chan struct{}, 1), make(chan struct{})
+	cc, done := startServers(T, stop, started, release)
+	defer cc.Close()
+
+	rpcErr := make(chan error, 1)
+	go func() {
+		rpcErr <- cc.Invoke(testctx, "/test.Service/Block", &healthpb.HealthCheckRequest{}, &healthpb.HealthCheckResponse{})
+	}()
+
+	<-started
+	close(stop)
+
+	var shutdownErr error
+	select {
+	case shutdownErr = <-done:
+	case <-time.After(5 * time.Second):
+		T.Fatal("Shutdown did not finish")
+	}
+
+	expectations := map[string]bool{
+		"Report timeout":       shutdownErr != nil && strings.Contains(shutdownErr.Error(), "timed out"),
+		"Cancel in-flight RPC": <-rpcErr != nil,
+	}
+
+	CheckExpectations(expectations, T)
+}
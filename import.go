@@ -0,0 +1,334 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/tooxoot/authservice/protobuf"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Formats of imported users. CSV needs a header naming the id, algorithm and hash columns,
+// email and email_verified are optional. JSON lines hold one importRow per line.
+const importCSV = "csv"
+const importJSONLines = "jsonl"
+
+// Machine clients allowed to import users through the AuthService. Without any, users can only be
+// imported with the CLI.
+var adminClients = []string{}
+
+// importRow is a user exported from another system with its password hash.
+type importRow struct {
+	ID            string `json:"id"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Algorithm     string `json:"algorithm"`
+	Hash          string `json:"hash"`
+}
+
+type importError struct {
+	Row     int
+	ID      string
+	Message string
+}
+
+// importReport counts the imported users and lists the rows that were not imported.
+// Rows are numbered from 1, not counting the CSV header.
+type importReport struct {
+	Imported int
+	Errors   []importError
+	DryRun   bool
+}
+
+// rowReader returns the next importRow, or io.EOF after the last one.
+// Errors of a single row are returned as *rowError, other errors end the import.
+type rowReader func() (*importRow, error)
+
+type rowError struct {
+	err error
+}
+
+func (e *rowError) Error() string {
+	return e.err.Error()
+}
+
+func newRowReader(r io.Reader, format string) (rowReader, error) {
+	switch format {
+	case importCSV:
+		return newCSVRowReader(r)
+	case importJSONLines:
+		return newJSONRowReader(r), nil
+	}
+
+	return nil, fmt.Errorf("Unknown import format '%v', expected %v or %v", format, importCSV, importJSONLines)
+}
+
+func newCSVRowReader(r io.Reader) (rowReader, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+
+	if err == io.EOF {
+		return nil, errors.New("Missing CSV header")
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	columns := map[string]int{}
+
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+
+		switch name {
+		case "id", "email", "email_verified", "algorithm", "hash":
+		default:
+			return nil, fmt.Errorf("Unknown CSV column '%v'", name)
+		}
+
+		columns[name] = i
+	}
+
+	for _, required := range []string{"id", "algorithm", "hash"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("Missing CSV column '%v'", required)
+		}
+	}
+
+	return func() (*importRow, error) {
+		record, err := reader.Read()
+
+		if err == io.EOF {
+			return nil, err
+		}
+
+		if err != nil {
+			return nil, &rowError{err}
+		}
+
+		if len(record) != len(header) {
+			return nil, &rowError{fmt.Errorf("Expected %v fields, got %v", len(header), len(record))}
+		}
+
+		row := &importRow{
+			ID:        record[columns["id"]],
+			Algorithm: record[columns["algorithm"]],
+			Hash:      record[columns["hash"]],
+		}
+
+		if i, ok := columns["email"]; ok {
+			row.Email = record[i]
+		}
+
+		if i, ok := columns["email_verified"]; ok && record[i] != "" {
+			if row.EmailVerified, err = strconv.ParseBool(record[i]); err != nil {
+				return nil, &rowError{fmt.Errorf("Invalid email_verified '%v'", record[i])}
+			}
+		}
+
+		return row, nil
+	}, nil
+}
+
+func newJSONRowReader(r io.Reader) rowReader {
+	lines := newLineReader(r)
+
+	return func() (*importRow, error) {
+		line, err := lines()
+
+		if err != nil {
+			return nil, err
+		}
+
+		decoder := json.NewDecoder(strings.NewReader(line))
+		decoder.DisallowUnknownFields()
+		row := &importRow{}
+
+		if err := decoder.Decode(row); err != nil {
+			return nil, &rowError{fmt.Errorf("Malformed JSON: %v", err)}
+		}
+
+		return row, nil
+	}
+}
+
+// newLineReader returns the lines of r, skipping empty ones.
+func newLineReader(r io.Reader) func() (string, error) {
+	reader := bufio.NewReader(r)
+
+	return func() (string, error) {
+		for {
+			line, err := reader.ReadString('\n')
+
+			if line = strings.TrimSpace(line); line != "" {
+				return line, nil
+			}
+
+			if err != nil {
+				return "", err
+			}
+		}
+	}
+}
+
+// userOf validates the row and returns the UserData to store for it.
+func (row *importRow) userOf() (*UserData, error) {
+	canonical, err := canonicalID(row.ID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkForeignHash(row.Algorithm, row.Hash); err != nil {
+		return nil, err
+	}
+
+	ud := &UserData{
+		ID:            row.ID,
+		CanonicalID:   canonical,
+		Hash:          row.Hash,
+		HashAlgorithm: row.Algorithm,
+		EmailVerified: row.EmailVerified,
+	}
+
+	if row.Email != "" {
+		if ud.Email, err = normalizeEmail(row.Email); err != nil {
+			return nil, err
+		}
+	} else if row.EmailVerified {
+		return nil, errors.New("Verified email without address")
+	}
+
+	return ud, nil
+}
+
+// importUsers stores the users read from r in the format with their foreign password hashes.
+// Invalid rows are reported and skipped, the other rows are still imported. Failing to read the store ends
+// the import, so no ID or verified email address is imported without knowing it is free. With dryRun nothing is stored.
+func importUsers(ctx context.Context, r io.Reader, format string, dryRun bool) (*importReport, error) {
+	next, err := newRowReader(r, format)
+
+	if err != nil {
+		return nil, err
+	}
+
+	report := &importReport{DryRun: dryRun}
+	seen := map[string]int{}
+	seenEmails := map[string]int{}
+
+	for number := 1; ; number++ {
+		row, err := next()
+
+		if err == io.EOF {
+			return report, nil
+		}
+
+		if _, ok := err.(*rowError); ok {
+			report.Errors = append(report.Errors, importError{Row: number, Message: err.Error()})
+			continue
+		}
+
+		if err != nil {
+			return report, err
+		}
+
+		ud, err := row.userOf()
+
+		if err == nil {
+			if first, ok := seen[ud.CanonicalID]; ok {
+				err = fmt.Errorf("ID '%v' is already imported in row %v", row.ID, first)
+			} else if exists, readErr := userExists(ctx, row.ID); readErr != nil {
+				return report, fmt.Errorf("Row %v: Unable to check ID '%v': %w", number, row.ID, readErr)
+			} else if exists {
+				err = fmt.Errorf("ID '%v' is already taken", row.ID)
+			}
+		}
+
+		// Verified addresses are unique like on verifyEmail
+		if err == nil && ud.EmailVerified {
+			if first, ok := seenEmails[ud.Email]; ok {
+				err = fmt.Errorf("Email address '%v' is already verified in row %v", ud.Email, first)
+			} else if owners, readErr := verifiedOwners(ctx, ud.Email); readErr != nil {
+				return report, fmt.Errorf("Row %v: Unable to check email address '%v': %w", number, ud.Email, readErr)
+			} else if len(owners) > 0 {
+				err = errEmailTaken
+			}
+		}
+
+		if err == nil {
+			seen[ud.CanonicalID] = number
+
+			if ud.EmailVerified {
+				seenEmails[ud.Email] = number
+			}
+		}
+
+		if err == nil && !dryRun {
+			if err = insertUser(ctx, ud); err == errAlreadyExists {
+				err = fmt.Errorf("ID '%v' is already taken", row.ID)
+			}
+		}
+
+		if err != nil {
+			report.Errors = append(report.Errors, importError{Row: number, ID: row.ID, Message: err.Error()})
+			continue
+		}
+
+		report.Imported++
+	}
+}
+
+// isAdminClient reports whether the Claims are a token of one of the adminClients.
+func isAdminClient(claims *Claims) bool {
+	if !claims.IsClient() || claims.Typ != "" {
+		return false
+	}
+
+	for _, id := range adminClients {
+		if id == claims.ID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// importUsersRPC imports the users of the request for tokens of the adminClients.
+func importUsersRPC(ctx context.Context, in *protobuf.ImportRequest) (*protobuf.ImportReport, error) {
+	_, claims, err := parse(in.GetSignedString())
+
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "Invalid token")
+	}
+
+	if !isAdminClient(claims) {
+		return nil, status.Error(codes.PermissionDenied, "Importing users requires an admin client")
+	}
+
+	report, err := importUsers(ctx, strings.NewReader(string(in.GetData())), in.GetFormat(), in.GetDryRun())
+
+	if err != nil && report == nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	if err != nil {
+		return nil, statusOf(err, codes.Internal, "Unable to import users")
+	}
+
+	out := &protobuf.ImportReport{Imported: int32(report.Imported), Failed: int32(len(report.Errors)), DryRun: report.DryRun}
+
+	for _, e := range report.Errors {
+		out.Errors = append(out.Errors, &protobuf.ImportError{Row: int32(e.Row), ID: e.ID, Message: e.Message})
+	}
+
+	return out, nil
+}
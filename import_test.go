@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/datastore"
+	"github.com/tooxoot/authservice/protobuf"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestImportCSV(T *testing.T) {
+	injectOAuthStore()
+	some, _ := readUser(testctx, "SomeID")
+	some.Email, some.EmailVerified = "some@example.com", true
+
+	input := "id,email,email_verified,algorithm,hash\n" +
+		"OtherID,other@Example.com,true,sha1," + sha1Hash("OtherPW") + "\n" +
+		"ThirdID,,,pbkdf2-sha256," + pbkdf2Hash("ThirdPW") + "\n" +
+		"SomeID,,,sha1," + sha1Hash("SomePW") + "\n" +
+		"otherid,,,sha1," + sha1Hash("OtherPW") + "\n" +
+		"FourthID,,,md5,SomeHash\n" +
+		"FifthID,no-address,,sha1," + sha1Hash("FifthPW") + "\n" +
+		"SixthID,,\n" +
+		"SeventhID,other@example.com,true,sha1," + sha1Hash("SeventhPW") + "\n" +
+		"EighthID,some@example.com,true,sha1," + sha1Hash("EighthPW") + "\n" +
+		"NinthID,some@example.com,false,sha1," + sha1Hash("NinthPW") + "\n" +
+		"TenthID,,,pbkdf2-sha256,pbkdf2_sha256$100000000$SomeSalt$AAAA\n"
+
+	report, err := importUsers(testctx, strings.NewReader(input), importCSV, false)
+	other, _ := readUser(testctx, "OtherID")
+	_, loginErr := login(testctx, "ThirdID", "ThirdPW")
+
+	failed := map[int]string{}
+	for _, e := range report.Errors {
+		failed[e.Row] = e.Message
+	}
+
+	_, headerErr := importUsers(testctx, strings.NewReader("id,hash\n"), importCSV, false)
+	_, columnErr := importUsers(testctx, strings.NewReader("id,password,algorithm,hash\n"), importCSV, false)
+
+	expectations := map[string]bool{
+		"Import valid rows":      err == nil && report.Imported == 3 && len(report.Errors) == 8,
+		"Keep foreign hash":      other != nil && other.Hash == sha1Hash("OtherPW") && other.HashAlgorithm == hashSaltedSHA1,
+		"Import email":           other != nil && other.Email == "other@example.com" && other.EmailVerified,
+		"Login with import":      loginErr == nil,
+		"Report taken ID":        strings.Contains(failed[3], "already taken"),
+		"Report duplicate":       strings.Contains(failed[4], "row 1"),
+		"Report unknown hash":    strings.Contains(failed[5], "Unknown hash algorithm"),
+		"Report invalid email":   strings.Contains(failed[6], "Invalid email"),
+		"Report missing fields":  failed[7] != "",
+		"Report imported email":  strings.Contains(failed[8], "already verified in row 1"),
+		"Report verified email":  failed[9] == errEmailTaken.Error(),
+		"Report iterations":      strings.Contains(failed[11], "at most"),
+		"Require header columns": headerErr != nil,
+		"Reject unknown columns": columnErr != nil,
+	}
+
+	CheckExpectations(expectations, T)
+}
+
+func TestImportStoreFailure(T *testing.T) {
+	store := injectOAuthStore()
+	getAll = func(ctx context.Context, q *datastore.Query, dst interface{}) ([]*datastore.Key, error) {
+		return nil, errors.New("Unavailable")
+	}
+
+	report, err := importUsers(testctx, strings.NewReader("id,algorithm,hash\nOtherID,sha1,"+sha1Hash("OtherPW")+"\n"), importCSV, false)
+
+	expectations := map[string]bool{
+		"Stop on store errors": err != nil && strings.Contains(err.Error(), "Row 1") && report.Imported == 0,
+		"Store nothing":        len(store.entities) == 4,
+	}
+
+	CheckExpectations(expectations, T)
+}
+
+func TestImportJSONLinesDryRun(T *testing.T) {
+	injectOAuthStore()
+
+	input := `{"id":"OtherID","algorithm":"bcrypt","hash":"` + bcryptHash("OtherPW") + `"}` + "\n\n" +
+		`{"id":"ThirdID","password":"ThirdPW"}` + "\n" +
+		`{"id":` + "\n"
+
+	report, err := importUsers(testctx, strings.NewReader(input), importJSONLines, true)
+	_, readErr := readUser(testctx, "OtherID")
+	_, formatErr := importUsers(testctx, strings.NewReader(input), "xml", false)
+
+	expectations := map[string]bool{
+		"Validate valid rows":    err == nil && report.Imported == 1 && report.DryRun,
+		"Report unknown fields":  len(report.Errors) == 2 && report.Errors[0].Row == 2,
+		"Report malformed JSON":  len(report.Errors) == 2 && report.Errors[1].Row == 3,
+		"Store nothing":          readErr != nil,
+		"Reject unknown formats": formatErr != nil,
+	}
+
+	CheckExpectations(expectations, T)
+}
+
+func TestImportCommand(T *testing.T) {
+	defer injectCLI()()
+
+	dir, _ := ioutil.TempDir("", "import")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "users.csv")
+	ioutil.WriteFile(path, []byte("id,algorithm,hash\nOtherID,sha1,"+sha1Hash("OtherPW")+"\nSomeID,sha1,"+sha1Hash("SomePW")+"\n"), 0600)
+
+	dryRun, dryRunErr := runCLIWith("", "user", "import", "-dry-run", path)
+	_, readErr := readUser(testctx, "OtherID")
+	imported, importErr := runCLIWith("", "user", "import", path)
+	_, loginErr := login(testctx, "OtherID", "OtherPW")
+	_, stdinErr := runCLIWith(`{"id":"ThirdID","algorithm":"sha1","hash":"`+sha1Hash("ThirdPW")+`"}`, "user", "import", "-format", "jsonl", "-")
+
+	expectations := map[string]bool{
+		"Dry run":            dryRunErr != nil && strings.Contains(dryRun, "nothing was imported") && readErr != nil,
+		"Report failed rows": importErr != nil && strings.Contains(imported, "Row 2 (SomeID)"),
+		"Import file":        strings.Contains(imported, "Imported 1 users") && loginErr == nil,
+		"Import stdin":       stdinErr == nil,
+	}
+
+	CheckExpectations(expectations, T)
+}
+
+func TestImportUsersRPC(T *testing.T) {
+	injectOAuthStore()
+
+	adminClients = []string{"SomeService"}
+	defer func() { adminClients = []string{} }()
+
+	token, _, _ := clientLogin(testctx, "SomeService", "SomeServiceSecret", "")
+	scoped := NewClaims("SomeID")
+	scoped.Scope = "users:import"
+	userToken, _ := signClaims(testctx, scoped)
+	lookalike := NewClaims("SomeService")
+	lookalikeToken, _ := signClaims(testctx, lookalike)
+
+	request := func(token, format string) *protobuf.ImportRequest {
+		return &protobuf.ImportRequest{SignedString: token, Format: format, Data: []byte(`{"id":"OtherID","algorithm":"sha1","hash":"` + sha1Hash("OtherPW") + `"}`)}
+	}
+
+	report, err := importUsersRPC(testctx, request(token, importJSONLines))
+	_, userErr := importUsersRPC(testctx, request(userToken, importJSONLines))
+	_, lookalikeErr := importUsersRPC(testctx, request(lookalikeToken, importJSONLines))
+	_, tokenErr := importUsersRPC(testctx, request("SomeToken", importJSONLines))
+	_, formatErr := importUsersRPC(testctx, request(token, "xml"))
+
+	expectations := map[string]bool{
+		"Import users":          err == nil && report.GetImported() == 1,
+		"Reject users":          status.Code(userErr) == codes.PermissionDenied,
+		"Require client token":  status.Code(lookalikeErr) == codes.PermissionDenied,
+		"Require token":         status.Code(tokenErr) == codes.Unauthenticated,
+		"Reject unknown format": status.Code(formatErr) == codes.InvalidArgument,
+		"Keep off the gateway":  postJSON("/v1/importusers", "{}").Code == http.StatusNotFound,
+	}
+
+	CheckExpectations(expectations, T)
+}
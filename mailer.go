@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Mail is a plain text message to a single recipient.
+type Mail struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers Mails to users.
+type Mailer interface {
+	Send(m Mail) error
+}
+
+// mailer is used to send all Mails. Defaults to refusing them, so mails with live tokens
+// are only logged when that is configured.
+var mailer Mailer = noMailer{}
+
+// noMailer is used while neither SMTP nor a mail log is configured.
+type noMailer struct{}
+
+// Send fails, as there is nowhere to deliver the Mail to.
+func (noMailer) Send(m Mail) error {
+	return errors.New("No mailer configured, set smtp_addr or mail_log")
+}
+
+var smtpSendMail = smtp.SendMail
+
+// SMTPMailer sends Mails through an SMTP server. Auth may be nil.
+type SMTPMailer struct {
+	Addr string
+	From string
+	Auth smtp.Auth
+}
+
+// Send delivers the Mail to the server at Addr.
+func (s *SMTPMailer) Send(m Mail) error {
+	message, err := m.bytes(s.From)
+
+	if err != nil {
+		return err
+	}
+
+	return smtpSendMail(s.Addr, s.Auth, s.From, []string{m.To}, message)
+}
+
+// LogMailer writes Mails to Out instead of delivering them. Meant for local testing,
+// as the mails contain live verification and reset tokens.
+type LogMailer struct {
+	Out io.Writer
+	mu  sync.Mutex
+}
+
+// NewFileMailer creates a LogMailer which appends to the file at path.
+func NewFileMailer(path string) (*LogMailer, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &LogMailer{Out: file}, nil
+}
+
+// Send writes the Mail in its wire format followed by a separator line.
+func (l *LogMailer) Send(m Mail) error {
+	message, err := m.bytes("tooxoot")
+
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	_, err = fmt.Fprintf(l.Out, "%s\r\n----\r\n", message)
+
+	return err
+}
+
+// bytes formats the Mail as RFC 5322 message.
+// Header values containing line breaks are rejected to prevent header injection.
+func (m Mail) bytes(from string) ([]byte, error) {
+	for _, header := range []string{from, m.To, m.Subject} {
+		if strings.ContainsAny(header, "\r\n") {
+			return nil, errors.New("Mail header must not contain line breaks")
+		}
+	}
+
+	if m.To == "" {
+		return nil, errors.New("Mail without recipient")
+	}
+
+	body := strings.Replace(m.Body, "\r\n", "\n", -1)
+	body = strings.Replace(body, "\n", "\r\n", -1)
+
+	return []byte(fmt.Sprintf(
+		"From: %v\r\nTo: %v\r\nSubject: %v\r\nMIME-Version: 1.0\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%v",
+		from, m.To, mime.QEncoding.Encode("utf-8", m.Subject), body,
+	)), nil
+}
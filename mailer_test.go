@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// recordingMailer keeps sent Mails for inspection.
+type recordingMailer struct {
+	sent []Mail
+}
+
+func (r *recordingMailer) Send(m Mail) error {
+	r.sent = append(r.sent, m)
+	return nil
+}
+
+func injectRecordingMailer() *recordingMailer {
+	recorder := &recordingMailer{}
+	mailer = recorder
+	return recorder
+}
+
+func TestMailBytes(T *testing.T) {
+	message, err := Mail{To: "some@example.com", Subject: "Grüße", Body: "Line1\nLine2"}.bytes("tooxoot@example.com")
+
+	expectations := map[string]bool{
+		"Format without error": err == nil,
+		"Write headers":        strings.HasPrefix(string(message), "From: tooxoot@example.com\r\nTo: some@example.com\r\n"),
+		"Encode subject":       strings.Contains(string(message), "Subject: =?utf-8?q?Gr=C3=BC=C3=9Fe?=\r\n"),
+		"Use CRLF in body":     strings.HasSuffix(string(message), "\r\n\r\nLine1\r\nLine2"),
+	}
+
+	_, err = Mail{To: "some@example.com\r\nBcc: other@example.com"}.bytes("tooxoot@example.com")
+	expectations["Reject header injection"] = err != nil
+
+	_, err = Mail{}.bytes("tooxoot@example.com")
+	expectations["Reject missing recipient"] = err != nil
+
+	CheckExpectations(expectations, T)
+}
+
+func TestSMTPMailer(T *testing.T) {
+	var addr, from string
+	var to []string
+	var msg []byte
+
+	smtpSendMail = func(a string, auth smtp.Auth, f string, t []string, m []byte) error {
+		addr, from, to, msg = a, f, t, m
+		return nil
+	}
+	defer func() { smtpSendMail = smtp.SendMail }()
+
+	err := (&SMTPMailer{Addr: "smtp.example.com:587", From: "tooxoot@example.com"}).Send(Mail{To: "some@example.com", Subject: "SomeSubject"})
+
+	if err != nil || addr != "smtp.example.com:587" || from != "tooxoot@example.com" || len(to) != 1 || to[0] != "some@example.com" || !bytes.Contains(msg, []byte("Subject: SomeSubject")) {
+		T.Errorf("SMTPMailer failed! Got '%v', '%v', '%v', '%s', '%v'", addr, from, to, msg, err)
+	}
+}
+
+func TestFileMailer(T *testing.T) {
+	dir, _ := ioutil.TempDir("", "mailer")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "mail.log")
+
+	fileMailer, err := NewFileMailer(path)
+
+	if err != nil {
+		T.Fatalf("NewFileMailer failed with '%v'", err)
+	}
+
+	fileMailer.Send(Mail{To: "some@example.com", Subject: "First"})
+	fileMailer.Send(Mail{To: "some@example.com", Subject: "Second"})
+	content, _ := ioutil.ReadFile(path)
+
+	if !bytes.Contains(content, []byte("Subject: First")) || !bytes.Contains(content, []byte("Subject: Second")) {
+		T.Errorf("FileMailer failed! Expected both mails got '%s'", content)
+	}
+
+	if _, err := NewFileMailer(filepath.Join(dir, "missing", "mail.log")); err == nil {
+		T.Errorf("NewFileMailer failed! Expected error for missing directory")
+	}
+}
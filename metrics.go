@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+var metricsRegistry = newMetricsRegistry()
+var metrics = promauto.With(metricsRegistry)
+
+var rpcRequests = metrics.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "authservice",
+	Name:      "rpc_requests_total",
+	Help:      "Handled RPCs by method and status code.",
+}, []string{"method", "code"})
+
+var rpcDuration = metrics.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: "authservice",
+	Name:      "rpc_duration_seconds",
+	Help:      "Latency of handled RPCs by method and status code.",
+	Buckets:   prometheus.DefBuckets,
+}, []string{"method", "code"})
+
+var httpRequests = metrics.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "authservice",
+	Name:      "http_requests_total",
+	Help:      "Handled HTTP requests by path and status code.",
+}, []string{"path", "code"})
+
+var httpDuration = metrics.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: "authservice",
+	Name:      "http_request_duration_seconds",
+	Help:      "Latency of handled HTTP requests by path and status code.",
+	Buckets:   prometheus.DefBuckets,
+}, []string{"path", "code"})
+
+var logins = metrics.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "authservice",
+	Name:      "logins_total",
+	Help:      "Login attempts by result and failure reason.",
+}, []string{"result", "reason"})
+
+var hashingDuration = metrics.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: "authservice",
+	Name:      "bcrypt_duration_seconds",
+	Help:      "Duration of bcrypt hashing and comparison.",
+	Buckets:   prometheus.ExponentialBuckets(0.001, 2, 12),
+}, []string{"operation"})
+
+var storeDuration = metrics.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: "authservice",
+	Name:      "store_duration_seconds",
+	Help:      "Latency of Datastore operations.",
+	Buckets:   prometheus.DefBuckets,
+}, []string{"operation"})
+
+var tokensIssued = metrics.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "authservice",
+	Name:      "tokens_issued_total",
+	Help:      "Signed tokens by type.",
+}, []string{"type"})
+
+var tokenRenewals = metrics.NewCounter(prometheus.CounterOpts{
+	Namespace: "authservice",
+	Name:      "token_renewals_total",
+	Help:      "Tokens renewed through refresh tokens and session renewals.",
+})
+
+// signingKeyCollector exposes the kid of the active signing key as label of a constant gauge.
+type signingKeyCollector struct {
+	desc *prometheus.Desc
+}
+
+func (c signingKeyCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c signingKeyCollector) Collect(ch chan<- prometheus.Metric) {
+	if privateKey == nil {
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, 1, publicJWK().Kid)
+}
+
+func newMetricsRegistry() *prometheus.Registry {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		signingKeyCollector{prometheus.NewDesc("authservice_signing_key_info", "The active signing key.", []string{"kid"}, nil)},
+	)
+
+	return registry
+}
+
+// metricsToken is the bearer token required for /metrics. Empty hides the metrics, as they are served
+// next to the public endpoints.
+var metricsToken = ""
+
+// metricsHandler serves all metrics in the Prometheus exposition format to requests carrying the metricsToken.
+func metricsHandler() http.Handler {
+	handler := promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if metricsToken == "" {
+			http.NotFound(w, r)
+			return
+		}
+
+		authorization := r.Header.Get("Authorization")
+		token := strings.TrimPrefix(authorization, "Bearer ")
+
+		if !strings.HasPrefix(authorization, "Bearer ") || subtle.ConstantTimeCompare([]byte(token), []byte(metricsToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+			http.Error(w, "", http.StatusUnauthorized)
+			return
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// observeLogin counts a login attempt. An empty reason counts as success.
+func observeLogin(reason string) {
+	if reason == "" {
+		logins.WithLabelValues(auditSuccess, "").Inc()
+		return
+	}
+
+	logins.WithLabelValues(auditFailure, reason).Inc()
+}
+
+func observeSince(observer prometheus.Observer, start time.Time) {
+	observer.Observe(time.Since(start).Seconds())
+}
+
+// tokenType labels signed Claims for tokensIssued.
+func tokenType(c *Claims) string {
+	switch {
+	case c.Typ != "":
+		return c.Typ
+	case c.IsClient():
+		return subjectClient
+	default:
+		return "user"
+	}
+}
+
+func instrumentGenerate(generate func([]byte, int) ([]byte, error)) func([]byte, int) ([]byte, error) {
+	return func(password []byte, cost int) ([]byte, error) {
+		defer observeSince(hashingDuration.WithLabelValues("generate"), time.Now())
+		return generate(password, cost)
+	}
+}
+
+func instrumentCompare(compare func([]byte, []byte) error) func([]byte, []byte) error {
+	return func(hash, password []byte) error {
+		defer observeSince(hashingDuration.WithLabelValues("compare"), time.Now())
+		return compare(hash, password)
+	}
+}
+
+// metricsUnaryInterceptor counts RPCs and observes their latency.
+func metricsUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	code := status.Code(err).String()
+
+	rpcRequests.WithLabelValues(info.FullMethod, code).Inc()
+	observeSince(rpcDuration.WithLabelValues(info.FullMethod, code), start)
+
+	return resp, err
+}
+
+// statusRecorder captures the status of an HTTP response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// instrumentHTTP counts requests to next and observes their latency.
+// Requests are labeled with the mux pattern they match to keep the label set bounded.
+func instrumentHTTP(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(recorder, r)
+
+		path := "other"
+
+		if _, pattern := mux.Handler(r); pattern != "" {
+			path = pattern
+		}
+
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+
+		code := strconv.Itoa(recorder.status)
+
+		httpRequests.WithLabelValues(path, code).Inc()
+		observeSince(httpDuration.WithLabelValues(path, code), start)
+	})
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestMetricsHandler(T *testing.T) {
+	hidden := get("/metrics", "")
+	metricsToken = "SomeMetricsToken"
+	defer func() { metricsToken = "" }()
+
+	recorder := get("/metrics", "Bearer SomeMetricsToken")
+	body := recorder.Body.String()
+	unauthorized := get("/metrics", "Bearer SomeOtherToken")
+
+	expectations := map[string]bool{
+		"Hide without token":  hidden.Code == http.StatusNotFound,
+		"Reject wrong token":  unauthorized.Code == http.StatusUnauthorized && !strings.Contains(unauthorized.Body.String(), "go_goroutines"),
+		"Return 200":          recorder.Code == http.StatusOK,
+		"Expose signing kid":  strings.Contains(body, `authservice_signing_key_info{kid="`+publicJWK().Kid+`"} 1`),
+		"Expose go collector": strings.Contains(body, "go_goroutines"),
+	}
+
+	CheckExpectations(expectations, T)
+}
+
+func TestMetricsUnaryInterceptor(T *testing.T) {
+	info := &grpc.UnaryServerInfo{FullMethod: "/AuthService/SomeMethod"}
+	ok := rpcRequests.WithLabelValues(info.FullMethod, "OK")
+	unauthenticated := rpcRequests.WithLabelValues(info.FullMethod, "Unauthenticated")
+	before, beforeFailed := testutil.ToFloat64(ok), testutil.ToFloat64(unauthenticated)
+
+	metricsUnaryInterceptor(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, nil
+	})
+	metricsUnaryInterceptor(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, status.Error(codes.Unauthenticated, "")
+	})
+
+	expectations := map[string]bool{
+		"Count OK":             testutil.ToFloat64(ok) == before+1,
+		"Count by status code": testutil.ToFloat64(unauthenticated) == beforeFailed+1,
+		"Observe latency":      testutil.CollectAndCount(rpcDuration) >= 2,
+	}
+
+	CheckExpectations(expectations, T)
+}
+
+func TestHTTPMetrics(T *testing.T) {
+	injectOAuthStore()
+	failed := httpRequests.WithLabelValues("/token", "400")
+	unknown := httpRequests.WithLabelValues("other", "404")
+	before, beforeUnknown := testutil.ToFloat64(failed), testutil.ToFloat64(unknown)
+
+	postForm("/token", url.Values{"grant_type": {"password"}}, func(r *http.Request) { r.SetBasicAuth("SomeService", "SomeServiceSecret") })
+	get("/some/unknown/path", "")
+
+	if testutil.ToFloat64(failed) != before+1 || testutil.ToFloat64(unknown) != beforeUnknown+1 {
+		T.Errorf("HTTP metrics failed! Expected requests counted by pattern and status code")
+	}
+}
+
+func TestLoginMetrics(T *testing.T) {
+	injectOAuthStore()
+	success := logins.WithLabelValues(auditSuccess, "")
+	invalid := logins.WithLabelValues(auditFailure, "invalid_credentials")
+	before, beforeInvalid := testutil.ToFloat64(success), testutil.ToFloat64(invalid)
+
+	authorize(authorizeParams("SomeClient"), "SomeID", "SomePW")
+	authorize(authorizeParams("SomeClient"), "SomeID", "SomeOtherPW")
+	register(testctx, "OtherID", "OtherPW")
+
+	if testutil.ToFloat64(success) != before+1 || testutil.ToFloat64(invalid) != beforeInvalid+1 {
+		T.Errorf("Login metrics failed! Expected one success and one invalid_credentials")
+	}
+
+	renewals := testutil.ToFloat64(tokenRenewals)
+	token, _ := login(testctx, "SomeID", "SomePW")
+	renew(testctx, token)
+
+	if testutil.ToFloat64(success) != before+2 || testutil.ToFloat64(tokenRenewals) != renewals+1 {
+		T.Errorf("Login metrics failed! Expected the session login and its renewal to be counted")
+	}
+}
+
+func TestTokenMetrics(T *testing.T) {
+	injectOAuthStore()
+	client := tokensIssued.WithLabelValues(subjectClient)
+	challenge := tokensIssued.WithLabelValues(mfaRequired)
+	before, beforeChallenge := testutil.ToFloat64(client), testutil.ToFloat64(challenge)
+
+	clientLogin(testctx, "SomeService", "SomeServiceSecret", "")
+	signClaims(testctx, NewMFAChallengeClaims("SomeID"))
+
+	response := openIDTokens(T, "openid")
+	renewals := testutil.ToFloat64(tokenRenewals)
+	postForm("/token", url.Values{"grant_type": {"refresh_token"}, "client_id": {"SomePublicClient"}, "refresh_token": {response.RefreshToken}})
+
+	expectations := map[string]bool{
+		"Count client tokens":    testutil.ToFloat64(client) == before+1,
+		"Count challenge tokens": testutil.ToFloat64(challenge) == beforeChallenge+1,
+		"Count renewals":         testutil.ToFloat64(tokenRenewals) == renewals+1,
+	}
+
+	CheckExpectations(expectations, T)
+}
+
+func TestInstrumentHashing(T *testing.T) {
+	generate := instrumentGenerate(bcrypt.GenerateFromPassword)
+	compare := instrumentCompare(func([]byte, []byte) error { return errors.New("SomeError") })
+
+	hash, err := generate([]byte("SomePW"), bcrypt.MinCost)
+	compareErr := compare(hash, []byte("SomePW"))
+
+	expectations := map[string]bool{
+		"Pass through hash":  err == nil && bcrypt.CompareHashAndPassword(hash, []byte("SomePW")) == nil,
+		"Pass through error": compareErr != nil && compareErr.Error() == "SomeError",
+		"Observe both":       testutil.CollectAndCount(hashingDuration) == 2,
+	}
+
+	CheckExpectations(expectations, T)
+}
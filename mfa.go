@@ -0,0 +1,293 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+)
+
+const mfaRequired = "mfa_required"
+const recoveryCodeCount = 10
+
+// Failed second factors after which a user's second factor is locked for mfaLockout.
+// The limit applies to the user, not to a challenge, so requesting new challenges does not reset it.
+const maxMFAFailures = 5
+const mfaLockout = 15 * time.Minute
+
+var errInvalidSecondFactor = errors.New("Invalid second factor")
+var errSecondFactorLocked = errors.New("Too many failed second factors, try again later")
+
+// issueToken returns the token handed out after a successful password check.
+// Users with confirmed TOTP only get a mfa_required challenge which has to be passed to verifyMFA.
+func issueToken(ctx context.Context, ud *UserData) (string, error) {
+	if ud == nil {
+		return "", errors.New("nil UserData")
+	}
+
+	if ud.TOTPConfirmed {
+		return signClaims(ctx, NewMFAChallengeClaims(ud.ID))
+	}
+
+	return finishLogin(ctx, ud)
+}
+
+// completeLogin signs new Claims for the user and persists the token.
+// It is shared by logins and registrations, so it does not count logins.
+func completeLogin(ctx context.Context, ud *UserData) (string, error) {
+	token, err := signClaims(ctx, NewClaims(ud.ID))
+
+	if err != nil {
+		return "", err
+	}
+
+	ud.Token = token
+
+	if err := writeToDB(ctx, ud); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// finishLogin completes the login of a user who passed all factors and counts it.
+func finishLogin(ctx context.Context, ud *UserData) (string, error) {
+	token, err := completeLogin(ctx, ud)
+
+	if err == nil {
+		observeLogin("")
+	}
+
+	return token, err
+}
+
+// enrollTOTP stores a new sealed TOTP secret for the user and returns its otpauth:// URI.
+// The secret is not used before it is confirmed through confirmTOTP.
+func enrollTOTP(ctx context.Context, id string) (string, error) {
+	ud, err := readComplete(ctx, id)
+
+	if err != nil {
+		return "", err
+	}
+
+	if ud.TOTPConfirmed {
+		return "", errors.New("TOTP is already enabled")
+	}
+
+	secret, err := newTOTPSecret()
+
+	if err != nil {
+		return "", err
+	}
+
+	sealed, err := seal(secret)
+
+	if err != nil {
+		return "", err
+	}
+
+	ud.TOTPSecret = sealed
+
+	if err := writeToDB(ctx, ud); err != nil {
+		return "", err
+	}
+
+	return totpURI(ud.ID, secret), nil
+}
+
+// confirmTOTP enables TOTP for the user if the code matches the enrolled secret.
+// Returns the one-time recovery codes which are only persisted as hashes.
+func confirmTOTP(ctx context.Context, id, code string) ([]string, error) {
+	ud, err := readComplete(ctx, id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if ud.TOTPConfirmed {
+		return nil, errors.New("TOTP is already enabled")
+	}
+
+	if len(ud.TOTPSecret) == 0 {
+		return nil, errors.New("TOTP is not enrolled")
+	}
+
+	secret, err := unseal(ud.TOTPSecret)
+
+	if err != nil {
+		return nil, err
+	}
+
+	counter, ok := validateTOTP(secret, code, ud.TOTPCounter)
+
+	if !ok {
+		return nil, errors.New("Invalid TOTP code")
+	}
+
+	codes, hashes, err := newRecoveryCodes(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = updateUser(ctx, ud, func(stored *UserData) error {
+		if stored.TOTPConfirmed {
+			return errors.New("TOTP is already enabled")
+		}
+
+		stored.TOTPConfirmed = true
+		stored.TOTPCounter = counter
+		stored.RecoveryCodes = hashes
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// verifyMFA exchanges a mfa_required challenge and a TOTP or recovery code for a regular token.
+func verifyMFA(ctx context.Context, challenge, code string) (string, error) {
+	_, claims, err := parseTyped(challenge, mfaRequired)
+
+	if err != nil {
+		return "", err
+	}
+
+	ud, err := readComplete(ctx, claims.ID)
+
+	if err != nil {
+		return "", err
+	}
+
+	if err := ud.verifySecondFactor(ctx, code); err != nil {
+		observeLogin("invalid_second_factor")
+		return "", err
+	}
+
+	return finishLogin(ctx, ud)
+}
+
+// verifySecondFactor checks the code as TOTP code first and as recovery code second.
+// A matching TOTP code is recorded and a matching recovery code is removed from the stored UserData.
+// Failures are counted, after maxMFAFailures the second factor is locked for mfaLockout.
+// Both happen in one transaction with the check of the stored TOTPCounter, so of concurrent
+// uses of the same code only one succeeds and no failure goes uncounted.
+func (ud *UserData) verifySecondFactor(ctx context.Context, code string) error {
+	if ud == nil || !ud.TOTPConfirmed {
+		return errInvalidSecondFactor
+	}
+
+	if now().Before(ud.MFALockedUntil) {
+		return errSecondFactorLocked
+	}
+
+	counter, recoveryHash, matched := ud.matchSecondFactor(ctx, code)
+
+	err := updateUser(ctx, ud, func(stored *UserData) error {
+		if now().Before(stored.MFALockedUntil) {
+			return errSecondFactorLocked
+		}
+
+		matched = matched && stored.useSecondFactor(counter, recoveryHash)
+
+		if matched {
+			stored.MFAFailures = 0
+			return nil
+		}
+
+		stored.MFAFailures++
+
+		if stored.MFAFailures >= maxMFAFailures {
+			stored.MFAFailures = 0
+			stored.MFALockedUntil = now().Add(mfaLockout)
+		}
+
+		return nil
+	})
+
+	if err == errSecondFactorLocked {
+		return err
+	}
+
+	if err != nil {
+		log.Printf("Unable to store second factor of %v: %v", ud.ID, err)
+		return errInvalidSecondFactor
+	}
+
+	if !matched {
+		return errInvalidSecondFactor
+	}
+
+	return nil
+}
+
+// matchSecondFactor returns the time step of a matching TOTP code or the hash of a matching recovery code.
+// The comparisons happen outside of the transaction of verifySecondFactor as recovery codes are hashed.
+func (ud *UserData) matchSecondFactor(ctx context.Context, code string) (int64, string, bool) {
+	secret, err := unseal(ud.TOTPSecret)
+
+	if err == nil {
+		if counter, ok := validateTOTP(secret, code, ud.TOTPCounter); ok {
+			return counter, "", true
+		}
+	}
+
+	for _, hash := range ud.RecoveryCodes {
+		if comparePassword(ctx, []byte(hash), []byte(strings.ToLower(code))) == nil {
+			return 0, hash, true
+		}
+	}
+
+	return 0, "", false
+}
+
+// useSecondFactor records the TOTP time step or removes the recovery code returned by matchSecondFactor.
+// It fails for time steps which are not newer than the stored TOTPCounter and for removed recovery codes.
+func (ud *UserData) useSecondFactor(counter int64, recoveryHash string) bool {
+	if recoveryHash == "" {
+		if ud.TOTPCounter != 0 && counter <= ud.TOTPCounter {
+			return false
+		}
+
+		ud.TOTPCounter = counter
+		return true
+	}
+
+	for i, hash := range ud.RecoveryCodes {
+		if hash == recoveryHash {
+			ud.RecoveryCodes = append(ud.RecoveryCodes[:i:i], ud.RecoveryCodes[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+func newRecoveryCodes(ctx context.Context) ([]string, []string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+
+	for i := range codes {
+		raw := make([]byte, 5)
+
+		if _, err := randRead(raw); err != nil {
+			return nil, nil, err
+		}
+
+		codes[i] = strings.ToLower(base32NoPadding.EncodeToString(raw))
+		hash, err := hashPassword(ctx, []byte(codes[i]))
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		hashes[i] = string(hash)
+	}
+
+	return codes, hashes, nil
+}
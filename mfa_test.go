@@ -0,0 +1,343 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/datastore"
+	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// injectUserData lets getAll return the given UserData, records calls to put and update and keeps inserted keys.
+func injectUserData(ud *UserData, expectations map[string]bool) {
+	getAll = func(ctx context.Context, q *datastore.Query, dst interface{}) ([]*datastore.Key, error) {
+		slice, _ := dst.(*[]*UserData)
+		*slice = append(*slice, ud)
+		return nil, nil
+	}
+
+	put = func(ctx context.Context, key *datastore.Key, src interface{}) (*datastore.Key, error) {
+		expectations["Call put"] = true
+		return &datastore.Key{}, nil
+	}
+
+	inserted := map[string]bool{}
+	insert = func(ctx context.Context, key *datastore.Key, src interface{}) error {
+		if inserted[key.String()] {
+			return status.Error(codes.AlreadyExists, "entity already exists")
+		}
+
+		inserted[key.String()] = true
+		return nil
+	}
+
+	update = func(ctx context.Context, key *datastore.Key, dst interface{}, change func() error) error {
+		expectations["Call put"] = true
+		*dst.(*UserData) = *ud
+
+		if err := change(); err != nil {
+			return err
+		}
+
+		*ud = *dst.(*UserData)
+		return nil
+	}
+}
+
+func currentTOTP(secret []byte) string {
+	return hotp(secret, uint64(now().Unix()/totpPeriod))
+}
+
+// nextTOTP returns the code of the next time step, which is accepted after the current code was used.
+func nextTOTP(secret []byte) string {
+	return hotp(secret, uint64(now().Unix()/totpPeriod+1))
+}
+
+// enrolledUserData returns confirmed UserData along with its TOTP secret and recovery codes
+func enrolledUserData(T *testing.T) (*UserData, []byte, []string) {
+	generateFromPassword = bcrypt.GenerateFromPassword
+	compareHashAndPassword = bcrypt.CompareHashAndPassword
+
+	ud := &UserData{ID: "SomeID"}
+	injectUserData(ud, map[string]bool{})
+
+	uri, err := enrollTOTP(testctx, "SomeID")
+	if err != nil {
+		T.Fatalf("enrollTOTP failed with Error: %v", err)
+	}
+
+	parsedURI, _ := url.Parse(uri)
+	secret, _ := base32NoPadding.DecodeString(parsedURI.Query().Get("secret"))
+
+	codes, err := confirmTOTP(testctx, "SomeID", currentTOTP(secret))
+	if err != nil {
+		T.Fatalf("confirmTOTP failed with Error: %v", err)
+	}
+
+	return ud, secret, codes
+}
+
+func TestEnrollTOTP(T *testing.T) {
+	T.Run("Valid enrollment", func(t *testing.T) {
+		expectations := map[string]bool{}
+		ud := &UserData{ID: "SomeID"}
+		injectUserData(ud, expectations)
+
+		uri, err := enrollTOTP(testctx, "SomeID")
+		parsedURI, _ := url.Parse(uri)
+		secret, _ := base32NoPadding.DecodeString(parsedURI.Query().Get("secret"))
+		unsealed, _ := unseal(ud.TOTPSecret)
+
+		expectations["Nil error"] = err == nil
+		expectations["Return otpauth URI"] = parsedURI.Scheme == "otpauth" && parsedURI.Host == "totp"
+		expectations["Return 20 byte secret"] = len(secret) == 20
+		expectations["Store sealed secret"] = string(unsealed) == string(secret) && string(ud.TOTPSecret) != string(secret)
+		expectations["Do not confirm TOTP"] = !ud.TOTPConfirmed
+
+		CheckExpectations(expectations, t)
+	})
+
+	T.Run("Already enabled", func(t *testing.T) {
+		expectations := map[string]bool{}
+		injectUserData(&UserData{ID: "SomeID", TOTPConfirmed: true}, expectations)
+
+		uri, err := enrollTOTP(testctx, "SomeID")
+
+		expectations["Return empty URI"] = uri == ""
+		expectations["Return error"] = err != nil && err.Error() == "TOTP is already enabled"
+		expectations["Do not call put"] = !expectations["Call put"]
+
+		CheckExpectations(expectations, t)
+	})
+}
+
+func TestConfirmTOTP(T *testing.T) {
+	T.Run("Not enrolled", func(t *testing.T) {
+		injectUserData(&UserData{ID: "SomeID"}, map[string]bool{})
+
+		codes, err := confirmTOTP(testctx, "SomeID", "123456")
+
+		if codes != nil || err == nil || err.Error() != "TOTP is not enrolled" {
+			t.Errorf("confirmTOTP failed! Expected 'TOTP is not enrolled' got '%v', '%v'", codes, err)
+		}
+	})
+
+	T.Run("Invalid code", func(t *testing.T) {
+		expectations := map[string]bool{}
+		ud := &UserData{ID: "SomeID"}
+		injectUserData(ud, map[string]bool{})
+		uri, _ := enrollTOTP(testctx, "SomeID")
+		injectUserData(ud, expectations)
+
+		codes, err := confirmTOTP(testctx, "SomeID", "abcdef")
+
+		expectations["Return no codes"] = codes == nil
+		expectations["Return error"] = err != nil && err.Error() == "Invalid TOTP code"
+		expectations["Do not confirm TOTP"] = !ud.TOTPConfirmed
+		expectations["Do not call put"] = !expectations["Call put"]
+		expectations["Enroll before"] = uri != ""
+
+		CheckExpectations(expectations, t)
+	})
+
+	T.Run("Valid code", func(t *testing.T) {
+		expectations := map[string]bool{}
+		ud, _, codes := enrolledUserData(t)
+
+		expectations["Confirm TOTP"] = ud.TOTPConfirmed
+		expectations["Return recovery codes"] = len(codes) == recoveryCodeCount
+		expectations["Store recovery code hashes"] = len(ud.RecoveryCodes) == recoveryCodeCount && ud.RecoveryCodes[0] != codes[0]
+
+		CheckExpectations(expectations, t)
+	})
+}
+
+func TestIssueToken(T *testing.T) {
+	T.Run("Nil UserData", func(t *testing.T) {
+		token, err := issueToken(testctx, nil)
+
+		if token != "" || err == nil {
+			t.Errorf("issueToken failed! Expected error for nil UserData got '%v', '%v'", token, err)
+		}
+	})
+
+	T.Run("Without TOTP", func(t *testing.T) {
+		expectations := map[string]bool{}
+		ud := &UserData{ID: "SomeID"}
+		injectUserData(ud, expectations)
+
+		token, err := issueToken(testctx, ud)
+		_, claims, parseErr := parse(token)
+
+		expectations["Nil error"] = err == nil
+		expectations["Return regular token"] = parseErr == nil && claims.ID == "SomeID"
+		expectations["Store token"] = ud.Token == token
+
+		CheckExpectations(expectations, t)
+	})
+
+	T.Run("With TOTP", func(t *testing.T) {
+		expectations := map[string]bool{}
+		ud := &UserData{ID: "SomeID", TOTPConfirmed: true}
+		injectUserData(ud, expectations)
+
+		challenge, err := issueToken(testctx, ud)
+		_, _, parseErr := parse(challenge)
+		_, claims, challengeErr := parseTyped(challenge, mfaRequired)
+
+		expectations["Nil error"] = err == nil
+		expectations["Reject challenge as regular token"] = parseErr != nil
+		expectations["Return mfa_required challenge"] = challengeErr == nil && claims.ID == "SomeID"
+		expectations["Do not store challenge"] = ud.Token == ""
+		expectations["Do not call put"] = !expectations["Call put"]
+
+		CheckExpectations(expectations, t)
+	})
+}
+
+func TestVerifyMFA(T *testing.T) {
+	T.Run("Valid TOTP code", func(t *testing.T) {
+		expectations := map[string]bool{}
+		ud, secret, _ := enrolledUserData(t)
+		challenge, _ := issueToken(testctx, ud)
+
+		_, confirmedErr := verifyMFA(testctx, challenge, currentTOTP(secret))
+		token, err := verifyMFA(testctx, challenge, nextTOTP(secret))
+		_, claims, parseErr := parse(token)
+		_, replayErr := verifyMFA(testctx, challenge, nextTOTP(secret))
+
+		expectations["Reject code used to confirm"] = confirmedErr == errInvalidSecondFactor
+		expectations["Nil error"] = err == nil
+		expectations["Return regular token"] = parseErr == nil && claims.ID == "SomeID"
+		expectations["Store token"] = ud.Token == token
+		expectations["Reject replayed code"] = replayErr == errInvalidSecondFactor
+
+		CheckExpectations(expectations, t)
+	})
+
+	T.Run("Recovery code", func(t *testing.T) {
+		expectations := map[string]bool{}
+		ud, _, codes := enrolledUserData(t)
+		challenge, _ := issueToken(testctx, ud)
+
+		token, err := verifyMFA(testctx, challenge, codes[3])
+		expectations["Nil error"] = err == nil
+		expectations["Return token"] = token != ""
+		expectations["Consume recovery code"] = len(ud.RecoveryCodes) == recoveryCodeCount-1
+
+		token, err = verifyMFA(testctx, challenge, codes[3])
+		expectations["Reject used recovery code"] = token == "" && err != nil
+
+		CheckExpectations(expectations, t)
+	})
+
+	T.Run("Invalid code", func(t *testing.T) {
+		ud, _, _ := enrolledUserData(t)
+		challenge, _ := issueToken(testctx, ud)
+
+		token, err := verifyMFA(testctx, challenge, "000000a")
+
+		if token != "" || err == nil || err.Error() != "Invalid second factor" {
+			t.Errorf("verifyMFA failed! Expected 'Invalid second factor' got '%v', '%v'", token, err)
+		}
+	})
+
+	T.Run("Lockout", func(t *testing.T) {
+		expectations := map[string]bool{}
+		ud, secret, _ := enrolledUserData(t)
+		defer func() { now = func() time.Time { return testtime } }()
+
+		for i := 0; i < maxMFAFailures; i++ {
+			challenge, _ := issueToken(testctx, ud)
+			verifyMFA(testctx, challenge, "000000")
+		}
+
+		challenge, _ := issueToken(testctx, ud)
+		_, lockedErr := verifyMFA(testctx, challenge, nextTOTP(secret))
+		expectations["Lock after failures"] = lockedErr == errSecondFactorLocked && ud.MFALockedUntil == testtime.Add(mfaLockout)
+
+		now = func() time.Time { return testtime.Add(mfaLockout) }
+		challenge, _ = issueToken(testctx, ud)
+		_, unlockedErr := verifyMFA(testctx, challenge, currentTOTP(secret))
+		expectations["Unlock after lockout"] = unlockedErr == nil && ud.MFAFailures == 0
+
+		CheckExpectations(expectations, t)
+	})
+
+	T.Run("Regular token as challenge", func(t *testing.T) {
+		ud, secret, _ := enrolledUserData(t)
+		ud.TOTPConfirmed = false
+		token, _ := issueToken(testctx, ud)
+		ud.TOTPConfirmed = true
+
+		result, err := verifyMFA(testctx, token, currentTOTP(secret))
+
+		if result != "" || err == nil {
+			t.Errorf("verifyMFA failed! Expected error for regular token got '%v', '%v'", result, err)
+		}
+	})
+}
+
+func TestMFAUpdatesStoredUser(T *testing.T) {
+	generateFromPassword = bcrypt.GenerateFromPassword
+	compareHashAndPassword = bcrypt.CompareHashAndPassword
+	store := injectMemoryStore(NewUserData(testctx, "SomeID", "SomePW"))
+	expectations := map[string]bool{}
+
+	uri, err := enrollTOTP(testctx, "SomeID")
+	parsedURI, _ := url.Parse(uri)
+	secret, _ := base32NoPadding.DecodeString(parsedURI.Query().Get("secret"))
+	expectations["Enroll"] = err == nil && store.count("USER") == 1
+
+	_, err = confirmTOTP(testctx, "SomeID", currentTOTP(secret))
+	expectations["Confirm"] = err == nil && store.count("USER") == 1
+
+	challenge, _ := login(testctx, "SomeID", "SomePW")
+	_, failedErr := verifyMFA(testctx, challenge, "000000")
+	expectations["Count failure"] = failedErr == errInvalidSecondFactor && store.count("USER") == 1
+
+	token, err := verifyMFA(testctx, challenge, nextTOTP(secret))
+	ud, readErr := readComplete(testctx, "SomeID")
+	expectations["Verify"] = err == nil && store.count("USER") == 1
+	expectations["Keep a single readable user"] = readErr == nil && ud.Token == token && ud.TOTPConfirmed
+
+	CheckExpectations(expectations, T)
+}
+
+func TestConcurrentSecondFactor(T *testing.T) {
+	generateFromPassword = bcrypt.GenerateFromPassword
+	compareHashAndPassword = bcrypt.CompareHashAndPassword
+	injectMemoryStore(NewUserData(testctx, "SomeID", "SomePW"))
+
+	uri, _ := enrollTOTP(testctx, "SomeID")
+	parsedURI, _ := url.Parse(uri)
+	secret, _ := base32NoPadding.DecodeString(parsedURI.Query().Get("secret"))
+	confirmTOTP(testctx, "SomeID", currentTOTP(secret))
+
+	ud, _ := readComplete(testctx, "SomeID")
+	// Another instance read the user before the first use was stored
+	stale := *ud
+	first := ud.verifySecondFactor(testctx, nextTOTP(secret))
+	second := stale.verifySecondFactor(testctx, nextTOTP(secret))
+
+	// Every instance read the user before any failure was stored
+	read := *ud
+	for i := 0; i < maxMFAFailures; i++ {
+		stale := read
+		stale.verifySecondFactor(testctx, "000000")
+	}
+
+	stored, err := readComplete(testctx, "SomeID")
+
+	expectations := map[string]bool{
+		"Accept first use":    first == nil,
+		"Reject second use":   second == errInvalidSecondFactor,
+		"Count every failure": err == nil && stored.MFALockedUntil == testtime.Add(mfaLockout),
+	}
+
+	CheckExpectations(expectations, T)
+}
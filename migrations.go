@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"cloud.google.com/go/datastore"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Datastore kind of the migrationState.
+const migrationKind = "MIGRATION"
+
+// Number of users read and written by a migration at once. Progress is stored after every batch.
+var migrationBatchSize = 500
+
+// userMigration changes stored UserData, e.g. to backfill a new field.
+// apply changes the ud in place and reports whether it changed. It has to be idempotent,
+// because the batch of a migration which was interrupted is applied again when the migration is resumed.
+// Errors wrapping errMigrationConflict skip the user, all other errors stop the migration.
+type userMigration struct {
+	name        string
+	description string
+	apply       func(ctx context.Context, run *migrationRun, ud *UserData) (bool, error)
+}
+
+// errMigrationConflict marks users which can not be migrated before an operator resolved a conflict,
+// e.g. by deleting one of two users whose IDs canonicalize to the same CanonicalID.
+var errMigrationConflict = errors.New("Conflict")
+
+// migrationRun is the state of a single run of a migration.
+type migrationRun struct {
+	// claimed maps the CanonicalIDs set during the run to the ID of their user. Dry runs do not
+	// store them, so collisions within the run are only found through claimed.
+	claimed   map[string]string
+	conflicts []string
+}
+
+// Name of the migration setting the CanonicalID of users stored before IDs were canonicalized.
+const canonicalIDsMigration = "0001-canonical-ids"
+
+// userMigrations are applied in order. Applied migrations must neither be changed nor removed.
+var userMigrations = []userMigration{
+	{
+		name:        canonicalIDsMigration,
+		description: "Set the CanonicalID of users stored before IDs were canonicalized",
+		apply: func(ctx context.Context, run *migrationRun, ud *UserData) (bool, error) {
+			if ud.CanonicalID != "" {
+				return false, nil
+			}
+
+			canonical, err := canonicalID(ud.ID)
+
+			if err != nil {
+				return false, err
+			}
+
+			if other, ok := run.claimed[canonical]; ok {
+				return false, fmt.Errorf("%w: CanonicalID '%v' is already taken by '%v'", errMigrationConflict, canonical, other)
+			}
+
+			taken, err := canonicalIDTaken(ctx, canonical)
+
+			if err != nil {
+				return false, err
+			}
+
+			if taken {
+				return false, fmt.Errorf("%w: CanonicalID '%v' is already taken", errMigrationConflict, canonical)
+			}
+
+			run.claimed[canonical] = ud.ID
+			ud.CanonicalID = canonical
+			return true, nil
+		},
+	},
+	{
+		name:        "0002-native-bcrypt-hashes",
+		description: "Use imported bcrypt hashes of at least bcryptCost like hashes of hashPassword",
+		apply: func(ctx context.Context, run *migrationRun, ud *UserData) (bool, error) {
+			if ud.HashAlgorithm != hashBcrypt {
+				return false, nil
+			}
+
+			if cost, err := bcrypt.Cost([]byte(ud.Hash)); err != nil || cost < bcryptCost {
+				return false, nil
+			}
+
+			ud.HashAlgorithm = ""
+			return true, nil
+		},
+	},
+}
+
+// migrationState tracks the progress of a migration in the store.
+// Cursor points behind the last completed batch and is empty before the first one.
+type migrationState struct {
+	Name      string
+	Cursor    string `datastore:",noindex"`
+	Processed int
+	Changed   int
+	Done      bool
+	Started   time.Time
+	Finished  time.Time
+	key       *datastore.Key `datastore:"__key__"`
+}
+
+func (s *migrationState) setKey(key *datastore.Key) {
+	s.key = key
+}
+
+func (s *migrationState) status() string {
+	if s.Done {
+		return "applied"
+	}
+
+	if s.key == nil {
+		return "pending"
+	}
+
+	return "interrupted"
+}
+
+// readMigrationState returns the stored state of the migration, or a new one if it never ran.
+func readMigrationState(ctx context.Context, name string) (*migrationState, error) {
+	states := []*migrationState{}
+
+	if err := getEntities(ctx, newQuery(migrationKind).Filter("Name =", name), &states); err != nil {
+		return nil, err
+	}
+
+	if len(states) > 1 {
+		return nil, fmt.Errorf("Migration '%v' is tracked %v times", name, len(states))
+	}
+
+	if len(states) == 0 {
+		return &migrationState{Name: name}, nil
+	}
+
+	return states[0], nil
+}
+
+func writeMigrationState(ctx context.Context, s *migrationState) error {
+	key := s.key
+
+	if key == nil {
+		key = datastore.NameKey(migrationKind, s.Name, nil)
+	}
+
+	k, err := putEntity(ctx, migrationKind, key, s)
+
+	if err != nil {
+		return err
+	}
+
+	s.key = k
+
+	return nil
+}
+
+// runMigrations applies all migrations which are not applied yet and reports their progress to out.
+// With dryRun users are migrated in memory only and neither they nor the progress are stored.
+func runMigrations(ctx context.Context, dryRun bool, out io.Writer) error {
+	for _, m := range userMigrations {
+		if err := runMigration(ctx, m, dryRun, out); err != nil {
+			return fmt.Errorf("Migration %v failed: %w", m.name, err)
+		}
+	}
+
+	return nil
+}
+
+// runMigration applies the migration batch by batch, resuming after the last stored batch.
+// Conflicting users are skipped and reported at the end. The migration stays pending until
+// a run without conflicts, which starts over and skips the users migrated before.
+func runMigration(ctx context.Context, m userMigration, dryRun bool, out io.Writer) error {
+	state, err := readMigrationState(ctx, m.name)
+
+	if err != nil {
+		return err
+	}
+
+	if state.Done {
+		fmt.Fprintf(out, "%v: already applied\n", m.name)
+		return nil
+	}
+
+	if state.Cursor != "" {
+		fmt.Fprintf(out, "%v: resuming after %v users\n", m.name, state.Processed)
+	} else {
+		state.Processed, state.Changed = 0, 0
+		state.Started = now()
+	}
+
+	run := &migrationRun{claimed: map[string]string{}}
+
+	for {
+		page := []*UserData{}
+		next, err := getEntityPage(ctx, newQuery(userKind).Limit(migrationBatchSize), state.Cursor, &page)
+
+		if err != nil {
+			return err
+		}
+
+		for _, stored := range page {
+			// The stored UserData stays unchanged on dry runs
+			ud := *stored
+			changed, err := m.apply(ctx, run, &ud)
+
+			if errors.Is(err, errMigrationConflict) {
+				run.conflicts = append(run.conflicts, fmt.Sprintf("User '%v': %v", ud.ID, err))
+				continue
+			}
+
+			if err != nil {
+				return fmt.Errorf("User '%v': %w", ud.ID, err)
+			}
+
+			if changed && !dryRun {
+				if err := writeToDB(ctx, &ud); err != nil {
+					return fmt.Errorf("User '%v': %w", ud.ID, err)
+				}
+			}
+
+			if changed {
+				state.Changed++
+			}
+		}
+
+		state.Processed += len(page)
+		state.Cursor = next
+		last := len(page) < migrationBatchSize
+
+		if last {
+			state.Done = len(run.conflicts) == 0
+			state.Cursor = ""
+
+			if state.Done {
+				state.Finished = now()
+			}
+		}
+
+		if !dryRun {
+			if err := writeMigrationState(ctx, state); err != nil {
+				return err
+			}
+		}
+
+		fmt.Fprintf(out, "%v: %v users processed, %v changed\n", m.name, state.Processed, state.Changed)
+
+		if last {
+			break
+		}
+	}
+
+	for _, conflict := range run.conflicts {
+		fmt.Fprintf(out, "%v: %v\n", m.name, conflict)
+	}
+
+	if dryRun {
+		fmt.Fprintf(out, "%v: dry run, nothing was changed\n", m.name)
+	}
+
+	if len(run.conflicts) > 0 {
+		return fmt.Errorf("%v users conflict, delete or re-register one user of each conflict and run the migration again", len(run.conflicts))
+	}
+
+	return nil
+}
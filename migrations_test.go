@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/datastore"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// legacyUser is stored without CanonicalID like users registered before IDs were canonicalized.
+func legacyUser(id string) *UserData {
+	ud := NewUserData(testctx, id, "SomePW")
+	ud.CanonicalID = ""
+
+	return ud
+}
+
+func TestRunMigrations(T *testing.T) {
+	migrationBatchSize = 2
+	defer func() { migrationBatchSize = 500 }()
+
+	bcryptHash, _ := bcrypt.GenerateFromPassword([]byte("OtherPW"), bcrypt.MinCost)
+	imported := &UserData{ID: "ImportedID", CanonicalID: "importedid", Hash: string(bcryptHash), HashAlgorithm: hashBcrypt}
+	store := injectMemoryStore(NewUserData(testctx, "SomeID", "SomePW"), legacyUser("LegacyID"), legacyUser("OtherLegacyID"), imported)
+
+	dryRun := &bytes.Buffer{}
+	dryRunErr := runMigrations(testctx, true, dryRun)
+	entitiesAfterDryRun := len(store.entities)
+	unmigrated, dryRunReadErr := readUser(testctx, "LegacyID")
+
+	out := &bytes.Buffer{}
+	err := runMigrations(testctx, false, out)
+	migrated, readErr := readUser(testctx, "LegacyID")
+	converted, _ := readUser(testctx, "ImportedID")
+	state, _ := readMigrationState(testctx, "0001-canonical-ids")
+	users, states := store.count("USER"), store.count("MIGRATION")
+
+	again := &bytes.Buffer{}
+	againErr := runMigrations(testctx, false, again)
+
+	expectations := map[string]bool{
+		"Dry run":               dryRunErr == nil && strings.Contains(dryRun.String(), "4 users processed, 2 changed") && strings.Contains(dryRun.String(), "nothing was changed"),
+		"Store nothing on dry":  entitiesAfterDryRun == 4 && dryRunReadErr == nil && unmigrated.CanonicalID == "",
+		"Backfill CanonicalID":  err == nil && readErr == nil && migrated.CanonicalID == "legacyid",
+		"Convert bcrypt hashes": converted.HashAlgorithm == "" && converted.compare(testctx, "OtherPW"),
+		"Report progress":       strings.Contains(out.String(), "0001-canonical-ids: 2 users processed") && strings.Contains(out.String(), "0001-canonical-ids: 4 users processed, 2 changed"),
+		"Update users in place": users == 4 && states == len(userMigrations),
+		"Track state":           state.Done && state.Processed == 4 && state.Changed == 2 && state.Cursor == "" && state.status() == "applied",
+		"Skip applied":          againErr == nil && strings.Count(again.String(), "already applied") == len(userMigrations),
+	}
+
+	CheckExpectations(expectations, T)
+}
+
+func TestResumeMigration(T *testing.T) {
+	migrationBatchSize = 1
+	defer func() { migrationBatchSize = 500 }()
+
+	store := injectMemoryStore(legacyUser("LegacyID"), legacyUser("OtherLegacyID"), legacyUser("ThirdLegacyID"))
+	memoryPut := put
+	puts := 0
+
+	put = func(ctx context.Context, key *datastore.Key, src interface{}) (*datastore.Key, error) {
+		if _, ok := src.(*UserData); ok {
+			if puts++; puts == 2 {
+				return nil, errors.New("Unavailable")
+			}
+		}
+
+		return memoryPut(ctx, key, src)
+	}
+
+	failErr := runMigration(testctx, userMigrations[0], false, &bytes.Buffer{})
+	interrupted, _ := readMigrationState(testctx, "0001-canonical-ids")
+	interruptedCursor, interruptedStatus := interrupted.Cursor, interrupted.status()
+
+	now = func() time.Time { return testtime.Add(time.Hour) }
+	defer func() { now = func() time.Time { return testtime } }()
+
+	out := &bytes.Buffer{}
+	err := runMigration(testctx, userMigrations[0], false, out)
+	_, readErr := readUser(testctx, "OtherLegacyID")
+	state, _ := readMigrationState(testctx, "0001-canonical-ids")
+
+	expectations := map[string]bool{
+		"Stop on failure":     failErr != nil && strings.Contains(failErr.Error(), "OtherLegacyID"),
+		"Keep cursor":         interruptedCursor == "1" && interruptedStatus == "interrupted",
+		"Resume after cursor": err == nil && strings.Contains(out.String(), "resuming after 1 users"),
+		"Keep start of run":   state.Started == testtime && state.Finished == testtime.Add(time.Hour),
+		"Finish migration":    readErr == nil && state.Done && state.Processed == 3 && state.Changed == 3,
+		"Keep a single state": store.count("USER") == 3 && store.count("MIGRATION") == 1,
+	}
+
+	CheckExpectations(expectations, T)
+}
+
+func TestCanonicalIDConflict(T *testing.T) {
+	taken, duplicate := legacyUser("someid"), legacyUser("LEGACYID")
+	injectMemoryStore(NewUserData(testctx, "SomeID", "SomePW"), taken, legacyUser("LegacyID"), duplicate, legacyUser("OtherLegacyID"))
+
+	dryRun := &bytes.Buffer{}
+	dryRunErr := runMigration(testctx, userMigrations[0], true, dryRun)
+
+	out := &bytes.Buffer{}
+	err := runMigration(testctx, userMigrations[0], false, out)
+	migrated, _ := readUser(testctx, "OtherLegacyID")
+	state, _ := readMigrationState(testctx, "0001-canonical-ids")
+
+	expectations := map[string]bool{
+		"Report conflicts on dry run": dryRunErr != nil && strings.Contains(dryRunErr.Error(), "2 users conflict") && strings.Contains(dryRun.String(), "already taken by 'LegacyID'"),
+		"Report every conflict":       err != nil && strings.Contains(out.String(), "User 'someid'") && strings.Contains(out.String(), "User 'LEGACYID'"),
+		"Migrate other users":         migrated.CanonicalID == "otherlegacyid" && taken.CanonicalID == "" && duplicate.CanonicalID == "",
+		"Keep pending state":          !state.Done && state.Cursor == "",
+	}
+
+	deleteEntity(testctx, taken.key)
+	deleteEntity(testctx, duplicate.key)
+
+	err = runMigration(testctx, userMigrations[0], false, &bytes.Buffer{})
+	state, _ = readMigrationState(testctx, "0001-canonical-ids")
+	expectations["Apply after resolving"] = err == nil && state.Done && state.Processed == 3 && state.Changed == 0
+
+	CheckExpectations(expectations, T)
+}
+
+func TestMigrateCommands(T *testing.T) {
+	defer injectCLI()()
+
+	pending, pendingErr := runCLIWith("", "migrate", "status")
+	_, runErr := runCLIWith("", "migrate", "run", "-batch-size", "1")
+	applied, _ := runCLIWith("", "migrate", "status")
+
+	expectations := map[string]bool{
+		"Show pending":      pendingErr == nil && strings.Contains(pending, "0001-canonical-ids") && strings.Contains(pending, "pending"),
+		"Run migrations":    runErr == nil && migrationBatchSize == 1,
+		"Show applied":      strings.Count(applied, "applied") == len(userMigrations),
+		"Reject batch size": func() bool { _, err := runCLIWith("", "migrate", "run", "-batch-size", "0"); return err != nil }(),
+	}
+
+	migrationBatchSize = 500
+
+	CheckExpectations(expectations, T)
+}
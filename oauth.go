@@ -0,0 +1,584 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"time"
+
+	"cloud.google.com/go/datastore"
+)
+
+const accessTokenLifetime = time.Hour
+const authorizationCodeLifetime = time.Minute
+
+// accessTokenAudience is the aud of access tokens, naming the APIs they are meant for. Empty omits aud.
+var accessTokenAudience = ""
+
+// OAuthGrant is a user's authorization of a client.
+// Authorization code and refresh token are only stored as hashes. RedirectURI is the redirect_uri
+// of the authorization request, empty if the request relied on the client's only registered URI.
+type OAuthGrant struct {
+	ID            string
+	ClientID      string
+	Scope         string `datastore:",noindex"`
+	RedirectURI   string `datastore:",noindex"`
+	CodeHash      string
+	CodeChallenge string    `datastore:",noindex"`
+	CodeExp       time.Time `datastore:",noindex"`
+	RefreshHash   string
+	Nonce         string         `datastore:",noindex"`
+	AuthTime      time.Time      `datastore:",noindex"`
+	key           *datastore.Key `datastore:"__key__"`
+}
+
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+}
+
+type oauthError struct {
+	Error       string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+var loginForm = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html>
+<body>
+<form method="POST">
+{{range $key, $values := .Params}}{{range $values}}<input type="hidden" name="{{$key}}" value="{{.}}">
+{{end}}{{end}}{{if .Error}}<p>{{.Error}}</p>
+{{end}}<input name="ID" placeholder="ID" autofocus>
+<input name="Password" type="password" placeholder="Password">
+<input name="Code" placeholder="Authentication code (if enabled)" autocomplete="one-time-code">
+<button type="submit">Authorize {{.ClientID}}</button>
+</form>
+</body>
+</html>
+`))
+
+// oauthHandler serves the OAuth 2.0 authorization server and OpenID Connect provider endpoints.
+func oauthHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/authorize", handleAuthorize)
+	mux.HandleFunc("/token", handleToken)
+	mux.HandleFunc("/revoke", handleRevoke)
+	mux.HandleFunc("/userinfo", handleUserinfo)
+	mux.HandleFunc("/.well-known/openid-configuration", handleDiscovery)
+	mux.HandleFunc("/.well-known/jwks.json", handleJWKS)
+	mux.HandleFunc("/verify-email", handleVerifyEmail)
+	mux.HandleFunc("/reset-password", handleResetPassword)
+
+	if browserSessions {
+		mux.HandleFunc("/session/login", handleSessionLogin)
+		mux.Handle("/session/logout", browserSession(http.HandlerFunc(handleSessionLogout)))
+		mux.Handle("/session", browserSession(http.HandlerFunc(handleSession)))
+	}
+
+	registerGateway(mux)
+
+	root := http.NewServeMux()
+	root.Handle("/metrics", metricsHandler())
+	root.HandleFunc("/healthz", handleHealthz)
+	root.HandleFunc("/readyz", handleReadyz)
+	root.Handle("/", tracingHandler(mux, instrumentHTTP(mux, auditHandler(mux))))
+
+	return root
+}
+
+// randomToken returns 32 random bytes encoded as base64url.
+func randomToken() (string, error) {
+	raw := make([]byte, 32)
+
+	if _, err := randRead(raw); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// hashToken hashes high entropy tokens for lookups. Passwords go through bcrypt instead.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// newAccessToken signs short-lived Claims for the id on behalf of the client.
+func newAccessToken(ctx context.Context, id, clientID, scope string) (string, error) {
+	claims := NewClaims(id)
+
+	if claims == nil {
+		return "", errors.New("empty id")
+	}
+
+	claims.Exp = claims.Iat.Add(accessTokenLifetime)
+	claims.Aud = accessTokenAudience
+	claims.ClientID = clientID
+	claims.Scope = scope
+
+	return signClaims(ctx, claims)
+}
+
+func (g *OAuthGrant) setKey(key *datastore.Key) {
+	g.key = key
+}
+
+func writeGrantToDB(ctx context.Context, g *OAuthGrant) error {
+	if g == nil {
+		return nil
+	}
+
+	k, err := putEntity(ctx, "GRANT", g.key, g)
+
+	if err != nil {
+		return err
+	}
+
+	g.key = k
+
+	return nil
+}
+
+// readGrantByHash reads the grant whose CodeHash or RefreshHash field matches the hashed token.
+func readGrantByHash(ctx context.Context, field, token string) (*OAuthGrant, error) {
+	if token == "" {
+		return nil, errors.New("empty token")
+	}
+
+	query := newQuery("GRANT").Filter(field+" =", hashToken(token))
+	dst := []*OAuthGrant{}
+
+	if err := getEntities(ctx, query, &dst); err != nil {
+		return nil, err
+	}
+
+	if err := singleResult(len(dst), query); err != nil {
+		return nil, err
+	}
+
+	return dst[0], nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeOAuthError(w http.ResponseWriter, status int, code, description string) {
+	auditEventOf(w).Reason = code
+	writeJSON(w, status, oauthError{Error: code, Description: description})
+}
+
+// redirectWithParams redirects back to the client with the params added to the redirect URI's query.
+func redirectWithParams(w http.ResponseWriter, r *http.Request, redirectURI string, params url.Values) {
+	target, _ := url.Parse(redirectURI)
+	query := target.Query()
+
+	for key := range params {
+		query.Set(key, params.Get(key))
+	}
+
+	target.RawQuery = query.Encode()
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
+
+// handleAuthorize implements the authorization code flow with mandatory S256 PKCE.
+// GET renders a login form, POST checks the credentials and redirects with a code.
+func handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	client, err := readClient(ctx, r.Form.Get("client_id"))
+
+	if err != nil {
+		http.Error(w, "unknown client", http.StatusBadRequest)
+		return
+	}
+
+	// Errors are only reported to validated redirect URIs
+	redirectURI := client.redirectURI(r.Form.Get("redirect_uri"))
+
+	if redirectURI == "" {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	state := r.Form.Get("state")
+	redirectError := func(code, description string) {
+		auditEventOf(w).Result = auditFailure
+		auditEventOf(w).Reason = code
+		redirectWithParams(w, r, redirectURI, url.Values{"error": {code}, "error_description": {description}, "state": {state}})
+	}
+
+	if r.Form.Get("response_type") != "code" {
+		redirectError("unsupported_response_type", "response_type must be code")
+		return
+	}
+
+	if r.Form.Get("code_challenge") == "" || r.Form.Get("code_challenge_method") != "S256" {
+		redirectError("invalid_request", "PKCE with code_challenge_method S256 is required")
+		return
+	}
+
+	if err := checkUserScope(r.Form.Get("scope")); err != nil {
+		redirectError("invalid_scope", err.Error())
+		return
+	}
+
+	params := url.Values{}
+	for _, key := range []string{"response_type", "client_id", "redirect_uri", "scope", "state", "nonce", "code_challenge", "code_challenge_method"} {
+		if value := r.Form.Get(key); value != "" {
+			params.Set(key, value)
+		}
+	}
+
+	renderForm := func(status int, message string) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(status)
+		loginForm.Execute(w, map[string]interface{}{"Params": params, "ClientID": client.ID, "Error": message})
+	}
+
+	if r.Method == http.MethodGet {
+		renderForm(http.StatusOK, "")
+		return
+	}
+
+	auditEventOf(w).UserID = r.PostForm.Get("ID")
+	ud, err := readComplete(ctx, r.PostForm.Get("ID"))
+
+	if err != nil || !ud.compare(ctx, r.PostForm.Get("Password")) {
+		observeLogin("invalid_credentials")
+		auditEventOf(w).Reason = "invalid_credentials"
+		renderForm(http.StatusUnauthorized, "Invalid ID or password")
+		return
+	}
+
+	if ud.TOTPConfirmed {
+		if err := ud.verifySecondFactor(ctx, r.PostForm.Get("Code")); err != nil {
+			message := "Invalid authentication code"
+
+			if err == errSecondFactorLocked {
+				message = err.Error()
+			}
+
+			observeLogin("invalid_second_factor")
+			auditEventOf(w).Reason = "invalid_second_factor"
+			renderForm(http.StatusUnauthorized, message)
+			return
+		}
+	}
+
+	code, err := randomToken()
+
+	if err != nil {
+		redirectError("server_error", "")
+		return
+	}
+
+	grant := &OAuthGrant{
+		ID:            ud.ID,
+		ClientID:      client.ID,
+		Scope:         intersectScope(r.Form.Get("scope"), append(oidcScopes, client.Scopes...)),
+		RedirectURI:   r.Form.Get("redirect_uri"),
+		CodeHash:      hashToken(code),
+		CodeChallenge: r.Form.Get("code_challenge"),
+		CodeExp:       now().Add(authorizationCodeLifetime),
+		Nonce:         r.Form.Get("nonce"),
+		AuthTime:      now(),
+	}
+
+	if err := writeGrantToDB(ctx, grant); err != nil {
+		redirectError("server_error", "")
+		return
+	}
+
+	observeLogin("")
+	redirectWithParams(w, r, redirectURI, url.Values{"code": {code}, "state": {state}})
+}
+
+// authenticateClient reads the client from HTTP Basic authentication or the form
+// and checks its secret.
+func authenticateClient(r *http.Request) (*OAuthClient, error) {
+	ctx := r.Context()
+
+	id, secret, ok := r.BasicAuth()
+
+	if ok {
+		// RFC 6749 2.3.1: credentials are form-urlencoded before being put into the header
+		id, _ = url.QueryUnescape(id)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		id, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+
+	client, err := readClient(ctx, id)
+
+	if err != nil || !client.authenticate(ctx, secret) {
+		return nil, errors.New("Client authentication failed")
+	}
+
+	return client, nil
+}
+
+// verifyCodeChallenge checks the PKCE verifier against the stored S256 challenge.
+func verifyCodeChallenge(challenge, verifier string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
+
+// handleToken implements the authorization_code, refresh_token and client_credentials grants.
+func handleToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeOAuthError(w, http.StatusMethodNotAllowed, "invalid_request", "POST is required")
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "")
+		return
+	}
+
+	client, err := authenticateClient(r)
+
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", `Basic realm="tooxoot"`)
+		writeOAuthError(w, http.StatusUnauthorized, "invalid_client", err.Error())
+		return
+	}
+
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		exchangeAuthorizationCode(w, r, client)
+	case "refresh_token":
+		exchangeRefreshToken(w, r, client)
+	case "client_credentials":
+		exchangeClientCredentials(w, r, client)
+	default:
+		writeOAuthError(w, http.StatusBadRequest, "unsupported_grant_type", "")
+	}
+}
+
+func exchangeAuthorizationCode(w http.ResponseWriter, r *http.Request, client *OAuthClient) {
+	ctx := r.Context()
+
+	grant, err := readGrantByHash(ctx, "CodeHash", r.PostForm.Get("code"))
+
+	if err != nil || grant.ClientID != client.ID || grant.CodeExp.Before(now()) {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "Invalid authorization code")
+		return
+	}
+
+	// RFC 6749 4.1.3: required and identical if it was part of the authorization request
+	if r.PostForm.Get("redirect_uri") != grant.RedirectURI {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "redirect_uri does not match")
+		return
+	}
+
+	if !verifyCodeChallenge(grant.CodeChallenge, r.PostForm.Get("code_verifier")) {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "Invalid code_verifier")
+		return
+	}
+
+	// codes are single use, also for concurrent requests
+	if !consumeGrantToken(ctx, w, r.PostForm.Get("code"), grant.CodeExp, "Invalid authorization code") {
+		return
+	}
+
+	grant.CodeHash = ""
+	grant.CodeChallenge = ""
+
+	issueGrantTokens(ctx, w, grant)
+}
+
+func exchangeRefreshToken(w http.ResponseWriter, r *http.Request, client *OAuthClient) {
+	ctx := r.Context()
+
+	grant, err := readGrantByHash(ctx, "RefreshHash", r.PostForm.Get("refresh_token"))
+
+	if err != nil || grant.ClientID != client.ID {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "Invalid refresh token")
+		return
+	}
+
+	// refresh tokens are rotated, so each one is used once
+	if !consumeGrantToken(ctx, w, r.PostForm.Get("refresh_token"), time.Time{}, "Invalid refresh token") {
+		return
+	}
+
+	tokenRenewals.Inc()
+	issueGrantTokens(ctx, w, grant)
+}
+
+// consumeGrantToken marks the code or refresh token as used. Tokens used before are rejected with the description.
+func consumeGrantToken(ctx context.Context, w http.ResponseWriter, token string, exp time.Time, description string) bool {
+	err := consumeToken(ctx, token, exp)
+
+	switch {
+	case err == errAlreadyExists:
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", description)
+		return false
+	case err != nil:
+		writeOAuthError(w, http.StatusServiceUnavailable, "temporarily_unavailable", "")
+		return false
+	}
+
+	return true
+}
+
+// issueGrantTokens rotates the grant's refresh token and responds with a new token pair.
+// Grants with openid scope additionally get an ID token. Users which are disabled or deleted get no tokens.
+func issueGrantTokens(ctx context.Context, w http.ResponseWriter, grant *OAuthGrant) {
+	if _, err := readComplete(ctx, grant.ID); err == errUserDisabled || errors.Is(err, errNotFound) {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "User is disabled or deleted")
+		return
+	} else if err != nil {
+		writeOAuthError(w, http.StatusServiceUnavailable, "temporarily_unavailable", "")
+		return
+	}
+
+	accessToken, err := newAccessToken(ctx, grant.ID, grant.ClientID, grant.Scope)
+
+	if err != nil {
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	idToken := ""
+
+	if hasScope(grant.Scope, "openid") {
+		idToken, err = newIDToken(ctx, grant, accessToken)
+
+		if err != nil {
+			writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+			return
+		}
+	}
+
+	// the nonce only belongs into the ID token of the code exchange
+	grant.Nonce = ""
+
+	refreshToken, err := randomToken()
+
+	if err != nil {
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	grant.RefreshHash = hashToken(refreshToken)
+	auditEventOf(w).UserID = grant.ID
+	auditEventOf(w).JTI = tokenJTI(accessToken)
+
+	if err := writeGrantToDB(ctx, grant); err != nil {
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, tokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(accessTokenLifetime.Seconds()),
+		RefreshToken: refreshToken,
+		Scope:        grant.Scope,
+		IDToken:      idToken,
+	})
+}
+
+func exchangeClientCredentials(w http.ResponseWriter, r *http.Request, client *OAuthClient) {
+	ctx := r.Context()
+
+	if !client.isConfidential() {
+		writeOAuthError(w, http.StatusBadRequest, "unauthorized_client", "Public clients can not use client_credentials")
+		return
+	}
+
+	scope, err := client.grantScope(r.PostForm.Get("scope"))
+
+	if err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_scope", err.Error())
+		return
+	}
+
+	accessToken, claims, err := newClientToken(ctx, client, scope)
+
+	if err != nil {
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	auditEventOf(w).UserID = client.ID
+	auditEventOf(w).JTI = claims.Jti
+
+	writeJSON(w, http.StatusOK, tokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(client.tokenLifetime().Seconds()),
+		Scope:       scope,
+	})
+}
+
+// handleRevoke implements RFC 7009 for refresh tokens.
+// Access tokens are short-lived and can not be revoked, the request succeeds nonetheless.
+func handleRevoke(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if r.Method != http.MethodPost {
+		writeOAuthError(w, http.StatusMethodNotAllowed, "invalid_request", "POST is required")
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "")
+		return
+	}
+
+	client, err := authenticateClient(r)
+
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", `Basic realm="tooxoot"`)
+		writeOAuthError(w, http.StatusUnauthorized, "invalid_client", err.Error())
+		return
+	}
+
+	grant, err := readGrantByHash(ctx, "RefreshHash", r.PostForm.Get("token"))
+
+	if err == nil && grant.ClientID == client.ID {
+		auditEventOf(w).UserID = grant.ID
+		grant.RefreshHash = ""
+
+		if err := writeGrantToDB(ctx, grant); err != nil {
+			writeOAuthError(w, http.StatusServiceUnavailable, "temporarily_unavailable", "")
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/datastore"
+)
+
+// Marks the subject of tokens issued to clients instead of users.
+const subjectClient = "client"
+
+const defaultClientTokenLifetime = accessTokenLifetime
+
+// Rotated secrets stay valid for at most maxSecretOverlap, so a leaked secret can not be kept alive.
+var maxSecretOverlap = 7 * 24 * time.Hour
+
+// ClientSecret is a hashed client secret. Secrets without Exp never expire.
+type ClientSecret struct {
+	Hash string
+	Exp  time.Time
+}
+
+// OAuthClient is an application registered to use the OAuth endpoints.
+// Public clients have no Secrets and have to rely on PKCE alone.
+// Machine clients have no RedirectURIs and only use the client_credentials grant
+// restricted to their Scopes.
+type OAuthClient struct {
+	ID            string
+	Secrets       []ClientSecret `datastore:",noindex"`
+	RedirectURIs  []string       `datastore:",noindex"`
+	Scopes        []string       `datastore:",noindex"`
+	TokenLifetime time.Duration  `datastore:",noindex"`
+	key           *datastore.Key `datastore:"__key__"`
+}
+
+// NewOAuthClient creates a new OAuthClient. An empty secret creates a public client.
+// Returns nil for empty id or on hashing errors.
+func NewOAuthClient(ctx context.Context, id, secret string, redirectURIs []string) *OAuthClient {
+	if id == "" {
+		return nil
+	}
+
+	client := &OAuthClient{ID: id, RedirectURIs: redirectURIs}
+
+	if secret == "" {
+		return client
+	}
+
+	if err := client.addSecret(ctx, secret); err != nil {
+		return nil
+	}
+
+	return client
+}
+
+// NewMachineClient creates a confidential client for service-to-service authentication.
+// A lifetime of 0 uses the default access token lifetime.
+// Returns nil for empty id or secret or on hashing errors.
+func NewMachineClient(ctx context.Context, id, secret string, scopes []string, lifetime time.Duration) *OAuthClient {
+	if secret == "" {
+		return nil
+	}
+
+	client := NewOAuthClient(ctx, id, secret, nil)
+
+	if client == nil {
+		return nil
+	}
+
+	client.Scopes = scopes
+	client.TokenLifetime = lifetime
+
+	return client
+}
+
+func (c *OAuthClient) addSecret(ctx context.Context, secret string) error {
+	hash, err := hashPassword(ctx, []byte(secret))
+
+	if err != nil {
+		return err
+	}
+
+	c.Secrets = append(c.Secrets, ClientSecret{Hash: string(hash)})
+
+	return nil
+}
+
+// rotateSecret adds a new secret and lets the existing ones expire after overlap.
+// Already expired secrets are removed.
+func (c *OAuthClient) rotateSecret(ctx context.Context, secret string, overlap time.Duration) error {
+	if secret == "" {
+		return errors.New("Empty secret")
+	}
+
+	if overlap < 0 || overlap > maxSecretOverlap {
+		return fmt.Errorf("Overlap must be between 0s and %v but is %v", maxSecretOverlap, overlap)
+	}
+
+	currentTime := now()
+	exp := currentTime.Add(overlap)
+	secrets := []ClientSecret{}
+
+	for _, s := range c.Secrets {
+		if !s.Exp.IsZero() && !s.Exp.After(currentTime) {
+			continue
+		}
+
+		if s.Exp.IsZero() || s.Exp.After(exp) {
+			s.Exp = exp
+		}
+
+		secrets = append(secrets, s)
+	}
+
+	c.Secrets = secrets
+
+	return c.addSecret(ctx, secret)
+}
+
+func (c *OAuthClient) isConfidential() bool {
+	return c != nil && len(c.Secrets) > 0
+}
+
+// authenticate checks the secret of confidential clients. Public clients must not send a secret.
+func (c *OAuthClient) authenticate(ctx context.Context, secret string) bool {
+	if c == nil {
+		return false
+	}
+
+	if !c.isConfidential() {
+		return secret == ""
+	}
+
+	currentTime := now()
+
+	for _, s := range c.Secrets {
+		if !s.Exp.IsZero() && !s.Exp.After(currentTime) {
+			continue
+		}
+
+		if nil == comparePassword(ctx, []byte(s.Hash), []byte(secret)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// grantScope checks that every requested scope is allowed for the client.
+// Without a requested scope all allowed scopes are granted.
+func (c *OAuthClient) grantScope(requested string) (string, error) {
+	if requested == "" {
+		return strings.Join(c.Scopes, " "), nil
+	}
+
+	for _, s := range strings.Fields(requested) {
+		if !hasScope(strings.Join(c.Scopes, " "), s) {
+			return "", fmt.Errorf("Scope '%v' is not allowed", s)
+		}
+	}
+
+	return requested, nil
+}
+
+func (c *OAuthClient) tokenLifetime() time.Duration {
+	if c.TokenLifetime <= 0 {
+		return defaultClientTokenLifetime
+	}
+
+	return c.TokenLifetime
+}
+
+// redirectURI returns the registered redirect URI which exactly matches the requested one.
+// Without a requested URI the only registered one is used. Returns "" if no URI matches.
+func (c *OAuthClient) redirectURI(requested string) string {
+	if c == nil {
+		return ""
+	}
+
+	if requested == "" && len(c.RedirectURIs) == 1 {
+		return c.RedirectURIs[0]
+	}
+
+	for _, registered := range c.RedirectURIs {
+		if registered == requested && requested != "" {
+			return registered
+		}
+	}
+
+	return ""
+}
+
+func (c *OAuthClient) setKey(key *datastore.Key) {
+	c.key = key
+}
+
+func writeClientToDB(ctx context.Context, c *OAuthClient) error {
+	if c == nil {
+		return nil
+	}
+
+	k, err := putEntity(ctx, "CLIENT", c.key, c)
+
+	if err != nil {
+		return err
+	}
+
+	c.key = k
+
+	return nil
+}
+
+func readClient(ctx context.Context, id string) (*OAuthClient, error) {
+	if id == "" {
+		return nil, errors.New("empty id")
+	}
+
+	query := newQuery("CLIENT").Filter("ID =", id)
+	dst := []*OAuthClient{}
+
+	if err := getEntities(ctx, query, &dst); err != nil {
+		return nil, err
+	}
+
+	if err := singleResult(len(dst), query); err != nil {
+		return nil, err
+	}
+
+	return dst[0], nil
+}
+
+// clientLogin authenticates a confidential client and signs a token for the granted scope.
+func clientLogin(ctx context.Context, id, secret, scope string) (string, *Claims, error) {
+	client, err := readClient(ctx, id)
+
+	if err != nil || !client.isConfidential() || !client.authenticate(ctx, secret) {
+		return "", nil, errors.New("Invalid client credentials")
+	}
+
+	return newClientToken(ctx, client, scope)
+}
+
+// newClientToken signs a token whose subject is the client itself.
+func newClientToken(ctx context.Context, client *OAuthClient, scope string) (string, *Claims, error) {
+	granted, err := client.grantScope(scope)
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	claims := NewClaims(client.ID)
+	claims.Exp = claims.Iat.Add(client.tokenLifetime())
+	claims.Aud = accessTokenAudience
+	claims.ClientID = client.ID
+	claims.Scope = granted
+	claims.SubType = subjectClient
+
+	signed, err := signClaims(ctx, claims)
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	return signed, claims, nil
+}
+
+// rotateClientSecret authenticates the client with a current secret and replaces it by a new random one.
+// The previous secrets stay valid for overlap, at most maxSecretOverlap, so deployments can switch over.
+func rotateClientSecret(ctx context.Context, id, secret string, overlap time.Duration) (string, error) {
+	client, err := readClient(ctx, id)
+
+	if err != nil || !client.isConfidential() || !client.authenticate(ctx, secret) {
+		return "", errors.New("Invalid client credentials")
+	}
+
+	newSecret, err := randomToken()
+
+	if err != nil {
+		return "", err
+	}
+
+	if err := client.rotateSecret(ctx, newSecret, overlap); err != nil {
+		return "", err
+	}
+
+	if err := writeClientToDB(ctx, client); err != nil {
+		return "", err
+	}
+
+	return newSecret, nil
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestNewOAuthClient(T *testing.T) {
+	generateFromPassword = bcrypt.GenerateFromPassword
+	compareHashAndPassword = bcrypt.CompareHashAndPassword
+
+	confidential := NewOAuthClient(testctx, "SomeClient", "SomeSecret", []string{"https://client.example/cb"})
+	public := NewOAuthClient(testctx, "SomePublicClient", "", nil)
+
+	expectations := map[string]bool{
+		"Hash secret":                     len(confidential.Secrets) == 1 && confidential.Secrets[0].Hash != "SomeSecret",
+		"Confidential with secret":        confidential.isConfidential(),
+		"Public without secret":           !public.isConfidential(),
+		"Authenticate correct secret":     confidential.authenticate(testctx, "SomeSecret"),
+		"Reject wrong secret":             !confidential.authenticate(testctx, "SomeOtherSecret"),
+		"Reject missing secret":           !confidential.authenticate(testctx, ""),
+		"Authenticate public client":      public.authenticate(testctx, ""),
+		"Reject secret for public client": !public.authenticate(testctx, "SomeSecret"),
+		"Reject nil client":               !(*OAuthClient)(nil).authenticate(testctx, ""),
+		"Return nil for empty id":         NewOAuthClient(testctx, "", "SomeSecret", nil) == nil,
+	}
+
+	CheckExpectations(expectations, T)
+}
+
+func TestNewMachineClient(T *testing.T) {
+	generateFromPassword = bcrypt.GenerateFromPassword
+	compareHashAndPassword = bcrypt.CompareHashAndPassword
+
+	client := NewMachineClient(testctx, "SomeService", "SomeSecret", []string{"SomeScope"}, 0)
+
+	expectations := map[string]bool{
+		"Create confidential client": client.isConfidential() && client.authenticate(testctx, "SomeSecret"),
+		"Set scopes":                 len(client.Scopes) == 1 && client.Scopes[0] == "SomeScope",
+		"Default lifetime":           client.tokenLifetime() == defaultClientTokenLifetime,
+		"Register no redirect URI":   client.redirectURI("") == "",
+		"Return nil without secret":  NewMachineClient(testctx, "SomeService", "", nil, 0) == nil,
+		"Return nil for empty id":    NewMachineClient(testctx, "", "SomeSecret", nil, 0) == nil,
+	}
+
+	CheckExpectations(expectations, T)
+}
+
+func TestGrantScope(T *testing.T) {
+	client := &OAuthClient{Scopes: []string{"SomeScope", "OtherScope"}}
+
+	cases := map[string]string{
+		"":                     "SomeScope OtherScope",
+		"OtherScope":           "OtherScope",
+		"SomeScope OtherScope": "SomeScope OtherScope",
+	}
+
+	for requested, expected := range cases {
+		if granted, err := client.grantScope(requested); granted != expected || err != nil {
+			T.Errorf("grantScope failed for '%v'! Expected '%v' got '%v', '%v'", requested, expected, granted, err)
+		}
+	}
+
+	if _, err := client.grantScope("SomeScope AdminScope"); err == nil || err.Error() != "Scope 'AdminScope' is not allowed" {
+		T.Errorf("grantScope failed! Expected 'Scope 'AdminScope' is not allowed' got '%v'", err)
+	}
+}
+
+func TestRotateSecret(T *testing.T) {
+	generateFromPassword = bcrypt.GenerateFromPassword
+	compareHashAndPassword = bcrypt.CompareHashAndPassword
+
+	client := NewMachineClient(testctx, "SomeService", "OldSecret", nil, 0)
+	client.Secrets = append(client.Secrets, ClientSecret{Hash: "ExpiredHash", Exp: testtime.Add(-time.Second)})
+	err := client.rotateSecret(testctx, "NewSecret", time.Hour)
+
+	expectations := map[string]bool{
+		"Rotate without error":   err == nil,
+		"Remove expired secrets": len(client.Secrets) == 2,
+		"Expire old secret":      client.Secrets[0].Exp == testtime.Add(time.Hour),
+		"Keep new secret":        client.Secrets[1].Exp.IsZero(),
+		"Accept old secret":      client.authenticate(testctx, "OldSecret"),
+		"Accept new secret":      client.authenticate(testctx, "NewSecret"),
+	}
+
+	now = func() time.Time { return testtime.Add(time.Hour) }
+	expectations["Reject old secret after overlap"] = !client.authenticate(testctx, "OldSecret")
+	expectations["Accept new secret after overlap"] = client.authenticate(testctx, "NewSecret")
+	now = func() time.Time { return testtime }
+
+	expectations["Reject empty secret"] = client.rotateSecret(testctx, "", time.Hour) != nil
+	expectations["Reject negative overlap"] = client.rotateSecret(testctx, "OtherSecret", -time.Hour) != nil
+	expectations["Reject overlap above maximum"] = client.rotateSecret(testctx, "OtherSecret", maxSecretOverlap+time.Second) != nil
+
+	CheckExpectations(expectations, T)
+}
+
+func TestClientLogin(T *testing.T) {
+	injectOAuthStore()
+
+	signed, claims, err := clientLogin(testctx, "SomeService", "SomeServiceSecret", "OtherScope")
+	_, parsed, parseErr := parse(signed)
+
+	expectations := map[string]bool{
+		"Login without error":  err == nil && parseErr == nil,
+		"Sign client token":    parsed != nil && parsed.ID == "SomeService" && parsed.IsClient() && parsed.Scope == "OtherScope",
+		"Return signed claims": claims != nil && parsed != nil && *claims == *parsed,
+	}
+
+	failures := map[string][3]string{
+		"Wrong secret":      {"SomeService", "SomeOtherSecret", ""},
+		"Public client":     {"SomePublicClient", "", ""},
+		"Unknown client":    {"SomeUnknownService", "SomeServiceSecret", ""},
+		"Scope not allowed": {"SomeService", "SomeServiceSecret", "AdminScope"},
+	}
+
+	for name, f := range failures {
+		signed, _, err := clientLogin(testctx, f[0], f[1], f[2])
+		expectations["Reject "+name] = signed == "" && err != nil
+	}
+
+	CheckExpectations(expectations, T)
+}
+
+func TestRotateClientSecret(T *testing.T) {
+	store := injectOAuthStore()
+	client, _ := store.entities[3].(*OAuthClient)
+
+	secret, err := rotateClientSecret(testctx, "SomeService", "SomeServiceSecret", time.Hour)
+	_, _, oldErr := clientLogin(testctx, "SomeService", "SomeServiceSecret", "")
+	_, _, newErr := clientLogin(testctx, "SomeService", secret, "")
+
+	expectations := map[string]bool{
+		"Rotate without error": err == nil && secret != "",
+		"Store rotated client": client != nil && len(client.Secrets) == 2 && client.Secrets[0].Exp == testtime.Add(time.Hour),
+		"Replace the client":   store.count("CLIENT") == 3,
+		"Accept old secret":    oldErr == nil,
+		"Accept new secret":    newErr == nil,
+	}
+
+	secret, err = rotateClientSecret(testctx, "SomeService", "SomeOtherSecret", time.Hour)
+	expectations["Reject wrong secret"] = secret == "" && err != nil && len(client.Secrets) == 2
+
+	secret, err = rotateClientSecret(testctx, "SomeService", "SomeServiceSecret", 30*24*time.Hour)
+	expectations["Reject long overlap"] = secret == "" && err != nil && len(client.Secrets) == 2
+
+	now = func() time.Time { return testtime.Add(time.Hour) }
+	_, _, expiredErr := clientLogin(testctx, "SomeService", "SomeServiceSecret", "")
+	now = func() time.Time { return testtime }
+	expectations["Expire old secret"] = expiredErr != nil
+
+	CheckExpectations(expectations, T)
+}
+
+func TestRedirectURI(T *testing.T) {
+	single := &OAuthClient{RedirectURIs: []string{"https://client.example/cb"}}
+	multiple := &OAuthClient{RedirectURIs: []string{"https://client.example/cb", "https://client.example/other"}}
+
+	expectations := map[string]bool{
+		"Match exact URI":                multiple.redirectURI("https://client.example/other") == "https://client.example/other",
+		"Reject prefix match":            single.redirectURI("https://client.example/cb/evil") == "",
+		"Reject other host":              single.redirectURI("https://evil.example/cb") == "",
+		"Default to single registered":   single.redirectURI("") == "https://client.example/cb",
+		"No default for multiple":        multiple.redirectURI("") == "",
+		"Reject for client without URIs": (&OAuthClient{}).redirectURI("") == "",
+	}
+
+	CheckExpectations(expectations, T)
+}
+
+func TestReadClient(T *testing.T) {
+	client := &OAuthClient{ID: "SomeClient"}
+	injectMemoryStore(client, &OAuthClient{ID: "SomeOtherClient"})
+
+	result, err := readClient(testctx, "SomeClient")
+
+	if result != client || err != nil {
+		T.Errorf("readClient failed! Expected '%+v' got '%+v', '%v'", client, result, err)
+	}
+
+	result, err = readClient(testctx, "")
+
+	if result != nil || err == nil || err.Error() != "empty id" {
+		T.Errorf("readClient failed! Expected 'empty id' got '%+v', '%v'", result, err)
+	}
+}
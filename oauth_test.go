@@ -0,0 +1,376 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const testVerifier = "SomeCodeVerifierWhichIsLongEnoughForPKCE0123"
+
+func testChallenge() string {
+	sum := sha256.Sum256([]byte(testVerifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// injectOAuthStore stores a user "SomeID", a confidential client "SomeClient", a public client "SomePublicClient"
+// and a machine client "SomeService".
+func injectOAuthStore() *memoryStore {
+	generateFromPassword = bcrypt.GenerateFromPassword
+	compareHashAndPassword = bcrypt.CompareHashAndPassword
+
+	client := NewOAuthClient(testctx, "SomeClient", "SomeSecret", []string{"https://client.example/cb"})
+	client.Scopes = []string{"SomeScope"}
+	publicClient := NewOAuthClient(testctx, "SomePublicClient", "", []string{"https://client.example/cb", "https://client.example/other"})
+	publicClient.Scopes = []string{"SomeScope"}
+
+	return injectMemoryStore(
+		NewUserData(testctx, "SomeID", "SomePW"),
+		client,
+		publicClient,
+		NewMachineClient(testctx, "SomeService", "SomeServiceSecret", []string{"SomeScope", "OtherScope"}, 10*time.Minute),
+	)
+}
+
+func authorizeParams(clientID string) url.Values {
+	return url.Values{
+		"response_type":         {"code"},
+		"client_id":             {clientID},
+		"redirect_uri":          {"https://client.example/cb"},
+		"scope":                 {"SomeScope"},
+		"state":                 {"SomeState"},
+		"code_challenge":        {testChallenge()},
+		"code_challenge_method": {"S256"},
+	}
+}
+
+func postForm(path string, form url.Values, configure ...func(*http.Request)) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	for _, c := range configure {
+		c(request)
+	}
+
+	recorder := httptest.NewRecorder()
+	oauthHandler().ServeHTTP(recorder, request)
+
+	return recorder
+}
+
+// authorize logs in through /authorize and returns the redirect location.
+func authorize(params url.Values, id, password string) *httptest.ResponseRecorder {
+	form := url.Values{"ID": {id}, "Password": {password}}
+
+	for key := range params {
+		form.Set(key, params.Get(key))
+	}
+
+	return postForm("/authorize", form)
+}
+
+func authorizationCode(T *testing.T, clientID string) string {
+	recorder := authorize(authorizeParams(clientID), "SomeID", "SomePW")
+	location, _ := url.Parse(recorder.Header().Get("Location"))
+
+	if recorder.Code != http.StatusFound || location.Query().Get("code") == "" {
+		T.Fatalf("authorize failed! Got status %v and location '%v'", recorder.Code, location)
+	}
+
+	return location.Query().Get("code")
+}
+
+func decodeTokenResponse(recorder *httptest.ResponseRecorder) (tokenResponse, oauthError) {
+	response, failure := tokenResponse{}, oauthError{}
+	json.Unmarshal(recorder.Body.Bytes(), &response)
+	json.Unmarshal(recorder.Body.Bytes(), &failure)
+
+	return response, failure
+}
+
+func TestAuthorize(T *testing.T) {
+	T.Run("Login form", func(t *testing.T) {
+		injectOAuthStore()
+		request := httptest.NewRequest(http.MethodGet, "/authorize?"+authorizeParams("SomeClient").Encode(), nil)
+		recorder := httptest.NewRecorder()
+
+		oauthHandler().ServeHTTP(recorder, request)
+
+		if recorder.Code != http.StatusOK || !strings.Contains(recorder.Body.String(), `name="code_challenge" value="`+testChallenge()+`"`) {
+			t.Errorf("authorize failed! Expected login form got %v: %v", recorder.Code, recorder.Body.String())
+		}
+	})
+
+	T.Run("Valid login", func(t *testing.T) {
+		expectations := map[string]bool{}
+		store := injectOAuthStore()
+		params := authorizeParams("SomeClient")
+		params.Set("scope", "SomeScope UnregisteredScope openid")
+
+		recorder := authorize(params, "SomeID", "SomePW")
+		location, _ := url.Parse(recorder.Header().Get("Location"))
+		grant, _ := store.entities[len(store.entities)-1].(*OAuthGrant)
+
+		expectations["Redirect"] = recorder.Code == http.StatusFound
+		expectations["Redirect to registered URI"] = strings.HasPrefix(location.String(), "https://client.example/cb?")
+		expectations["Return state"] = location.Query().Get("state") == "SomeState"
+		expectations["Return code"] = location.Query().Get("code") != ""
+		expectations["Store grant"] = grant != nil && grant.ID == "SomeID" && grant.ClientID == "SomeClient" && grant.Scope == "SomeScope openid"
+		expectations["Store only code hash"] = grant != nil && grant.CodeHash == hashToken(location.Query().Get("code"))
+
+		CheckExpectations(expectations, t)
+	})
+
+	T.Run("Invalid requests", func(t *testing.T) {
+		injectOAuthStore()
+
+		unknownClient := authorizeParams("SomeUnknownClient")
+		foreignRedirect := authorizeParams("SomeClient")
+		foreignRedirect.Set("redirect_uri", "https://evil.example/cb")
+		missingPKCE := authorizeParams("SomeClient")
+		missingPKCE.Del("code_challenge")
+		plainPKCE := authorizeParams("SomeClient")
+		plainPKCE.Set("code_challenge_method", "plain")
+		implicit := authorizeParams("SomeClient")
+		implicit.Set("response_type", "token")
+		ambiguousRedirect := authorizeParams("SomePublicClient")
+		ambiguousRedirect.Del("redirect_uri")
+		reservedScope := authorizeParams("SomeClient")
+		reservedScope.Set("scope", "SomeScope users:import")
+
+		errorCases := map[string]url.Values{
+			"400:unknown client":                  unknownClient,
+			"400:invalid redirect_uri":            foreignRedirect,
+			"400:ambiguous redirect_uri":          ambiguousRedirect,
+			"302:invalid_request":                 missingPKCE,
+			"302:invalid_request with plain PKCE": plainPKCE,
+			"302:unsupported_response_type":       implicit,
+			"302:invalid_scope":                   reservedScope,
+		}
+
+		for name, params := range errorCases {
+			recorder := authorize(params, "SomeID", "SomePW")
+			location, _ := url.Parse(recorder.Header().Get("Location"))
+
+			switch {
+			case strings.HasPrefix(name, "400") && (recorder.Code != http.StatusBadRequest || location.String() != ""):
+				t.Errorf("authorize failed for %v! Expected 400 without redirect got %v '%v'", name, recorder.Code, location)
+			case strings.HasPrefix(name, "302") && (recorder.Code != http.StatusFound || location.Query().Get("error") == "" || !strings.HasPrefix(name[4:], location.Query().Get("error")) || location.Query().Get("code") != ""):
+				t.Errorf("authorize failed for %v! Expected error redirect got %v '%v'", name, recorder.Code, location)
+			}
+		}
+	})
+
+	T.Run("Invalid credentials", func(t *testing.T) {
+		store := injectOAuthStore()
+
+		recorder := authorize(authorizeParams("SomeClient"), "SomeID", "SomeOtherPW")
+
+		if recorder.Code != http.StatusUnauthorized || recorder.Header().Get("Location") != "" || len(store.entities) != 4 {
+			t.Errorf("authorize failed! Expected 401 without grant got %v", recorder.Code)
+		}
+	})
+}
+
+func TestTokenAuthorizationCode(T *testing.T) {
+	T.Run("Public client", func(t *testing.T) {
+		expectations := map[string]bool{}
+		injectOAuthStore()
+		code := authorizationCode(t, "SomePublicClient")
+		form := url.Values{
+			"grant_type":    {"authorization_code"},
+			"client_id":     {"SomePublicClient"},
+			"code":          {code},
+			"redirect_uri":  {"https://client.example/cb"},
+			"code_verifier": {testVerifier},
+		}
+
+		recorder := postForm("/token", form)
+		response, _ := decodeTokenResponse(recorder)
+		_, claims, err := parse(response.AccessToken)
+
+		expectations["Return 200"] = recorder.Code == http.StatusOK
+		expectations["Disable caching"] = recorder.Header().Get("Cache-Control") == "no-store"
+		expectations["Return bearer token"] = response.TokenType == "Bearer" && response.ExpiresIn == 3600
+		expectations["Sign access token"] = err == nil && claims.ID == "SomeID" && claims.ClientID == "SomePublicClient" && claims.Scope == "SomeScope"
+		expectations["Return refresh token"] = response.RefreshToken != ""
+
+		recorder = postForm("/token", form)
+		_, failure := decodeTokenResponse(recorder)
+		expectations["Reject reused code"] = recorder.Code == http.StatusBadRequest && failure.Error == "invalid_grant"
+
+		CheckExpectations(expectations, t)
+	})
+
+	T.Run("Confidential client", func(t *testing.T) {
+		injectOAuthStore()
+		code := authorizationCode(t, "SomeClient")
+		form := url.Values{"grant_type": {"authorization_code"}, "code": {code}, "redirect_uri": {"https://client.example/cb"}, "code_verifier": {testVerifier}}
+
+		recorder := postForm("/token", form, func(r *http.Request) { r.SetBasicAuth("SomeClient", "SomeSecret") })
+		response, _ := decodeTokenResponse(recorder)
+
+		if recorder.Code != http.StatusOK || response.AccessToken == "" {
+			t.Errorf("token failed! Expected 200 got %v: %v", recorder.Code, recorder.Body.String())
+		}
+	})
+
+	T.Run("Concurrent redemption", func(t *testing.T) {
+		injectOAuthStore()
+		code := authorizationCode(t, "SomeClient")
+		form := url.Values{"grant_type": {"authorization_code"}, "code": {code}, "redirect_uri": {"https://client.example/cb"}, "code_verifier": {testVerifier}}
+
+		// Another request redeemed the code but did not store the grant yet
+		consumeToken(testctx, code, testtime.Add(authorizationCodeLifetime))
+
+		recorder := postForm("/token", form, func(r *http.Request) { r.SetBasicAuth("SomeClient", "SomeSecret") })
+		_, failure := decodeTokenResponse(recorder)
+
+		if recorder.Code != http.StatusBadRequest || failure.Error != "invalid_grant" {
+			t.Errorf("token failed! Expected invalid_grant got %v: %v", recorder.Code, recorder.Body.String())
+		}
+	})
+
+	T.Run("Invalid requests", func(t *testing.T) {
+		injectOAuthStore()
+		code := authorizationCode(t, "SomeClient")
+		valid := url.Values{"grant_type": {"authorization_code"}, "client_id": {"SomeClient"}, "client_secret": {"SomeSecret"}, "code": {code}, "redirect_uri": {"https://client.example/cb"}, "code_verifier": {testVerifier}}
+		with := func(key, value string) url.Values {
+			form := url.Values{}
+			for k := range valid {
+				form.Set(k, valid.Get(k))
+			}
+			form.Set(key, value)
+			return form
+		}
+
+		errorCases := map[string]url.Values{
+			"invalid_client:wrong secret":      with("client_secret", "SomeOtherSecret"),
+			"invalid_client:unknown client":    with("client_id", "SomeUnknownClient"),
+			"invalid_grant:other client":       with("client_id", "SomePublicClient"),
+			"invalid_grant:wrong verifier":     with("code_verifier", strings.Repeat("a", 43)),
+			"invalid_grant:wrong redirect_uri": with("redirect_uri", "https://client.example/other"),
+			"invalid_grant:no redirect_uri":    with("redirect_uri", ""),
+			"invalid_grant:unknown code":       with("code", "SomeUnknownCode"),
+			"unsupported_grant_type:password":  with("grant_type", "password"),
+		}
+
+		for name, form := range errorCases {
+			if name == "invalid_grant:other client" {
+				form.Del("client_secret")
+			}
+
+			_, failure := decodeTokenResponse(postForm("/token", form))
+
+			if !strings.HasPrefix(name, failure.Error+":") {
+				t.Errorf("token failed for %v! Got '%+v'", name, failure)
+			}
+		}
+
+		recorder := postForm("/token", valid)
+
+		if recorder.Code != http.StatusOK {
+			t.Errorf("token failed! Code was consumed by invalid requests: %v", recorder.Body.String())
+		}
+	})
+}
+
+func TestTokenRefreshAndRevoke(T *testing.T) {
+	expectations := map[string]bool{}
+	store := injectOAuthStore()
+	code := authorizationCode(T, "SomePublicClient")
+	first, _ := decodeTokenResponse(postForm("/token", url.Values{
+		"grant_type":    {"authorization_code"},
+		"client_id":     {"SomePublicClient"},
+		"code":          {code},
+		"redirect_uri":  {"https://client.example/cb"},
+		"code_verifier": {testVerifier},
+	}))
+	refresh := func(clientID, token string) (tokenResponse, oauthError) {
+		return decodeTokenResponse(postForm("/token", url.Values{"grant_type": {"refresh_token"}, "client_id": {clientID}, "refresh_token": {token}}))
+	}
+
+	_, failure := refresh("SomeClient", first.RefreshToken)
+	expectations["Reject refresh by other client"] = failure.Error == "invalid_client"
+
+	second, _ := refresh("SomePublicClient", first.RefreshToken)
+	_, claims, err := parse(second.AccessToken)
+	expectations["Return new access token"] = err == nil && claims.ID == "SomeID" && claims.Scope == "SomeScope"
+	expectations["Rotate refresh token"] = second.RefreshToken != "" && second.RefreshToken != first.RefreshToken
+	expectations["Update the stored grant"] = store.count("GRANT") == 1
+
+	_, failure = refresh("SomePublicClient", first.RefreshToken)
+	expectations["Reject rotated refresh token"] = failure.Error == "invalid_grant"
+
+	recorder := postForm("/revoke", url.Values{"client_id": {"SomePublicClient"}, "token": {second.RefreshToken}})
+	expectations["Return 200 on revoke"] = recorder.Code == http.StatusOK
+
+	_, failure = refresh("SomePublicClient", second.RefreshToken)
+	expectations["Reject revoked refresh token"] = failure.Error == "invalid_grant" && store.count("GRANT") <= 1
+
+	recorder = postForm("/revoke", url.Values{"client_id": {"SomePublicClient"}, "token": {"SomeUnknownToken"}})
+	expectations["Return 200 for unknown token"] = recorder.Code == http.StatusOK
+
+	CheckExpectations(expectations, T)
+}
+
+func TestTokenRefreshDisabledUser(T *testing.T) {
+	injectOAuthStore()
+	code := authorizationCode(T, "SomePublicClient")
+	first, _ := decodeTokenResponse(postForm("/token", url.Values{
+		"grant_type":    {"authorization_code"},
+		"client_id":     {"SomePublicClient"},
+		"code":          {code},
+		"redirect_uri":  {"https://client.example/cb"},
+		"code_verifier": {testVerifier},
+	}))
+
+	ud, _ := readUser(testctx, "SomeID")
+	ud.Disabled = true
+	writeToDB(testctx, ud)
+
+	_, failure := decodeTokenResponse(postForm("/token", url.Values{"grant_type": {"refresh_token"}, "client_id": {"SomePublicClient"}, "refresh_token": {first.RefreshToken}}))
+
+	if failure.Error != "invalid_grant" {
+		T.Errorf("token failed! Expected invalid_grant for disabled user got '%+v'", failure)
+	}
+}
+
+func TestTokenClientCredentials(T *testing.T) {
+	injectOAuthStore()
+	form := url.Values{"grant_type": {"client_credentials"}, "scope": {"SomeScope"}}
+
+	recorder := postForm("/token", form, func(r *http.Request) { r.SetBasicAuth("SomeService", "SomeServiceSecret") })
+	response, _ := decodeTokenResponse(recorder)
+	_, claims, err := parse(response.AccessToken)
+
+	expectations := map[string]bool{
+		"Return 200":              recorder.Code == http.StatusOK,
+		"Sign token for client":   err == nil && claims.ID == "SomeService" && claims.ClientID == "SomeService" && claims.Scope == "SomeScope",
+		"Mark subject as client":  err == nil && claims.IsClient(),
+		"Use client lifetime":     err == nil && response.ExpiresIn == 600 && claims.Exp == testtime.Add(10*time.Minute),
+		"Return no refresh token": response.RefreshToken == "",
+	}
+
+	form.Del("scope")
+	response, _ = decodeTokenResponse(postForm("/token", form, func(r *http.Request) { r.SetBasicAuth("SomeService", "SomeServiceSecret") }))
+	expectations["Default to allowed scopes"] = response.Scope == "SomeScope OtherScope"
+
+	form.Set("scope", "SomeScope AdminScope")
+	_, failure := decodeTokenResponse(postForm("/token", form, func(r *http.Request) { r.SetBasicAuth("SomeService", "SomeServiceSecret") }))
+	expectations["Reject scope not allowed"] = failure.Error == "invalid_scope"
+
+	form.Set("client_id", "SomePublicClient")
+	_, failure = decodeTokenResponse(postForm("/token", form))
+	expectations["Reject public client"] = failure.Error == "unauthorized_client"
+
+	CheckExpectations(expectations, T)
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const idTokenLifetime = accessTokenLifetime
+
+// Scopes of OpenID Connect. Every client may request them in addition to its registered Scopes.
+var oidcScopes = []string{"openid", "profile", "email"}
+
+// Public base URL of the service. Used as OpenID issuer and to build the endpoint URLs.
+var issuerURL = "https://localhost"
+
+// IDTokenClaims are the claims of an OpenID Connect ID token.
+// Unlike Claims they use numeric dates as required by the specification.
+type IDTokenClaims struct {
+	Iss      string `json:"iss"`
+	Sub      string `json:"sub"`
+	Aud      string `json:"aud"`
+	Exp      int64  `json:"exp"`
+	Iat      int64  `json:"iat"`
+	AuthTime int64  `json:"auth_time"`
+	Nonce    string `json:"nonce,omitempty"`
+	AtHash   string `json:"at_hash,omitempty"`
+}
+
+type discoveryDocument struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserinfoEndpoint                  string   `json:"userinfo_endpoint"`
+	RevocationEndpoint                string   `json:"revocation_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+}
+
+// Valid returns a jwt.ValidationError if the IDTokenClaims are expired or issued in the future
+func (c IDTokenClaims) Valid() error {
+	currentTime := now().Unix()
+
+	if c.Exp < currentTime-300 {
+		return jwt.NewValidationError("Token is expired", 2)
+	}
+
+	if c.Iat > currentTime+300 {
+		return jwt.NewValidationError("Token is issued in the future", 3)
+	}
+
+	return nil
+}
+
+// Scopes with this prefix are reserved for administration. They are never granted for scopes a user chooses,
+// e.g. for API keys or authorization requests.
+const reservedScopePrefix = "users:"
+
+// checkUserScope returns an error if the scope requested by a user contains a reserved scope.
+func checkUserScope(scope string) error {
+	for _, s := range strings.Fields(scope) {
+		if strings.HasPrefix(s, reservedScopePrefix) {
+			return fmt.Errorf("Scope '%v' is reserved", s)
+		}
+	}
+
+	return nil
+}
+
+// intersectScope returns the scopes of scope which are allowed, in the order of scope.
+func intersectScope(scope string, allowed []string) string {
+	granted := []string{}
+
+	for _, s := range strings.Fields(scope) {
+		if hasScope(strings.Join(allowed, " "), s) && !hasScope(strings.Join(granted, " "), s) {
+			granted = append(granted, s)
+		}
+	}
+
+	return strings.Join(granted, " ")
+}
+
+func hasScope(scope, wanted string) bool {
+	for _, s := range strings.Fields(scope) {
+		if s == wanted {
+			return true
+		}
+	}
+
+	return false
+}
+
+// accessTokenHash computes the at_hash of an RS256 signed ID token.
+func accessTokenHash(accessToken string) string {
+	sum := sha256.Sum256([]byte(accessToken))
+	return base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2])
+}
+
+// newIDToken signs an ID token for the grant's user bound to the access token.
+func newIDToken(ctx context.Context, grant *OAuthGrant, accessToken string) (string, error) {
+	issuedAt := now()
+	tokensIssued.WithLabelValues("id_token").Inc()
+
+	return signJWT(ctx, IDTokenClaims{
+		Iss:      issuerURL,
+		Sub:      grant.ID,
+		Aud:      grant.ClientID,
+		Exp:      issuedAt.Add(idTokenLifetime).Unix(),
+		Iat:      issuedAt.Unix(),
+		AuthTime: grant.AuthTime.Unix(),
+		Nonce:    grant.Nonce,
+		AtHash:   accessTokenHash(accessToken),
+	})
+}
+
+// userinfoClaims returns the standard claims of the user the scope grants access to.
+func userinfoClaims(ud *UserData, scope string) map[string]interface{} {
+	claims := map[string]interface{}{"sub": ud.ID}
+
+	if hasScope(scope, "profile") {
+		claims["preferred_username"] = ud.ID
+		claims["name"] = ud.ID
+	}
+
+	if hasScope(scope, "email") && ud.Email != "" {
+		claims["email"] = ud.Email
+		claims["email_verified"] = ud.EmailVerified
+	}
+
+	return claims
+}
+
+func handleDiscovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, discoveryDocument{
+		Issuer:                            issuerURL,
+		AuthorizationEndpoint:             issuerURL + "/authorize",
+		TokenEndpoint:                     issuerURL + "/token",
+		UserinfoEndpoint:                  issuerURL + "/userinfo",
+		RevocationEndpoint:                issuerURL + "/revoke",
+		JWKSURI:                           issuerURL + "/.well-known/jwks.json",
+		ScopesSupported:                   oidcScopes,
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{"authorization_code", "refresh_token", "client_credentials"},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{"RS256"},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+		ClaimsSupported:                   []string{"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "at_hash", "name", "preferred_username", "email", "email_verified"},
+	})
+}
+
+func handleJWKS(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string][]JWK{"keys": publishedJWKs()})
+}
+
+// handleUserinfo returns the userinfo claims for a bearer access token with openid scope.
+func handleUserinfo(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	authorization := r.Header.Get("Authorization")
+
+	if !strings.HasPrefix(authorization, "Bearer ") {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="tooxoot"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	_, claims, err := parse(strings.TrimPrefix(authorization, "Bearer "))
+
+	// Tokens of clients have no user, even if a user with the client's ID exists
+	if err != nil || claims.IsClient() {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="tooxoot", error="invalid_token"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	auditEventOf(w).UserID = claims.ID
+	auditEventOf(w).JTI = claims.Jti
+
+	if !hasScope(claims.Scope, "openid") {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="tooxoot", error="insufficient_scope", scope="openid"`)
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	ud, err := readComplete(ctx, claims.ID)
+
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="tooxoot", error="invalid_token"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, userinfoClaims(ud, claims.Scope))
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/tooxoot/authservice/verifier"
+)
+
+func get(path, authorization string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodGet, path, nil)
+
+	if authorization != "" {
+		request.Header.Set("Authorization", authorization)
+	}
+
+	recorder := httptest.NewRecorder()
+	oauthHandler().ServeHTTP(recorder, request)
+
+	return recorder
+}
+
+// openIDTokens runs the authorization code flow with the given scope and returns the token response.
+func openIDTokens(T *testing.T, scope string) tokenResponse {
+	injectOAuthStore()
+	params := authorizeParams("SomePublicClient")
+	params.Set("scope", scope)
+	params.Set("nonce", "SomeNonce")
+	recorder := authorize(params, "SomeID", "SomePW")
+	location, _ := url.Parse(recorder.Header().Get("Location"))
+
+	response, failure := decodeTokenResponse(postForm("/token", url.Values{
+		"grant_type":    {"authorization_code"},
+		"client_id":     {"SomePublicClient"},
+		"code":          {location.Query().Get("code")},
+		"redirect_uri":  {"https://client.example/cb"},
+		"code_verifier": {testVerifier},
+	}))
+
+	if response.AccessToken == "" {
+		T.Fatalf("token failed with '%+v'", failure)
+	}
+
+	return response
+}
+
+func TestDiscovery(T *testing.T) {
+	recorder := get("/.well-known/openid-configuration", "")
+	document := discoveryDocument{}
+	err := json.Unmarshal(recorder.Body.Bytes(), &document)
+
+	expectations := map[string]bool{
+		"Return 200":             recorder.Code == http.StatusOK && err == nil,
+		"Return issuer":          document.Issuer == issuerURL,
+		"Return endpoints":       document.AuthorizationEndpoint == issuerURL+"/authorize" && document.UserinfoEndpoint == issuerURL+"/userinfo",
+		"Return jwks_uri":        document.JWKSURI == issuerURL+"/.well-known/jwks.json",
+		"Return standard scopes": len(document.ScopesSupported) == 3,
+		"Return RS256":           len(document.IDTokenSigningAlgValuesSupported) == 1 && document.IDTokenSigningAlgValuesSupported[0] == "RS256",
+		"Return S256 PKCE":       len(document.CodeChallengeMethodsSupported) == 1 && document.CodeChallengeMethodsSupported[0] == "S256",
+	}
+
+	CheckExpectations(expectations, T)
+}
+
+func TestJWKS(T *testing.T) {
+	recorder := get("/.well-known/jwks.json", "")
+	keySet := map[string][]JWK{}
+	json.Unmarshal(recorder.Body.Bytes(), &keySet)
+
+	if recorder.Code != http.StatusOK || len(keySet["keys"]) != 1 || keySet["keys"][0] != publicJWK() {
+		T.Errorf("jwks failed! Got %v: %v", recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestVerifierCompatibility(T *testing.T) {
+	keys, err := verifier.ParseJWKS(get("/.well-known/jwks.json", "").Body.Bytes())
+
+	if err != nil {
+		T.Fatalf("ParseJWKS failed with '%v'", err)
+	}
+
+	v := verifier.New(keys)
+	v.Now = now
+	v.Audience = "SomeAPI"
+
+	accessTokenAudience = "SomeAPI"
+	defer func() { accessTokenAudience = "" }()
+
+	accessToken, _ := newAccessToken(testctx, "SomeID", "SomeClient", "openid SomeScope")
+	challenge, _ := signClaims(testctx, NewMFAChallengeClaims("SomeID"))
+	session, _ := signClaims(testctx, NewClaims("SomeID"))
+	claims, err := v.Verify(accessToken)
+
+	expectations := map[string]bool{
+		"Verify access token": err == nil && claims.ID == "SomeID" && claims.HasScope("SomeScope") && claims.Aud == "SomeAPI",
+	}
+
+	_, err = v.Verify(session)
+	expectations["Reject session token without audience"] = err != nil
+
+	_, err = v.Verify(challenge)
+	expectations["Reject challenge"] = err != nil
+
+	CheckExpectations(expectations, T)
+}
+
+func TestIDToken(T *testing.T) {
+	T.Run("Code exchange", func(t *testing.T) {
+		response := openIDTokens(t, "openid profile")
+		claims := &IDTokenClaims{}
+		_, err := jwt.ParseWithClaims(response.IDToken, claims, func(token *jwt.Token) (interface{}, error) { return &privateKey.PublicKey, nil })
+
+		expectations := map[string]bool{
+			"Return valid ID token": err == nil,
+			"Set issuer URL":        claims.Iss == issuerURL,
+			"Set subject":           claims.Sub == "SomeID",
+			"Set client as aud":     claims.Aud == "SomePublicClient",
+			"Set nonce":             claims.Nonce == "SomeNonce",
+			"Set auth_time":         claims.AuthTime == testtime.Unix(),
+			"Set exp":               claims.Exp == testtime.Add(idTokenLifetime).Unix(),
+			"Set at_hash":           claims.AtHash == accessTokenHash(response.AccessToken) && claims.AtHash != "",
+		}
+
+		CheckExpectations(expectations, t)
+	})
+
+	T.Run("Refresh", func(t *testing.T) {
+		response := openIDTokens(t, "openid")
+		refreshed, _ := decodeTokenResponse(postForm("/token", url.Values{"grant_type": {"refresh_token"}, "client_id": {"SomePublicClient"}, "refresh_token": {response.RefreshToken}}))
+		claims := &IDTokenClaims{}
+		_, err := jwt.ParseWithClaims(refreshed.IDToken, claims, func(token *jwt.Token) (interface{}, error) { return &privateKey.PublicKey, nil })
+
+		if err != nil || claims.Sub != "SomeID" || claims.Nonce != "" {
+			t.Errorf("Refreshed ID token failed! Expected ID token without nonce got '%+v', '%v'", claims, err)
+		}
+	})
+
+	T.Run("Without openid scope", func(t *testing.T) {
+		response := openIDTokens(t, "SomeScope")
+
+		if response.IDToken != "" {
+			t.Errorf("ID token failed! Expected no ID token without openid scope")
+		}
+	})
+}
+
+func TestUserinfo(T *testing.T) {
+	T.Run("Profile scope", func(t *testing.T) {
+		response := openIDTokens(t, "openid profile")
+		recorder := get("/userinfo", "Bearer "+response.AccessToken)
+		claims := map[string]interface{}{}
+		json.Unmarshal(recorder.Body.Bytes(), &claims)
+
+		if recorder.Code != http.StatusOK || claims["sub"] != "SomeID" || claims["preferred_username"] != "SomeID" {
+			t.Errorf("userinfo failed! Got %v: %v", recorder.Code, recorder.Body.String())
+		}
+	})
+
+	T.Run("Openid scope only", func(t *testing.T) {
+		response := openIDTokens(t, "openid")
+		recorder := get("/userinfo", "Bearer "+response.AccessToken)
+		claims := map[string]interface{}{}
+		json.Unmarshal(recorder.Body.Bytes(), &claims)
+
+		if recorder.Code != http.StatusOK || len(claims) != 1 || claims["sub"] != "SomeID" {
+			t.Errorf("userinfo failed! Got %v: %v", recorder.Code, recorder.Body.String())
+		}
+	})
+
+	T.Run("Invalid requests", func(t *testing.T) {
+		withoutOpenID := openIDTokens(t, "profile")
+		clientClaims := NewClaims("SomeID")
+		clientClaims.ClientID = "SomeID"
+		clientClaims.Scope = "openid profile"
+		clientClaims.SubType = subjectClient
+		clientToken, _ := signClaims(testctx, clientClaims)
+
+		errorCases := map[string]int{
+			"":                                    http.StatusUnauthorized,
+			"Bearer SomeInvalidToken":             http.StatusUnauthorized,
+			"Bearer " + withoutOpenID.AccessToken: http.StatusForbidden,
+			"Bearer " + clientToken:               http.StatusUnauthorized,
+		}
+
+		for authorization, expected := range errorCases {
+			recorder := get("/userinfo", authorization)
+
+			if recorder.Code != expected || recorder.Header().Get("WWW-Authenticate") == "" {
+				t.Errorf("userinfo failed for '%v'! Expected %v got %v", authorization, expected, recorder.Code)
+			}
+		}
+	})
+}
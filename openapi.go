@@ -0,0 +1,145 @@
+package main
+
+import (
+	"net/http"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+const authServiceName = "protobuf.AuthService"
+
+// openAPIDocument generates the OpenAPI 3 document of the gateway from the AuthService descriptor in interface.proto.
+func openAPIDocument() (map[string]interface{}, error) {
+	descriptor, err := protoregistry.GlobalFiles.FindDescriptorByName(authServiceName)
+
+	if err != nil {
+		return nil, err
+	}
+
+	service := descriptor.(protoreflect.ServiceDescriptor)
+	paths := map[string]interface{}{}
+	schemas := map[string]interface{}{
+		"Error": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"code":    map[string]interface{}{"type": "integer"},
+				"status":  map[string]interface{}{"type": "string"},
+				"message": map[string]interface{}{"type": "string"},
+			},
+		},
+	}
+
+	for _, m := range gatewayMethods {
+		method := service.Methods().ByName(protoreflect.Name(m.name))
+
+		if method == nil {
+			continue
+		}
+
+		addSchema(schemas, method.Input())
+		addSchema(schemas, method.Output())
+
+		paths[m.path()] = map[string]interface{}{
+			"post": map[string]interface{}{
+				"operationId": m.name,
+				"requestBody": map[string]interface{}{
+					"required": true,
+					"content":  jsonContent(method.Input()),
+				},
+				"responses": map[string]interface{}{
+					"200": map[string]interface{}{
+						"description": "OK",
+						"content":     jsonContent(method.Output()),
+					},
+					"default": map[string]interface{}{
+						"description": "gRPC status mapped to the HTTP status",
+						"content": map[string]interface{}{
+							"application/json": map[string]interface{}{"schema": schemaRef("Error")},
+						},
+					},
+				},
+			},
+		}
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   string(service.FullName()),
+			"version": "v1",
+		},
+		"servers":    []interface{}{map[string]interface{}{"url": issuerURL}},
+		"paths":      paths,
+		"components": map[string]interface{}{"schemas": schemas},
+	}, nil
+}
+
+func schemaRef(name string) map[string]interface{} {
+	return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+}
+
+func jsonContent(message protoreflect.MessageDescriptor) map[string]interface{} {
+	return map[string]interface{}{
+		"application/json": map[string]interface{}{"schema": schemaRef(string(message.Name()))},
+	}
+}
+
+// addSchema adds the schema of the message and the messages it references.
+func addSchema(schemas map[string]interface{}, message protoreflect.MessageDescriptor) {
+	name := string(message.Name())
+
+	if _, ok := schemas[name]; ok {
+		return
+	}
+
+	properties := map[string]interface{}{}
+	schemas[name] = map[string]interface{}{"type": "object", "properties": properties}
+
+	fields := message.Fields()
+
+	for i := 0; i < fields.Len(); i++ {
+		field := fields.Get(i)
+		schema := fieldSchema(schemas, field)
+
+		if field.Cardinality() == protoreflect.Repeated {
+			schema = map[string]interface{}{"type": "array", "items": schema}
+		}
+
+		properties[string(field.Name())] = schema
+	}
+}
+
+// fieldSchema follows the proto3 JSON mapping, e.g. 64 bit integers are strings and bytes are base64.
+func fieldSchema(schemas map[string]interface{}, field protoreflect.FieldDescriptor) map[string]interface{} {
+	switch field.Kind() {
+	case protoreflect.BoolKind:
+		return map[string]interface{}{"type": "boolean"}
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		return map[string]interface{}{"type": "integer", "format": "int32"}
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind,
+		protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return map[string]interface{}{"type": "string", "format": "int64"}
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		return map[string]interface{}{"type": "number"}
+	case protoreflect.BytesKind:
+		return map[string]interface{}{"type": "string", "format": "byte"}
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		addSchema(schemas, field.Message())
+		return schemaRef(string(field.Message().Name()))
+	default:
+		return map[string]interface{}{"type": "string"}
+	}
+}
+
+func handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	document, err := openAPIDocument()
+
+	if err != nil {
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, document)
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// Algorithms of password hashes imported from other systems, stored as UserData.HashAlgorithm.
+// Hashes created by hashPassword have no algorithm. Imported hashes are replaced by one on the first login.
+const hashBcrypt = "bcrypt"
+
+// pbkdf2_sha256$<iterations>$<salt>$<base64 of the derived key>
+const hashPBKDF2SHA256 = "pbkdf2-sha256"
+
+// Highest accepted PBKDF2 iteration count. Every login with an imported hash derives its key once,
+// so counts far above those of current systems would let a single hash occupy a CPU for seconds.
+const maxPBKDF2Iterations = 3000000
+
+// sha1$<salt>$<hex of sha1(salt + password)>
+const hashSaltedSHA1 = "sha1"
+
+// checkForeignHash returns an error if the hash is not in the format of the algorithm.
+func checkForeignHash(algorithm, hash string) error {
+	switch algorithm {
+	case hashBcrypt:
+		_, err := bcrypt.Cost([]byte(hash))
+		return err
+	case hashPBKDF2SHA256:
+		_, _, _, err := splitPBKDF2(hash)
+		return err
+	case hashSaltedSHA1:
+		_, _, err := splitSaltedSHA1(hash)
+		return err
+	}
+
+	return fmt.Errorf("Unknown hash algorithm '%v', expected %v, %v or %v", algorithm, hashBcrypt, hashPBKDF2SHA256, hashSaltedSHA1)
+}
+
+func splitPBKDF2(hash string) (iterations int, salt string, key []byte, err error) {
+	parts := strings.Split(hash, "$")
+
+	if len(parts) != 4 || parts[0] != "pbkdf2_sha256" {
+		return 0, "", nil, errors.New("Expected pbkdf2_sha256$<iterations>$<salt>$<hash>")
+	}
+
+	iterations, err = strconv.Atoi(parts[1])
+
+	if err != nil || iterations < 1 {
+		return 0, "", nil, errors.New("Invalid PBKDF2 iteration count")
+	}
+
+	if iterations > maxPBKDF2Iterations {
+		return 0, "", nil, fmt.Errorf("PBKDF2 iteration count must be at most %v", maxPBKDF2Iterations)
+	}
+
+	key, err = base64.StdEncoding.DecodeString(parts[3])
+
+	if err != nil || len(key) == 0 {
+		return 0, "", nil, errors.New("Invalid PBKDF2 hash encoding")
+	}
+
+	return iterations, parts[2], key, nil
+}
+
+func splitSaltedSHA1(hash string) (salt string, sum []byte, err error) {
+	parts := strings.Split(hash, "$")
+
+	if len(parts) != 3 || parts[0] != "sha1" {
+		return "", nil, errors.New("Expected sha1$<salt>$<hash>")
+	}
+
+	sum, err = hex.DecodeString(parts[2])
+
+	if err != nil || len(sum) != sha1.Size {
+		return "", nil, errors.New("Invalid SHA-1 hash encoding")
+	}
+
+	return parts[1], sum, nil
+}
+
+// compareForeignHash returns nil if the pw matches the hash of the algorithm.
+func compareForeignHash(algorithm, hash string, pw []byte) error {
+	var expected, actual []byte
+
+	switch algorithm {
+	case hashBcrypt:
+		return compareHashAndPassword([]byte(hash), pw)
+	case hashPBKDF2SHA256:
+		iterations, salt, key, err := splitPBKDF2(hash)
+
+		if err != nil {
+			return err
+		}
+
+		expected, actual = key, pbkdf2.Key(pw, []byte(salt), iterations, len(key), sha256.New)
+	case hashSaltedSHA1:
+		salt, sum, err := splitSaltedSHA1(hash)
+
+		if err != nil {
+			return err
+		}
+
+		digest := sha1.Sum(append([]byte(salt), pw...))
+		expected, actual = sum, digest[:]
+	default:
+		return checkForeignHash(algorithm, hash)
+	}
+
+	if subtle.ConstantTimeCompare(expected, actual) != 1 {
+		return errors.New("Password does not match")
+	}
+
+	return nil
+}
+
+// setPassword replaces the user's hash with a hash of the pw by hashPassword.
+func (ud *UserData) setPassword(ctx context.Context, pw string) error {
+	hash, err := hashPassword(ctx, []byte(pw))
+
+	if err != nil {
+		return err
+	}
+
+	ud.Hash = string(hash)
+	ud.HashAlgorithm = ""
+
+	return nil
+}
+
+// compareForeign checks the pw against an imported hash. After a match the hash is replaced
+// by one of hashPassword, so the foreign hash is only used once. Failing to store it does not fail the login.
+func (ud *UserData) compareForeign(ctx context.Context, pw string) bool {
+	_, span := startSpan(ctx, "hash.compare."+ud.HashAlgorithm)
+	err := compareForeignHash(ud.HashAlgorithm, ud.Hash, []byte(pw))
+	span.End()
+
+	if err != nil {
+		return false
+	}
+
+	if err := ud.setPassword(ctx, pw); err != nil {
+		log.Printf("Unable to rehash password of %v: %v", ud.ID, err)
+		return true
+	}
+
+	if err := writeToDB(ctx, ud); err != nil {
+		log.Printf("Unable to store rehashed password of %v: %v", ud.ID, err)
+	}
+
+	return true
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+func pbkdf2Hash(pw string) string {
+	key := pbkdf2.Key([]byte(pw), []byte("SomeSalt"), 1000, 32, sha256.New)
+	return "pbkdf2_sha256$1000$SomeSalt$" + base64.StdEncoding.EncodeToString(key)
+}
+
+func sha1Hash(pw string) string {
+	sum := sha1.Sum([]byte("SomeSalt" + pw))
+	return "sha1$SomeSalt$" + hex.EncodeToString(sum[:])
+}
+
+func bcryptHash(pw string) string {
+	hash, _ := bcrypt.GenerateFromPassword([]byte(pw), bcrypt.MinCost)
+	return string(hash)
+}
+
+func TestCompareForeignHash(T *testing.T) {
+	expectations := map[string]bool{
+		"Match bcrypt":         compareForeignHash(hashBcrypt, bcryptHash("SomePW"), []byte("SomePW")) == nil,
+		"Match PBKDF2":         compareForeignHash(hashPBKDF2SHA256, pbkdf2Hash("SomePW"), []byte("SomePW")) == nil,
+		"Match SHA-1":          compareForeignHash(hashSaltedSHA1, sha1Hash("SomePW"), []byte("SomePW")) == nil,
+		"Reject bcrypt":        compareForeignHash(hashBcrypt, bcryptHash("SomePW"), []byte("OtherPW")) != nil,
+		"Reject PBKDF2":        compareForeignHash(hashPBKDF2SHA256, pbkdf2Hash("SomePW"), []byte("OtherPW")) != nil,
+		"Reject SHA-1":         compareForeignHash(hashSaltedSHA1, sha1Hash("SomePW"), []byte("OtherPW")) != nil,
+		"Reject unknown":       compareForeignHash("md5", "SomeHash", []byte("SomePW")) != nil,
+		"Check bcrypt format":  checkForeignHash(hashBcrypt, "SomeHash") != nil,
+		"Check PBKDF2 format":  checkForeignHash(hashPBKDF2SHA256, "pbkdf2_sha256$x$SomeSalt$AAAA") != nil,
+		"Cap PBKDF2 count":     checkForeignHash(hashPBKDF2SHA256, "pbkdf2_sha256$100000000$SomeSalt$AAAA") != nil,
+		"Check SHA-1 format":   checkForeignHash(hashSaltedSHA1, "sha1$SomeSalt$abc") != nil,
+		"Accept valid formats": checkForeignHash(hashPBKDF2SHA256, pbkdf2Hash("SomePW")) == nil && checkForeignHash(hashSaltedSHA1, sha1Hash("SomePW")) == nil,
+	}
+
+	CheckExpectations(expectations, T)
+}
+
+func TestRehashOnLogin(T *testing.T) {
+	injectOAuthStore()
+
+	ud := &UserData{ID: "OtherID", CanonicalID: "otherid", Hash: pbkdf2Hash("OtherPW"), HashAlgorithm: hashPBKDF2SHA256}
+	writeToDB(testctx, ud)
+
+	_, wrongErr := login(testctx, "OtherID", "SomePW")
+	unchanged, _ := readUser(testctx, "OtherID")
+	unchangedHash := unchanged.Hash
+
+	_, loginErr := login(testctx, "OtherID", "OtherPW")
+	rehashed, _ := readUser(testctx, "OtherID")
+	_, againErr := login(testctx, "OtherID", "OtherPW")
+
+	expectations := map[string]bool{
+		"Reject wrong password": wrongErr != nil && unchangedHash == pbkdf2Hash("OtherPW"),
+		"Accept foreign hash":   loginErr == nil,
+		"Rehash password":       rehashed.HashAlgorithm == "" && strings.HasPrefix(rehashed.Hash, "$2"),
+		"Accept rehashed":       againErr == nil,
+	}
+
+	CheckExpectations(expectations, T)
+}
@@ -0,0 +1,215 @@
+// Package client wraps the AuthServiceClient and keeps the token of a logged in user valid.
+package client
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tooxoot/authservice/protobuf"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// DefaultRenewBefore is the remaining lifetime below which a token is renewed.
+const DefaultRenewBefore = 5 * time.Minute
+
+// ErrMFARequired is returned by Login for users with a second factor.
+// Such users have to complete the login through VerifyMFA themselves.
+var ErrMFARequired = errors.New("Login requires a second factor")
+
+// ErrNotLoggedIn is returned if a token is requested before Login.
+var ErrNotLoggedIn = errors.New("Not logged in")
+
+// Client logs in a user and renews the token before it expires.
+// The credentials are kept in memory to log in again if the token is revoked.
+type Client struct {
+	protobuf.AuthServiceClient
+	// RenewBefore defaults to DefaultRenewBefore.
+	RenewBefore time.Duration
+
+	mu    sync.Mutex
+	user  *protobuf.User
+	token string
+	exp   time.Time
+	now   func() time.Time
+}
+
+// New creates a Client for the AuthService reachable through the connection.
+func New(cc grpc.ClientConnInterface) *Client {
+	return Wrap(protobuf.NewAuthServiceClient(cc))
+}
+
+// Wrap creates a Client around an existing AuthServiceClient.
+func Wrap(c protobuf.AuthServiceClient) *Client {
+	return &Client{AuthServiceClient: c, RenewBefore: DefaultRenewBefore, now: time.Now}
+}
+
+// tokenClaims are the parts of the token's claims the Client needs.
+type tokenClaims struct {
+	Exp time.Time `json:"exp"`
+	Typ string    `json:"typ"`
+}
+
+// readClaims decodes the claims of a token without verifying it.
+// The Client only uses them to schedule renewals.
+func readClaims(signedString string) (*tokenClaims, error) {
+	parts := strings.Split(signedString, ".")
+
+	if len(parts) != 3 {
+		return nil, errors.New("Malformed token")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+
+	if err != nil {
+		return nil, fmt.Errorf("Malformed token: %w", err)
+	}
+
+	claims := &tokenClaims{}
+
+	if err := json.Unmarshal(payload, claims); err != nil {
+		return nil, fmt.Errorf("Malformed token: %w", err)
+	}
+
+	return claims, nil
+}
+
+// store keeps the token if it is a regular token. Must be called with mu held.
+func (c *Client) store(t *protobuf.Token) error {
+	claims, err := readClaims(t.GetSignedString())
+
+	if err != nil {
+		return err
+	}
+
+	if claims.Typ != "" {
+		return ErrMFARequired
+	}
+
+	c.token = t.GetSignedString()
+	c.exp = claims.Exp
+
+	return nil
+}
+
+// Login logs the user in and keeps the token for subsequent calls.
+func (c *Client) Login(ctx context.Context, id, password string, opts ...grpc.CallOption) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	user := &protobuf.User{ID: id, Password: password}
+	t, err := c.AuthServiceClient.Login(ctx, user, opts...)
+
+	if err != nil {
+		return err
+	}
+
+	if err := c.store(t); err != nil {
+		return err
+	}
+
+	c.user = user
+
+	return nil
+}
+
+// Logout revokes the token and forgets the credentials.
+func (c *Client) Logout(ctx context.Context, opts ...grpc.CallOption) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	token := c.token
+	c.user, c.token, c.exp = nil, "", time.Time{}
+
+	if token == "" {
+		return nil
+	}
+
+	_, err := c.AuthServiceClient.Revoke(ctx, &protobuf.Token{SignedString: token}, opts...)
+
+	return err
+}
+
+// Token returns a valid token. It is renewed first if it expires within RenewBefore.
+// If renewing fails with Unauthenticated the user is logged in again.
+func (c *Client) Token(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.user == nil {
+		return "", ErrNotLoggedIn
+	}
+
+	if c.token != "" && c.now().Add(c.RenewBefore).Before(c.exp) {
+		return c.token, nil
+	}
+
+	if c.token != "" {
+		t, err := c.AuthServiceClient.Renew(ctx, &protobuf.Token{SignedString: c.token})
+
+		if err == nil {
+			return c.renewed(t)
+		}
+
+		if status.Code(err) != codes.Unauthenticated {
+			return "", err
+		}
+	}
+
+	t, err := c.AuthServiceClient.Login(ctx, c.user)
+
+	if err != nil {
+		return "", err
+	}
+
+	return c.renewed(t)
+}
+
+// renewed stores and returns the new token. Must be called with mu held.
+func (c *Client) renewed(t *protobuf.Token) (string, error) {
+	if err := c.store(t); err != nil {
+		return "", err
+	}
+
+	return c.token, nil
+}
+
+// invalidate drops the token if it is still the given one, forcing the next Token call to log in again.
+func (c *Client) invalidate(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token == token {
+		c.token, c.exp = "", time.Time{}
+	}
+}
+
+// Do calls f with a valid token and retries once with a new token if f fails with Unauthenticated.
+func (c *Client) Do(ctx context.Context, f func(ctx context.Context, token string) error) error {
+	token, err := c.Token(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	err = f(ctx, token)
+
+	if status.Code(err) != codes.Unauthenticated {
+		return err
+	}
+
+	c.invalidate(token)
+
+	if token, err = c.Token(ctx); err != nil {
+		return err
+	}
+
+	return f(ctx, token)
+}
@@ -0,0 +1,205 @@
+package client
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/tooxoot/authservice/protobuf"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+var testtime = time.Date(2020, 4, 1, 12, 0, 0, 0, time.UTC)
+
+func checkExpectations(expectations map[string]bool, T *testing.T) {
+	T.Helper()
+
+	for name, fulfilled := range expectations {
+		if !fulfilled {
+			T.Errorf("Expectation failed: %s", name)
+		}
+	}
+}
+
+// fakeToken builds an unsigned token with the claims the Client reads.
+func fakeToken(exp time.Time, typ string) string {
+	payload := fmt.Sprintf(`{"exp":"%v","typ":"%v","id":"SomeID"}`, exp.Format(time.RFC3339), typ)
+	return "e30." + base64.RawURLEncoding.EncodeToString([]byte(payload)) + ".SomeSignature"
+}
+
+// fakeAuthService issues tokens valid for one hour after testtime and counts the calls.
+type fakeAuthService struct {
+	protobuf.AuthServiceClient
+	calls      map[string]int
+	renewError error
+	typ        string
+	lifetime   time.Duration
+}
+
+func newFakeAuthService() *fakeAuthService {
+	return &fakeAuthService{calls: map[string]int{}, lifetime: time.Hour}
+}
+
+func (f *fakeAuthService) token() *protobuf.Token {
+	return &protobuf.Token{SignedString: fakeToken(testtime.Add(f.lifetime), f.typ)}
+}
+
+func (f *fakeAuthService) Login(ctx context.Context, in *protobuf.User, opts ...grpc.CallOption) (*protobuf.Token, error) {
+	f.calls["Login"]++
+
+	if in.GetPassword() != "SomePW" {
+		return nil, status.Error(codes.Unauthenticated, "Invalid credentials")
+	}
+
+	return f.token(), nil
+}
+
+func (f *fakeAuthService) Renew(ctx context.Context, in *protobuf.Token, opts ...grpc.CallOption) (*protobuf.Token, error) {
+	f.calls["Renew"]++
+
+	if f.renewError != nil {
+		return nil, f.renewError
+	}
+
+	return f.token(), nil
+}
+
+func (f *fakeAuthService) Revoke(ctx context.Context, in *protobuf.Token, opts ...grpc.CallOption) (*protobuf.Token, error) {
+	f.calls["Revoke"]++
+	return in, nil
+}
+
+// testClient wraps the fake service at testtime.
+func testClient(service *fakeAuthService) *Client {
+	c := Wrap(service)
+	c.now = func() time.Time { return testtime }
+
+	return c
+}
+
+func TestLogin(T *testing.T) {
+	service := newFakeAuthService()
+	c := testClient(service)
+
+	_, notLoggedIn := c.Token(context.Background())
+	loginErr := c.Login(context.Background(), "SomeID", "SomePW")
+	token, err := c.Token(context.Background())
+
+	expectations := map[string]bool{
+		"Require login":         notLoggedIn == ErrNotLoggedIn,
+		"Login":                 loginErr == nil && service.calls["Login"] == 1,
+		"Return stored token":   err == nil && token == fakeToken(testtime.Add(time.Hour), ""),
+		"Reject wrong password": c.Login(context.Background(), "SomeID", "OtherPW") != nil,
+	}
+
+	service.typ = "mfa_required"
+	expectations["Reject mfa challenge"] = testClient(service).Login(context.Background(), "SomeID", "SomePW") == ErrMFARequired
+
+	c.Logout(context.Background())
+	_, err = c.Token(context.Background())
+	expectations["Revoke on logout"] = service.calls["Revoke"] == 1 && err == ErrNotLoggedIn
+
+	checkExpectations(expectations, T)
+}
+
+func TestRenewal(T *testing.T) {
+	service := newFakeAuthService()
+	c := testClient(service)
+	c.Login(context.Background(), "SomeID", "SomePW")
+
+	c.now = func() time.Time { return testtime.Add(time.Hour - DefaultRenewBefore - time.Second) }
+	c.Token(context.Background())
+
+	expectations := map[string]bool{
+		"Keep token until RenewBefore": service.calls["Renew"] == 0,
+	}
+
+	c.now = func() time.Time { return testtime.Add(time.Hour - time.Minute) }
+	service.lifetime = 2 * time.Hour
+	token, err := c.Token(context.Background())
+	expectations["Renew before exp"] = err == nil && service.calls["Renew"] == 1 && token == fakeToken(testtime.Add(2*time.Hour), "")
+
+	c.now = func() time.Time { return testtime.Add(2 * time.Hour) }
+	service.renewError = status.Error(codes.Unauthenticated, "Token was revoked")
+	_, err = c.Token(context.Background())
+	expectations["Log in again if renewal is rejected"] = err == nil && service.calls["Renew"] == 2 && service.calls["Login"] == 2
+
+	service.renewError = status.Error(codes.Unavailable, "")
+	_, err = c.Token(context.Background())
+	expectations["Fail on other renewal errors"] = status.Code(err) == codes.Unavailable && service.calls["Login"] == 2
+
+	checkExpectations(expectations, T)
+}
+
+func TestDo(T *testing.T) {
+	service := newFakeAuthService()
+	c := testClient(service)
+	c.Login(context.Background(), "SomeID", "SomePW")
+
+	calls := 0
+	err := c.Do(context.Background(), func(ctx context.Context, token string) error {
+		calls++
+
+		if calls == 1 {
+			return status.Error(codes.Unauthenticated, "")
+		}
+
+		return nil
+	})
+
+	expectations := map[string]bool{
+		"Retry once with new token": err == nil && calls == 2 && service.calls["Login"] == 2,
+	}
+
+	calls = 0
+	err = c.Do(context.Background(), func(ctx context.Context, token string) error {
+		calls++
+		return status.Error(codes.Unauthenticated, "")
+	})
+	expectations["Give up after retry"] = status.Code(err) == codes.Unauthenticated && calls == 2
+
+	calls = 0
+	err = c.Do(context.Background(), func(ctx context.Context, token string) error {
+		calls++
+		return status.Error(codes.PermissionDenied, "")
+	})
+	expectations["Do not retry other errors"] = status.Code(err) == codes.PermissionDenied && calls == 1
+
+	checkExpectations(expectations, T)
+}
+
+func TestCredentials(T *testing.T) {
+	service := newFakeAuthService()
+	c := testClient(service)
+
+	_, notLoggedIn := c.Credentials().GetRequestMetadata(context.Background())
+	c.Login(context.Background(), "SomeID", "SomePW")
+	md, err := c.Credentials().GetRequestMetadata(context.Background())
+
+	var sent []string
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		outgoing, _ := metadata.FromOutgoingContext(ctx)
+		sent = append(sent, outgoing.Get("authorization")...)
+
+		if len(sent) == 1 {
+			return status.Error(codes.Unauthenticated, "")
+		}
+
+		return nil
+	}
+	invokeErr := c.UnaryClientInterceptor()(context.Background(), "/SomeService/SomeMethod", nil, nil, nil, invoker)
+
+	expectations := map[string]bool{
+		"Require login":               status.Code(notLoggedIn) == codes.Unauthenticated,
+		"Attach bearer token":         err == nil && md["authorization"] == "Bearer "+fakeToken(testtime.Add(time.Hour), ""),
+		"Require transport security":  c.Credentials().RequireTransportSecurity() && !c.InsecureCredentials().RequireTransportSecurity(),
+		"Retry intercepted call once": invokeErr == nil && len(sent) == 2 && sent[1] == md["authorization"],
+	}
+
+	checkExpectations(expectations, T)
+}
@@ -0,0 +1,55 @@
+package client
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// tokenCredentials attach the Client's token as bearer token to every RPC.
+type tokenCredentials struct {
+	client   *Client
+	insecure bool
+}
+
+// GetRequestMetadata returns the authorization metadata with a valid token.
+func (t tokenCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	token, err := t.client.Token(ctx)
+
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	return map[string]string{"authorization": "Bearer " + token}, nil
+}
+
+// RequireTransportSecurity keeps the token from being sent in plain text unless allowed.
+func (t tokenCredentials) RequireTransportSecurity() bool {
+	return !t.insecure
+}
+
+// Credentials returns PerRPCCredentials attaching the token to RPCs of other services, e.g. through grpc.WithPerRPCCredentials.
+// They require transport security. They must not be used for the connection of the Client itself.
+func (c *Client) Credentials() credentials.PerRPCCredentials {
+	return tokenCredentials{client: c}
+}
+
+// InsecureCredentials returns Credentials that may be used without transport security, e.g. for local development.
+func (c *Client) InsecureCredentials() credentials.PerRPCCredentials {
+	return tokenCredentials{client: c, insecure: true}
+}
+
+// UnaryClientInterceptor retries an RPC once with a new token if it fails with Unauthenticated.
+// It attaches the token itself, so it can be used instead of Credentials but also not on the Client's own connection.
+func (c *Client) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return c.Do(ctx, func(ctx context.Context, token string) error {
+			ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+			return invoker(ctx, method, req, reply, cc, opts...)
+		})
+	}
+}
@@ -28,6 +28,7 @@ const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
 type User struct {
 	ID                   string   `protobuf:"bytes,1,opt,name=ID,proto3" json:"ID,omitempty"`
 	Password             string   `protobuf:"bytes,2,opt,name=Password,proto3" json:"Password,omitempty"`
+	Email                string   `protobuf:"bytes,3,opt,name=Email,proto3" json:"Email,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -72,6 +73,13 @@ func (m *User) GetPassword() string {
 	return ""
 }
 
+func (m *User) GetEmail() string {
+	if m != nil {
+		return m.Email
+	}
+	return ""
+}
+
 type Token struct {
 	SignedString         string   `protobuf:"bytes,1,opt,name=SignedString,proto3" json:"SignedString,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
@@ -111,191 +119,1699 @@ func (m *Token) GetSignedString() string {
 	return ""
 }
 
-func init() {
-	proto.RegisterType((*User)(nil), "protobuf.User")
-	proto.RegisterType((*Token)(nil), "protobuf.Token")
+type MFACode struct {
+	SignedString         string   `protobuf:"bytes,1,opt,name=SignedString,proto3" json:"SignedString,omitempty"`
+	Code                 string   `protobuf:"bytes,2,opt,name=Code,proto3" json:"Code,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
 }
 
-func init() {
-	proto.RegisterFile("interface.proto", fileDescriptor_3ef53c9e620778f1)
+func (m *MFACode) Reset()         { *m = MFACode{} }
+func (m *MFACode) String() string { return proto.CompactTextString(m) }
+func (*MFACode) ProtoMessage()    {}
+func (*MFACode) Descriptor() ([]byte, []int) {
+	return fileDescriptor_3ef53c9e620778f1, []int{2}
 }
 
-var fileDescriptor_3ef53c9e620778f1 = []byte{
-	// 200 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xe2, 0xe2, 0xcf, 0xcc, 0x2b, 0x49,
-	0x2d, 0x4a, 0x4b, 0x4c, 0x4e, 0xd5, 0x2b, 0x28, 0xca, 0x2f, 0xc9, 0x17, 0xe2, 0x00, 0x53, 0x49,
-	0xa5, 0x69, 0x4a, 0x46, 0x5c, 0x2c, 0xa1, 0xc5, 0xa9, 0x45, 0x42, 0x7c, 0x5c, 0x4c, 0x9e, 0x2e,
-	0x12, 0x8c, 0x0a, 0x8c, 0x1a, 0x9c, 0x41, 0x4c, 0x9e, 0x2e, 0x42, 0x52, 0x5c, 0x1c, 0x01, 0x89,
-	0xc5, 0xc5, 0xe5, 0xf9, 0x45, 0x29, 0x12, 0x4c, 0x60, 0x51, 0x38, 0x5f, 0x49, 0x9b, 0x8b, 0x35,
-	0x24, 0x3f, 0x3b, 0x35, 0x4f, 0x48, 0x89, 0x8b, 0x27, 0x38, 0x33, 0x3d, 0x2f, 0x35, 0x25, 0xb8,
-	0xa4, 0x28, 0x33, 0x2f, 0x1d, 0xaa, 0x1d, 0x45, 0xcc, 0x68, 0x37, 0x23, 0x17, 0xb7, 0x63, 0x69,
-	0x49, 0x46, 0x70, 0x6a, 0x51, 0x59, 0x66, 0x72, 0xaa, 0x90, 0x06, 0x17, 0xab, 0x4f, 0x7e, 0x7a,
-	0x66, 0x9e, 0x10, 0x9f, 0x1e, 0xcc, 0x11, 0x7a, 0x20, 0x17, 0x48, 0xf1, 0x23, 0xf8, 0x10, 0xd3,
-	0xb5, 0xb9, 0x38, 0x82, 0x52, 0xd3, 0x33, 0x8b, 0x4b, 0x40, 0xce, 0x23, 0xa4, 0x58, 0x8b, 0x8b,
-	0x2d, 0x28, 0xb5, 0x2c, 0x3f, 0x3b, 0x55, 0x08, 0x5d, 0x0a, 0x53, 0xad, 0x26, 0x17, 0x6b, 0x50,
-	0x6a, 0x5e, 0x6a, 0x39, 0x61, 0xa5, 0x49, 0x6c, 0x60, 0xbe, 0x31, 0x20, 0x00, 0x00, 0xff, 0xff,
-	0x21, 0x66, 0x66, 0xfe, 0x42, 0x01, 0x00, 0x00,
+func (m *MFACode) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_MFACode.Unmarshal(m, b)
+}
+func (m *MFACode) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_MFACode.Marshal(b, m, deterministic)
+}
+func (m *MFACode) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_MFACode.Merge(m, src)
+}
+func (m *MFACode) XXX_Size() int {
+	return xxx_messageInfo_MFACode.Size(m)
+}
+func (m *MFACode) XXX_DiscardUnknown() {
+	xxx_messageInfo_MFACode.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_MFACode proto.InternalMessageInfo
+
+func (m *MFACode) GetSignedString() string {
+	if m != nil {
+		return m.SignedString
+	}
+	return ""
+}
+
+func (m *MFACode) GetCode() string {
+	if m != nil {
+		return m.Code
+	}
+	return ""
+}
+
+type TOTPEnrollment struct {
+	URI                  string   `protobuf:"bytes,1,opt,name=URI,proto3" json:"URI,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *TOTPEnrollment) Reset()         { *m = TOTPEnrollment{} }
+func (m *TOTPEnrollment) String() string { return proto.CompactTextString(m) }
+func (*TOTPEnrollment) ProtoMessage()    {}
+func (*TOTPEnrollment) Descriptor() ([]byte, []int) {
+	return fileDescriptor_3ef53c9e620778f1, []int{3}
+}
+
+func (m *TOTPEnrollment) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_TOTPEnrollment.Unmarshal(m, b)
+}
+func (m *TOTPEnrollment) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_TOTPEnrollment.Marshal(b, m, deterministic)
+}
+func (m *TOTPEnrollment) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_TOTPEnrollment.Merge(m, src)
+}
+func (m *TOTPEnrollment) XXX_Size() int {
+	return xxx_messageInfo_TOTPEnrollment.Size(m)
+}
+func (m *TOTPEnrollment) XXX_DiscardUnknown() {
+	xxx_messageInfo_TOTPEnrollment.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_TOTPEnrollment proto.InternalMessageInfo
+
+func (m *TOTPEnrollment) GetURI() string {
+	if m != nil {
+		return m.URI
+	}
+	return ""
+}
+
+type RecoveryCodes struct {
+	Codes                []string `protobuf:"bytes,1,rep,name=Codes,proto3" json:"Codes,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *RecoveryCodes) Reset()         { *m = RecoveryCodes{} }
+func (m *RecoveryCodes) String() string { return proto.CompactTextString(m) }
+func (*RecoveryCodes) ProtoMessage()    {}
+func (*RecoveryCodes) Descriptor() ([]byte, []int) {
+	return fileDescriptor_3ef53c9e620778f1, []int{4}
+}
+
+func (m *RecoveryCodes) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_RecoveryCodes.Unmarshal(m, b)
+}
+func (m *RecoveryCodes) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_RecoveryCodes.Marshal(b, m, deterministic)
+}
+func (m *RecoveryCodes) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_RecoveryCodes.Merge(m, src)
+}
+func (m *RecoveryCodes) XXX_Size() int {
+	return xxx_messageInfo_RecoveryCodes.Size(m)
+}
+func (m *RecoveryCodes) XXX_DiscardUnknown() {
+	xxx_messageInfo_RecoveryCodes.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_RecoveryCodes proto.InternalMessageInfo
+
+func (m *RecoveryCodes) GetCodes() []string {
+	if m != nil {
+		return m.Codes
+	}
+	return nil
+}
+
+type WebAuthnOptions struct {
+	SessionToken         string   `protobuf:"bytes,1,opt,name=SessionToken,proto3" json:"SessionToken,omitempty"`
+	PublicKeyJSON        string   `protobuf:"bytes,2,opt,name=PublicKeyJSON,proto3" json:"PublicKeyJSON,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *WebAuthnOptions) Reset()         { *m = WebAuthnOptions{} }
+func (m *WebAuthnOptions) String() string { return proto.CompactTextString(m) }
+func (*WebAuthnOptions) ProtoMessage()    {}
+func (*WebAuthnOptions) Descriptor() ([]byte, []int) {
+	return fileDescriptor_3ef53c9e620778f1, []int{5}
+}
+
+func (m *WebAuthnOptions) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_WebAuthnOptions.Unmarshal(m, b)
+}
+func (m *WebAuthnOptions) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_WebAuthnOptions.Marshal(b, m, deterministic)
+}
+func (m *WebAuthnOptions) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_WebAuthnOptions.Merge(m, src)
+}
+func (m *WebAuthnOptions) XXX_Size() int {
+	return xxx_messageInfo_WebAuthnOptions.Size(m)
+}
+func (m *WebAuthnOptions) XXX_DiscardUnknown() {
+	xxx_messageInfo_WebAuthnOptions.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_WebAuthnOptions proto.InternalMessageInfo
+
+func (m *WebAuthnOptions) GetSessionToken() string {
+	if m != nil {
+		return m.SessionToken
+	}
+	return ""
+}
+
+func (m *WebAuthnOptions) GetPublicKeyJSON() string {
+	if m != nil {
+		return m.PublicKeyJSON
+	}
+	return ""
+}
+
+type WebAuthnAttestation struct {
+	SessionToken         string   `protobuf:"bytes,1,opt,name=SessionToken,proto3" json:"SessionToken,omitempty"`
+	ClientDataJSON       []byte   `protobuf:"bytes,2,opt,name=ClientDataJSON,proto3" json:"ClientDataJSON,omitempty"`
+	AttestationObject    []byte   `protobuf:"bytes,3,opt,name=AttestationObject,proto3" json:"AttestationObject,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *WebAuthnAttestation) Reset()         { *m = WebAuthnAttestation{} }
+func (m *WebAuthnAttestation) String() string { return proto.CompactTextString(m) }
+func (*WebAuthnAttestation) ProtoMessage()    {}
+func (*WebAuthnAttestation) Descriptor() ([]byte, []int) {
+	return fileDescriptor_3ef53c9e620778f1, []int{6}
+}
+
+func (m *WebAuthnAttestation) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_WebAuthnAttestation.Unmarshal(m, b)
+}
+func (m *WebAuthnAttestation) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_WebAuthnAttestation.Marshal(b, m, deterministic)
+}
+func (m *WebAuthnAttestation) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_WebAuthnAttestation.Merge(m, src)
+}
+func (m *WebAuthnAttestation) XXX_Size() int {
+	return xxx_messageInfo_WebAuthnAttestation.Size(m)
+}
+func (m *WebAuthnAttestation) XXX_DiscardUnknown() {
+	xxx_messageInfo_WebAuthnAttestation.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_WebAuthnAttestation proto.InternalMessageInfo
+
+func (m *WebAuthnAttestation) GetSessionToken() string {
+	if m != nil {
+		return m.SessionToken
+	}
+	return ""
+}
+
+func (m *WebAuthnAttestation) GetClientDataJSON() []byte {
+	if m != nil {
+		return m.ClientDataJSON
+	}
+	return nil
+}
+
+func (m *WebAuthnAttestation) GetAttestationObject() []byte {
+	if m != nil {
+		return m.AttestationObject
+	}
+	return nil
+}
+
+type WebAuthnCredential struct {
+	ID                   []byte   `protobuf:"bytes,1,opt,name=ID,proto3" json:"ID,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *WebAuthnCredential) Reset()         { *m = WebAuthnCredential{} }
+func (m *WebAuthnCredential) String() string { return proto.CompactTextString(m) }
+func (*WebAuthnCredential) ProtoMessage()    {}
+func (*WebAuthnCredential) Descriptor() ([]byte, []int) {
+	return fileDescriptor_3ef53c9e620778f1, []int{7}
+}
+
+func (m *WebAuthnCredential) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_WebAuthnCredential.Unmarshal(m, b)
+}
+func (m *WebAuthnCredential) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_WebAuthnCredential.Marshal(b, m, deterministic)
+}
+func (m *WebAuthnCredential) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_WebAuthnCredential.Merge(m, src)
+}
+func (m *WebAuthnCredential) XXX_Size() int {
+	return xxx_messageInfo_WebAuthnCredential.Size(m)
+}
+func (m *WebAuthnCredential) XXX_DiscardUnknown() {
+	xxx_messageInfo_WebAuthnCredential.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_WebAuthnCredential proto.InternalMessageInfo
+
+func (m *WebAuthnCredential) GetID() []byte {
+	if m != nil {
+		return m.ID
+	}
+	return nil
+}
+
+type WebAuthnAssertion struct {
+	SessionToken         string   `protobuf:"bytes,1,opt,name=SessionToken,proto3" json:"SessionToken,omitempty"`
+	CredentialID         []byte   `protobuf:"bytes,2,opt,name=CredentialID,proto3" json:"CredentialID,omitempty"`
+	ClientDataJSON       []byte   `protobuf:"bytes,3,opt,name=ClientDataJSON,proto3" json:"ClientDataJSON,omitempty"`
+	AuthenticatorData    []byte   `protobuf:"bytes,4,opt,name=AuthenticatorData,proto3" json:"AuthenticatorData,omitempty"`
+	Signature            []byte   `protobuf:"bytes,5,opt,name=Signature,proto3" json:"Signature,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *WebAuthnAssertion) Reset()         { *m = WebAuthnAssertion{} }
+func (m *WebAuthnAssertion) String() string { return proto.CompactTextString(m) }
+func (*WebAuthnAssertion) ProtoMessage()    {}
+func (*WebAuthnAssertion) Descriptor() ([]byte, []int) {
+	return fileDescriptor_3ef53c9e620778f1, []int{8}
+}
+
+func (m *WebAuthnAssertion) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_WebAuthnAssertion.Unmarshal(m, b)
+}
+func (m *WebAuthnAssertion) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_WebAuthnAssertion.Marshal(b, m, deterministic)
+}
+func (m *WebAuthnAssertion) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_WebAuthnAssertion.Merge(m, src)
+}
+func (m *WebAuthnAssertion) XXX_Size() int {
+	return xxx_messageInfo_WebAuthnAssertion.Size(m)
+}
+func (m *WebAuthnAssertion) XXX_DiscardUnknown() {
+	xxx_messageInfo_WebAuthnAssertion.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_WebAuthnAssertion proto.InternalMessageInfo
+
+func (m *WebAuthnAssertion) GetSessionToken() string {
+	if m != nil {
+		return m.SessionToken
+	}
+	return ""
+}
+
+func (m *WebAuthnAssertion) GetCredentialID() []byte {
+	if m != nil {
+		return m.CredentialID
+	}
+	return nil
+}
+
+func (m *WebAuthnAssertion) GetClientDataJSON() []byte {
+	if m != nil {
+		return m.ClientDataJSON
+	}
+	return nil
+}
+
+func (m *WebAuthnAssertion) GetAuthenticatorData() []byte {
+	if m != nil {
+		return m.AuthenticatorData
+	}
+	return nil
+}
+
+func (m *WebAuthnAssertion) GetSignature() []byte {
+	if m != nil {
+		return m.Signature
+	}
+	return nil
+}
+
+type ClientCredentials struct {
+	ID                   string   `protobuf:"bytes,1,opt,name=ID,proto3" json:"ID,omitempty"`
+	Secret               string   `protobuf:"bytes,2,opt,name=Secret,proto3" json:"Secret,omitempty"`
+	Scope                string   `protobuf:"bytes,3,opt,name=Scope,proto3" json:"Scope,omitempty"`
+	OverlapSeconds       int64    `protobuf:"varint,4,opt,name=OverlapSeconds,proto3" json:"OverlapSeconds,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ClientCredentials) Reset()         { *m = ClientCredentials{} }
+func (m *ClientCredentials) String() string { return proto.CompactTextString(m) }
+func (*ClientCredentials) ProtoMessage()    {}
+func (*ClientCredentials) Descriptor() ([]byte, []int) {
+	return fileDescriptor_3ef53c9e620778f1, []int{9}
+}
+
+func (m *ClientCredentials) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ClientCredentials.Unmarshal(m, b)
+}
+func (m *ClientCredentials) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ClientCredentials.Marshal(b, m, deterministic)
+}
+func (m *ClientCredentials) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ClientCredentials.Merge(m, src)
+}
+func (m *ClientCredentials) XXX_Size() int {
+	return xxx_messageInfo_ClientCredentials.Size(m)
+}
+func (m *ClientCredentials) XXX_DiscardUnknown() {
+	xxx_messageInfo_ClientCredentials.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ClientCredentials proto.InternalMessageInfo
+
+func (m *ClientCredentials) GetID() string {
+	if m != nil {
+		return m.ID
+	}
+	return ""
+}
+
+func (m *ClientCredentials) GetSecret() string {
+	if m != nil {
+		return m.Secret
+	}
+	return ""
+}
+
+func (m *ClientCredentials) GetScope() string {
+	if m != nil {
+		return m.Scope
+	}
+	return ""
+}
+
+func (m *ClientCredentials) GetOverlapSeconds() int64 {
+	if m != nil {
+		return m.OverlapSeconds
+	}
+	return 0
+}
+
+type APIKeyRequest struct {
+	SignedString         string   `protobuf:"bytes,1,opt,name=SignedString,proto3" json:"SignedString,omitempty"`
+	Name                 string   `protobuf:"bytes,2,opt,name=Name,proto3" json:"Name,omitempty"`
+	Scope                string   `protobuf:"bytes,3,opt,name=Scope,proto3" json:"Scope,omitempty"`
+	LifetimeSeconds      int64    `protobuf:"varint,4,opt,name=LifetimeSeconds,proto3" json:"LifetimeSeconds,omitempty"`
+	Prefix               string   `protobuf:"bytes,5,opt,name=Prefix,proto3" json:"Prefix,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *APIKeyRequest) Reset()         { *m = APIKeyRequest{} }
+func (m *APIKeyRequest) String() string { return proto.CompactTextString(m) }
+func (*APIKeyRequest) ProtoMessage()    {}
+func (*APIKeyRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_3ef53c9e620778f1, []int{10}
+}
+
+func (m *APIKeyRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_APIKeyRequest.Unmarshal(m, b)
+}
+func (m *APIKeyRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_APIKeyRequest.Marshal(b, m, deterministic)
+}
+func (m *APIKeyRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_APIKeyRequest.Merge(m, src)
+}
+func (m *APIKeyRequest) XXX_Size() int {
+	return xxx_messageInfo_APIKeyRequest.Size(m)
+}
+func (m *APIKeyRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_APIKeyRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_APIKeyRequest proto.InternalMessageInfo
+
+func (m *APIKeyRequest) GetSignedString() string {
+	if m != nil {
+		return m.SignedString
+	}
+	return ""
+}
+
+func (m *APIKeyRequest) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *APIKeyRequest) GetScope() string {
+	if m != nil {
+		return m.Scope
+	}
+	return ""
+}
+
+func (m *APIKeyRequest) GetLifetimeSeconds() int64 {
+	if m != nil {
+		return m.LifetimeSeconds
+	}
+	return 0
+}
+
+func (m *APIKeyRequest) GetPrefix() string {
+	if m != nil {
+		return m.Prefix
+	}
+	return ""
+}
+
+type APIKey struct {
+	Key                  string   `protobuf:"bytes,1,opt,name=Key,proto3" json:"Key,omitempty"`
+	Prefix               string   `protobuf:"bytes,2,opt,name=Prefix,proto3" json:"Prefix,omitempty"`
+	Name                 string   `protobuf:"bytes,3,opt,name=Name,proto3" json:"Name,omitempty"`
+	Scope                string   `protobuf:"bytes,4,opt,name=Scope,proto3" json:"Scope,omitempty"`
+	Iat                  int64    `protobuf:"varint,5,opt,name=Iat,proto3" json:"Iat,omitempty"`
+	Exp                  int64    `protobuf:"varint,6,opt,name=Exp,proto3" json:"Exp,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *APIKey) Reset()         { *m = APIKey{} }
+func (m *APIKey) String() string { return proto.CompactTextString(m) }
+func (*APIKey) ProtoMessage()    {}
+func (*APIKey) Descriptor() ([]byte, []int) {
+	return fileDescriptor_3ef53c9e620778f1, []int{11}
+}
+
+func (m *APIKey) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_APIKey.Unmarshal(m, b)
+}
+func (m *APIKey) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_APIKey.Marshal(b, m, deterministic)
+}
+func (m *APIKey) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_APIKey.Merge(m, src)
+}
+func (m *APIKey) XXX_Size() int {
+	return xxx_messageInfo_APIKey.Size(m)
+}
+func (m *APIKey) XXX_DiscardUnknown() {
+	xxx_messageInfo_APIKey.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_APIKey proto.InternalMessageInfo
+
+func (m *APIKey) GetKey() string {
+	if m != nil {
+		return m.Key
+	}
+	return ""
+}
+
+func (m *APIKey) GetPrefix() string {
+	if m != nil {
+		return m.Prefix
+	}
+	return ""
+}
+
+func (m *APIKey) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *APIKey) GetScope() string {
+	if m != nil {
+		return m.Scope
+	}
+	return ""
+}
+
+func (m *APIKey) GetIat() int64 {
+	if m != nil {
+		return m.Iat
+	}
+	return 0
+}
+
+func (m *APIKey) GetExp() int64 {
+	if m != nil {
+		return m.Exp
+	}
+	return 0
+}
+
+type APIKeys struct {
+	Keys                 []*APIKey `protobuf:"bytes,1,rep,name=Keys,proto3" json:"Keys,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}  `json:"-"`
+	XXX_unrecognized     []byte    `json:"-"`
+	XXX_sizecache        int32     `json:"-"`
+}
+
+func (m *APIKeys) Reset()         { *m = APIKeys{} }
+func (m *APIKeys) String() string { return proto.CompactTextString(m) }
+func (*APIKeys) ProtoMessage()    {}
+func (*APIKeys) Descriptor() ([]byte, []int) {
+	return fileDescriptor_3ef53c9e620778f1, []int{12}
+}
+
+func (m *APIKeys) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_APIKeys.Unmarshal(m, b)
+}
+func (m *APIKeys) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_APIKeys.Marshal(b, m, deterministic)
+}
+func (m *APIKeys) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_APIKeys.Merge(m, src)
+}
+func (m *APIKeys) XXX_Size() int {
+	return xxx_messageInfo_APIKeys.Size(m)
+}
+func (m *APIKeys) XXX_DiscardUnknown() {
+	xxx_messageInfo_APIKeys.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_APIKeys proto.InternalMessageInfo
+
+func (m *APIKeys) GetKeys() []*APIKey {
+	if m != nil {
+		return m.Keys
+	}
+	return nil
+}
+
+type EmailChange struct {
+	SignedString         string   `protobuf:"bytes,1,opt,name=SignedString,proto3" json:"SignedString,omitempty"`
+	Email                string   `protobuf:"bytes,2,opt,name=Email,proto3" json:"Email,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *EmailChange) Reset()         { *m = EmailChange{} }
+func (m *EmailChange) String() string { return proto.CompactTextString(m) }
+func (*EmailChange) ProtoMessage()    {}
+func (*EmailChange) Descriptor() ([]byte, []int) {
+	return fileDescriptor_3ef53c9e620778f1, []int{13}
+}
+
+func (m *EmailChange) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_EmailChange.Unmarshal(m, b)
+}
+func (m *EmailChange) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_EmailChange.Marshal(b, m, deterministic)
+}
+func (m *EmailChange) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_EmailChange.Merge(m, src)
+}
+func (m *EmailChange) XXX_Size() int {
+	return xxx_messageInfo_EmailChange.Size(m)
+}
+func (m *EmailChange) XXX_DiscardUnknown() {
+	xxx_messageInfo_EmailChange.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_EmailChange proto.InternalMessageInfo
+
+func (m *EmailChange) GetSignedString() string {
+	if m != nil {
+		return m.SignedString
+	}
+	return ""
+}
+
+func (m *EmailChange) GetEmail() string {
+	if m != nil {
+		return m.Email
+	}
+	return ""
+}
+
+type PasswordReset struct {
+	SignedString         string   `protobuf:"bytes,1,opt,name=SignedString,proto3" json:"SignedString,omitempty"`
+	Password             string   `protobuf:"bytes,2,opt,name=Password,proto3" json:"Password,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *PasswordReset) Reset()         { *m = PasswordReset{} }
+func (m *PasswordReset) String() string { return proto.CompactTextString(m) }
+func (*PasswordReset) ProtoMessage()    {}
+func (*PasswordReset) Descriptor() ([]byte, []int) {
+	return fileDescriptor_3ef53c9e620778f1, []int{14}
+}
+
+func (m *PasswordReset) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_PasswordReset.Unmarshal(m, b)
+}
+func (m *PasswordReset) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_PasswordReset.Marshal(b, m, deterministic)
+}
+func (m *PasswordReset) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_PasswordReset.Merge(m, src)
+}
+func (m *PasswordReset) XXX_Size() int {
+	return xxx_messageInfo_PasswordReset.Size(m)
+}
+func (m *PasswordReset) XXX_DiscardUnknown() {
+	xxx_messageInfo_PasswordReset.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_PasswordReset proto.InternalMessageInfo
+
+func (m *PasswordReset) GetSignedString() string {
+	if m != nil {
+		return m.SignedString
+	}
+	return ""
+}
+
+func (m *PasswordReset) GetPassword() string {
+	if m != nil {
+		return m.Password
+	}
+	return ""
+}
+
+type ImportRequest struct {
+	SignedString         string   `protobuf:"bytes,1,opt,name=SignedString,proto3" json:"SignedString,omitempty"`
+	Format               string   `protobuf:"bytes,2,opt,name=Format,proto3" json:"Format,omitempty"`
+	Data                 []byte   `protobuf:"bytes,3,opt,name=Data,proto3" json:"Data,omitempty"`
+	DryRun               bool     `protobuf:"varint,4,opt,name=DryRun,proto3" json:"DryRun,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ImportRequest) Reset()         { *m = ImportRequest{} }
+func (m *ImportRequest) String() string { return proto.CompactTextString(m) }
+func (*ImportRequest) ProtoMessage()    {}
+func (*ImportRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_3ef53c9e620778f1, []int{15}
+}
+
+func (m *ImportRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ImportRequest.Unmarshal(m, b)
+}
+func (m *ImportRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ImportRequest.Marshal(b, m, deterministic)
+}
+func (m *ImportRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ImportRequest.Merge(m, src)
+}
+func (m *ImportRequest) XXX_Size() int {
+	return xxx_messageInfo_ImportRequest.Size(m)
+}
+func (m *ImportRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ImportRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ImportRequest proto.InternalMessageInfo
+
+func (m *ImportRequest) GetSignedString() string {
+	if m != nil {
+		return m.SignedString
+	}
+	return ""
+}
+
+func (m *ImportRequest) GetFormat() string {
+	if m != nil {
+		return m.Format
+	}
+	return ""
+}
+
+func (m *ImportRequest) GetData() []byte {
+	if m != nil {
+		return m.Data
+	}
+	return nil
+}
+
+func (m *ImportRequest) GetDryRun() bool {
+	if m != nil {
+		return m.DryRun
+	}
+	return false
+}
+
+type ImportReport struct {
+	Imported             int32          `protobuf:"varint,1,opt,name=Imported,proto3" json:"Imported,omitempty"`
+	Failed               int32          `protobuf:"varint,2,opt,name=Failed,proto3" json:"Failed,omitempty"`
+	Errors               []*ImportError `protobuf:"bytes,3,rep,name=Errors,proto3" json:"Errors,omitempty"`
+	DryRun               bool           `protobuf:"varint,4,opt,name=DryRun,proto3" json:"DryRun,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}       `json:"-"`
+	XXX_unrecognized     []byte         `json:"-"`
+	XXX_sizecache        int32          `json:"-"`
+}
+
+func (m *ImportReport) Reset()         { *m = ImportReport{} }
+func (m *ImportReport) String() string { return proto.CompactTextString(m) }
+func (*ImportReport) ProtoMessage()    {}
+func (*ImportReport) Descriptor() ([]byte, []int) {
+	return fileDescriptor_3ef53c9e620778f1, []int{16}
+}
+
+func (m *ImportReport) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ImportReport.Unmarshal(m, b)
+}
+func (m *ImportReport) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ImportReport.Marshal(b, m, deterministic)
+}
+func (m *ImportReport) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ImportReport.Merge(m, src)
+}
+func (m *ImportReport) XXX_Size() int {
+	return xxx_messageInfo_ImportReport.Size(m)
+}
+func (m *ImportReport) XXX_DiscardUnknown() {
+	xxx_messageInfo_ImportReport.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ImportReport proto.InternalMessageInfo
+
+func (m *ImportReport) GetImported() int32 {
+	if m != nil {
+		return m.Imported
+	}
+	return 0
+}
+
+func (m *ImportReport) GetFailed() int32 {
+	if m != nil {
+		return m.Failed
+	}
+	return 0
+}
+
+func (m *ImportReport) GetErrors() []*ImportError {
+	if m != nil {
+		return m.Errors
+	}
+	return nil
+}
+
+func (m *ImportReport) GetDryRun() bool {
+	if m != nil {
+		return m.DryRun
+	}
+	return false
+}
+
+type ImportError struct {
+	Row                  int32    `protobuf:"varint,1,opt,name=Row,proto3" json:"Row,omitempty"`
+	ID                   string   `protobuf:"bytes,2,opt,name=ID,proto3" json:"ID,omitempty"`
+	Message              string   `protobuf:"bytes,3,opt,name=Message,proto3" json:"Message,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ImportError) Reset()         { *m = ImportError{} }
+func (m *ImportError) String() string { return proto.CompactTextString(m) }
+func (*ImportError) ProtoMessage()    {}
+func (*ImportError) Descriptor() ([]byte, []int) {
+	return fileDescriptor_3ef53c9e620778f1, []int{17}
+}
+
+func (m *ImportError) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ImportError.Unmarshal(m, b)
+}
+func (m *ImportError) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ImportError.Marshal(b, m, deterministic)
+}
+func (m *ImportError) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ImportError.Merge(m, src)
+}
+func (m *ImportError) XXX_Size() int {
+	return xxx_messageInfo_ImportError.Size(m)
+}
+func (m *ImportError) XXX_DiscardUnknown() {
+	xxx_messageInfo_ImportError.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ImportError proto.InternalMessageInfo
+
+func (m *ImportError) GetRow() int32 {
+	if m != nil {
+		return m.Row
+	}
+	return 0
+}
+
+func (m *ImportError) GetID() string {
+	if m != nil {
+		return m.ID
+	}
+	return ""
+}
+
+func (m *ImportError) GetMessage() string {
+	if m != nil {
+		return m.Message
+	}
+	return ""
+}
+
+func init() {
+	proto.RegisterType((*User)(nil), "protobuf.User")
+	proto.RegisterType((*Token)(nil), "protobuf.Token")
+	proto.RegisterType((*MFACode)(nil), "protobuf.MFACode")
+	proto.RegisterType((*TOTPEnrollment)(nil), "protobuf.TOTPEnrollment")
+	proto.RegisterType((*RecoveryCodes)(nil), "protobuf.RecoveryCodes")
+	proto.RegisterType((*WebAuthnOptions)(nil), "protobuf.WebAuthnOptions")
+	proto.RegisterType((*WebAuthnAttestation)(nil), "protobuf.WebAuthnAttestation")
+	proto.RegisterType((*WebAuthnCredential)(nil), "protobuf.WebAuthnCredential")
+	proto.RegisterType((*WebAuthnAssertion)(nil), "protobuf.WebAuthnAssertion")
+	proto.RegisterType((*ClientCredentials)(nil), "protobuf.ClientCredentials")
+	proto.RegisterType((*APIKeyRequest)(nil), "protobuf.APIKeyRequest")
+	proto.RegisterType((*APIKey)(nil), "protobuf.APIKey")
+	proto.RegisterType((*APIKeys)(nil), "protobuf.APIKeys")
+	proto.RegisterType((*EmailChange)(nil), "protobuf.EmailChange")
+	proto.RegisterType((*PasswordReset)(nil), "protobuf.PasswordReset")
+	proto.RegisterType((*ImportRequest)(nil), "protobuf.ImportRequest")
+	proto.RegisterType((*ImportReport)(nil), "protobuf.ImportReport")
+	proto.RegisterType((*ImportError)(nil), "protobuf.ImportError")
+}
+
+func init() {
+	proto.RegisterFile("interface.proto", fileDescriptor_3ef53c9e620778f1)
+}
+
+var fileDescriptor_3ef53c9e620778f1 = []byte{
+	// 1040 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x94, 0x56, 0x4b, 0x6f, 0x5b, 0x45,
+	0x14, 0x96, 0xed, 0xd8, 0x4d, 0x8e, 0x9d, 0xd7, 0xb4, 0xa4, 0xae, 0x29, 0x52, 0x75, 0x15, 0x50,
+	0xa1, 0x90, 0x88, 0x74, 0x81, 0x22, 0x24, 0x90, 0x71, 0x9c, 0x62, 0xf2, 0x70, 0x34, 0x4e, 0x41,
+	0x88, 0xd5, 0xcd, 0xf5, 0xb1, 0x33, 0xd4, 0xbe, 0x63, 0x66, 0xc6, 0x49, 0xbc, 0x63, 0xcb, 0x8a,
+	0x15, 0x6b, 0x7e, 0x12, 0x7f, 0x09, 0xcd, 0xe3, 0xbe, 0x7c, 0x9d, 0xd4, 0xdd, 0xf8, 0xce, 0x39,
+	0x73, 0x1e, 0xdf, 0x9c, 0x39, 0x73, 0x3e, 0xc3, 0x26, 0x0b, 0x15, 0x8a, 0x81, 0x1f, 0xe0, 0xde,
+	0x44, 0x70, 0xc5, 0xc9, 0xaa, 0xf9, 0x5c, 0x4d, 0x07, 0xde, 0x8f, 0xb0, 0xf2, 0x56, 0xa2, 0x20,
+	0x1b, 0x50, 0xec, 0x1c, 0xd5, 0x0b, 0x2f, 0x0a, 0x2f, 0xd7, 0x68, 0xb1, 0x73, 0x44, 0x1a, 0xb0,
+	0x7a, 0xe1, 0x4b, 0x79, 0xcb, 0x45, 0xbf, 0x5e, 0x34, 0xda, 0x58, 0x26, 0x4f, 0xa0, 0xdc, 0x1e,
+	0xfb, 0x6c, 0x54, 0x2f, 0x99, 0x0d, 0x2b, 0x78, 0xaf, 0xa0, 0x7c, 0xc9, 0xdf, 0x61, 0x48, 0x3c,
+	0xa8, 0xf5, 0xd8, 0x30, 0xc4, 0x7e, 0x4f, 0x09, 0x16, 0x0e, 0x5d, 0xd0, 0x8c, 0xce, 0x6b, 0xc2,
+	0xa3, 0xb3, 0xe3, 0x66, 0x8b, 0xf7, 0x71, 0x19, 0x73, 0x42, 0x60, 0x45, 0xdb, 0x3a, 0x24, 0x66,
+	0xed, 0x79, 0xb0, 0x71, 0xd9, 0xbd, 0xbc, 0x68, 0x87, 0x82, 0x8f, 0x46, 0x63, 0x0c, 0x15, 0xd9,
+	0x82, 0xd2, 0x5b, 0xda, 0x71, 0x01, 0xf4, 0xd2, 0xfb, 0x14, 0xd6, 0x29, 0x06, 0xfc, 0x06, 0xc5,
+	0x4c, 0xfb, 0x48, 0x0d, 0xdd, 0x2c, 0xea, 0x85, 0x17, 0x25, 0x0d, 0xdd, 0x08, 0xde, 0x6f, 0xb0,
+	0xf9, 0x0b, 0x5e, 0x35, 0xa7, 0xea, 0x3a, 0xec, 0x4e, 0x14, 0xe3, 0xa1, 0x34, 0xa8, 0x50, 0x4a,
+	0xc6, 0x43, 0x73, 0xa8, 0x18, 0x55, 0x4a, 0x47, 0x76, 0x61, 0xfd, 0x62, 0x7a, 0x35, 0x62, 0xc1,
+	0x09, 0xce, 0x7e, 0xea, 0x75, 0xcf, 0x1d, 0xbc, 0xac, 0xd2, 0xfb, 0xbb, 0x00, 0x8f, 0xa3, 0xe8,
+	0x4d, 0xa5, 0x50, 0x2a, 0x5f, 0xa7, 0x58, 0x2a, 0xc3, 0x67, 0xb0, 0xd1, 0x1a, 0x31, 0x0c, 0xd5,
+	0x91, 0xaf, 0xfc, 0x38, 0x45, 0x8d, 0xce, 0x69, 0xc9, 0x97, 0xb0, 0x9d, 0x0a, 0xdd, 0xbd, 0xfa,
+	0x1d, 0x03, 0x65, 0x6e, 0xa7, 0x46, 0xf3, 0x1b, 0xde, 0x2e, 0x90, 0x08, 0x50, 0x4b, 0x60, 0x1f,
+	0x43, 0xc5, 0xfc, 0x51, 0xaa, 0x03, 0x6a, 0xba, 0x03, 0xbc, 0xff, 0x0a, 0xb0, 0x1d, 0xe3, 0x96,
+	0x12, 0xc5, 0xd2, 0xa8, 0x3d, 0xa8, 0x25, 0x71, 0x3b, 0x47, 0x0e, 0x73, 0x46, 0xb7, 0xe0, 0x64,
+	0xa5, 0x7b, 0x4f, 0x36, 0x55, 0xd7, 0xda, 0x2f, 0xf0, 0x15, 0x17, 0x7a, 0xa3, 0xbe, 0xe2, 0x4e,
+	0x36, 0xbf, 0x41, 0x9e, 0xc3, 0x9a, 0xee, 0x1b, 0x5f, 0x4d, 0x05, 0xd6, 0xcb, 0xc6, 0x2a, 0x51,
+	0x78, 0x33, 0xd8, 0xb6, 0xd1, 0x13, 0x24, 0x32, 0xd7, 0xf8, 0x3b, 0x50, 0xe9, 0x61, 0x20, 0x50,
+	0xb9, 0xdb, 0x74, 0x92, 0xee, 0x9c, 0x5e, 0xc0, 0x27, 0x18, 0x35, 0xbd, 0x11, 0xf4, 0x31, 0xba,
+	0x37, 0x28, 0x46, 0xfe, 0xa4, 0x87, 0x01, 0x0f, 0xfb, 0xd2, 0x60, 0x2b, 0xd1, 0x39, 0xad, 0xf7,
+	0x6f, 0x01, 0xd6, 0x9b, 0x17, 0x9d, 0x13, 0x9c, 0x51, 0xfc, 0x63, 0x8a, 0x52, 0x2d, 0xdb, 0xf6,
+	0xe7, 0xfe, 0x38, 0x6e, 0x7b, 0xbd, 0xbe, 0x07, 0xc7, 0x4b, 0xd8, 0x3c, 0x65, 0x03, 0x54, 0x6c,
+	0x8c, 0x59, 0x20, 0xf3, 0x6a, 0x7d, 0xbe, 0x0b, 0x81, 0x03, 0x76, 0x67, 0xea, 0xb3, 0x46, 0x9d,
+	0xe4, 0xfd, 0x59, 0x80, 0x8a, 0x45, 0xa8, 0xdf, 0xd1, 0x09, 0xce, 0xa2, 0x77, 0xa4, 0x35, 0x89,
+	0x53, 0x31, 0xed, 0x14, 0x03, 0x2c, 0x2d, 0x02, 0xb8, 0x92, 0x06, 0xb8, 0x05, 0xa5, 0x8e, 0xaf,
+	0x4c, 0xce, 0x12, 0xd5, 0x4b, 0xad, 0x69, 0xdf, 0x4d, 0xea, 0x15, 0xab, 0x69, 0xdf, 0x4d, 0xbc,
+	0x7d, 0x78, 0x64, 0x11, 0x48, 0xb2, 0x0b, 0x2b, 0xfa, 0x6b, 0x9e, 0x69, 0xf5, 0x60, 0x6b, 0x2f,
+	0x9a, 0x57, 0x7b, 0xae, 0x88, 0x66, 0xd7, 0x7b, 0x03, 0x55, 0x33, 0x7b, 0x5a, 0xd7, 0x7e, 0x38,
+	0x5c, 0x6e, 0x92, 0xc4, 0xb3, 0xab, 0x98, 0x9e, 0x5d, 0x5d, 0x58, 0x8f, 0xa6, 0x1b, 0x45, 0x89,
+	0xcb, 0xdd, 0xce, 0x03, 0x23, 0xd2, 0xbb, 0x85, 0xf5, 0xce, 0x78, 0xc2, 0x85, 0xfa, 0x90, 0xeb,
+	0xde, 0x81, 0xca, 0x31, 0x17, 0x63, 0x3f, 0x6e, 0x3d, 0x2b, 0xe9, 0x2a, 0x9b, 0xb6, 0xb7, 0x2f,
+	0xc4, 0xac, 0xb5, 0xed, 0x91, 0x98, 0xd1, 0x69, 0x68, 0xca, 0xbc, 0x4a, 0x9d, 0xe4, 0xfd, 0x55,
+	0x80, 0x5a, 0x94, 0x59, 0xff, 0x6a, 0x94, 0x56, 0xc6, 0xbe, 0x49, 0x5a, 0xa6, 0xb1, 0x6c, 0x12,
+	0xfa, 0x6c, 0x84, 0x16, 0x7f, 0x99, 0x3a, 0x89, 0x7c, 0x05, 0x95, 0xb6, 0x10, 0x5c, 0xc8, 0x7a,
+	0xc9, 0xd4, 0xff, 0xa3, 0xa4, 0xfe, 0xd6, 0xd7, 0xec, 0x52, 0x67, 0x74, 0x2f, 0x96, 0x0e, 0x54,
+	0x53, 0xe6, 0xfa, 0xc2, 0x29, 0xbf, 0x75, 0x20, 0xf4, 0xd2, 0xbd, 0xbd, 0x62, 0xfc, 0xf6, 0xea,
+	0xf0, 0xe8, 0x0c, 0xa5, 0xf4, 0x87, 0x51, 0x47, 0x45, 0xe2, 0xc1, 0x3f, 0x00, 0x55, 0xfd, 0xdc,
+	0x7b, 0x28, 0x6e, 0x58, 0xa0, 0xfb, 0xbd, 0x7c, 0xca, 0x87, 0x2c, 0x24, 0x1b, 0x09, 0x34, 0xcd,
+	0x63, 0x8d, 0xcd, 0x44, 0xb6, 0xc3, 0xe8, 0x15, 0xac, 0x52, 0x1c, 0x32, 0xa9, 0x34, 0xc9, 0xbd,
+	0xcf, 0xf8, 0x0b, 0xa8, 0x50, 0xbc, 0xe1, 0xef, 0x90, 0xcc, 0x6f, 0xe5, 0x6d, 0x3f, 0x87, 0x32,
+	0xc5, 0x10, 0x6f, 0x97, 0x30, 0xfd, 0x06, 0xc0, 0xd2, 0x94, 0x26, 0xac, 0xbc, 0x7d, 0x3d, 0xa5,
+	0xc8, 0x32, 0xda, 0x21, 0x54, 0x5b, 0x3c, 0x1c, 0x30, 0x31, 0x36, 0x9e, 0xdb, 0x89, 0xa1, 0x63,
+	0xcf, 0xc6, 0xd3, 0x44, 0x95, 0x65, 0xba, 0x7d, 0x58, 0xfb, 0x19, 0x05, 0x1b, 0xcc, 0xce, 0x8e,
+	0x9b, 0x8b, 0x1c, 0x73, 0x20, 0xdf, 0xc0, 0xb3, 0x1f, 0x70, 0xc8, 0xc2, 0x68, 0xe6, 0xdb, 0xaa,
+	0x09, 0x4b, 0x56, 0x39, 0xcc, 0xcf, 0x12, 0xc5, 0x3c, 0x75, 0xfe, 0x0a, 0x8d, 0x63, 0x16, 0x32,
+	0x79, 0xbd, 0x30, 0xd2, 0x27, 0x79, 0xc7, 0x14, 0x43, 0x35, 0x9e, 0xe7, 0xb7, 0x53, 0x1c, 0xf5,
+	0x3d, 0x90, 0x0c, 0xc6, 0xc5, 0x3d, 0xf0, 0x00, 0xb6, 0x16, 0x3c, 0xce, 0x62, 0xb3, 0x11, 0x3e,
+	0x5e, 0x00, 0x2a, 0xa2, 0xbc, 0x7c, 0xa5, 0xbe, 0x85, 0xaa, 0xe5, 0x91, 0x9c, 0x73, 0x8e, 0x5e,
+	0xf2, 0xce, 0xe7, 0x40, 0x28, 0x57, 0xbe, 0x42, 0x6b, 0xeb, 0xd8, 0xe5, 0xc1, 0x18, 0x0f, 0x6d,
+	0x92, 0x43, 0x43, 0xb6, 0xbe, 0x42, 0x37, 0xbc, 0x9f, 0xe6, 0x66, 0xa5, 0x9d, 0x40, 0x8d, 0xdc,
+	0x10, 0x25, 0x5f, 0x43, 0xf5, 0x94, 0x49, 0x15, 0xcd, 0xdc, 0xdc, 0x1d, 0x6f, 0xcf, 0x7b, 0x98,
+	0x6c, 0xf6, 0x81, 0x7c, 0x78, 0xb6, 0xd7, 0xb0, 0xd1, 0xbe, 0x0b, 0xcc, 0xa4, 0x8e, 0x78, 0x66,
+	0xde, 0x26, 0x5f, 0xad, 0x03, 0x58, 0xed, 0xa1, 0x32, 0x43, 0x9a, 0xa4, 0xa6, 0x50, 0x6a, 0xea,
+	0xe7, 0x7d, 0xf6, 0xa1, 0x6a, 0x3b, 0xdf, 0xba, 0xbd, 0xff, 0x79, 0x7e, 0x07, 0x4f, 0x1c, 0xec,
+	0x2c, 0x09, 0x2c, 0x9b, 0xf0, 0x50, 0xff, 0xcb, 0x94, 0x18, 0x7b, 0xa7, 0xab, 0x92, 0x89, 0xb8,
+	0x28, 0xb5, 0x1b, 0x91, 0xba, 0x71, 0x65, 0xda, 0x31, 0x43, 0x1f, 0x8d, 0x9d, 0xfc, 0x86, 0xfe,
+	0xbd, 0xaa, 0x18, 0xf5, 0xeb, 0xff, 0x07, 0x00, 0xbe, 0xee, 0x38, 0x74, 0xe2, 0x0b, 0x00, 0x00,
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConnInterface
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion6
+
+// AuthServiceClient is the client API for AuthService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type AuthServiceClient interface {
+	Login(ctx context.Context, in *User, opts ...grpc.CallOption) (*Token, error)
+	Register(ctx context.Context, in *User, opts ...grpc.CallOption) (*Token, error)
+	Revoke(ctx context.Context, in *Token, opts ...grpc.CallOption) (*Token, error)
+	Renew(ctx context.Context, in *Token, opts ...grpc.CallOption) (*Token, error)
+	EnrollTOTP(ctx context.Context, in *Token, opts ...grpc.CallOption) (*TOTPEnrollment, error)
+	ConfirmTOTP(ctx context.Context, in *MFACode, opts ...grpc.CallOption) (*RecoveryCodes, error)
+	VerifyMFA(ctx context.Context, in *MFACode, opts ...grpc.CallOption) (*Token, error)
+	BeginWebAuthnRegistration(ctx context.Context, in *Token, opts ...grpc.CallOption) (*WebAuthnOptions, error)
+	FinishWebAuthnRegistration(ctx context.Context, in *WebAuthnAttestation, opts ...grpc.CallOption) (*WebAuthnCredential, error)
+	BeginWebAuthnLogin(ctx context.Context, in *User, opts ...grpc.CallOption) (*WebAuthnOptions, error)
+	FinishWebAuthnLogin(ctx context.Context, in *WebAuthnAssertion, opts ...grpc.CallOption) (*Token, error)
+	ClientLogin(ctx context.Context, in *ClientCredentials, opts ...grpc.CallOption) (*Token, error)
+	RotateClientSecret(ctx context.Context, in *ClientCredentials, opts ...grpc.CallOption) (*ClientCredentials, error)
+	CreateAPIKey(ctx context.Context, in *APIKeyRequest, opts ...grpc.CallOption) (*APIKey, error)
+	ListAPIKeys(ctx context.Context, in *Token, opts ...grpc.CallOption) (*APIKeys, error)
+	RevokeAPIKey(ctx context.Context, in *APIKeyRequest, opts ...grpc.CallOption) (*APIKey, error)
+	ExchangeAPIKey(ctx context.Context, in *APIKey, opts ...grpc.CallOption) (*Token, error)
+	SetEmail(ctx context.Context, in *EmailChange, opts ...grpc.CallOption) (*Token, error)
+	VerifyEmail(ctx context.Context, in *Token, opts ...grpc.CallOption) (*Token, error)
+	RequestPasswordReset(ctx context.Context, in *EmailChange, opts ...grpc.CallOption) (*Token, error)
+	ResetPassword(ctx context.Context, in *PasswordReset, opts ...grpc.CallOption) (*Token, error)
+	ImportUsers(ctx context.Context, in *ImportRequest, opts ...grpc.CallOption) (*ImportReport, error)
+}
+
+type authServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewAuthServiceClient(cc grpc.ClientConnInterface) AuthServiceClient {
+	return &authServiceClient{cc}
+}
+
+func (c *authServiceClient) Login(ctx context.Context, in *User, opts ...grpc.CallOption) (*Token, error) {
+	out := new(Token)
+	err := c.cc.Invoke(ctx, "/protobuf.AuthService/Login", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *authServiceClient) Register(ctx context.Context, in *User, opts ...grpc.CallOption) (*Token, error) {
+	out := new(Token)
+	err := c.cc.Invoke(ctx, "/protobuf.AuthService/Register", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *authServiceClient) Revoke(ctx context.Context, in *Token, opts ...grpc.CallOption) (*Token, error) {
+	out := new(Token)
+	err := c.cc.Invoke(ctx, "/protobuf.AuthService/Revoke", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *authServiceClient) Renew(ctx context.Context, in *Token, opts ...grpc.CallOption) (*Token, error) {
+	out := new(Token)
+	err := c.cc.Invoke(ctx, "/protobuf.AuthService/Renew", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *authServiceClient) EnrollTOTP(ctx context.Context, in *Token, opts ...grpc.CallOption) (*TOTPEnrollment, error) {
+	out := new(TOTPEnrollment)
+	err := c.cc.Invoke(ctx, "/protobuf.AuthService/EnrollTOTP", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *authServiceClient) ConfirmTOTP(ctx context.Context, in *MFACode, opts ...grpc.CallOption) (*RecoveryCodes, error) {
+	out := new(RecoveryCodes)
+	err := c.cc.Invoke(ctx, "/protobuf.AuthService/ConfirmTOTP", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *authServiceClient) VerifyMFA(ctx context.Context, in *MFACode, opts ...grpc.CallOption) (*Token, error) {
+	out := new(Token)
+	err := c.cc.Invoke(ctx, "/protobuf.AuthService/VerifyMFA", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *authServiceClient) BeginWebAuthnRegistration(ctx context.Context, in *Token, opts ...grpc.CallOption) (*WebAuthnOptions, error) {
+	out := new(WebAuthnOptions)
+	err := c.cc.Invoke(ctx, "/protobuf.AuthService/BeginWebAuthnRegistration", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *authServiceClient) FinishWebAuthnRegistration(ctx context.Context, in *WebAuthnAttestation, opts ...grpc.CallOption) (*WebAuthnCredential, error) {
+	out := new(WebAuthnCredential)
+	err := c.cc.Invoke(ctx, "/protobuf.AuthService/FinishWebAuthnRegistration", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *authServiceClient) BeginWebAuthnLogin(ctx context.Context, in *User, opts ...grpc.CallOption) (*WebAuthnOptions, error) {
+	out := new(WebAuthnOptions)
+	err := c.cc.Invoke(ctx, "/protobuf.AuthService/BeginWebAuthnLogin", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *authServiceClient) FinishWebAuthnLogin(ctx context.Context, in *WebAuthnAssertion, opts ...grpc.CallOption) (*Token, error) {
+	out := new(Token)
+	err := c.cc.Invoke(ctx, "/protobuf.AuthService/FinishWebAuthnLogin", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *authServiceClient) ClientLogin(ctx context.Context, in *ClientCredentials, opts ...grpc.CallOption) (*Token, error) {
+	out := new(Token)
+	err := c.cc.Invoke(ctx, "/protobuf.AuthService/ClientLogin", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *authServiceClient) RotateClientSecret(ctx context.Context, in *ClientCredentials, opts ...grpc.CallOption) (*ClientCredentials, error) {
+	out := new(ClientCredentials)
+	err := c.cc.Invoke(ctx, "/protobuf.AuthService/RotateClientSecret", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *authServiceClient) CreateAPIKey(ctx context.Context, in *APIKeyRequest, opts ...grpc.CallOption) (*APIKey, error) {
+	out := new(APIKey)
+	err := c.cc.Invoke(ctx, "/protobuf.AuthService/CreateAPIKey", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *authServiceClient) ListAPIKeys(ctx context.Context, in *Token, opts ...grpc.CallOption) (*APIKeys, error) {
+	out := new(APIKeys)
+	err := c.cc.Invoke(ctx, "/protobuf.AuthService/ListAPIKeys", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *authServiceClient) RevokeAPIKey(ctx context.Context, in *APIKeyRequest, opts ...grpc.CallOption) (*APIKey, error) {
+	out := new(APIKey)
+	err := c.cc.Invoke(ctx, "/protobuf.AuthService/RevokeAPIKey", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *authServiceClient) ExchangeAPIKey(ctx context.Context, in *APIKey, opts ...grpc.CallOption) (*Token, error) {
+	out := new(Token)
+	err := c.cc.Invoke(ctx, "/protobuf.AuthService/ExchangeAPIKey", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *authServiceClient) SetEmail(ctx context.Context, in *EmailChange, opts ...grpc.CallOption) (*Token, error) {
+	out := new(Token)
+	err := c.cc.Invoke(ctx, "/protobuf.AuthService/SetEmail", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *authServiceClient) VerifyEmail(ctx context.Context, in *Token, opts ...grpc.CallOption) (*Token, error) {
+	out := new(Token)
+	err := c.cc.Invoke(ctx, "/protobuf.AuthService/VerifyEmail", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *authServiceClient) RequestPasswordReset(ctx context.Context, in *EmailChange, opts ...grpc.CallOption) (*Token, error) {
+	out := new(Token)
+	err := c.cc.Invoke(ctx, "/protobuf.AuthService/RequestPasswordReset", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *authServiceClient) ResetPassword(ctx context.Context, in *PasswordReset, opts ...grpc.CallOption) (*Token, error) {
+	out := new(Token)
+	err := c.cc.Invoke(ctx, "/protobuf.AuthService/ResetPassword", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *authServiceClient) ImportUsers(ctx context.Context, in *ImportRequest, opts ...grpc.CallOption) (*ImportReport, error) {
+	out := new(ImportReport)
+	err := c.cc.Invoke(ctx, "/protobuf.AuthService/ImportUsers", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// AuthServiceServer is the server API for AuthService service.
+type AuthServiceServer interface {
+	Login(context.Context, *User) (*Token, error)
+	Register(context.Context, *User) (*Token, error)
+	Revoke(context.Context, *Token) (*Token, error)
+	Renew(context.Context, *Token) (*Token, error)
+	EnrollTOTP(context.Context, *Token) (*TOTPEnrollment, error)
+	ConfirmTOTP(context.Context, *MFACode) (*RecoveryCodes, error)
+	VerifyMFA(context.Context, *MFACode) (*Token, error)
+	BeginWebAuthnRegistration(context.Context, *Token) (*WebAuthnOptions, error)
+	FinishWebAuthnRegistration(context.Context, *WebAuthnAttestation) (*WebAuthnCredential, error)
+	BeginWebAuthnLogin(context.Context, *User) (*WebAuthnOptions, error)
+	FinishWebAuthnLogin(context.Context, *WebAuthnAssertion) (*Token, error)
+	ClientLogin(context.Context, *ClientCredentials) (*Token, error)
+	RotateClientSecret(context.Context, *ClientCredentials) (*ClientCredentials, error)
+	CreateAPIKey(context.Context, *APIKeyRequest) (*APIKey, error)
+	ListAPIKeys(context.Context, *Token) (*APIKeys, error)
+	RevokeAPIKey(context.Context, *APIKeyRequest) (*APIKey, error)
+	ExchangeAPIKey(context.Context, *APIKey) (*Token, error)
+	SetEmail(context.Context, *EmailChange) (*Token, error)
+	VerifyEmail(context.Context, *Token) (*Token, error)
+	RequestPasswordReset(context.Context, *EmailChange) (*Token, error)
+	ResetPassword(context.Context, *PasswordReset) (*Token, error)
+	ImportUsers(context.Context, *ImportRequest) (*ImportReport, error)
+}
+
+// UnimplementedAuthServiceServer can be embedded to have forward compatible implementations.
+type UnimplementedAuthServiceServer struct {
+}
+
+func (*UnimplementedAuthServiceServer) Login(ctx context.Context, req *User) (*Token, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Login not implemented")
+}
+func (*UnimplementedAuthServiceServer) Register(ctx context.Context, req *User) (*Token, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Register not implemented")
+}
+func (*UnimplementedAuthServiceServer) Revoke(ctx context.Context, req *Token) (*Token, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Revoke not implemented")
+}
+func (*UnimplementedAuthServiceServer) Renew(ctx context.Context, req *Token) (*Token, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Renew not implemented")
+}
+func (*UnimplementedAuthServiceServer) EnrollTOTP(ctx context.Context, req *Token) (*TOTPEnrollment, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method EnrollTOTP not implemented")
+}
+func (*UnimplementedAuthServiceServer) ConfirmTOTP(ctx context.Context, req *MFACode) (*RecoveryCodes, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ConfirmTOTP not implemented")
+}
+func (*UnimplementedAuthServiceServer) VerifyMFA(ctx context.Context, req *MFACode) (*Token, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method VerifyMFA not implemented")
+}
+func (*UnimplementedAuthServiceServer) BeginWebAuthnRegistration(ctx context.Context, req *Token) (*WebAuthnOptions, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BeginWebAuthnRegistration not implemented")
+}
+func (*UnimplementedAuthServiceServer) FinishWebAuthnRegistration(ctx context.Context, req *WebAuthnAttestation) (*WebAuthnCredential, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method FinishWebAuthnRegistration not implemented")
+}
+func (*UnimplementedAuthServiceServer) BeginWebAuthnLogin(ctx context.Context, req *User) (*WebAuthnOptions, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BeginWebAuthnLogin not implemented")
+}
+func (*UnimplementedAuthServiceServer) FinishWebAuthnLogin(ctx context.Context, req *WebAuthnAssertion) (*Token, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method FinishWebAuthnLogin not implemented")
+}
+func (*UnimplementedAuthServiceServer) ClientLogin(ctx context.Context, req *ClientCredentials) (*Token, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ClientLogin not implemented")
+}
+func (*UnimplementedAuthServiceServer) RotateClientSecret(ctx context.Context, req *ClientCredentials) (*ClientCredentials, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RotateClientSecret not implemented")
+}
+func (*UnimplementedAuthServiceServer) CreateAPIKey(ctx context.Context, req *APIKeyRequest) (*APIKey, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateAPIKey not implemented")
+}
+func (*UnimplementedAuthServiceServer) ListAPIKeys(ctx context.Context, req *Token) (*APIKeys, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListAPIKeys not implemented")
+}
+func (*UnimplementedAuthServiceServer) RevokeAPIKey(ctx context.Context, req *APIKeyRequest) (*APIKey, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RevokeAPIKey not implemented")
+}
+func (*UnimplementedAuthServiceServer) ExchangeAPIKey(ctx context.Context, req *APIKey) (*Token, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ExchangeAPIKey not implemented")
+}
+func (*UnimplementedAuthServiceServer) SetEmail(ctx context.Context, req *EmailChange) (*Token, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetEmail not implemented")
+}
+func (*UnimplementedAuthServiceServer) VerifyEmail(ctx context.Context, req *Token) (*Token, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method VerifyEmail not implemented")
+}
+func (*UnimplementedAuthServiceServer) RequestPasswordReset(ctx context.Context, req *EmailChange) (*Token, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RequestPasswordReset not implemented")
+}
+func (*UnimplementedAuthServiceServer) ResetPassword(ctx context.Context, req *PasswordReset) (*Token, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ResetPassword not implemented")
+}
+func (*UnimplementedAuthServiceServer) ImportUsers(ctx context.Context, req *ImportRequest) (*ImportReport, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ImportUsers not implemented")
+}
+
+func RegisterAuthServiceServer(s *grpc.Server, srv AuthServiceServer) {
+	s.RegisterService(&_AuthService_serviceDesc, srv)
+}
+
+func _AuthService_Login_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(User)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuthServiceServer).Login(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/protobuf.AuthService/Login",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuthServiceServer).Login(ctx, req.(*User))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AuthService_Register_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(User)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuthServiceServer).Register(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/protobuf.AuthService/Register",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuthServiceServer).Register(ctx, req.(*User))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AuthService_Revoke_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Token)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuthServiceServer).Revoke(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/protobuf.AuthService/Revoke",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuthServiceServer).Revoke(ctx, req.(*Token))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AuthService_Renew_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Token)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuthServiceServer).Renew(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/protobuf.AuthService/Renew",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuthServiceServer).Renew(ctx, req.(*Token))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AuthService_EnrollTOTP_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Token)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuthServiceServer).EnrollTOTP(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/protobuf.AuthService/EnrollTOTP",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuthServiceServer).EnrollTOTP(ctx, req.(*Token))
+	}
+	return interceptor(ctx, in, info, handler)
 }
 
-// Reference imports to suppress errors if they are not otherwise used.
-var _ context.Context
-var _ grpc.ClientConnInterface
-
-// This is a compile-time assertion to ensure that this generated file
-// is compatible with the grpc package it is being compiled against.
-const _ = grpc.SupportPackageIsVersion6
-
-// AuthServiceClient is the client API for AuthService service.
-//
-// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
-type AuthServiceClient interface {
-	Login(ctx context.Context, in *User, opts ...grpc.CallOption) (*Token, error)
-	Register(ctx context.Context, in *User, opts ...grpc.CallOption) (*Token, error)
-	Revoke(ctx context.Context, in *Token, opts ...grpc.CallOption) (*Token, error)
-	Renew(ctx context.Context, in *Token, opts ...grpc.CallOption) (*Token, error)
+func _AuthService_ConfirmTOTP_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MFACode)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuthServiceServer).ConfirmTOTP(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/protobuf.AuthService/ConfirmTOTP",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuthServiceServer).ConfirmTOTP(ctx, req.(*MFACode))
+	}
+	return interceptor(ctx, in, info, handler)
 }
 
-type authServiceClient struct {
-	cc grpc.ClientConnInterface
+func _AuthService_VerifyMFA_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MFACode)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuthServiceServer).VerifyMFA(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/protobuf.AuthService/VerifyMFA",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuthServiceServer).VerifyMFA(ctx, req.(*MFACode))
+	}
+	return interceptor(ctx, in, info, handler)
 }
 
-func NewAuthServiceClient(cc grpc.ClientConnInterface) AuthServiceClient {
-	return &authServiceClient{cc}
+func _AuthService_BeginWebAuthnRegistration_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Token)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuthServiceServer).BeginWebAuthnRegistration(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/protobuf.AuthService/BeginWebAuthnRegistration",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuthServiceServer).BeginWebAuthnRegistration(ctx, req.(*Token))
+	}
+	return interceptor(ctx, in, info, handler)
 }
 
-func (c *authServiceClient) Login(ctx context.Context, in *User, opts ...grpc.CallOption) (*Token, error) {
-	out := new(Token)
-	err := c.cc.Invoke(ctx, "/protobuf.AuthService/Login", in, out, opts...)
-	if err != nil {
+func _AuthService_FinishWebAuthnRegistration_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(WebAuthnAttestation)
+	if err := dec(in); err != nil {
 		return nil, err
 	}
-	return out, nil
+	if interceptor == nil {
+		return srv.(AuthServiceServer).FinishWebAuthnRegistration(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/protobuf.AuthService/FinishWebAuthnRegistration",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuthServiceServer).FinishWebAuthnRegistration(ctx, req.(*WebAuthnAttestation))
+	}
+	return interceptor(ctx, in, info, handler)
 }
 
-func (c *authServiceClient) Register(ctx context.Context, in *User, opts ...grpc.CallOption) (*Token, error) {
-	out := new(Token)
-	err := c.cc.Invoke(ctx, "/protobuf.AuthService/Register", in, out, opts...)
-	if err != nil {
+func _AuthService_BeginWebAuthnLogin_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(User)
+	if err := dec(in); err != nil {
 		return nil, err
 	}
-	return out, nil
+	if interceptor == nil {
+		return srv.(AuthServiceServer).BeginWebAuthnLogin(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/protobuf.AuthService/BeginWebAuthnLogin",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuthServiceServer).BeginWebAuthnLogin(ctx, req.(*User))
+	}
+	return interceptor(ctx, in, info, handler)
 }
 
-func (c *authServiceClient) Revoke(ctx context.Context, in *Token, opts ...grpc.CallOption) (*Token, error) {
-	out := new(Token)
-	err := c.cc.Invoke(ctx, "/protobuf.AuthService/Revoke", in, out, opts...)
-	if err != nil {
+func _AuthService_FinishWebAuthnLogin_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(WebAuthnAssertion)
+	if err := dec(in); err != nil {
 		return nil, err
 	}
-	return out, nil
+	if interceptor == nil {
+		return srv.(AuthServiceServer).FinishWebAuthnLogin(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/protobuf.AuthService/FinishWebAuthnLogin",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuthServiceServer).FinishWebAuthnLogin(ctx, req.(*WebAuthnAssertion))
+	}
+	return interceptor(ctx, in, info, handler)
 }
 
-func (c *authServiceClient) Renew(ctx context.Context, in *Token, opts ...grpc.CallOption) (*Token, error) {
-	out := new(Token)
-	err := c.cc.Invoke(ctx, "/protobuf.AuthService/Renew", in, out, opts...)
-	if err != nil {
+func _AuthService_ClientLogin_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ClientCredentials)
+	if err := dec(in); err != nil {
 		return nil, err
 	}
-	return out, nil
+	if interceptor == nil {
+		return srv.(AuthServiceServer).ClientLogin(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/protobuf.AuthService/ClientLogin",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuthServiceServer).ClientLogin(ctx, req.(*ClientCredentials))
+	}
+	return interceptor(ctx, in, info, handler)
 }
 
-// AuthServiceServer is the server API for AuthService service.
-type AuthServiceServer interface {
-	Login(context.Context, *User) (*Token, error)
-	Register(context.Context, *User) (*Token, error)
-	Revoke(context.Context, *Token) (*Token, error)
-	Renew(context.Context, *Token) (*Token, error)
+func _AuthService_RotateClientSecret_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ClientCredentials)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuthServiceServer).RotateClientSecret(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/protobuf.AuthService/RotateClientSecret",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuthServiceServer).RotateClientSecret(ctx, req.(*ClientCredentials))
+	}
+	return interceptor(ctx, in, info, handler)
 }
 
-// UnimplementedAuthServiceServer can be embedded to have forward compatible implementations.
-type UnimplementedAuthServiceServer struct {
+func _AuthService_CreateAPIKey_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(APIKeyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuthServiceServer).CreateAPIKey(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/protobuf.AuthService/CreateAPIKey",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuthServiceServer).CreateAPIKey(ctx, req.(*APIKeyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
 }
 
-func (*UnimplementedAuthServiceServer) Login(ctx context.Context, req *User) (*Token, error) {
-	return nil, status.Errorf(codes.Unimplemented, "method Login not implemented")
-}
-func (*UnimplementedAuthServiceServer) Register(ctx context.Context, req *User) (*Token, error) {
-	return nil, status.Errorf(codes.Unimplemented, "method Register not implemented")
+func _AuthService_ListAPIKeys_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Token)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuthServiceServer).ListAPIKeys(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/protobuf.AuthService/ListAPIKeys",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuthServiceServer).ListAPIKeys(ctx, req.(*Token))
+	}
+	return interceptor(ctx, in, info, handler)
 }
-func (*UnimplementedAuthServiceServer) Revoke(ctx context.Context, req *Token) (*Token, error) {
-	return nil, status.Errorf(codes.Unimplemented, "method Revoke not implemented")
+
+func _AuthService_RevokeAPIKey_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(APIKeyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuthServiceServer).RevokeAPIKey(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/protobuf.AuthService/RevokeAPIKey",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuthServiceServer).RevokeAPIKey(ctx, req.(*APIKeyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
 }
-func (*UnimplementedAuthServiceServer) Renew(ctx context.Context, req *Token) (*Token, error) {
-	return nil, status.Errorf(codes.Unimplemented, "method Renew not implemented")
+
+func _AuthService_ExchangeAPIKey_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(APIKey)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuthServiceServer).ExchangeAPIKey(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/protobuf.AuthService/ExchangeAPIKey",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuthServiceServer).ExchangeAPIKey(ctx, req.(*APIKey))
+	}
+	return interceptor(ctx, in, info, handler)
 }
 
-func RegisterAuthServiceServer(s *grpc.Server, srv AuthServiceServer) {
-	s.RegisterService(&_AuthService_serviceDesc, srv)
+func _AuthService_SetEmail_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EmailChange)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuthServiceServer).SetEmail(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/protobuf.AuthService/SetEmail",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuthServiceServer).SetEmail(ctx, req.(*EmailChange))
+	}
+	return interceptor(ctx, in, info, handler)
 }
 
-func _AuthService_Login_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(User)
+func _AuthService_VerifyEmail_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Token)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(AuthServiceServer).Login(ctx, in)
+		return srv.(AuthServiceServer).VerifyEmail(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: "/protobuf.AuthService/Login",
+		FullMethod: "/protobuf.AuthService/VerifyEmail",
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(AuthServiceServer).Login(ctx, req.(*User))
+		return srv.(AuthServiceServer).VerifyEmail(ctx, req.(*Token))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
-func _AuthService_Register_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(User)
+func _AuthService_RequestPasswordReset_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EmailChange)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(AuthServiceServer).Register(ctx, in)
+		return srv.(AuthServiceServer).RequestPasswordReset(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: "/protobuf.AuthService/Register",
+		FullMethod: "/protobuf.AuthService/RequestPasswordReset",
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(AuthServiceServer).Register(ctx, req.(*User))
+		return srv.(AuthServiceServer).RequestPasswordReset(ctx, req.(*EmailChange))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
-func _AuthService_Revoke_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(Token)
+func _AuthService_ResetPassword_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PasswordReset)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(AuthServiceServer).Revoke(ctx, in)
+		return srv.(AuthServiceServer).ResetPassword(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: "/protobuf.AuthService/Revoke",
+		FullMethod: "/protobuf.AuthService/ResetPassword",
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(AuthServiceServer).Revoke(ctx, req.(*Token))
+		return srv.(AuthServiceServer).ResetPassword(ctx, req.(*PasswordReset))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
-func _AuthService_Renew_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(Token)
+func _AuthService_ImportUsers_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ImportRequest)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(AuthServiceServer).Renew(ctx, in)
+		return srv.(AuthServiceServer).ImportUsers(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: "/protobuf.AuthService/Renew",
+		FullMethod: "/protobuf.AuthService/ImportUsers",
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(AuthServiceServer).Renew(ctx, req.(*Token))
+		return srv.(AuthServiceServer).ImportUsers(ctx, req.(*ImportRequest))
 	}
 	return interceptor(ctx, in, info, handler)
 }
@@ -320,6 +1836,78 @@ var _AuthService_serviceDesc = grpc.ServiceDesc{
 			MethodName: "Renew",
 			Handler:    _AuthService_Renew_Handler,
 		},
+		{
+			MethodName: "EnrollTOTP",
+			Handler:    _AuthService_EnrollTOTP_Handler,
+		},
+		{
+			MethodName: "ConfirmTOTP",
+			Handler:    _AuthService_ConfirmTOTP_Handler,
+		},
+		{
+			MethodName: "VerifyMFA",
+			Handler:    _AuthService_VerifyMFA_Handler,
+		},
+		{
+			MethodName: "BeginWebAuthnRegistration",
+			Handler:    _AuthService_BeginWebAuthnRegistration_Handler,
+		},
+		{
+			MethodName: "FinishWebAuthnRegistration",
+			Handler:    _AuthService_FinishWebAuthnRegistration_Handler,
+		},
+		{
+			MethodName: "BeginWebAuthnLogin",
+			Handler:    _AuthService_BeginWebAuthnLogin_Handler,
+		},
+		{
+			MethodName: "FinishWebAuthnLogin",
+			Handler:    _AuthService_FinishWebAuthnLogin_Handler,
+		},
+		{
+			MethodName: "ClientLogin",
+			Handler:    _AuthService_ClientLogin_Handler,
+		},
+		{
+			MethodName: "RotateClientSecret",
+			Handler:    _AuthService_RotateClientSecret_Handler,
+		},
+		{
+			MethodName: "CreateAPIKey",
+			Handler:    _AuthService_CreateAPIKey_Handler,
+		},
+		{
+			MethodName: "ListAPIKeys",
+			Handler:    _AuthService_ListAPIKeys_Handler,
+		},
+		{
+			MethodName: "RevokeAPIKey",
+			Handler:    _AuthService_RevokeAPIKey_Handler,
+		},
+		{
+			MethodName: "ExchangeAPIKey",
+			Handler:    _AuthService_ExchangeAPIKey_Handler,
+		},
+		{
+			MethodName: "SetEmail",
+			Handler:    _AuthService_SetEmail_Handler,
+		},
+		{
+			MethodName: "VerifyEmail",
+			Handler:    _AuthService_VerifyEmail_Handler,
+		},
+		{
+			MethodName: "RequestPasswordReset",
+			Handler:    _AuthService_RequestPasswordReset_Handler,
+		},
+		{
+			MethodName: "ResetPassword",
+			Handler:    _AuthService_ResetPassword_Handler,
+		},
+		{
+			MethodName: "ImportUsers",
+			Handler:    _AuthService_ImportUsers_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "interface.proto",
@@ -1,17 +1,25 @@
 package main
 
 import (
+	"context"
 	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/x509"
+	"encoding/base64"
 	"encoding/pem"
 	"errors"
 	"fmt"
+	"math/big"
 
 	"github.com/dgrijalva/jwt-go"
 )
 
 var privateKey *rsa.PrivateKey
 
+// previousKey is the public part of the signing key replaced by the last rotation.
+// Tokens signed by it stay valid and it is published, so verifiers accept them until they expire.
+var previousKey *rsa.PublicKey
+
 func readRSAKEY(keyString string) (*rsa.PrivateKey, error) {
 	if keyString == "" {
 		return nil, errors.New("Empty RSAKEY")
@@ -32,14 +40,113 @@ func readRSAKEY(keyString string) (*rsa.PrivateKey, error) {
 	return key, nil
 }
 
-func signClaims(c *Claims) (string, error) {
-	return jwt.NewWithClaims(jwt.SigningMethodRS256, c).SignedString(privateKey)
+// encodeRSAKEY encodes the key as PEM in the format readRSAKEY accepts.
+func encodeRSAKEY(key *rsa.PrivateKey) string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}))
+}
+
+func signClaims(ctx context.Context, c *Claims) (string, error) {
+	signed, err := signJWT(ctx, c)
+
+	if err == nil && c != nil {
+		tokensIssued.WithLabelValues(tokenType(c)).Inc()
+	}
+
+	return signed, err
+}
+
+// signJWT signs arbitrary claims with the privateKey. The kid header names its JWK,
+// so verifiers pick the published key without trying each one.
+func signJWT(ctx context.Context, c jwt.Claims) (string, error) {
+	_, span := startSpan(ctx, "jwt.sign")
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, c)
+	token.Header["kid"] = publicJWK().Kid
+	signed, err := token.SignedString(privateKey)
+	endSpan(span, err)
+
+	return signed, err
+}
+
+// JWK is the JSON Web Key representation of the public part of the privateKey.
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N string `json:"n"`
+	E string `json:"e"`
+}
+
+func publicJWK() JWK {
+	return jwkOf(&privateKey.PublicKey)
+}
+
+// publishedJWKs returns the JWKs of the privateKey and, after a rotation, the previousKey.
+func publishedJWKs() []JWK {
+	if previousKey == nil {
+		return []JWK{publicJWK()}
+	}
+
+	return []JWK{publicJWK(), jwkOf(previousKey)}
+}
+
+func jwkOf(key *rsa.PublicKey) JWK {
+	n := base64.RawURLEncoding.EncodeToString(key.N.Bytes())
+	e := base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes())
+
+	// RFC 7638 thumbprint over the required members in lexicographic order
+	thumbprint := sha256.Sum256([]byte(fmt.Sprintf(`{"e":"%v","kty":"RSA","n":"%v"}`, e, n)))
+
+	return JWK{
+		Kty: "RSA",
+		Use: "sig",
+		Alg: "RS256",
+		Kid: base64.RawURLEncoding.EncodeToString(thumbprint[:]),
+		N: n,
+		E: e,
+	}
+}
+
+// verificationKey selects the key named by the kid of the token. Tokens without kid are checked with the privateKey.
+func verificationKey(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+		return nil, fmt.Errorf("Unexpected signing method '%v'", token.Header["alg"])
+	}
+
+	kid, ok := token.Header["kid"]
+
+	switch {
+	case !ok:
+		return &privateKey.PublicKey, nil
+	case kid == publicJWK().Kid:
+		return &privateKey.PublicKey, nil
+	case previousKey != nil && kid == jwkOf(previousKey).Kid:
+		return previousKey, nil
+	}
+
+	return nil, fmt.Errorf("Unknown key '%v'", kid)
 }
 
 func parse(signedString string) (*jwt.Token, *Claims, error) {
+	return parseTyped(signedString, "")
+}
+
+// parseTyped parses the signedString and fails if its Claims are not of the given typ.
+// This keeps e.g. mfa_required challenges from being used as regular tokens.
+func parseTyped(signedString string, typ string) (*jwt.Token, *Claims, error) {
 	claims := &Claims{}
-	keyFunc := func(token *jwt.Token) (interface{}, error) { return &privateKey.PublicKey, nil }
-	token, err := jwt.ParseWithClaims(signedString, claims, keyFunc)
+	token, err := jwt.ParseWithClaims(signedString, claims, verificationKey)
+
+	// Tokens issued before they carried a kid are tried with the previousKey after the signature did not match the privateKey
+	if validationErr, ok := err.(*jwt.ValidationError); ok && validationErr.Errors&jwt.ValidationErrorSignatureInvalid != 0 && previousKey != nil && token != nil && token.Header["kid"] == nil {
+		claims = &Claims{}
+		keyFunc := func(token *jwt.Token) (interface{}, error) { return previousKey, nil }
+		token, err = jwt.ParseWithClaims(signedString, claims, keyFunc)
+	}
+
+	if err == nil && claims.Typ != typ {
+		err = jwt.NewValidationError(fmt.Sprintf("Token type must be '%v'", typ), 5)
+	}
 
 	return token, claims, err
 }
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+var mfaKey []byte
+
+var errMFANotConfigured = errors.New("TOTP is not configured, set mfa_key")
+
+// Dependency for injection
+var randRead = rand.Read
+
+func readMFAKEY(keyString string) ([]byte, error) {
+	return readKey("MFAKEY", keyString)
+}
+
+// readKey decodes the base64 encoded 32 byte key of the setting name, e.g. the MFAKEY or the CSRF key.
+func readKey(name, keyString string) ([]byte, error) {
+	if keyString == "" {
+		return nil, fmt.Errorf("Empty %v", name)
+	}
+
+	key, err := base64.StdEncoding.DecodeString(keyString)
+
+	if err != nil {
+		return nil, fmt.Errorf("Unable to decode %v: %w", name, err)
+	}
+
+	if len(key) != 32 {
+		return nil, fmt.Errorf("%v must be 32 bytes but got %v", name, len(key))
+	}
+
+	return key, nil
+}
+
+func newGCM() (cipher.AEAD, error) {
+	if mfaKey == nil {
+		return nil, errMFANotConfigured
+	}
+
+	block, err := aes.NewCipher(mfaKey)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts plain with the MFAKEY. The random nonce is prepended to the result.
+func seal(plain []byte) ([]byte, error) {
+	gcm, err := newGCM()
+
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+
+	if _, err := randRead(nonce); err != nil {
+		return nil, err
+	}
+
+	return gcm.Seal(nonce, nonce, plain, nil), nil
+}
+
+func unseal(sealed []byte) ([]byte, error) {
+	gcm, err := newGCM()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("Sealed data is too short")
+	}
+
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+
+	return gcm.Open(nil, nonce, ciphertext, nil)
+}
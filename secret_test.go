@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+)
+
+func TestReadMFAKEY(T *testing.T) {
+	T.Run("Empty MFAKEY", func(t *testing.T) {
+		key, err := readMFAKEY("")
+		expected := "Empty MFAKEY"
+
+		if key != nil || err == nil || err.Error() != expected {
+			t.Errorf("MFAKEY setup failed! Expected '<nil>', '%v' got '%v', '%v'", expected, key, err)
+		}
+	})
+
+	T.Run("Undecodable MFAKEY", func(t *testing.T) {
+		key, err := readMFAKEY("!!!")
+
+		if key != nil || err == nil {
+			t.Errorf("MFAKEY setup failed! Expected '<nil>' and an error got '%v', '%v'", key, err)
+		}
+	})
+
+	T.Run("Short MFAKEY", func(t *testing.T) {
+		key, err := readMFAKEY(base64.StdEncoding.EncodeToString([]byte("short")))
+		expected := "MFAKEY must be 32 bytes but got 5"
+
+		if key != nil || err == nil || err.Error() != expected {
+			t.Errorf("MFAKEY setup failed! Expected '<nil>', '%v' got '%v', '%v'", expected, key, err)
+		}
+	})
+
+	T.Run("Valid MFAKEY", func(t *testing.T) {
+		key, err := readMFAKEY(base64.StdEncoding.EncodeToString(mfaKey))
+
+		if !bytes.Equal(key, mfaKey) || err != nil {
+			t.Errorf("MFAKEY setup failed! Expected error to be '<nil>' got '%v'", err)
+		}
+	})
+}
+
+func TestSealing(T *testing.T) {
+	expectations := map[string]bool{}
+	plain := []byte("SomeSecret")
+
+	sealed, err := seal(plain)
+	expectations["Nil error on seal"] = err == nil
+	expectations["Do not contain plain text"] = !bytes.Contains(sealed, plain)
+
+	unsealed, err := unseal(sealed)
+	expectations["Nil error on unseal"] = err == nil
+	expectations["Unseal to plain text"] = bytes.Equal(unsealed, plain)
+
+	sealed[len(sealed)-1] ^= 0xff
+	_, err = unseal(sealed)
+	expectations["Error on tampered data"] = err != nil
+
+	_, err = unseal([]byte("short"))
+	expectations["Error on short data"] = err != nil && err.Error() == "Sealed data is too short"
+
+	defer func(key []byte) { mfaKey = key }(mfaKey)
+	mfaKey = nil
+	_, err = seal(plain)
+	expectations["Error without key"] = err == errMFANotConfigured
+
+	CheckExpectations(expectations, T)
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/tooxoot/authservice/protobuf"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// authServer implements the AuthService on top of the session, MFA, WebAuthn, client, API key and email functions.
+// Methods taking a Token or SignedString of a user act on the session it belongs to.
+type authServer struct {
+	protobuf.UnimplementedAuthServiceServer
+}
+
+func (authServer) Login(ctx context.Context, in *protobuf.User) (*protobuf.Token, error) {
+	token, err := login(ctx, in.GetID(), in.GetPassword())
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &protobuf.Token{SignedString: token}, nil
+}
+
+func (authServer) Register(ctx context.Context, in *protobuf.User) (*protobuf.Token, error) {
+	token, err := register(ctx, in.GetID(), in.GetPassword())
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &protobuf.Token{SignedString: token}, nil
+}
+
+func (authServer) Revoke(ctx context.Context, in *protobuf.Token) (*protobuf.Token, error) {
+	if err := revoke(ctx, in.GetSignedString()); err != nil {
+		return nil, err
+	}
+
+	return &protobuf.Token{}, nil
+}
+
+func (authServer) Renew(ctx context.Context, in *protobuf.Token) (*protobuf.Token, error) {
+	token, err := renew(ctx, in.GetSignedString())
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &protobuf.Token{SignedString: token}, nil
+}
+
+func (authServer) EnrollTOTP(ctx context.Context, in *protobuf.Token) (*protobuf.TOTPEnrollment, error) {
+	ud, err := currentSession(ctx, in.GetSignedString())
+
+	if err != nil {
+		return nil, err
+	}
+
+	uri, err := enrollTOTP(ctx, ud.ID)
+
+	if err != nil {
+		return nil, statusOf(err, codes.FailedPrecondition, err.Error())
+	}
+
+	return &protobuf.TOTPEnrollment{URI: uri}, nil
+}
+
+func (authServer) ConfirmTOTP(ctx context.Context, in *protobuf.MFACode) (*protobuf.RecoveryCodes, error) {
+	ud, err := currentSession(ctx, in.GetSignedString())
+
+	if err != nil {
+		return nil, err
+	}
+
+	recoveryCodes, err := confirmTOTP(ctx, ud.ID, in.GetCode())
+
+	if err != nil {
+		return nil, statusOf(err, codes.InvalidArgument, err.Error())
+	}
+
+	return &protobuf.RecoveryCodes{Codes: recoveryCodes}, nil
+}
+
+func (authServer) VerifyMFA(ctx context.Context, in *protobuf.MFACode) (*protobuf.Token, error) {
+	token, err := verifyMFA(ctx, in.GetSignedString(), in.GetCode())
+
+	if err != nil {
+		return nil, statusOf(err, codes.Unauthenticated, "Invalid challenge or code")
+	}
+
+	return &protobuf.Token{SignedString: token}, nil
+}
+
+func (authServer) BeginWebAuthnRegistration(ctx context.Context, in *protobuf.Token) (*protobuf.WebAuthnOptions, error) {
+	ud, err := currentSession(ctx, in.GetSignedString())
+
+	if err != nil {
+		return nil, err
+	}
+
+	options, session, err := beginWebAuthnRegistration(ctx, ud.ID)
+
+	if err != nil {
+		return nil, statusOf(err, codes.Internal, "Unable to begin registration")
+	}
+
+	return webauthnOptions(options, session)
+}
+
+func (authServer) FinishWebAuthnRegistration(ctx context.Context, in *protobuf.WebAuthnAttestation) (*protobuf.WebAuthnCredential, error) {
+	id, err := finishWebAuthnRegistration(ctx, in.GetSessionToken(), in.GetClientDataJSON(), in.GetAttestationObject())
+
+	if err != nil {
+		return nil, statusOf(err, codes.InvalidArgument, err.Error())
+	}
+
+	return &protobuf.WebAuthnCredential{ID: id}, nil
+}
+
+func (authServer) BeginWebAuthnLogin(ctx context.Context, in *protobuf.User) (*protobuf.WebAuthnOptions, error) {
+	options, session, err := beginWebAuthnLogin(ctx, in.GetID())
+
+	if err != nil {
+		return nil, statusOf(err, codes.Unauthenticated, "Invalid ID or no WebAuthn credentials")
+	}
+
+	return webauthnOptions(options, session)
+}
+
+func (authServer) FinishWebAuthnLogin(ctx context.Context, in *protobuf.WebAuthnAssertion) (*protobuf.Token, error) {
+	token, err := finishWebAuthnLogin(ctx, in.GetSessionToken(), in.GetCredentialID(), in.GetClientDataJSON(), in.GetAuthenticatorData(), in.GetSignature())
+
+	if err != nil {
+		return nil, statusOf(err, codes.Unauthenticated, "Invalid assertion")
+	}
+
+	return &protobuf.Token{SignedString: token}, nil
+}
+
+// webauthnOptions returns the options as the JSON the browser passes to navigator.credentials.
+func webauthnOptions(options interface{}, session string) (*protobuf.WebAuthnOptions, error) {
+	publicKey, err := json.Marshal(options)
+
+	if err != nil {
+		return nil, status.Error(codes.Internal, "Unable to encode options")
+	}
+
+	return &protobuf.WebAuthnOptions{SessionToken: session, PublicKeyJSON: string(publicKey)}, nil
+}
+
+func (authServer) ClientLogin(ctx context.Context, in *protobuf.ClientCredentials) (*protobuf.Token, error) {
+	token, _, err := clientLogin(ctx, in.GetID(), in.GetSecret(), in.GetScope())
+
+	if err != nil {
+		return nil, statusOf(err, codes.Unauthenticated, err.Error())
+	}
+
+	return &protobuf.Token{SignedString: token}, nil
+}
+
+func (authServer) RotateClientSecret(ctx context.Context, in *protobuf.ClientCredentials) (*protobuf.ClientCredentials, error) {
+	overlap := time.Duration(in.GetOverlapSeconds()) * time.Second
+	secret, err := rotateClientSecret(ctx, in.GetID(), in.GetSecret(), overlap)
+
+	if err != nil {
+		return nil, statusOf(err, codes.Unauthenticated, err.Error())
+	}
+
+	return &protobuf.ClientCredentials{ID: in.GetID(), Secret: secret}, nil
+}
+
+func (authServer) CreateAPIKey(ctx context.Context, in *protobuf.APIKeyRequest) (*protobuf.APIKey, error) {
+	ud, err := currentSession(ctx, in.GetSignedString())
+
+	if err != nil {
+		return nil, err
+	}
+
+	lifetime := time.Duration(in.GetLifetimeSeconds()) * time.Second
+	key, apiKey, err := createAPIKey(ctx, ud.ID, in.GetName(), in.GetScope(), lifetime)
+
+	if err != nil {
+		return nil, statusOf(err, codes.InvalidArgument, err.Error())
+	}
+
+	out := apiKeyOf(apiKey)
+	out.Key = key
+
+	return out, nil
+}
+
+func (authServer) ListAPIKeys(ctx context.Context, in *protobuf.Token) (*protobuf.APIKeys, error) {
+	ud, err := currentSession(ctx, in.GetSignedString())
+
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := listAPIKeys(ctx, ud.ID)
+
+	if err != nil {
+		return nil, statusOf(err, codes.Internal, "Unable to list API keys")
+	}
+
+	out := &protobuf.APIKeys{}
+
+	for _, k := range keys {
+		out.Keys = append(out.Keys, apiKeyOf(k))
+	}
+
+	return out, nil
+}
+
+func (authServer) RevokeAPIKey(ctx context.Context, in *protobuf.APIKeyRequest) (*protobuf.APIKey, error) {
+	ud, err := currentSession(ctx, in.GetSignedString())
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := revokeAPIKey(ctx, ud.ID, in.GetPrefix()); err != nil {
+		return nil, statusOf(err, codes.NotFound, err.Error())
+	}
+
+	return &protobuf.APIKey{Prefix: in.GetPrefix()}, nil
+}
+
+func (authServer) ExchangeAPIKey(ctx context.Context, in *protobuf.APIKey) (*protobuf.Token, error) {
+	token, err := exchangeAPIKey(ctx, in.GetKey())
+
+	if err != nil {
+		return nil, statusOf(err, codes.Unauthenticated, "Invalid API key")
+	}
+
+	return &protobuf.Token{SignedString: token}, nil
+}
+
+// apiKeyOf returns the APIKey without its hash.
+func apiKeyOf(k *APIKey) *protobuf.APIKey {
+	return &protobuf.APIKey{Prefix: k.Prefix, Name: k.Name, Scope: k.Scope, Iat: k.Iat.Unix(), Exp: k.Exp.Unix()}
+}
+
+func (authServer) SetEmail(ctx context.Context, in *protobuf.EmailChange) (*protobuf.Token, error) {
+	ud, err := currentSession(ctx, in.GetSignedString())
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := setEmail(ctx, ud.ID, in.GetEmail()); err != nil {
+		return nil, statusOf(err, codes.InvalidArgument, err.Error())
+	}
+
+	return &protobuf.Token{}, nil
+}
+
+func (authServer) VerifyEmail(ctx context.Context, in *protobuf.Token) (*protobuf.Token, error) {
+	if err := verifyEmail(ctx, in.GetSignedString()); err != nil {
+		return nil, statusOf(err, codes.InvalidArgument, err.Error())
+	}
+
+	return &protobuf.Token{}, nil
+}
+
+func (authServer) RequestPasswordReset(ctx context.Context, in *protobuf.EmailChange) (*protobuf.Token, error) {
+	if err := requestPasswordReset(ctx, in.GetEmail()); err != nil {
+		return nil, statusOf(err, codes.InvalidArgument, err.Error())
+	}
+
+	return &protobuf.Token{}, nil
+}
+
+func (authServer) ResetPassword(ctx context.Context, in *protobuf.PasswordReset) (*protobuf.Token, error) {
+	if err := resetPassword(ctx, in.GetSignedString(), in.GetPassword()); err != nil {
+		return nil, statusOf(err, codes.InvalidArgument, err.Error())
+	}
+
+	return &protobuf.Token{}, nil
+}
+
+func (authServer) ImportUsers(ctx context.Context, in *protobuf.ImportRequest) (*protobuf.ImportReport, error) {
+	return importUsersRPC(ctx, in)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/tooxoot/authservice/protobuf"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// dialAuthService serves the newGRPCServer on a local port and returns a client of its AuthService.
+func dialAuthService(T *testing.T) (protobuf.AuthServiceClient, func()) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		T.Fatal(err)
+	}
+
+	server := newGRPCServer(nil)
+	go server.Serve(listener)
+
+	cc, err := grpc.Dial(listener.Addr().String(), grpc.WithInsecure())
+
+	if err != nil {
+		T.Fatal(err)
+	}
+
+	return protobuf.NewAuthServiceClient(cc), func() {
+		cc.Close()
+		server.Stop()
+	}
+}
+
+func TestAuthService(T *testing.T) {
+	store := injectOAuthStore()
+	client, stop := dialAuthService(T)
+	defer stop()
+
+	registered, registerErr := client.Register(testctx, &protobuf.User{ID: "OtherID", Password: "OtherPW"})
+	_, takenErr := client.Register(testctx, &protobuf.User{ID: "otherid", Password: "OtherPW"})
+	loggedIn, loginErr := client.Login(testctx, &protobuf.User{ID: "SomeID", Password: "SomePW"})
+	_, wrongErr := client.Login(testctx, &protobuf.User{ID: "SomeID", Password: "WrongPW"})
+
+	renewed, renewErr := client.Renew(testctx, loggedIn)
+	_, revokeErr := client.Revoke(testctx, renewed)
+	_, revokedErr := client.Renew(testctx, renewed)
+
+	_, keysErr := client.ListAPIKeys(testctx, registered)
+	_, enrollErr := client.EnrollTOTP(testctx, renewed)
+
+	expectations := map[string]bool{
+		"Register":                  registerErr == nil && registered.GetSignedString() != "",
+		"Reject taken ID":           status.Code(takenErr) == codes.AlreadyExists,
+		"Login":                     loginErr == nil && loggedIn.GetSignedString() != "",
+		"Reject wrong password":     status.Code(wrongErr) == codes.Unauthenticated,
+		"Renew":                     renewErr == nil && renewed.GetSignedString() != loggedIn.GetSignedString(),
+		"Revoke":                    revokeErr == nil && status.Code(revokedErr) == codes.Unauthenticated,
+		"Act on the session":        keysErr == nil,
+		"Require a current session": status.Code(enrollErr) == codes.Unauthenticated,
+		"Store registered user":     store.count(userKind) == 2,
+	}
+
+	CheckExpectations(expectations, T)
+}
+
+func TestAuthServiceClients(T *testing.T) {
+	store := injectOAuthStore()
+	client, stop := dialAuthService(T)
+	defer stop()
+
+	token, loginErr := client.ClientLogin(testctx, &protobuf.ClientCredentials{ID: "SomeService", Secret: "SomeServiceSecret", Scope: "SomeScope"})
+	_, wrongErr := client.ClientLogin(testctx, &protobuf.ClientCredentials{ID: "SomeService", Secret: "WrongSecret"})
+
+	rotated, rotateErr := client.RotateClientSecret(testctx, &protobuf.ClientCredentials{ID: "SomeService", Secret: "SomeServiceSecret", OverlapSeconds: 60})
+	_, oldErr := client.ClientLogin(testctx, &protobuf.ClientCredentials{ID: "SomeService", Secret: "SomeServiceSecret"})
+	now = func() time.Time { return testtime.Add(2 * time.Minute) }
+	_, expiredErr := client.ClientLogin(testctx, &protobuf.ClientCredentials{ID: "SomeService", Secret: "SomeServiceSecret"})
+	now = func() time.Time { return testtime }
+	_, newErr := client.ClientLogin(testctx, &protobuf.ClientCredentials{ID: "SomeService", Secret: rotated.GetSecret()})
+
+	_, importErr := client.ImportUsers(testctx, &protobuf.ImportRequest{SignedString: token.GetSignedString(), Format: "jsonl"})
+
+	expectations := map[string]bool{
+		"Login client":          loginErr == nil && token.GetSignedString() != "",
+		"Reject wrong secret":   status.Code(wrongErr) == codes.Unauthenticated,
+		"Rotate secret":         rotateErr == nil && rotated.GetID() == "SomeService" && rotated.GetSecret() != "",
+		"Keep old for overlap":  oldErr == nil,
+		"Expire old secret":     status.Code(expiredErr) == codes.Unauthenticated,
+		"Accept new secret":     newErr == nil,
+		"Require admin client":  status.Code(importErr) == codes.PermissionDenied,
+		"Replace stored client": store.count("CLIENT") == 3,
+	}
+
+	CheckExpectations(expectations, T)
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Each user has a single session. Its token is stored as UserData.Token and
+// a token is only accepted for revocation and renewal while it is the stored one.
+// Errors carry the gRPC status the AuthService responds with.
+
+// statusOf keeps the gRPC status of err, e.g. of an exceeded store deadline, and falls back to code and message.
+func statusOf(err error, code codes.Code, message string) error {
+	if _, ok := status.FromError(err); ok && err != nil {
+		return err
+	}
+
+	return status.Error(code, message)
+}
+
+// login checks the password and returns a token or an mfa_required challenge.
+func login(ctx context.Context, id, password string) (string, error) {
+	ud, err := readComplete(ctx, id)
+
+	if err != nil || !ud.compare(ctx, password) {
+		observeLogin("invalid_credentials")
+		return "", statusOf(err, codes.Unauthenticated, "Invalid ID or password")
+	}
+
+	token, err := issueToken(ctx, ud)
+
+	if err != nil {
+		return "", statusOf(err, codes.Internal, "Unable to issue token")
+	}
+
+	return token, nil
+}
+
+// register inserts a new user and logs it in.
+func register(ctx context.Context, id, password string) (string, error) {
+	if password == "" {
+		return "", status.Error(codes.InvalidArgument, "Empty password")
+	}
+
+	if _, err := canonicalID(id); err != nil {
+		return "", status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	exists, err := userExists(ctx, id)
+
+	if err != nil {
+		return "", statusOf(err, codes.Internal, "Unable to check ID")
+	}
+
+	if exists {
+		return "", status.Errorf(codes.AlreadyExists, "ID '%v' is already taken", id)
+	}
+
+	ud := NewUserData(ctx, id, password)
+
+	if ud == nil {
+		return "", status.Error(codes.Internal, "Unable to create user")
+	}
+
+	// Registered concurrently, e.g. on another instance
+	err = insertUser(ctx, ud)
+
+	if err == errAlreadyExists {
+		return "", status.Errorf(codes.AlreadyExists, "ID '%v' is already taken", id)
+	}
+
+	if err != nil {
+		return "", statusOf(err, codes.Internal, "Unable to create user")
+	}
+
+	token, err := completeLogin(ctx, ud)
+
+	if err != nil {
+		return "", statusOf(err, codes.Internal, "Unable to issue token")
+	}
+
+	return token, nil
+}
+
+// currentSession returns the UserData of the token if it is the user's stored token.
+func currentSession(ctx context.Context, token string) (*UserData, error) {
+	_, claims, err := parse(token)
+
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "Invalid token")
+	}
+
+	ud, err := readComplete(ctx, claims.ID)
+
+	if err != nil || ud.Token != token {
+		return nil, statusOf(err, codes.Unauthenticated, "Token was revoked")
+	}
+
+	return ud, nil
+}
+
+// validateSession checks like currentSession that the token is the user's stored token, but reads the user
+// through the userCache. Sessions revoked on other instances are rejected after userCacheTTL at the latest.
+// A token not matching the cached one is checked against the store, as it may have been issued by another instance.
+func validateSession(ctx context.Context, token string) (*Claims, error) {
+	_, claims, err := parse(token)
+
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "Invalid token")
+	}
+
+	cached, err := readCachedUser(ctx, claims.ID)
+
+	if err == nil && !cached.Disabled && !cached.hasToken(token) {
+		cached, err = refreshCachedUser(ctx, claims.ID)
+	}
+
+	if err != nil || cached.Disabled || !cached.hasToken(token) {
+		return nil, statusOf(err, codes.Unauthenticated, "Token was revoked")
+	}
+
+	return claims, nil
+}
+
+// revoke ends the session of the token.
+func revoke(ctx context.Context, token string) error {
+	ud, err := currentSession(ctx, token)
+
+	if err != nil {
+		return err
+	}
+
+	ud.Token = ""
+
+	if err := writeToDB(ctx, ud); err != nil {
+		return statusOf(err, codes.Internal, "Unable to revoke token")
+	}
+
+	return nil
+}
+
+// renew replaces the token of the session with a new one.
+func renew(ctx context.Context, token string) (string, error) {
+	ud, err := currentSession(ctx, token)
+
+	if err != nil {
+		return "", err
+	}
+
+	renewed, err := signClaims(ctx, NewClaims(ud.ID))
+
+	if err != nil {
+		return "", status.Error(codes.Internal, "Unable to issue token")
+	}
+
+	ud.Token = renewed
+
+	if err := writeToDB(ctx, ud); err != nil {
+		return "", statusOf(err, codes.Internal, "Unable to renew token")
+	}
+
+	tokenRenewals.Inc()
+
+	return renewed, nil
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"cloud.google.com/go/datastore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestLogin(T *testing.T) {
+	injectOAuthStore()
+
+	token, err := login(testctx, "SomeID", "SomePW")
+	ud, _ := readComplete(testctx, "SomeID")
+	_, claims, parseErr := parse(token)
+
+	_, wrongPW := login(testctx, "SomeID", "OtherPW")
+	_, unknown := login(testctx, "SomeUnknownID", "SomePW")
+
+	expectations := map[string]bool{
+		"Issue token":           err == nil && parseErr == nil && claims.ID == "SomeID",
+		"Store token":           ud.Token == token,
+		"Reject wrong password": status.Code(wrongPW) == codes.Unauthenticated,
+		"Reject unknown ID":     status.Code(unknown) == codes.Unauthenticated,
+	}
+
+	getAll = func(ctx context.Context, q *datastore.Query, dst interface{}) ([]*datastore.Key, error) {
+		return nil, context.DeadlineExceeded
+	}
+	_, timeout := login(testctx, "SomeID", "SomePW")
+	expectations["Keep store status"] = status.Code(timeout) == codes.DeadlineExceeded
+
+	CheckExpectations(expectations, T)
+}
+
+func TestRegister(T *testing.T) {
+	injectOAuthStore()
+
+	token, err := register(testctx, "OtherID", "OtherPW")
+	ud, readErr := readComplete(testctx, "otherid")
+
+	_, taken := register(testctx, "someid", "OtherPW")
+	_, emptyPW := register(testctx, "NewID", "")
+	_, invalidID := register(testctx, "", "OtherPW")
+
+	expectations := map[string]bool{
+		"Store user":            readErr == nil && ud.ID == "OtherID" && ud.compare(testctx, "OtherPW"),
+		"Issue token":           err == nil && ud.Token == token,
+		"Reject taken ID":       status.Code(taken) == codes.AlreadyExists,
+		"Reject empty password": status.Code(emptyPW) == codes.InvalidArgument,
+		"Reject invalid ID":     status.Code(invalidID) == codes.InvalidArgument,
+	}
+
+	store := injectOAuthStore()
+	memoryGetAll := getAll
+	getAll = func(ctx context.Context, q *datastore.Query, dst interface{}) ([]*datastore.Key, error) {
+		return nil, errors.New("Unavailable")
+	}
+	_, failed := register(testctx, "OtherID", "OtherPW")
+	getAll = memoryGetAll
+	expectations["Fail on store errors"] = status.Code(failed) == codes.Internal && len(store.entities) == 4
+
+	CheckExpectations(expectations, T)
+}
+
+func TestConcurrentRegister(T *testing.T) {
+	store := injectOAuthStore()
+
+	// Another registration of a like ID passes its checks and inserts first
+	var concurrentErr error
+	memoryInsert := insert
+	insert = func(ctx context.Context, key *datastore.Key, src interface{}) error {
+		insert = memoryInsert
+		_, concurrentErr = register(testctx, "otherid", "ConcurrentPW")
+		return insert(ctx, key, src)
+	}
+
+	_, err := register(testctx, "OtherID", "OtherPW")
+	ud, readErr := readComplete(testctx, "OtherID")
+	users := store.count(userKind)
+
+	store.add(&UserData{ID: "LegacyID", Hash: "LegacyHash"})
+	_, legacyErr := register(testctx, "legacyid", "OtherPW")
+
+	store.add(&migrationState{Name: canonicalIDsMigration, Done: true})
+	_, migratedErr := register(testctx, "NewID", "NewPW")
+
+	expectations := map[string]bool{
+		"Register first":         concurrentErr == nil && readErr == nil && ud.ID == "otherid",
+		"Reject second":          status.Code(err) == codes.AlreadyExists,
+		"Store once":             users == 2,
+		"Reject legacy like ID":  status.Code(legacyErr) == codes.AlreadyExists,
+		"Register after migrate": migratedErr == nil,
+		"Key by canonical ID":    store.index(datastore.NameKey(userKind, "newid", nil)) >= 0,
+	}
+
+	CheckExpectations(expectations, T)
+}
+
+func TestRenewAndRevoke(T *testing.T) {
+	store := injectOAuthStore()
+	token, _ := login(testctx, "SomeID", "SomePW")
+
+	renewed, err := renew(testctx, token)
+	ud, _ := readComplete(testctx, "SomeID")
+
+	_, reused := renew(testctx, token)
+	_, invalid := renew(testctx, "SomeInvalidToken")
+
+	expectations := map[string]bool{
+		"Renew token":                    err == nil && renewed != token && ud.Token == renewed,
+		"Reject replaced token":          status.Code(reused) == codes.Unauthenticated,
+		"Reject invalid token":           status.Code(invalid) == codes.Unauthenticated,
+		"Reject revoking replaced token": status.Code(revoke(testctx, token)) == codes.Unauthenticated,
+		"Revoke token":                   revoke(testctx, renewed) == nil && ud.Token == "",
+	}
+
+	_, revoked := renew(testctx, renewed)
+	stored, readErr := readTokenByID(testctx, "SomeID")
+	expectations["Reject revoked token"] = status.Code(revoked) == codes.Unauthenticated
+	expectations["Update the stored user"] = store.count("USER") == 1 && readErr == nil && stored.Token == ""
+
+	CheckExpectations(expectations, T)
+}
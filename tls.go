@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// Minimum interval between checks of the certificate files for changes.
+var tlsReloadInterval = 10 * time.Second
+
+// certReloader serves a key pair and an optional client CA bundle from disk.
+// The files are reloaded on handshakes after they changed, so certificates can be rotated without restart.
+type certReloader struct {
+	certFile     string
+	keyFile      string
+	clientCAFile string
+
+	mu        sync.RWMutex
+	config    *tls.Config
+	modTimes  []time.Time
+	checkedAt time.Time
+}
+
+// newCertReloader loads the key pair and, if clientCAFile is not empty, the client CA bundle.
+// With a client CA bundle every client has to present a certificate signed by one of the CAs.
+func newCertReloader(certFile, keyFile, clientCAFile string) (*certReloader, error) {
+	if certFile == "" || keyFile == "" {
+		return nil, errors.New("Certificate and key file are required for TLS")
+	}
+
+	r := &certReloader{certFile: certFile, keyFile: keyFile, clientCAFile: clientCAFile}
+
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *certReloader) files() []string {
+	if r.clientCAFile == "" {
+		return []string{r.certFile, r.keyFile}
+	}
+
+	return []string{r.certFile, r.keyFile, r.clientCAFile}
+}
+
+func (r *certReloader) stat() ([]time.Time, error) {
+	modTimes := []time.Time{}
+
+	for _, file := range r.files() {
+		info, err := os.Stat(file)
+
+		if err != nil {
+			return nil, err
+		}
+
+		modTimes = append(modTimes, info.ModTime())
+	}
+
+	return modTimes, nil
+}
+
+func (r *certReloader) reload() error {
+	modTimes, err := r.stat()
+
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+
+	if err != nil {
+		return fmt.Errorf("Unable to load key pair: %w", err)
+	}
+
+	config := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   []string{"h2"},
+	}
+
+	if r.clientCAFile != "" {
+		bundle, err := ioutil.ReadFile(r.clientCAFile)
+
+		if err != nil {
+			return err
+		}
+
+		config.ClientCAs = x509.NewCertPool()
+
+		if !config.ClientCAs.AppendCertsFromPEM(bundle) {
+			return fmt.Errorf("No certificates in client CA bundle '%v'", r.clientCAFile)
+		}
+
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	r.mu.Lock()
+	r.config = config
+	r.modTimes = modTimes
+	r.checkedAt = now()
+	r.mu.Unlock()
+
+	return nil
+}
+
+// maybeReload reloads the files if they changed since the last load.
+// The current configuration is kept if reloading fails.
+func (r *certReloader) maybeReload() {
+	r.mu.RLock()
+	due := now().Sub(r.checkedAt) >= tlsReloadInterval
+	loaded := r.modTimes
+	r.mu.RUnlock()
+
+	if !due {
+		return
+	}
+
+	modTimes, err := r.stat()
+	changed := err != nil
+
+	for i := 0; !changed && i < len(modTimes); i++ {
+		changed = !modTimes[i].Equal(loaded[i])
+	}
+
+	if !changed {
+		r.mu.Lock()
+		r.checkedAt = now()
+		r.mu.Unlock()
+		return
+	}
+
+	if err := r.reload(); err != nil {
+		log.Printf("Unable to reload TLS certificates: %v", err)
+
+		r.mu.Lock()
+		r.checkedAt = now()
+		r.mu.Unlock()
+	}
+}
+
+func (r *certReloader) getConfigForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	r.maybeReload()
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.config, nil
+}
+
+// TLSConfig returns a tls.Config resolving the current certificates on every handshake.
+func (r *certReloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		NextProtos:         []string{"h2"},
+		GetConfigForClient: r.getConfigForClient,
+	}
+}
+
+// serverCredentials returns gRPC transport credentials for the listener.
+func serverCredentials(certFile, keyFile, clientCAFile string) (credentials.TransportCredentials, error) {
+	r, err := newCertReloader(certFile, keyFile, clientCAFile)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return credentials.NewTLS(r.TLSConfig()), nil
+}
+
+// clientCertificate returns the verified certificate of an mTLS client from a gRPC context.
+func clientCertificate(ctx context.Context) (*x509.Certificate, bool) {
+	p, ok := peer.FromContext(ctx)
+
+	if !ok {
+		return nil, false
+	}
+
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+
+	if !ok {
+		return nil, false
+	}
+
+	return verifiedLeaf(&info.State)
+}
+
+// requestClientCertificate returns the verified certificate of an mTLS client of an HTTP request.
+func requestClientCertificate(r *http.Request) (*x509.Certificate, bool) {
+	return verifiedLeaf(r.TLS)
+}
+
+func verifiedLeaf(state *tls.ConnectionState) (*x509.Certificate, bool) {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil, false
+	}
+
+	return state.VerifiedChains[0][0], true
+}
+
+// clientSubject returns the subject of the client certificate, e.g. "CN=SomeService,O=tooxoot", for client-aware policies.
+func clientSubject(ctx context.Context) (string, bool) {
+	cert, ok := clientCertificate(ctx)
+
+	if !ok {
+		return "", false
+	}
+
+	return cert.Subject.String(), true
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// issueCert creates a certificate for the subject signed by the parent, or self-signed if parent is nil.
+func issueCert(T *testing.T, cn string, isCA bool, parent *x509.Certificate, parentKey *rsa.PrivateKey) (*x509.Certificate, *rsa.PrivateKey) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+
+	if err != nil {
+		T.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn, Organization: []string{"tooxoot"}},
+		DNSNames:              []string{"localhost"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+
+	if err != nil {
+		T.Fatal(err)
+	}
+
+	cert, _ := x509.ParseCertificate(der)
+
+	return cert, key
+}
+
+func writePEM(T *testing.T, path string, cert *x509.Certificate, key *rsa.PrivateKey) {
+	var block *pem.Block
+
+	if cert != nil {
+		block = &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}
+	} else {
+		block = &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}
+	}
+
+	if err := ioutil.WriteFile(path, pem.EncodeToMemory(block), 0600); err != nil {
+		T.Fatal(err)
+	}
+}
+
+// connect returns the server and client end of a loopback connection.
+// Unlike net.Pipe the connection is buffered, so handshakes do not block on unread messages.
+func connect(T *testing.T) (net.Conn, net.Conn) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		T.Fatal(err)
+	}
+
+	defer listener.Close()
+
+	client, err := net.Dial("tcp", listener.Addr().String())
+
+	if err != nil {
+		T.Fatal(err)
+	}
+
+	server, err := listener.Accept()
+
+	if err != nil {
+		T.Fatal(err)
+	}
+
+	return server, client
+}
+
+// handshake connects a client with the given certificates to a server using config.
+func handshake(T *testing.T, config *tls.Config, roots *x509.CertPool, clientCerts []tls.Certificate) (tls.ConnectionState, tls.ConnectionState, error) {
+	serverConn, clientConn := connect(T)
+	defer serverConn.Close()
+	defer clientConn.Close()
+
+	server := tls.Server(serverConn, config)
+	result := make(chan error, 1)
+
+	go func() { result <- server.Handshake() }()
+
+	client := tls.Client(clientConn, &tls.Config{RootCAs: roots, ServerName: "localhost", Certificates: clientCerts})
+	clientErr := client.Handshake()
+
+	if serverErr := <-result; serverErr != nil {
+		return tls.ConnectionState{}, tls.ConnectionState{}, serverErr
+	}
+
+	return server.ConnectionState(), client.ConnectionState(), clientErr
+}
+
+func TestTLS(T *testing.T) {
+	dir, _ := ioutil.TempDir("", "tls")
+	defer os.RemoveAll(dir)
+
+	ca, caKey := issueCert(T, "SomeCA", true, nil, nil)
+	serverCert, serverKey := issueCert(T, "localhost", false, ca, caKey)
+	clientCert, clientKey := issueCert(T, "SomeService", false, ca, caKey)
+	otherCA, otherCAKey := issueCert(T, "OtherCA", true, nil, nil)
+	otherClient, otherClientKey := issueCert(T, "OtherService", false, otherCA, otherCAKey)
+
+	certFile, keyFile, caFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"), filepath.Join(dir, "ca.pem")
+	writePEM(T, certFile, serverCert, nil)
+	writePEM(T, keyFile, nil, serverKey)
+	writePEM(T, caFile, ca, nil)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	client := []tls.Certificate{{Certificate: [][]byte{clientCert.Raw}, PrivateKey: clientKey}}
+	other := []tls.Certificate{{Certificate: [][]byte{otherClient.Raw}, PrivateKey: otherClientKey}}
+
+	plain, err := newCertReloader(certFile, keyFile, "")
+	_, _, plainErr := handshake(T, plain.TLSConfig(), roots, nil)
+
+	mutual, mutualErr := newCertReloader(certFile, keyFile, caFile)
+	state, _, clientErr := handshake(T, mutual.TLSConfig(), roots, client)
+	_, _, missingErr := handshake(T, mutual.TLSConfig(), roots, nil)
+	_, _, otherErr := handshake(T, mutual.TLSConfig(), roots, other)
+
+	ctx := peer.NewContext(testctx, &peer.Peer{AuthInfo: credentials.TLSInfo{State: state}})
+	subject, ok := clientSubject(ctx)
+	_, noPeer := clientSubject(testctx)
+
+	_, missingFiles := newCertReloader("", "", "")
+
+	expectations := map[string]bool{
+		"Serve TLS":                  err == nil && plainErr == nil,
+		"Accept trusted client":      mutualErr == nil && clientErr == nil,
+		"Reject missing client cert": missingErr != nil,
+		"Reject untrusted client":    otherErr != nil,
+		"Expose client subject":      ok && subject == "CN=SomeService,O=tooxoot",
+		"Require peer":               !noPeer,
+		"Require files":              missingFiles != nil,
+	}
+
+	CheckExpectations(expectations, T)
+}
+
+func TestTLSReload(T *testing.T) {
+	dir, _ := ioutil.TempDir("", "tls")
+	defer os.RemoveAll(dir)
+
+	ca, caKey := issueCert(T, "SomeCA", true, nil, nil)
+	first, firstKey := issueCert(T, "localhost", false, ca, caKey)
+	second, secondKey := issueCert(T, "localhost", false, ca, caKey)
+
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writePEM(T, certFile, first, nil)
+	writePEM(T, keyFile, nil, firstKey)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+
+	r, _ := newCertReloader(certFile, keyFile, "")
+	config := r.TLSConfig()
+	served := func() []byte {
+		_, state, err := handshake(T, config, roots, nil)
+
+		if err != nil {
+			return nil
+		}
+
+		return state.PeerCertificates[0].Raw
+	}
+
+	before := served()
+
+	writePEM(T, certFile, second, nil)
+	writePEM(T, keyFile, nil, secondKey)
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, later, later)
+	os.Chtimes(keyFile, later, later)
+
+	throttled := served()
+
+	now = func() time.Time { return testtime.Add(tlsReloadInterval) }
+	defer func() { now = func() time.Time { return testtime } }()
+
+	reloaded := served()
+
+	ioutil.WriteFile(certFile, []byte("Broken"), 0600)
+	os.Chtimes(certFile, later.Add(time.Minute), later.Add(time.Minute))
+	now = func() time.Time { return testtime.Add(2 * tlsReloadInterval) }
+
+	kept := served()
+
+	expectations := map[string]bool{
+		"Serve initial cert":      string(before) == string(first.Raw),
+		"Throttle file checks":    string(throttled) == string(first.Raw),
+		"Serve reloaded cert":     string(reloaded) == string(second.Raw),
+		"Keep cert on bad reload": string(kept) == string(second.Raw),
+	}
+
+	CheckExpectations(expectations, T)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+)
+
+const totpPeriod = 30
+const totpSkew = 1
+
+var base32NoPadding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+func newTOTPSecret() ([]byte, error) {
+	secret := make([]byte, 20)
+
+	if _, err := randRead(secret); err != nil {
+		return nil, err
+	}
+
+	return secret, nil
+}
+
+// totpURI returns the otpauth:// URI authenticator apps use to enroll the secret.
+func totpURI(id string, secret []byte) string {
+	query := url.Values{}
+	query.Set("secret", base32NoPadding.EncodeToString(secret))
+	query.Set("issuer", "tooxoot")
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", "6")
+	query.Set("period", fmt.Sprint(totpPeriod))
+
+	uri := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/tooxoot:" + id,
+		RawQuery: query.Encode(),
+	}
+
+	return uri.String()
+}
+
+// hotp computes the 6 digit RFC 4226 code for the given counter.
+func hotp(secret []byte, counter uint64) string {
+	message := make([]byte, 8)
+	binary.BigEndian.PutUint64(message, counter)
+
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(message)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	code := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%06d", code%1000000)
+}
+
+// validateTOTP checks the code against the current RFC 6238 time step
+// and totpSkew steps around it. Steps up to the last accepted one, if any, are rejected, so each code is only used once.
+// Returns the matching time step.
+func validateTOTP(secret []byte, code string, last int64) (int64, bool) {
+	if len(secret) == 0 || len(code) != 6 {
+		return 0, false
+	}
+
+	counter := now().Unix() / totpPeriod
+
+	for step := int64(-totpSkew); step <= totpSkew; step++ {
+		if last != 0 && counter+step <= last {
+			continue
+		}
+
+		expected := hotp(secret, uint64(counter+step))
+		if hmac.Equal([]byte(expected), []byte(code)) {
+			return counter + step, true
+		}
+	}
+
+	return 0, false
+}
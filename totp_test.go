@@ -0,0 +1,66 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// Test vectors from RFC 6238 Appendix B truncated to 6 digits
+var rfcSecret = []byte("12345678901234567890")
+var rfcVectors = map[int64]string{
+	59:         "287082",
+	1111111109: "081804",
+	1111111111: "050471",
+	1234567890: "005924",
+	2000000000: "279037",
+}
+
+func TestHOTP(T *testing.T) {
+	for unix, expected := range rfcVectors {
+		if result := hotp(rfcSecret, uint64(unix/totpPeriod)); result != expected {
+			T.Errorf("hotp failed! Expected '%v' got '%v' for time %v", expected, result, unix)
+		}
+	}
+}
+
+func TestValidateTOTP(T *testing.T) {
+	defer func() { now = func() time.Time { return testtime } }()
+
+	for unix, code := range rfcVectors {
+		expectations := map[string]bool{}
+
+		valid := func(secret []byte, code string, last int64) bool {
+			_, ok := validateTOTP(secret, code, last)
+			return ok
+		}
+		step := unix / totpPeriod
+
+		now = func() time.Time { return time.Unix(unix, 0) }
+		counter, ok := validateTOTP(rfcSecret, code, 0)
+		expectations["Accept current code"] = ok && counter == step
+
+		now = func() time.Time { return time.Unix(unix+totpPeriod, 0) }
+		expectations["Accept code of previous step"] = valid(rfcSecret, code, 0)
+
+		now = func() time.Time { return time.Unix(unix+3*totpPeriod, 0) }
+		expectations["Reject outdated code"] = !valid(rfcSecret, code, 0)
+
+		now = func() time.Time { return time.Unix(unix, 0) }
+		expectations["Reject used code"] = !valid(rfcSecret, code, step)
+		expectations["Reject code before used one"] = !valid(rfcSecret, code, step+1)
+		expectations["Reject wrong secret"] = !valid([]byte("SomeOtherSecret"), code, 0)
+		expectations["Reject empty secret"] = !valid(nil, code, 0)
+		expectations["Reject malformed code"] = !valid(rfcSecret, code+"0", 0)
+
+		CheckExpectations(expectations, T)
+	}
+}
+
+func TestTOTPURI(T *testing.T) {
+	result := totpURI("SomeID", rfcSecret)
+	expected := "otpauth://totp/tooxoot:SomeID?algorithm=SHA1&digits=6&issuer=tooxoot&period=30&secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+	if result != expected {
+		T.Errorf("totpURI failed! Expected '%v' got '%v'", expected, result)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const testTraceparent = "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"
+
+// injectSpanRecorder records all spans until the returned function restores the default provider.
+func injectSpanRecorder() (*tracetest.SpanRecorder, func()) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	original := tracerProvider
+
+	tracerProvider = func() trace.TracerProvider { return provider }
+
+	return recorder, func() { tracerProvider = original }
+}
+
+func spansByName(recorder *tracetest.SpanRecorder) map[string]sdktrace.ReadOnlySpan {
+	spans := map[string]sdktrace.ReadOnlySpan{}
+
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+
+	return spans
+}
+
+func TestTracingUnaryInterceptor(T *testing.T) {
+	injectOAuthStore()
+	recorder, restore := injectSpanRecorder()
+	defer restore()
+
+	ctx := metadata.NewIncomingContext(testctx, metadata.Pairs("traceparent", testTraceparent))
+	info := &grpc.UnaryServerInfo{FullMethod: "/AuthService/Login"}
+
+	tracingUnaryInterceptor(ctx, nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		ud, err := readComplete(ctx, "SomeID")
+
+		if err != nil || !ud.compare(ctx, "SomePW") {
+			T.Fatalf("Login failed with '%v'", err)
+		}
+
+		return completeLogin(ctx, ud)
+	})
+
+	spans := spansByName(recorder)
+	server := spans[info.FullMethod]
+
+	expectations := map[string]bool{
+		"Record server span":   server != nil && server.SpanKind() == trace.SpanKindServer,
+		"Continue trace":       server != nil && server.SpanContext().TraceID().String() == "0af7651916cd43dd8448eb211c80319c",
+		"Continue remote span": server != nil && server.Parent().SpanID().String() == "b7ad6b7169203331",
+	}
+
+	for _, name := range []string{"datastore.getAll", "bcrypt.compare", "jwt.sign", "datastore.put"} {
+		span := spans[name]
+		expectations["Record "+name+" as child"] = span != nil && server != nil && span.Parent().SpanID() == server.SpanContext().SpanID()
+	}
+
+	CheckExpectations(expectations, T)
+}
+
+func TestTracingHandler(T *testing.T) {
+	recorder, restore := injectSpanRecorder()
+	defer restore()
+
+	request := httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil)
+	request.Header.Set("traceparent", testTraceparent)
+	oauthHandler().ServeHTTP(httptest.NewRecorder(), request)
+
+	span := spansByName(recorder)["HTTP GET /.well-known/jwks.json"]
+
+	expectations := map[string]bool{
+		"Record server span":   span != nil && span.SpanKind() == trace.SpanKindServer,
+		"Continue trace":       span != nil && span.SpanContext().TraceID().String() == "0af7651916cd43dd8448eb211c80319c",
+		"Continue remote span": span != nil && span.Parent().SpanID().String() == "b7ad6b7169203331",
+	}
+
+	CheckExpectations(expectations, T)
+}
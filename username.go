@@ -0,0 +1,24 @@
+package main
+
+import (
+	"fmt"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/secure/precis"
+	"golang.org/x/text/unicode/norm"
+)
+
+var foldCase = cases.Fold()
+
+// canonicalID maps a user ID to the form used for lookups.
+// IDs which only differ in case or in compatibility characters like full width letters share one canonical ID.
+// Returns an error for IDs the PRECIS UsernameCaseMapped profile disallows, e.g. with spaces or control characters.
+func canonicalID(id string) (string, error) {
+	canonical, err := precis.UsernameCaseMapped.String(foldCase.String(norm.NFKC.String(id)))
+
+	if err != nil || canonical == "" {
+		return "", fmt.Errorf("Invalid ID '%v'", id)
+	}
+
+	return canonical, nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCanonicalID(T *testing.T) {
+	cases := map[string]string{
+		"alice":      "alice",
+		"Alice":      "alice",
+		"ALICE":      "alice",
+		"Ａｌｉｃｅ":      "alice",
+		"Straße":     "strasse",
+		"ﬁnn":        "finn",
+		"Αλέξανδρος": "αλέξανδροσ",
+	}
+
+	for id, expected := range cases {
+		if canonical, err := canonicalID(id); canonical != expected || err != nil {
+			T.Errorf("canonicalID failed for '%v'! Expected '%v' got '%v', '%v'", id, expected, canonical, err)
+		}
+	}
+
+	for _, id := range []string{"", "Some ID", "Some\tID", "Some\u0000ID", "​"} {
+		if canonical, err := canonicalID(id); canonical != "" || err == nil {
+			T.Errorf("canonicalID failed! Expected error for '%q' got '%v'", id, canonical)
+		}
+	}
+}
+
+func TestCaseInsensitiveLookup(T *testing.T) {
+	ud := NewUserData(testctx, "Alice", "SomePW")
+	legacy := &UserData{ID: "Bob"}
+	injectMemoryStore(ud)
+
+	expectations := map[string]bool{
+		"Find by other case":       func() bool { r, err := readComplete(testctx, "ALICE"); return r == ud && err == nil }(),
+		"Find by full width":       func() bool { r, err := readTokenByID(testctx, "Ａｌｉｃｅ"); return r == ud && err == nil }(),
+		"Preserve display ID":      ud.ID == "Alice",
+		"Backfill on write":        writeToDB(testctx, legacy) == nil && legacy.CanonicalID == "bob",
+		"Find backfilled UserData": func() bool { r, err := readComplete(testctx, "bob"); return r == legacy && err == nil }(),
+	}
+
+	_, err := readComplete(testctx, "Some ID")
+	expectations["Reject invalid ID"] = err != nil && err.Error() == "Invalid ID 'Some ID'"
+
+	CheckExpectations(expectations, T)
+}
+
+func TestLegacyLookup(T *testing.T) {
+	legacy := &UserData{ID: "Bob", Hash: "SomeHash"}
+	shadowed := &UserData{ID: "carol", Hash: "SomeHash"}
+	injectMemoryStore(legacy, shadowed, NewUserData(testctx, "Carol", "SomePW"), NewUserData(testctx, "Dave", "SomePW"), NewUserData(testctx, "dave", "SomePW"))
+
+	_, collisionErr := readComplete(testctx, "DAVE")
+	_, unknownErr := readComplete(testctx, "Unknown")
+
+	expectations := map[string]bool{
+		"Find legacy user by exact ID": func() bool { r, err := readComplete(testctx, "Bob"); return r == legacy && err == nil }(),
+		"Prefer exact legacy ID":       func() bool { r, err := readComplete(testctx, "carol"); return r == shadowed && err == nil }(),
+		"Find canonical user": func() bool {
+			r, err := readComplete(testctx, "CAROL")
+			return r != nil && r.ID == "Carol" && err == nil
+		}(),
+		"Report collisions":         errors.Is(collisionErr, errIDCollision) && strings.Contains(collisionErr.Error(), "matches 2 users"),
+		"Report unknown IDs":        errors.Is(unknownErr, errNotFound),
+		"Do not backfill taken IDs": writeToDB(testctx, shadowed) == nil && shadowed.CanonicalID == "",
+	}
+
+	CheckExpectations(expectations, T)
+}
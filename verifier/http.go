@@ -0,0 +1,72 @@
+package verifier
+
+import (
+	"net/http"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Middleware rejects requests without valid bearer token with 401 and puts the Claims into the request context.
+func (v *Verifier) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := bearerToken(r.Header.Get("Authorization"))
+
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="tooxoot"`)
+			http.Error(w, "Missing bearer token", http.StatusUnauthorized)
+			return
+		}
+
+		claims, err := v.VerifyContext(r.Context(), token)
+
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="tooxoot", error="invalid_token"`)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), claims)))
+	})
+}
+
+// ScopeHandler responds 403 unless the request's Claims carry the scope. It has to be wrapped by the Middleware.
+func ScopeHandler(scope string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if writeError(w, RequireScope(r.Context(), scope), `, error="insufficient_scope", scope="`+scope+`"`) {
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RoleHandler responds 403 unless the request's Claims carry the role. It has to be wrapped by the Middleware.
+func RoleHandler(role string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if writeError(w, RequireRole(r.Context(), role), "") {
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// writeError responds with the HTTP status of a RequireScope or RequireRole error. Returns false for nil.
+// The challenge is appended to the WWW-Authenticate header of 403 responses.
+func writeError(w http.ResponseWriter, err error, challenge string) bool {
+	if err == nil {
+		return false
+	}
+
+	if status.Code(err) == codes.Unauthenticated {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="tooxoot"`)
+		http.Error(w, status.Convert(err).Message(), http.StatusUnauthorized)
+		return true
+	}
+
+	w.Header().Set("WWW-Authenticate", `Bearer realm="tooxoot"`+challenge)
+	http.Error(w, status.Convert(err).Message(), http.StatusForbidden)
+
+	return true
+}
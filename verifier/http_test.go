@@ -0,0 +1,58 @@
+package verifier
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMiddleware(T *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := FromContext(r.Context())
+		w.Write([]byte(claims.ID))
+	})
+
+	mux := http.NewServeMux()
+	mux.Handle("/any", ok)
+	mux.Handle("/scoped", ScopeHandler("SomeScope", ok))
+	mux.Handle("/admin", RoleHandler("admin", ok))
+	handler := testVerifier().Middleware(mux)
+
+	serve := func(path, authorization string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodGet, path, nil)
+
+		if authorization != "" {
+			request.Header.Set("Authorization", authorization)
+		}
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+
+		return recorder
+	}
+
+	c := testClaims()
+	c.Scope = "SomeScope"
+	token := "Bearer " + sign(testKey, "", c)
+
+	valid := serve("/any", token)
+	scoped := serve("/scoped", token)
+	admin := serve("/admin", token)
+	missing := serve("/any", "")
+	invalid := serve("/any", "Bearer "+sign(otherKey, "", c))
+
+	expectations := map[string]bool{
+		"Put Claims in context": valid.Code == http.StatusOK && valid.Body.String() == "SomeID",
+		"Allow present scope":   scoped.Code == http.StatusOK,
+		"Deny missing role":     admin.Code == http.StatusForbidden,
+		"Reject missing token":  missing.Code == http.StatusUnauthorized && missing.Header().Get("WWW-Authenticate") != "",
+		"Reject invalid token":  invalid.Code == http.StatusUnauthorized && strings.Contains(invalid.Header().Get("WWW-Authenticate"), "invalid_token"),
+	}
+
+	c.Scope = "OtherScope"
+	unscoped := serve("/scoped", "Bearer "+sign(testKey, "", c))
+	expectations["Deny missing scope"] = unscoped.Code == http.StatusForbidden && strings.Contains(unscoped.Header().Get("WWW-Authenticate"), `scope="SomeScope"`)
+
+	checkExpectations(expectations, T)
+}
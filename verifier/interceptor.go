@@ -0,0 +1,127 @@
+package verifier
+
+import (
+	"context"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type claimsKey struct{}
+
+// NewContext returns a copy of ctx carrying the Claims.
+func NewContext(ctx context.Context, c *Claims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, c)
+}
+
+// FromContext returns the Claims put into ctx by the interceptors or the Middleware.
+func FromContext(ctx context.Context) (*Claims, bool) {
+	c, ok := ctx.Value(claimsKey{}).(*Claims)
+	return c, ok && c != nil
+}
+
+// bearerToken returns the token of an "authorization: Bearer <token>" header.
+func bearerToken(authorization string) (string, bool) {
+	if len(authorization) < len("Bearer ") || !strings.EqualFold(authorization[:len("Bearer ")], "Bearer ") {
+		return "", false
+	}
+
+	token := strings.TrimSpace(authorization[len("Bearer "):])
+
+	return token, token != ""
+}
+
+// authenticate verifies the bearer token of the incoming metadata and puts its Claims into ctx.
+func (v *Verifier) authenticate(ctx context.Context) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	authorization := md.Get("authorization")
+
+	if len(authorization) == 0 {
+		return nil, status.Error(codes.Unauthenticated, "Missing bearer token")
+	}
+
+	token, ok := bearerToken(authorization[0])
+
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "Missing bearer token")
+	}
+
+	claims, err := v.VerifyContext(ctx, token)
+
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	return NewContext(ctx, claims), nil
+}
+
+// UnaryServerInterceptor rejects RPCs without valid bearer token with Unauthenticated.
+func (v *Verifier) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := v.authenticate(ctx)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// authenticatedStream replaces the context of a stream with the authenticated one.
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
+
+// StreamServerInterceptor rejects streams without valid bearer token with Unauthenticated.
+func (v *Verifier) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := v.authenticate(ss.Context())
+
+		if err != nil {
+			return err
+		}
+
+		return handler(srv, &authenticatedStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// RequireScope fails with PermissionDenied unless the Claims in ctx carry the scope.
+// It fails with Unauthenticated if ctx carries no Claims.
+func RequireScope(ctx context.Context, scope string) error {
+	claims, ok := FromContext(ctx)
+
+	if !ok {
+		return status.Error(codes.Unauthenticated, "Missing claims")
+	}
+
+	if !claims.HasScope(scope) {
+		return status.Errorf(codes.PermissionDenied, "Scope '%v' is required", scope)
+	}
+
+	return nil
+}
+
+// RequireRole fails with PermissionDenied unless the Claims in ctx carry the role.
+// It fails with Unauthenticated if ctx carries no Claims.
+func RequireRole(ctx context.Context, role string) error {
+	claims, ok := FromContext(ctx)
+
+	if !ok {
+		return status.Error(codes.Unauthenticated, "Missing claims")
+	}
+
+	if !claims.HasRole(role) {
+		return status.Errorf(codes.PermissionDenied, "Role '%v' is required", role)
+	}
+
+	return nil
+}
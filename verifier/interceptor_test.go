@@ -0,0 +1,86 @@
+package verifier
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// incoming returns a context with the authorization metadata of an RPC.
+func incoming(authorization string) context.Context {
+	return metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", authorization))
+}
+
+func TestUnaryServerInterceptor(T *testing.T) {
+	interceptor := testVerifier().UnaryServerInterceptor()
+	info := &grpc.UnaryServerInfo{FullMethod: "/SomeService/SomeMethod"}
+
+	var received *Claims
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		received, _ = FromContext(ctx)
+		return "SomeResponse", nil
+	}
+
+	c := testClaims()
+	c.Scope = "SomeScope"
+	resp, err := interceptor(incoming("Bearer "+sign(testKey, "", c)), nil, info, handler)
+
+	expectations := map[string]bool{
+		"Call handler":           err == nil && resp == "SomeResponse",
+		"Put Claims in context":  received != nil && received.ID == "SomeID",
+		"Require present scope":  RequireScope(NewContext(context.Background(), received), "SomeScope") == nil,
+		"Deny missing scope":     status.Code(RequireScope(NewContext(context.Background(), received), "OtherScope")) == codes.PermissionDenied,
+		"Require present role":   RequireRole(NewContext(context.Background(), &Claims{Roles: []string{"SomeRole"}}), "SomeRole") == nil,
+		"Deny missing role":      status.Code(RequireRole(NewContext(context.Background(), received), "SomeRole")) == codes.PermissionDenied,
+		"Require authentication": status.Code(RequireScope(context.Background(), "SomeScope")) == codes.Unauthenticated,
+	}
+
+	for name, ctx := range map[string]context.Context{
+		"Missing metadata": context.Background(),
+		"Missing bearer":   incoming("Basic SomeCredentials"),
+		"Invalid token":    incoming("Bearer " + sign(otherKey, "", testClaims())),
+	} {
+		received = nil
+		_, err := interceptor(ctx, nil, info, handler)
+		expectations["Reject "+name] = status.Code(err) == codes.Unauthenticated && received == nil
+	}
+
+	checkExpectations(expectations, T)
+}
+
+type fakeServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *fakeServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func TestStreamServerInterceptor(T *testing.T) {
+	interceptor := testVerifier().StreamServerInterceptor()
+	info := &grpc.StreamServerInfo{FullMethod: "/SomeService/SomeStream"}
+
+	var received *Claims
+	handler := func(srv interface{}, stream grpc.ServerStream) error {
+		received, _ = FromContext(stream.Context())
+		return nil
+	}
+
+	err := interceptor(nil, &fakeServerStream{ctx: incoming("Bearer " + sign(testKey, "", testClaims()))}, info, handler)
+
+	expectations := map[string]bool{
+		"Call handler":          err == nil,
+		"Put Claims in context": received != nil && received.ID == "SomeID",
+	}
+
+	received = nil
+	err = interceptor(nil, &fakeServerStream{ctx: incoming("Bearer SomeInvalidToken")}, info, handler)
+	expectations["Reject invalid token"] = status.Code(err) == codes.Unauthenticated && received == nil
+
+	checkExpectations(expectations, T)
+}
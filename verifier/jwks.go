@@ -0,0 +1,200 @@
+package verifier
+
+import (
+	"context"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultRefreshInterval is the interval of background refreshes of a JWKSClient.
+const DefaultRefreshInterval = time.Hour
+
+// DefaultMinRefetchInterval limits on demand refetches of a JWKSClient on unknown keys.
+const DefaultMinRefetchInterval = time.Minute
+
+// DefaultFetchTimeout limits fetches of the JWK Set by the default HTTP client of a JWKSClient.
+const DefaultFetchTimeout = 10 * time.Second
+
+var defaultHTTPClient = &http.Client{Timeout: DefaultFetchTimeout}
+
+// JWKSClient is a KeySource caching the JWK Set served by the authservice.
+// Keys are refreshed in the background by Run and refetched on demand for unknown kids.
+type JWKSClient struct {
+	// URL of the JWK Set, e.g. https://auth.example.com/.well-known/jwks.json
+	URL string
+	// HTTPClient defaults to a client with DefaultFetchTimeout.
+	HTTPClient *http.Client
+	// RefreshInterval defaults to DefaultRefreshInterval.
+	RefreshInterval time.Duration
+	// MinRefetchInterval defaults to DefaultMinRefetchInterval.
+	MinRefetchInterval time.Duration
+
+	mu        sync.RWMutex
+	keys      KeySet
+	lastFetch time.Time
+	fetchMu   sync.Mutex
+}
+
+// NewJWKSClient creates a JWKSClient for the JWK Set at url. Keys are fetched on first use.
+func NewJWKSClient(url string) *JWKSClient {
+	return &JWKSClient{
+		URL:                url,
+		HTTPClient:         defaultHTTPClient,
+		RefreshInterval:    DefaultRefreshInterval,
+		MinRefetchInterval: DefaultMinRefetchInterval,
+	}
+}
+
+// Refresh fetches the JWK Set and replaces the cached keys.
+// The cached keys are kept if the fetch fails.
+func (c *JWKSClient) Refresh(ctx context.Context) error {
+	c.fetchMu.Lock()
+	defer c.fetchMu.Unlock()
+
+	return c.fetch(ctx)
+}
+
+func (c *JWKSClient) fetch(ctx context.Context) error {
+	c.mu.Lock()
+	c.lastFetch = time.Now()
+	c.mu.Unlock()
+
+	client := c.HTTPClient
+
+	if client == nil {
+		client = defaultHTTPClient
+	}
+
+	request, err := http.NewRequest(http.MethodGet, c.URL, nil)
+
+	if err != nil {
+		return err
+	}
+
+	response, err := client.Do(request.WithContext(ctx))
+
+	if err != nil {
+		return fmt.Errorf("Unable to fetch JWK Set: %w", err)
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("Unable to fetch JWK Set: %v", response.Status)
+	}
+
+	body, err := ioutil.ReadAll(response.Body)
+
+	if err != nil {
+		return fmt.Errorf("Unable to fetch JWK Set: %w", err)
+	}
+
+	keys, err := ParseJWKS(body)
+
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.keys = keys
+	c.mu.Unlock()
+
+	return nil
+}
+
+// refetch fetches the JWK Set unless it was fetched within the MinRefetchInterval.
+// Concurrent callers wait for a single fetch, which is bound to the ctx of the caller starting it.
+func (c *JWKSClient) refetch(ctx context.Context) {
+	c.fetchMu.Lock()
+	defer c.fetchMu.Unlock()
+
+	interval := c.MinRefetchInterval
+
+	if interval == 0 {
+		interval = DefaultMinRefetchInterval
+	}
+
+	c.mu.RLock()
+	recent := !c.lastFetch.IsZero() && time.Since(c.lastFetch) < interval
+	c.mu.RUnlock()
+
+	if recent {
+		return
+	}
+
+	if err := c.fetch(ctx); err != nil {
+		log.Printf("Unable to refetch JWK Set: %v", err)
+	}
+}
+
+// PublicKeys returns the cached keys for the kid like PublicKeysContext without a deadline
+// other than the timeout of the HTTPClient.
+func (c *JWKSClient) PublicKeys(kid string) ([]*rsa.PublicKey, error) {
+	return c.PublicKeysContext(context.Background(), kid)
+}
+
+// PublicKeysContext returns the cached keys for the kid. The JWK Set is refetched within ctx
+// if it was not fetched yet or the kid is unknown.
+func (c *JWKSClient) PublicKeysContext(ctx context.Context, kid string) ([]*rsa.PublicKey, error) {
+	c.mu.RLock()
+	keys := c.keys
+	c.mu.RUnlock()
+
+	if keys != nil {
+		if found, err := keys.PublicKeys(kid); err == nil {
+			return found, nil
+		}
+	}
+
+	c.refetch(ctx)
+
+	c.mu.RLock()
+	keys = c.keys
+	c.mu.RUnlock()
+
+	if keys == nil {
+		return nil, errors.New("JWK Set is unavailable")
+	}
+
+	return keys.PublicKeys(kid)
+}
+
+// Verify checks the token against the cached keys like Verifier.Verify without audience.
+// Rotated keys are picked up by the kid of the token, so invalid signatures do not cause refetches.
+func (c *JWKSClient) Verify(signedString string) (*Claims, error) {
+	return c.VerifyContext(context.Background(), signedString)
+}
+
+// VerifyContext works like Verify but refetches unknown keys within ctx.
+func (c *JWKSClient) VerifyContext(ctx context.Context, signedString string) (*Claims, error) {
+	return New(c).VerifyContext(ctx, signedString)
+}
+
+// Run refreshes the keys every RefreshInterval until ctx is done.
+func (c *JWKSClient) Run(ctx context.Context) {
+	interval := c.RefreshInterval
+
+	if interval == 0 {
+		interval = DefaultRefreshInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.Refresh(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("Unable to refresh JWK Set: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package verifier
+
+import (
+	"context"
+	"crypto/rsa"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// jwksServer serves the current keys and counts the requests.
+type jwksServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	keys     map[string]*rsa.PublicKey
+	requests int
+}
+
+func newJWKSServer(keys map[string]*rsa.PublicKey) *jwksServer {
+	s := &jwksServer{keys: keys}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		s.requests++
+		w.Write(jwks(s.keys))
+	}))
+
+	return s
+}
+
+func (s *jwksServer) rotate(keys map[string]*rsa.PublicKey) {
+	s.mu.Lock()
+	s.keys = keys
+	s.mu.Unlock()
+}
+
+func (s *jwksServer) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.requests
+}
+
+// verify checks the token like JWKSClient.Verify at testtime.
+func verify(client *JWKSClient, token string) error {
+	v := New(client)
+	v.Now = func() time.Time { return testtime }
+	_, err := v.Verify(token)
+
+	return err
+}
+
+func TestJWKSClient(T *testing.T) {
+	server := newJWKSServer(map[string]*rsa.PublicKey{"SomeKid": &testKey.PublicKey})
+	defer server.Close()
+
+	client := NewJWKSClient(server.URL)
+	client.MinRefetchInterval = time.Hour
+
+	expectations := map[string]bool{
+		"Fetch on first use": verify(client, sign(testKey, "SomeKid", testClaims())) == nil && server.count() == 1,
+		"Cache keys":         verify(client, sign(testKey, "SomeKid", testClaims())) == nil && server.count() == 1,
+	}
+
+	server.rotate(map[string]*rsa.PublicKey{"SomeKid": &testKey.PublicKey, "OtherKid": &otherKey.PublicKey})
+	expectations["Rate limit refetch"] = verify(client, sign(otherKey, "OtherKid", testClaims())) != nil && server.count() == 1
+
+	client.MinRefetchInterval = time.Nanosecond
+	expectations["Refetch unknown kid"] = verify(client, sign(otherKey, "OtherKid", testClaims())) == nil && server.count() == 2
+
+	client.MinRefetchInterval = time.Hour
+	expectations["Reject unknown kid"] = verify(client, sign(otherKey, "UnknownKid", testClaims())) != nil && server.count() == 2
+
+	_, err := client.Verify(sign(testKey, "SomeKid", testClaims()))
+	expectations["Reject expired token like parse"] = err != nil && err != ErrInvalidSignature
+
+	checkExpectations(expectations, T)
+}
+
+func TestJWKSClientVerifyWithoutKid(T *testing.T) {
+	server := newJWKSServer(map[string]*rsa.PublicKey{"SomeKid": &testKey.PublicKey})
+	defer server.Close()
+
+	client := NewJWKSClient(server.URL)
+	client.MinRefetchInterval = time.Nanosecond
+	claims := testClaims()
+	claims.Exp = time.Now().Add(time.Hour)
+	claims.Iat = time.Now()
+
+	_, err := client.Verify(sign(testKey, "", claims))
+
+	expectations := map[string]bool{
+		"Verify with cached key": err == nil && server.count() == 1,
+	}
+
+	server.rotate(map[string]*rsa.PublicKey{"OtherKid": &otherKey.PublicKey})
+	_, err = client.Verify(sign(otherKey, "", claims))
+	expectations["Do not refetch on invalid signature"] = err == ErrInvalidSignature && server.count() == 1
+
+	_, err = client.Verify(sign(otherKey, "OtherKid", claims))
+	expectations["Refetch rotated key by kid"] = err == nil && server.count() == 2
+
+	checkExpectations(expectations, T)
+}
+
+func TestJWKSClientContext(T *testing.T) {
+	server := newJWKSServer(map[string]*rsa.PublicKey{"SomeKid": &testKey.PublicKey})
+	defer server.Close()
+
+	client := NewJWKSClient(server.URL)
+	claims := testClaims()
+	claims.Exp = time.Now().Add(time.Hour)
+	claims.Iat = time.Now()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := client.VerifyContext(ctx, sign(testKey, "SomeKid", claims))
+
+	expectations := map[string]bool{
+		"Time out fetches":         client.HTTPClient.Timeout == DefaultFetchTimeout,
+		"Fetch within the context": err != nil && server.count() == 0,
+	}
+
+	checkExpectations(expectations, T)
+}
+
+func TestJWKSClientRun(T *testing.T) {
+	server := newJWKSServer(map[string]*rsa.PublicKey{"SomeKid": &testKey.PublicKey})
+	defer server.Close()
+
+	client := NewJWKSClient(server.URL)
+	client.RefreshInterval = time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		client.Run(ctx)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for server.count() < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+	<-done
+
+	keys, err := client.PublicKeys("SomeKid")
+
+	expectations := map[string]bool{
+		"Refresh in background": server.count() >= 2,
+		"Cache refreshed keys":  err == nil && len(keys) == 1,
+	}
+
+	checkExpectations(expectations, T)
+}
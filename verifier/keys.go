@@ -0,0 +1,122 @@
+package verifier
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// KeySource provides the public keys a token with the given kid may be signed with.
+// The kid is empty for tokens without kid header.
+type KeySource interface {
+	PublicKeys(kid string) ([]*rsa.PublicKey, error)
+}
+
+// ContextKeySource is a KeySource which fetches keys, e.g. over the network, within a context.
+// Verifiers prefer PublicKeysContext over PublicKeys.
+type ContextKeySource interface {
+	KeySource
+	PublicKeysContext(ctx context.Context, kid string) ([]*rsa.PublicKey, error)
+}
+
+// StaticKey is a KeySource of a single key, e.g. read from a PEM file.
+type StaticKey struct {
+	Key *rsa.PublicKey
+}
+
+// PublicKeys returns the static key for every kid.
+func (k StaticKey) PublicKeys(kid string) ([]*rsa.PublicKey, error) {
+	return []*rsa.PublicKey{k.Key}, nil
+}
+
+// KeySet is a KeySource of RSA keys by kid.
+type KeySet map[string]*rsa.PublicKey
+
+// PublicKeys returns the key with the kid or all keys if kid is empty.
+func (s KeySet) PublicKeys(kid string) ([]*rsa.PublicKey, error) {
+	if kid == "" {
+		keys := make([]*rsa.PublicKey, 0, len(s))
+
+		for _, key := range s {
+			keys = append(keys, key)
+		}
+
+		return keys, nil
+	}
+
+	key, ok := s[kid]
+
+	if !ok {
+		return nil, fmt.Errorf("Unknown kid '%v'", kid)
+	}
+
+	return []*rsa.PublicKey{key}, nil
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// ParseJWKS reads the RSA signing keys of a JWK Set as served under /.well-known/jwks.json.
+// Other keys are skipped.
+func ParseJWKS(data []byte) (KeySet, error) {
+	document := struct {
+		Keys []jwk `json:"keys"`
+	}{}
+
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("Unable to decode JWK Set: %w", err)
+	}
+
+	set := KeySet{}
+
+	for _, k := range document.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+
+		key, err := k.publicKey()
+
+		if err != nil {
+			return nil, fmt.Errorf("Invalid key '%v': %w", k.Kid, err)
+		}
+
+		set[k.Kid] = key
+	}
+
+	if len(set) == 0 {
+		return nil, errors.New("JWK Set contains no RSA signing key")
+	}
+
+	return set, nil
+}
+
+func (k jwk) publicKey() (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+
+	if err != nil {
+		return nil, err
+	}
+
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+
+	if err != nil {
+		return nil, err
+	}
+
+	exponent := new(big.Int).SetBytes(e)
+
+	if len(n) == 0 || !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+		return nil, errors.New("Invalid modulus or exponent")
+	}
+
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+}
@@ -0,0 +1,70 @@
+package verifier
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"testing"
+)
+
+// jwks renders the public keys like /.well-known/jwks.json of the authservice.
+func jwks(keys map[string]*rsa.PublicKey) []byte {
+	document := `{"keys":[`
+
+	i := 0
+	for kid, key := range keys {
+		if i > 0 {
+			document += ","
+		}
+
+		document += fmt.Sprintf(`{"kty":"RSA","use":"sig","alg":"RS256","kid":"%v","n":"%v","e":"%v"}`,
+			kid,
+			base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()))
+		i++
+	}
+
+	return []byte(document + `]}`)
+}
+
+func TestParseJWKS(T *testing.T) {
+	set, err := ParseJWKS(jwks(map[string]*rsa.PublicKey{"SomeKid": &testKey.PublicKey, "OtherKid": &otherKey.PublicKey}))
+
+	expectations := map[string]bool{
+		"Return nil error": err == nil,
+		"Read all keys":    len(set) == 2 && set["SomeKid"].N.Cmp(testKey.N) == 0 && set["SomeKid"].E == testKey.E,
+	}
+
+	keys, err := set.PublicKeys("OtherKid")
+	expectations["Select key by kid"] = err == nil && len(keys) == 1 && keys[0].N.Cmp(otherKey.N) == 0
+
+	keys, err = set.PublicKeys("")
+	expectations["Return all keys without kid"] = err == nil && len(keys) == 2
+
+	_, err = set.PublicKeys("UnknownKid")
+	expectations["Reject unknown kid"] = err != nil
+
+	v := testVerifier()
+	v.Keys = set
+	_, err = v.Verify(sign(otherKey, "OtherKid", testClaims()))
+	expectations["Verify by kid"] = err == nil
+
+	_, err = v.Verify(sign(otherKey, "", testClaims()))
+	expectations["Verify without kid"] = err == nil
+
+	_, err = v.Verify(sign(otherKey, "SomeKid", testClaims()))
+	expectations["Reject key of other kid"] = err != nil
+
+	for name, document := range map[string]string{
+		"Malformed JSON":  `{"keys":`,
+		"No RSA key":      `{"keys":[{"kty":"EC","kid":"SomeKid"}]}`,
+		"Invalid modulus": `{"keys":[{"kty":"RSA","kid":"SomeKid","n":"!","e":"AQAB"}]}`,
+		"Empty exponent":  `{"keys":[{"kty":"RSA","kid":"SomeKid","n":"AQAB","e":""}]}`,
+	} {
+		_, err := ParseJWKS([]byte(document))
+		expectations["Reject "+name] = err != nil
+	}
+
+	checkExpectations(expectations, T)
+}
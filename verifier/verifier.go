@@ -0,0 +1,198 @@
+// Package verifier checks tokens issued by the authservice in downstream services.
+// It mirrors the authservice's own parse semantics without access to its store.
+package verifier
+
+import (
+	"context"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// DefaultIssuer is the issuer of all tokens signed by the authservice.
+const DefaultIssuer = "tooxoot"
+
+// DefaultLeeway is the clock skew tolerated for exp and iat, matching the authservice.
+const DefaultLeeway = 5 * time.Minute
+
+const subjectClient = "client"
+
+// ErrInvalidSignature is returned for tokens not signed by any of the keys.
+var ErrInvalidSignature = errors.New("Invalid signature")
+
+// Claims mirror the claims of tokens signed by the authservice.
+type Claims struct {
+	Exp       time.Time `json:"exp"`
+	Iat       time.Time `json:"iat"`
+	ID        string    `json:"id"`
+	Iss       string    `json:"iss"`
+	Aud       string    `json:"aud,omitempty"`
+	Typ       string    `json:"typ,omitempty"`
+	Challenge string    `json:"challenge,omitempty"`
+	Scope     string    `json:"scope,omitempty"`
+	ClientID  string    `json:"client_id,omitempty"`
+	SubType   string    `json:"sub_type,omitempty"`
+	Jti       string    `json:"jti,omitempty"`
+	Roles     []string  `json:"roles,omitempty"`
+}
+
+// IsClient reports whether the subject of the Claims is a client instead of a user.
+func (c *Claims) IsClient() bool {
+	return c.SubType == subjectClient
+}
+
+// HasScope reports whether the space separated Scope contains scope.
+func (c *Claims) HasScope(scope string) bool {
+	for _, s := range strings.Fields(c.Scope) {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+// HasRole reports whether the Claims carry the role.
+func (c *Claims) HasRole(role string) bool {
+	for _, r := range c.Roles {
+		if r == role {
+			return true
+		}
+	}
+
+	return false
+}
+
+// tokenClaims lets jwt-go decode Claims. They are validated by the Verifier instead.
+type tokenClaims struct {
+	*Claims
+}
+
+func (tokenClaims) Valid() error {
+	return nil
+}
+
+// Verifier checks signature, issuer, audience and lifetime of tokens.
+type Verifier struct {
+	// Keys provides the public keys tokens may be signed with.
+	Keys KeySource
+	// Issuer defaults to DefaultIssuer.
+	Issuer string
+	// Audience is compared to the aud of access tokens, configured as access_token_audience of the authservice.
+	// Empty accepts all tokens.
+	Audience string
+	// Leeway defaults to DefaultLeeway.
+	Leeway time.Duration
+	// Now defaults to time.Now.
+	Now func() time.Time
+}
+
+// New creates a Verifier for tokens of the authservice signed with one of the keys.
+func New(keys KeySource) *Verifier {
+	return &Verifier{Keys: keys, Issuer: DefaultIssuer, Leeway: DefaultLeeway, Now: time.Now}
+}
+
+// Verify checks the token and returns its Claims.
+// Like the authservice's parse it rejects typed tokens such as mfa_required challenges.
+func (v *Verifier) Verify(signedString string) (*Claims, error) {
+	return v.VerifyContext(context.Background(), signedString)
+}
+
+// VerifyContext works like Verify but fetches keys of a ContextKeySource within ctx.
+func (v *Verifier) VerifyContext(ctx context.Context, signedString string) (*Claims, error) {
+	claims := &Claims{}
+	token, parts, err := new(jwt.Parser).ParseUnverified(signedString, &tokenClaims{claims})
+
+	if err != nil {
+		return nil, fmt.Errorf("Malformed token: %w", err)
+	}
+
+	if token.Method != jwt.SigningMethodRS256 {
+		return nil, fmt.Errorf("Unexpected signing method '%v'", token.Header["alg"])
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	keys, err := publicKeys(ctx, v.Keys, kid)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !verifySignature(parts, keys) {
+		return nil, ErrInvalidSignature
+	}
+
+	if err := v.validate(claims); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+func publicKeys(ctx context.Context, source KeySource, kid string) ([]*rsa.PublicKey, error) {
+	if contextSource, ok := source.(ContextKeySource); ok {
+		return contextSource.PublicKeysContext(ctx, kid)
+	}
+
+	return source.PublicKeys(kid)
+}
+
+func verifySignature(parts []string, keys []*rsa.PublicKey) bool {
+	signingString := strings.Join(parts[:2], ".")
+
+	for _, key := range keys {
+		if jwt.SigningMethodRS256.Verify(signingString, parts[2], key) == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (v *Verifier) validate(c *Claims) error {
+	issuer, leeway, now := v.Issuer, v.Leeway, time.Now
+
+	if issuer == "" {
+		issuer = DefaultIssuer
+	}
+
+	if leeway == 0 {
+		leeway = DefaultLeeway
+	}
+
+	if v.Now != nil {
+		now = v.Now
+	}
+
+	currentTime := now()
+
+	if c.Iss != issuer {
+		return fmt.Errorf("Issuer must be %v", issuer)
+	}
+
+	if c.Exp.Before(currentTime.Add(-leeway)) {
+		return errors.New("Token is expired")
+	}
+
+	if c.Iat.After(currentTime.Add(leeway)) {
+		return errors.New("Token is issued in the future")
+	}
+
+	if c.ID == "" {
+		return errors.New("Token's ID is empty")
+	}
+
+	if c.Typ != "" {
+		return fmt.Errorf("Token type '%v' is not accepted", c.Typ)
+	}
+
+	if v.Audience != "" && c.Aud != v.Audience {
+		return fmt.Errorf("Audience must be %v", v.Audience)
+	}
+
+	return nil
+}
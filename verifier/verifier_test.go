@@ -0,0 +1,119 @@
+package verifier
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+var testtime = time.Date(2020, 4, 1, 12, 0, 0, 0, time.UTC)
+
+var testKey, _ = rsa.GenerateKey(rand.Reader, 2048)
+var otherKey, _ = rsa.GenerateKey(rand.Reader, 2048)
+
+func checkExpectations(expectations map[string]bool, T *testing.T) {
+	T.Helper()
+
+	for name, fulfilled := range expectations {
+		if !fulfilled {
+			T.Errorf("Expectation failed: %s", name)
+		}
+	}
+}
+
+// testClaims are valid Claims of a user at testtime.
+func testClaims() *Claims {
+	return &Claims{
+		Exp: testtime.Add(time.Hour),
+		Iat: testtime,
+		ID:  "SomeID",
+		Iss: DefaultIssuer,
+		Jti: "SomeJTI",
+	}
+}
+
+// sign signs the Claims like the authservice with an optional kid header.
+func sign(key *rsa.PrivateKey, kid string, c *Claims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, tokenClaims{c})
+
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+
+	signed, _ := token.SignedString(key)
+
+	return signed
+}
+
+// testVerifier accepts tokens signed with testKey at testtime.
+func testVerifier() *Verifier {
+	v := New(StaticKey{&testKey.PublicKey})
+	v.Now = func() time.Time { return testtime }
+
+	return v
+}
+
+func TestVerify(T *testing.T) {
+	claims, err := testVerifier().Verify(sign(testKey, "", testClaims()))
+
+	expectations := map[string]bool{
+		"Return nil error": err == nil,
+		"Return Claims":    claims != nil && claims.ID == "SomeID" && claims.Jti == "SomeJTI" && claims.Exp.Equal(testtime.Add(time.Hour)),
+	}
+
+	failures := map[string]func(c *Claims){
+		"Wrong issuer":          func(c *Claims) { c.Iss = "SomeIssuer" },
+		"Expired":               func(c *Claims) { c.Exp = testtime.Add(-DefaultLeeway - time.Second) },
+		"Future":                func(c *Claims) { c.Iat = testtime.Add(DefaultLeeway + time.Second) },
+		"Empty ID":              func(c *Claims) { c.ID = "" },
+		"Typed token":           func(c *Claims) { c.Typ = "mfa_required" },
+		"Wrong audience":        func(c *Claims) { c.Aud = "OtherAPI" },
+		"Client ID as audience": func(c *Claims) { c.Aud, c.ClientID = "", "SomeAPI" },
+	}
+
+	audienceVerifier := testVerifier()
+	audienceVerifier.Audience = "SomeAPI"
+
+	for name, modify := range failures {
+		c := testClaims()
+		c.Aud = "SomeAPI"
+		modify(c)
+
+		_, err := audienceVerifier.Verify(sign(testKey, "", c))
+		expectations["Reject "+name] = err != nil
+	}
+
+	c := testClaims()
+	c.Exp = testtime.Add(-time.Minute)
+	_, err = testVerifier().Verify(sign(testKey, "", c))
+	expectations["Tolerate leeway"] = err == nil
+
+	_, err = testVerifier().Verify(sign(otherKey, "", testClaims()))
+	expectations["Reject other key"] = err != nil
+
+	_, err = testVerifier().Verify("SomeMalformedToken")
+	expectations["Reject malformed token"] = err != nil
+
+	hs256, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, tokenClaims{testClaims()}).SignedString([]byte("SomeSecret"))
+	_, err = testVerifier().Verify(hs256)
+	expectations["Reject other algorithm"] = err != nil
+
+	checkExpectations(expectations, T)
+}
+
+func TestClaimsHelpers(T *testing.T) {
+	claims := &Claims{Scope: "SomeScope OtherScope", Roles: []string{"SomeRole"}, SubType: subjectClient}
+
+	expectations := map[string]bool{
+		"Have scope":        claims.HasScope("OtherScope"),
+		"Lack scope":        !claims.HasScope("Some"),
+		"Have role":         claims.HasRole("SomeRole"),
+		"Lack role":         !claims.HasRole("OtherRole"),
+		"Recognize clients": claims.IsClient() && !(&Claims{}).IsClient(),
+	}
+
+	checkExpectations(expectations, T)
+}
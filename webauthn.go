@@ -0,0 +1,510 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+const webauthnRegistration = "webauthn_registration"
+const webauthnLogin = "webauthn_login"
+
+const coseAlgES256 = -7
+const coseAlgRS256 = -257
+
+const flagUserPresent = 0x01
+const flagUserVerified = 0x04
+const flagAttestedCredentialData = 0x40
+
+// Relying party the credentials are scoped to
+var webauthnRPID = "localhost"
+var webauthnOrigin = "https://localhost"
+
+// WebAuthnCredential is a public key credential registered by one of the user's authenticators.
+// PublicKey is kept in its COSE encoding.
+type WebAuthnCredential struct {
+	ID        []byte
+	PublicKey []byte `datastore:",noindex"`
+	SignCount int64  `datastore:",noindex"`
+}
+
+type relyingParty struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type webauthnUser struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+type credentialParameter struct {
+	Type string `json:"type"`
+	Alg  int64  `json:"alg"`
+}
+
+type credentialDescriptor struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+// creationOptions are passed to navigator.credentials.create() as publicKey.
+// Binary values are base64url encoded.
+type creationOptions struct {
+	Challenge          string                 `json:"challenge"`
+	RP                 relyingParty           `json:"rp"`
+	User               webauthnUser           `json:"user"`
+	PubKeyCredParams   []credentialParameter  `json:"pubKeyCredParams"`
+	Timeout            int                    `json:"timeout"`
+	Attestation        string                 `json:"attestation"`
+	ExcludeCredentials []credentialDescriptor `json:"excludeCredentials"`
+}
+
+// requestOptions are passed to navigator.credentials.get() as publicKey.
+// Binary values are base64url encoded.
+type requestOptions struct {
+	Challenge        string                 `json:"challenge"`
+	RPID             string                 `json:"rpId"`
+	Timeout          int                    `json:"timeout"`
+	AllowCredentials []credentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+type collectedClientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+type attestationObject struct {
+	Fmt      string          `cbor:"fmt"`
+	AttStmt  cbor.RawMessage `cbor:"attStmt"`
+	AuthData []byte          `cbor:"authData"`
+}
+
+type authenticatorData struct {
+	rpIDHash     []byte
+	flags        byte
+	signCount    uint32
+	credentialID []byte
+	publicKey    []byte
+}
+
+type coseKey struct {
+	Kty int64 `cbor:"1,keyasint"`
+	Alg int64 `cbor:"3,keyasint"`
+}
+
+type coseEC2Key struct {
+	Crv int64  `cbor:"-1,keyasint"`
+	X   []byte `cbor:"-2,keyasint"`
+	Y   []byte `cbor:"-3,keyasint"`
+}
+
+type coseRSAKey struct {
+	N []byte `cbor:"-1,keyasint"`
+	E []byte `cbor:"-2,keyasint"`
+}
+
+// newWebAuthnSession returns a random challenge along with a signed session token of the given typ carrying it.
+func newWebAuthnSession(ctx context.Context, id, typ string) (string, string, error) {
+	raw := make([]byte, 32)
+
+	if _, err := randRead(raw); err != nil {
+		return "", "", err
+	}
+
+	challenge := base64.RawURLEncoding.EncodeToString(raw)
+	claims := newChallengeClaims(id, typ)
+
+	if claims == nil {
+		return "", "", errors.New("empty id")
+	}
+
+	claims.Challenge = challenge
+	session, err := signClaims(ctx, claims)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	return challenge, session, nil
+}
+
+func (ud *UserData) credentialDescriptors() []credentialDescriptor {
+	descriptors := []credentialDescriptor{}
+
+	for _, credential := range ud.Credentials {
+		descriptors = append(descriptors, credentialDescriptor{
+			Type: "public-key",
+			ID:   base64.RawURLEncoding.EncodeToString(credential.ID),
+		})
+	}
+
+	return descriptors
+}
+
+// beginWebAuthnRegistration returns the creation options for a new credential of the user
+// and the session token which has to be passed to finishWebAuthnRegistration.
+func beginWebAuthnRegistration(ctx context.Context, id string) (*creationOptions, string, error) {
+	ud, err := readComplete(ctx, id)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	challenge, session, err := newWebAuthnSession(ctx, ud.ID, webauthnRegistration)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	userHandle := sha256.Sum256([]byte(ud.ID))
+
+	return &creationOptions{
+		Challenge: challenge,
+		RP:        relyingParty{ID: webauthnRPID, Name: "tooxoot"},
+		User: webauthnUser{
+			ID:          base64.RawURLEncoding.EncodeToString(userHandle[:]),
+			Name:        ud.ID,
+			DisplayName: ud.ID,
+		},
+		PubKeyCredParams: []credentialParameter{
+			{Type: "public-key", Alg: coseAlgES256},
+			{Type: "public-key", Alg: coseAlgRS256},
+		},
+		Timeout:            300000,
+		Attestation:        "none",
+		ExcludeCredentials: ud.credentialDescriptors(),
+	}, session, nil
+}
+
+// finishWebAuthnRegistration verifies the authenticator's response and stores the new credential.
+// Returns the id of the registered credential.
+func finishWebAuthnRegistration(ctx context.Context, session string, clientDataJSON, attestation []byte) ([]byte, error) {
+	_, claims, err := parseTyped(session, webauthnRegistration)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := verifyClientData(clientDataJSON, "webauthn.create", claims.Challenge); err != nil {
+		return nil, err
+	}
+
+	object := attestationObject{}
+
+	if err := cbor.Unmarshal(attestation, &object); err != nil {
+		return nil, fmt.Errorf("Unable to decode attestation object: %w", err)
+	}
+
+	if object.Fmt != "none" {
+		return nil, fmt.Errorf("Unsupported attestation format '%v'", object.Fmt)
+	}
+
+	data, err := parseAuthenticatorData(object.AuthData)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if data.flags&flagAttestedCredentialData == 0 {
+		return nil, errors.New("Missing attested credential data")
+	}
+
+	if _, _, err := parseCOSEKey(data.publicKey); err != nil {
+		return nil, err
+	}
+
+	if err := consumeWebAuthnSession(ctx, session, claims); err != nil {
+		return nil, err
+	}
+
+	ud, err := readComplete(ctx, claims.ID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if ud.credential(data.credentialID) != nil {
+		return nil, errors.New("Credential is already registered")
+	}
+
+	ud.Credentials = append(ud.Credentials, WebAuthnCredential{
+		ID:        data.credentialID,
+		PublicKey: data.publicKey,
+		SignCount: int64(data.signCount),
+	})
+
+	if err := writeToDB(ctx, ud); err != nil {
+		return nil, err
+	}
+
+	return data.credentialID, nil
+}
+
+// beginWebAuthnLogin returns the request options for the user's credentials
+// and the session token which has to be passed to finishWebAuthnLogin.
+func beginWebAuthnLogin(ctx context.Context, id string) (*requestOptions, string, error) {
+	ud, err := readComplete(ctx, id)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	if len(ud.Credentials) == 0 {
+		return nil, "", errors.New("No WebAuthn credentials registered")
+	}
+
+	challenge, session, err := newWebAuthnSession(ctx, ud.ID, webauthnLogin)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	return &requestOptions{
+		Challenge:        challenge,
+		RPID:             webauthnRPID,
+		Timeout:          300000,
+		AllowCredentials: ud.credentialDescriptors(),
+		UserVerification: "required",
+	}, session, nil
+}
+
+// finishWebAuthnLogin verifies the assertion of one of the user's credentials
+// and returns the same token as a password login.
+func finishWebAuthnLogin(ctx context.Context, session string, credentialID, clientDataJSON, rawAuthenticatorData, signature []byte) (string, error) {
+	_, claims, err := parseTyped(session, webauthnLogin)
+
+	if err != nil {
+		return "", err
+	}
+
+	if err := verifyClientData(clientDataJSON, "webauthn.get", claims.Challenge); err != nil {
+		return "", err
+	}
+
+	ud, err := readComplete(ctx, claims.ID)
+
+	if err != nil {
+		return "", err
+	}
+
+	credential := ud.credential(credentialID)
+
+	if credential == nil {
+		observeLogin("unknown_credential")
+		return "", errors.New("Unknown credential")
+	}
+
+	data, err := parseAuthenticatorData(rawAuthenticatorData)
+
+	if err != nil {
+		return "", err
+	}
+
+	// The credential is the only factor of the login, so presence alone is not enough
+	if data.flags&flagUserVerified == 0 {
+		return "", errors.New("User was not verified")
+	}
+
+	publicKey, alg, err := parseCOSEKey(credential.PublicKey)
+
+	if err != nil {
+		return "", err
+	}
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte{}, rawAuthenticatorData...), clientDataHash[:]...)
+
+	if err := verifySignature(publicKey, alg, signed, signature); err != nil {
+		observeLogin("invalid_signature")
+		return "", err
+	}
+
+	if (data.signCount != 0 || credential.SignCount != 0) && int64(data.signCount) <= credential.SignCount {
+		observeLogin("cloned_authenticator")
+		return "", errors.New("Sign count did not increase, the authenticator might be cloned")
+	}
+
+	if err := consumeWebAuthnSession(ctx, session, claims); err != nil {
+		return "", err
+	}
+
+	credential.SignCount = int64(data.signCount)
+
+	return finishLogin(ctx, ud)
+}
+
+// consumeWebAuthnSession marks the session token as used, so its challenge is answered once.
+// Authenticators without a sign count could otherwise replay an assertion until the session expires.
+func consumeWebAuthnSession(ctx context.Context, session string, claims *Claims) error {
+	err := consumeToken(ctx, session, claims.Exp)
+
+	if err == errAlreadyExists {
+		return errors.New("Challenge was already used")
+	}
+
+	return err
+}
+
+func (ud *UserData) credential(id []byte) *WebAuthnCredential {
+	for i := range ud.Credentials {
+		if bytes.Equal(ud.Credentials[i].ID, id) {
+			return &ud.Credentials[i]
+		}
+	}
+
+	return nil
+}
+
+func verifyClientData(clientDataJSON []byte, typ, challenge string) error {
+	clientData := collectedClientData{}
+
+	if err := json.Unmarshal(clientDataJSON, &clientData); err != nil {
+		return fmt.Errorf("Unable to decode client data: %w", err)
+	}
+
+	if clientData.Type != typ {
+		return fmt.Errorf("Client data type must be '%v'", typ)
+	}
+
+	if challenge == "" || clientData.Challenge != challenge {
+		return errors.New("Client data challenge does not match")
+	}
+
+	if clientData.Origin != webauthnOrigin {
+		return fmt.Errorf("Client data origin must be '%v'", webauthnOrigin)
+	}
+
+	return nil
+}
+
+// parseAuthenticatorData decodes raw authenticator data and checks the relying party and user presence.
+func parseAuthenticatorData(raw []byte) (*authenticatorData, error) {
+	if len(raw) < 37 {
+		return nil, errors.New("Authenticator data is too short")
+	}
+
+	data := &authenticatorData{
+		rpIDHash:  raw[:32],
+		flags:     raw[32],
+		signCount: binary.BigEndian.Uint32(raw[33:37]),
+	}
+
+	rpIDHash := sha256.Sum256([]byte(webauthnRPID))
+
+	if !bytes.Equal(data.rpIDHash, rpIDHash[:]) {
+		return nil, errors.New("Authenticator data is scoped to another relying party")
+	}
+
+	if data.flags&flagUserPresent == 0 {
+		return nil, errors.New("User was not present")
+	}
+
+	if data.flags&flagAttestedCredentialData == 0 {
+		return data, nil
+	}
+
+	// 16 byte AAGUID followed by the 2 byte credential id length
+	if len(raw) < 55 {
+		return nil, errors.New("Attested credential data is too short")
+	}
+
+	idLength := int(binary.BigEndian.Uint16(raw[53:55]))
+
+	if len(raw) < 55+idLength {
+		return nil, errors.New("Attested credential data is too short")
+	}
+
+	data.credentialID = raw[55 : 55+idLength]
+	rest := raw[55+idLength:]
+	decoder := cbor.NewDecoder(bytes.NewReader(rest))
+
+	if err := decoder.Decode(&cbor.RawMessage{}); err != nil {
+		return nil, fmt.Errorf("Unable to decode credential public key: %w", err)
+	}
+
+	data.publicKey = rest[:decoder.NumBytesRead()]
+
+	return data, nil
+}
+
+// parseCOSEKey decodes ES256 and RS256 public keys.
+func parseCOSEKey(raw []byte) (crypto.PublicKey, int64, error) {
+	key := coseKey{}
+
+	if err := cbor.Unmarshal(raw, &key); err != nil {
+		return nil, 0, fmt.Errorf("Unable to decode COSE key: %w", err)
+	}
+
+	switch {
+	case key.Kty == 2 && key.Alg == coseAlgES256:
+		ec2 := coseEC2Key{}
+
+		if err := cbor.Unmarshal(raw, &ec2); err != nil {
+			return nil, 0, fmt.Errorf("Unable to decode COSE key: %w", err)
+		}
+
+		x, y := new(big.Int).SetBytes(ec2.X), new(big.Int).SetBytes(ec2.Y)
+
+		if ec2.Crv != 1 || !elliptic.P256().IsOnCurve(x, y) {
+			return nil, 0, errors.New("Invalid P-256 key")
+		}
+
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, key.Alg, nil
+	case key.Kty == 3 && key.Alg == coseAlgRS256:
+		rsaKey := coseRSAKey{}
+
+		if err := cbor.Unmarshal(raw, &rsaKey); err != nil {
+			return nil, 0, fmt.Errorf("Unable to decode COSE key: %w", err)
+		}
+
+		e := new(big.Int).SetBytes(rsaKey.E)
+
+		if len(rsaKey.N) == 0 || !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+			return nil, 0, errors.New("Invalid RSA key")
+		}
+
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(rsaKey.N), E: int(e.Int64())}, key.Alg, nil
+	}
+
+	return nil, 0, fmt.Errorf("Unsupported COSE key type %v with algorithm %v", key.Kty, key.Alg)
+}
+
+func verifySignature(publicKey crypto.PublicKey, alg int64, signed, signature []byte) error {
+	digest := sha256.Sum256(signed)
+
+	switch key := publicKey.(type) {
+	case *ecdsa.PublicKey:
+		sig := struct{ R, S *big.Int }{}
+
+		if _, err := asn1.Unmarshal(signature, &sig); err != nil || !ecdsa.Verify(key, digest[:], sig.R, sig.S) {
+			return errors.New("Invalid signature")
+		}
+
+		return nil
+	case *rsa.PublicKey:
+		if rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) != nil {
+			return errors.New("Invalid signature")
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("Unsupported algorithm %v", alg)
+}
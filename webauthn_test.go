@@ -0,0 +1,312 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// Authenticators encode CBOR in CTAP2 canonical form
+var ctap2, _ = cbor.CTAP2EncOptions().EncMode()
+
+// softAuthenticator is a software ES256 authenticator producing "none" attestations
+type softAuthenticator struct {
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	signCount    uint32
+	rpID         string
+	origin       string
+}
+
+func newSoftAuthenticator() *softAuthenticator {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	credentialID := make([]byte, 16)
+	rand.Read(credentialID)
+
+	return &softAuthenticator{key: key, credentialID: credentialID, rpID: webauthnRPID, origin: webauthnOrigin}
+}
+
+func (a *softAuthenticator) cosePublicKey() []byte {
+	key, _ := ctap2.Marshal(map[int]interface{}{
+		1:  2,
+		3:  coseAlgES256,
+		-1: 1,
+		-2: coordinate(a.key.X),
+		-3: coordinate(a.key.Y),
+	})
+
+	return key
+}
+
+// coordinate pads a P-256 coordinate to 32 bytes
+func coordinate(i *big.Int) []byte {
+	padded := make([]byte, 32)
+	raw := i.Bytes()
+	copy(padded[32-len(raw):], raw)
+
+	return padded
+}
+
+func (a *softAuthenticator) authenticatorData(attested bool) []byte {
+	rpIDHash := sha256.Sum256([]byte(a.rpID))
+	data := append([]byte{}, rpIDHash[:]...)
+	counter := make([]byte, 4)
+	binary.BigEndian.PutUint32(counter, a.signCount)
+
+	if !attested {
+		return append(append(data, flagUserPresent|flagUserVerified), counter...)
+	}
+
+	data = append(append(data, flagUserPresent|flagAttestedCredentialData), counter...)
+	data = append(data, make([]byte, 16)...)
+	idLength := make([]byte, 2)
+	binary.BigEndian.PutUint16(idLength, uint16(len(a.credentialID)))
+	data = append(append(data, idLength...), a.credentialID...)
+
+	return append(data, a.cosePublicKey()...)
+}
+
+func (a *softAuthenticator) clientData(typ, challenge string) []byte {
+	clientDataJSON, _ := json.Marshal(collectedClientData{Type: typ, Challenge: challenge, Origin: a.origin})
+	return clientDataJSON
+}
+
+func (a *softAuthenticator) create(challenge string) ([]byte, []byte) {
+	attestation, _ := ctap2.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": a.authenticatorData(true),
+	})
+
+	return a.clientData("webauthn.create", challenge), attestation
+}
+
+func (a *softAuthenticator) get(challenge string) ([]byte, []byte, []byte) {
+	a.signCount++
+	clientDataJSON := a.clientData("webauthn.get", challenge)
+	authData := a.authenticatorData(false)
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	r, s, _ := ecdsa.Sign(rand.Reader, a.key, digest[:])
+	signature, _ := asn1.Marshal(struct{ R, S *big.Int }{r, s})
+
+	return clientDataJSON, authData, signature
+}
+
+// registeredAuthenticator registers a new softAuthenticator for the given UserData
+func registeredAuthenticator(T *testing.T, ud *UserData) *softAuthenticator {
+	injectUserData(ud, map[string]bool{})
+	authenticator := newSoftAuthenticator()
+
+	options, session, err := beginWebAuthnRegistration(testctx, ud.ID)
+	if err != nil {
+		T.Fatalf("beginWebAuthnRegistration failed with Error: %v", err)
+	}
+
+	clientDataJSON, attestation := authenticator.create(options.Challenge)
+
+	if _, err := finishWebAuthnRegistration(testctx, session, clientDataJSON, attestation); err != nil {
+		T.Fatalf("finishWebAuthnRegistration failed with Error: %v", err)
+	}
+
+	return authenticator
+}
+
+func TestWebAuthnRegistration(T *testing.T) {
+	T.Run("Valid registration", func(t *testing.T) {
+		expectations := map[string]bool{}
+		ud := &UserData{ID: "SomeID"}
+		injectUserData(ud, expectations)
+		authenticator := newSoftAuthenticator()
+
+		options, session, err := beginWebAuthnRegistration(testctx, "SomeID")
+		expectations["Nil error on begin"] = err == nil
+		expectations["Use configured relying party"] = options.RP.ID == webauthnRPID
+		expectations["Request no attestation"] = options.Attestation == "none"
+		expectations["Do not expose id as user handle"] = options.User.ID != "SomeID" && options.User.Name == "SomeID"
+
+		clientDataJSON, attestation := authenticator.create(options.Challenge)
+		credentialID, err := finishWebAuthnRegistration(testctx, session, clientDataJSON, attestation)
+
+		expectations["Nil error on finish"] = err == nil
+		expectations["Return credential id"] = string(credentialID) == string(authenticator.credentialID)
+		expectations["Store credential"] = len(ud.Credentials) == 1 && string(ud.Credentials[0].PublicKey) == string(authenticator.cosePublicKey())
+
+		options, _, _ = beginWebAuthnRegistration(testctx, "SomeID")
+		expectations["Exclude registered credentials"] = len(options.ExcludeCredentials) == 1
+
+		CheckExpectations(expectations, t)
+	})
+
+	T.Run("Invalid responses", func(t *testing.T) {
+		ud := &UserData{ID: "SomeID"}
+		injectUserData(ud, map[string]bool{})
+		options, session, _ := beginWebAuthnRegistration(testctx, "SomeID")
+		loginSession, _ := signClaims(testctx, newChallengeClaims("SomeID", webauthnLogin))
+
+		foreignOrigin := newSoftAuthenticator()
+		foreignOrigin.origin = "https://evil.example"
+		foreignRP := newSoftAuthenticator()
+		foreignRP.rpID = "evil.example"
+
+		clientDataJSON, attestation := newSoftAuthenticator().create(options.Challenge)
+		wrongChallengeData, _ := newSoftAuthenticator().create("SomeOtherChallenge")
+		foreignOriginData, foreignOriginAttestation := foreignOrigin.create(options.Challenge)
+		foreignRPData, foreignRPAttestation := foreignRP.create(options.Challenge)
+		packedAttestation, _ := cbor.Marshal(map[string]interface{}{"fmt": "packed", "attStmt": map[string]interface{}{}, "authData": []byte{}})
+
+		errorCases := map[string][3][]byte{
+			"Token type must be 'webauthn_registration'":            {[]byte(loginSession), clientDataJSON, attestation},
+			"Client data challenge does not match":                  {[]byte(session), wrongChallengeData, attestation},
+			"Client data origin must be 'https://localhost'":        {[]byte(session), foreignOriginData, foreignOriginAttestation},
+			"Authenticator data is scoped to another relying party": {[]byte(session), foreignRPData, foreignRPAttestation},
+			"Unsupported attestation format 'packed'":               {[]byte(session), clientDataJSON, packedAttestation},
+		}
+
+		for expected, input := range errorCases {
+			credentialID, err := finishWebAuthnRegistration(testctx, string(input[0]), input[1], input[2])
+
+			if credentialID != nil || err == nil || err.Error() != expected {
+				t.Errorf("finishWebAuthnRegistration failed! Expected '%v' got '%v'", expected, err)
+			}
+		}
+
+		if len(ud.Credentials) != 0 {
+			t.Errorf("finishWebAuthnRegistration failed! Stored credential of invalid response")
+		}
+	})
+}
+
+func TestWebAuthnLogin(T *testing.T) {
+	T.Run("No credentials", func(t *testing.T) {
+		injectUserData(&UserData{ID: "SomeID"}, map[string]bool{})
+
+		options, session, err := beginWebAuthnLogin(testctx, "SomeID")
+
+		if options != nil || session != "" || err == nil || err.Error() != "No WebAuthn credentials registered" {
+			t.Errorf("beginWebAuthnLogin failed! Expected 'No WebAuthn credentials registered' got '%v'", err)
+		}
+	})
+
+	T.Run("Valid assertion", func(t *testing.T) {
+		expectations := map[string]bool{}
+		ud := &UserData{ID: "SomeID"}
+		authenticator := registeredAuthenticator(t, ud)
+		injectUserData(ud, expectations)
+
+		options, session, err := beginWebAuthnLogin(testctx, "SomeID")
+		expectations["Nil error on begin"] = err == nil
+		expectations["Allow registered credential"] = len(options.AllowCredentials) == 1
+
+		clientDataJSON, authData, signature := authenticator.get(options.Challenge)
+		token, err := finishWebAuthnLogin(testctx, session, authenticator.credentialID, clientDataJSON, authData, signature)
+		_, claims, parseErr := parse(token)
+
+		expectations["Nil error on finish"] = err == nil
+		expectations["Return regular token"] = parseErr == nil && claims.ID == "SomeID"
+		expectations["Store token"] = ud.Token == token
+		expectations["Update sign count"] = ud.Credentials[0].SignCount == 1
+
+		// Authenticators without a sign count report 0 on every assertion
+		ud.Credentials[0].SignCount = 0
+		_, replayErr := finishWebAuthnLogin(testctx, session, authenticator.credentialID, clientDataJSON, authData, signature)
+		expectations["Reject replayed assertion"] = replayErr != nil && replayErr.Error() == "Challenge was already used"
+
+		CheckExpectations(expectations, t)
+	})
+
+	T.Run("Invalid assertions", func(t *testing.T) {
+		ud := &UserData{ID: "SomeID"}
+		authenticator := registeredAuthenticator(t, ud)
+		options, session, _ := beginWebAuthnLogin(testctx, "SomeID")
+
+		clientDataJSON, authData, signature := authenticator.get(options.Challenge)
+		tamperedSignature := append([]byte{}, signature...)
+		tamperedSignature[len(tamperedSignature)-1] ^= 0xff
+		registrationSession, _ := signClaims(testctx, newChallengeClaims("SomeID", webauthnRegistration))
+		unverifiedAuthData := append([]byte{}, authData...)
+		unverifiedAuthData[32] &^= flagUserVerified
+
+		type assertion struct {
+			session      string
+			credentialID []byte
+			clientData   []byte
+			authData     []byte
+			signature    []byte
+		}
+
+		errorCases := map[string]assertion{
+			"Token type must be 'webauthn_login'":     {registrationSession, authenticator.credentialID, clientDataJSON, authData, signature},
+			"Client data type must be 'webauthn.get'": {session, authenticator.credentialID, authenticator.clientData("webauthn.create", options.Challenge), authData, signature},
+			"Unknown credential":                      {session, []byte("SomeOtherCredential"), clientDataJSON, authData, signature},
+			"Invalid signature":                       {session, authenticator.credentialID, clientDataJSON, authData, tamperedSignature},
+			"Authenticator data is too short":         {session, authenticator.credentialID, clientDataJSON, authData[:36], signature},
+			"User was not verified":                   {session, authenticator.credentialID, clientDataJSON, unverifiedAuthData, signature},
+		}
+
+		for expected, input := range errorCases {
+			token, err := finishWebAuthnLogin(testctx, input.session, input.credentialID, input.clientData, input.authData, input.signature)
+
+			if token != "" || err == nil || err.Error() != expected {
+				t.Errorf("finishWebAuthnLogin failed! Expected '%v' got '%v'", expected, err)
+			}
+		}
+
+		ud.Credentials[0].SignCount = 10
+		_, err := finishWebAuthnLogin(testctx, session, authenticator.credentialID, clientDataJSON, authData, signature)
+		expected := "Sign count did not increase, the authenticator might be cloned"
+
+		if err == nil || err.Error() != expected {
+			t.Errorf("finishWebAuthnLogin failed! Expected '%v' got '%v'", expected, err)
+		}
+	})
+}
+
+func TestParseCOSEKey(T *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	e := big.NewInt(int64(rsaKey.E)).Bytes()
+	rsaCOSE, _ := cbor.Marshal(map[int]interface{}{1: 3, 3: coseAlgRS256, -1: rsaKey.N.Bytes(), -2: e})
+	offCurveCOSE, _ := cbor.Marshal(map[int]interface{}{1: 2, 3: coseAlgES256, -1: 1, -2: []byte{1}, -3: []byte{2}})
+	unsupportedCOSE, _ := cbor.Marshal(map[int]interface{}{1: 1, 3: -8})
+
+	T.Run("ES256", func(t *testing.T) {
+		key, alg, err := parseCOSEKey(newSoftAuthenticator().cosePublicKey())
+
+		if _, ok := key.(*ecdsa.PublicKey); !ok || alg != coseAlgES256 || err != nil {
+			t.Errorf("parseCOSEKey failed! Expected ES256 key got '%v', '%v', '%v'", key, alg, err)
+		}
+	})
+
+	T.Run("RS256", func(t *testing.T) {
+		key, alg, err := parseCOSEKey(rsaCOSE)
+		publicKey, ok := key.(*rsa.PublicKey)
+
+		if !ok || publicKey.N.Cmp(rsaKey.N) != 0 || publicKey.E != rsaKey.E || alg != coseAlgRS256 || err != nil {
+			t.Errorf("parseCOSEKey failed! Expected RS256 key got '%v', '%v', '%v'", key, alg, err)
+		}
+	})
+
+	T.Run("Invalid keys", func(t *testing.T) {
+		errorCases := map[string][]byte{
+			"Invalid P-256 key":                             offCurveCOSE,
+			"Unsupported COSE key type 1 with algorithm -8": unsupportedCOSE,
+		}
+
+		for expected, input := range errorCases {
+			key, _, err := parseCOSEKey(input)
+
+			if key != nil || err == nil || err.Error() != expected {
+				t.Errorf("parseCOSEKey failed! Expected '%v' got '%v'", expected, err)
+			}
+		}
+	})
+}